@@ -0,0 +1,46 @@
+package cli_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"godiscauth/internal/cli"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/testutils"
+)
+
+// TestMain sets up the test environment for all tests in the `cli_test` package.
+func TestMain(m *testing.M) {
+	testutils.TestEnvSetup()
+
+	os.Exit(m.Run())
+}
+
+// errNoDatabase fails commands that connect to the database although their stores are set
+var errNoDatabase = errors.New("commands must not connect to the database")
+
+// setupMemoryApp returns an app with in-memory stores that fails to connect to a database
+func setupMemoryApp() *cli.App {
+	return &cli.App{
+		Connect:  func(string) (*gorm.DB, error) { return nil, errNoDatabase },
+		Users:    repository.NewMemoryUserStore(),
+		Sessions: repository.NewMemorySessionStore(),
+	}
+}
+
+// run runs a command of the app with the given stdin and returns what it printed to stdout
+func run(app *cli.App, stdin string, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	cmd := cli.NewRootCommand(app)
+	cmd.SetArgs(args)
+	cmd.SetIn(strings.NewReader(stdin))
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&bytes.Buffer{})
+	err := cmd.Execute()
+	return stdout.String(), err
+}
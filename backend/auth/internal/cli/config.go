@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newConfigCommand(app *App) *cobra.Command {
+	cfg := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the runtime configuration",
+	}
+	cfg.AddCommand(&cobra.Command{
+		Use:   "dump",
+		Short: "Validate the config and print it as YAML, with secrets redacted",
+		Long: "Validate the config loaded from the defaults, the --config file and the env variables, and " +
+			"print it as a YAML config file with the env variable of each setting as a comment. The values " +
+			"of secrets are replaced by <redacted>.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := app.config()
+			if err != nil {
+				return err
+			}
+			return cfg.Dump(cmd.OutOrStdout())
+		},
+	})
+	return cfg
+}
@@ -0,0 +1,46 @@
+package cli_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// TestConfigDump tests that `config dump` prints the config loaded from the --config file and the
+// environment, without secrets
+func TestConfigDump(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "auth.yaml")
+	is.NoErr(os.WriteFile(path, []byte("sessions:\n  max_sessions: 3\n"), 0o600))
+
+	app := setupMemoryApp()
+	out, err := run(app, "", "config", "dump", "--config", path)
+	is.NoErr(err)
+	is.True(strings.Contains(out, "max_sessions: 3"))
+	is.True(strings.Contains(out, "# "+config.EnvMaxSessions))
+	is.True(strings.Contains(out, "key: "+config.Redacted))
+	is.True(!strings.Contains(out, os.Getenv(config.SessionKey)))
+
+	t.Run("invalid config", func(t *testing.T) {
+		is := is.New(t)
+		t.Setenv(config.EnvSessionLimitPolicy, "evict-newest")
+		_, err := run(setupMemoryApp(), "", "config", "dump")
+		is.True(errors.Is(err, apperrors.ErrInvalidConfigValue))
+	})
+
+	t.Run("weak session key", func(t *testing.T) {
+		is := is.New(t)
+		t.Setenv(config.SessionKey, "short")
+		_, err := run(setupMemoryApp(), "", "config", "dump")
+		is.True(errors.Is(err, apperrors.ErrInvalidConfigValue))
+		is.True(strings.Contains(err.Error(), config.SessionKey))
+	})
+}
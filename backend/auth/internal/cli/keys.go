@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"godiscauth/pkg/keyring"
+)
+
+// generatedKeyBytes is the number of random bytes in a generated key. Its encoding is longer than
+// `keyring.MinKeyLength`.
+const generatedKeyBytes = 32
+
+func newKeysCommand() *cobra.Command {
+	keys := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage signing and encryption keys",
+	}
+	keys.AddCommand(newKeysGenerateCommand())
+	return keys
+}
+
+func newKeysGenerateCommand() *cobra.Command {
+	var id string
+	var raw bool
+	generate := &cobra.Command{
+		Use:   "generate",
+		Short: "Print a new random key",
+		Long: "Print a new random key as an `id:key` pair to add to AUTH_SESSION_KEYS. With --raw only the " +
+			"key is printed, for a file in AUTH_SESSION_KEYS_DIR or the MFA key.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := generateKey()
+			if err != nil {
+				return err
+			}
+			// Parsing checks the ID the same way the server will
+			if _, _, err := keyring.ParseKeys(id + ":" + key); err != nil {
+				return err
+			}
+			if raw {
+				fmt.Fprintln(cmd.OutOrStdout(), key)
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s:%s\n", id, key)
+			}
+			return nil
+		},
+	}
+	generate.Flags().StringVar(&id, "id", time.Now().UTC().Format("2006-01"), "ID of the key")
+	generate.Flags().BoolVar(&raw, "raw", false, "print only the key")
+	return generate
+}
+
+// generateKey returns a random key, encoded so that it can be used in env variables and files
+func generateKey() (string, error) {
+	key := make([]byte, generatedKeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key), nil
+}
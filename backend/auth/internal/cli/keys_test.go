@@ -0,0 +1,52 @@
+package cli_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/cli"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/keyring"
+)
+
+// TestKeysGenerate tests that generated keys can be loaded into a key ring
+func TestKeysGenerate(t *testing.T) {
+	is := is.New(t)
+
+	// No database is needed
+	app := &cli.App{}
+
+	t.Run("prints an id:key pair", func(t *testing.T) {
+		out, err := run(app, "", "keys", "generate")
+		is.NoErr(err)
+		ids, keys, err := keyring.ParseKeys(strings.TrimSpace(out))
+		is.NoErr(err)
+		is.Equal(ids, []string{time.Now().UTC().Format("2006-01")})
+		is.True(len(keys[ids[0]]) >= keyring.MinKeyLength)
+	})
+
+	t.Run("prints random keys", func(t *testing.T) {
+		first, err := run(app, "", "keys", "generate", "--id", "first")
+		is.NoErr(err)
+		second, err := run(app, "", "keys", "generate", "--id", "first")
+		is.NoErr(err)
+		is.True(first != second)
+	})
+
+	t.Run("prints the raw key", func(t *testing.T) {
+		out, err := run(app, "", "keys", "generate", "--raw")
+		is.NoErr(err)
+		key := strings.TrimSpace(out)
+		is.True(!strings.Contains(key, ":"))
+		is.True(len(key) >= keyring.MinKeyLength)
+	})
+
+	t.Run("rejects invalid IDs", func(t *testing.T) {
+		_, err := run(app, "", "keys", "generate", "--id", "a,b")
+		is.True(errors.Is(err, apperrors.ErrInvalidKeyID))
+	})
+}
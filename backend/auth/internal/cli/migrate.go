@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"godiscauth/internal/database"
+)
+
+func newMigrateCommand(app *App) *cobra.Command {
+	migrate := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply, roll back or list database migrations",
+	}
+	migrate.AddCommand(
+		&cobra.Command{
+			Use:   "up",
+			Short: "Apply the pending migrations",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				migrator, err := app.migrator()
+				if err != nil {
+					return err
+				}
+				applied, err := migrator.Up()
+				if err != nil {
+					return err
+				}
+				log.Info().Int("applied", len(applied)).Msg("Database is up to date")
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "down [n]",
+			Short: "Roll back the last n migrations, one by default",
+			Args:  cobra.MaximumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				steps := 1
+				if len(args) > 0 {
+					var err error
+					if steps, err = strconv.Atoi(args[0]); err != nil {
+						return fmt.Errorf("invalid number of migrations to roll back: %w", err)
+					}
+				}
+				migrator, err := app.migrator()
+				if err != nil {
+					return err
+				}
+				rolledBack, err := migrator.Down(steps)
+				if err != nil {
+					return err
+				}
+				log.Info().Int("rolled_back", len(rolledBack)).Msg("Rolled back migrations")
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "status",
+			Short: "List the migrations and whether they are applied",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				migrator, err := app.migrator()
+				if err != nil {
+					return err
+				}
+				statuses, err := migrator.Status()
+				if err != nil {
+					return err
+				}
+				for _, status := range statuses {
+					appliedAt := "-"
+					if status.AppliedAt != nil {
+						appliedAt = status.AppliedAt.Format(time.RFC3339)
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "%04d  %-8s  %-20s  %s\n", status.Version, status.State, appliedAt, status.Name)
+				}
+				return nil
+			},
+		},
+	)
+	return migrate
+}
+
+// migrator returns a migrator for the migrations embedded in the binary
+func (a *App) migrator() (*database.Migrator, error) {
+	db, err := a.db()
+	if err != nil {
+		return nil, err
+	}
+	return database.NewMigrator(db)
+}
@@ -0,0 +1,25 @@
+package cli_test
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+// TestMigrateCommands tests that migrate commands check their arguments before connecting to the
+// database
+func TestMigrateCommands(t *testing.T) {
+	is := is.New(t)
+	app := setupMemoryApp()
+
+	_, err := run(app, "", "migrate", "down", "many")
+	is.True(err != nil)
+	is.True(err != errNoDatabase)
+
+	_, err = run(app, "", "migrate", "down", "1", "2")
+	is.True(err != nil)
+	is.True(err != errNoDatabase)
+
+	_, err = run(app, "", "migrate", "status")
+	is.Equal(err, errNoDatabase)
+}
@@ -0,0 +1,159 @@
+// Package cli implements the commands of the auth binary: serving the API and the operator tasks
+// that would otherwise mean editing rows by hand
+package cli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/database"
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/services"
+	"godiscauth/pkg/config"
+	"godiscauth/pkg/logger"
+)
+
+// App is what the commands share. The config, the database and the stores are loaded on first use,
+// so commands that don't need them, like `keys generate`, run without a database.
+type App struct {
+	// ConfigFile is the optional YAML or TOML config file, set by the `--config` flag
+	ConfigFile string
+	// Config is loaded from `ConfigFile` and the environment unless set
+	Config *config.Config
+	// Connect opens the database at a URL, `database.NewDB` if unset
+	Connect func(dsn string) (*gorm.DB, error)
+
+	DB       *gorm.DB
+	Users    repository.UserStore
+	Sessions repository.SessionStore
+}
+
+// Execute runs the command named by the arguments of the process
+func Execute() error {
+	logger.SetupLogger()
+	return NewRootCommand(&App{}).Execute()
+}
+
+// NewRootCommand returns the command of the auth binary, which serves the API when run without a
+// subcommand
+func NewRootCommand(app *App) *cobra.Command {
+	serve := newServeCommand(app)
+	root := &cobra.Command{
+		Use:   "godiscauth",
+		Short: "Authentication service of the discussion app",
+		// main logs the error, and usage is only helpful for mistyped arguments
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		Args:          cobra.NoArgs,
+		RunE:          serve.RunE,
+	}
+	root.PersistentFlags().StringVar(&app.ConfigFile, "config", os.Getenv(config.EnvConfigFile),
+		"YAML or TOML config file, overridden by env variables (env "+config.EnvConfigFile+")")
+	root.AddCommand(
+		serve,
+		newConfigCommand(app),
+		newMigrateCommand(app),
+		newUserCommand(app),
+		newSessionsCommand(app),
+		newKeysCommand(),
+		newReapSessionsCommand(app),
+	)
+	return root
+}
+
+// config returns the config, loading and validating it on first use
+func (a *App) config() (*config.Config, error) {
+	if a.Config != nil {
+		return a.Config, nil
+	}
+	cfg, err := config.Load(a.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	a.Config = cfg
+	return cfg, nil
+}
+
+// db returns the database, connecting to it on first use
+func (a *App) db() (*gorm.DB, error) {
+	if a.DB != nil {
+		return a.DB, nil
+	}
+	cfg, err := a.config()
+	if err != nil {
+		return nil, err
+	}
+	connect := a.Connect
+	if connect == nil {
+		connect = database.NewDB
+	}
+	db, err := connect(cfg.Database.URL)
+	if err != nil {
+		return nil, err
+	}
+	a.DB = db
+	return db, nil
+}
+
+// userStore returns the user store, backed by the database unless set
+func (a *App) userStore() (repository.UserStore, error) {
+	if a.Users != nil {
+		return a.Users, nil
+	}
+	db, err := a.db()
+	if err != nil {
+		return nil, err
+	}
+	ur, err := repository.NewUserRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	a.Users = ur
+	return ur, nil
+}
+
+// sessionStore returns the session store selected by the config, like the server's, unless set
+func (a *App) sessionStore() (repository.SessionStore, error) {
+	if a.Sessions != nil {
+		return a.Sessions, nil
+	}
+	cfg, err := a.config()
+	if err != nil {
+		return nil, err
+	}
+	db, err := a.db()
+	if err != nil {
+		return nil, err
+	}
+	sr, err := repository.NewSessionStoreFromConfig(db, cfg.Sessions)
+	if err != nil {
+		return nil, err
+	}
+	a.Sessions = sr
+	return sr, nil
+}
+
+// userService returns a user service on the app's stores with the configured password and session
+// policies
+func (a *App) userService() (*services.UserService, error) {
+	cfg, err := a.config()
+	if err != nil {
+		return nil, err
+	}
+	ur, err := a.userStore()
+	if err != nil {
+		return nil, err
+	}
+	sr, err := a.sessionStore()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := models.LoadSessionKeyRing(cfg.Sessions)
+	if err != nil {
+		return nil, err
+	}
+	return services.NewUserService(ur, sr, keys, cfg)
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"godiscauth/internal/database"
+	"godiscauth/internal/server"
+	"godiscauth/pkg/config"
+)
+
+func newServeCommand(app *App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Migrate the database and serve the API",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serve(app)
+		},
+	}
+}
+
+// serve loads the config, applies pending migrations and runs the API server until it's shut down
+func serve(app *App) error {
+	cfg, err := app.config()
+	if err != nil {
+		return err
+	}
+
+	db, err := app.db()
+	if err != nil {
+		return err
+	}
+	if err := database.Migrate(db); err != nil {
+		return err
+	}
+
+	log.Info().Msg("Connected to postgres database")
+	log.Info().
+		Str(config.AuthServerPort, cfg.Server.Port).
+		Str(config.EnvMetricsPort, cfg.Server.MetricsPort).
+		Bool("tls", cfg.Server.TLSCertFile != "").
+		Msg("Starting server")
+	apiServer, err := server.NewAPIServer(db, cfg)
+	if err != nil {
+		return err
+	}
+	if err := apiServer.Run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
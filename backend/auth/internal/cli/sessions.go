@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/services"
+)
+
+func newSessionsCommand(app *App) *cobra.Command {
+	sessions := &cobra.Command{
+		Use:   "sessions",
+		Short: "Manage sessions",
+	}
+	sessions.AddCommand(
+		newSessionsPurgeCommand(app),
+		&cobra.Command{
+			Use:   "revoke-user <email|id>",
+			Short: "End all of a user's sessions",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				us, err := app.userService()
+				if err != nil {
+					return err
+				}
+				user, err := findUser(us.UserRepo, args[0])
+				if err != nil {
+					return err
+				}
+				// A user without sessions has nothing to revoke
+				if err := us.LogoutEverywhere(user.ID.String()); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+					return err
+				}
+				log.Info().Str("userID", user.ID.String()).Msg("Revoked sessions")
+				return nil
+			},
+		},
+	)
+	return sessions
+}
+
+// newSessionsPurgeCommand returns the command deleting all expired sessions once, e.g. from a cron
+// job or before the server's own reaper has caught up with a large backlog
+func newSessionsPurgeCommand(app *App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "purge",
+		Short: "Delete all expired sessions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := app.config()
+			if err != nil {
+				return err
+			}
+			sr, err := app.sessionStore()
+			if err != nil {
+				return err
+			}
+			reaper, err := services.NewSessionReaper(sr, cfg.Sessions)
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			deleted, err := reaper.Reap(ctx)
+			if err != nil {
+				log.Error().Int64("deleted", deleted).Msg("Failed to reap expired sessions")
+				return err
+			}
+			log.Info().Int64("deleted", deleted).Msg("Reaped expired sessions")
+			return nil
+		},
+	}
+}
+
+// newReapSessionsCommand returns `sessions purge` under its old name, for existing cron jobs
+func newReapSessionsCommand(app *App) *cobra.Command {
+	reap := newSessionsPurgeCommand(app)
+	reap.Use = "reap-sessions"
+	reap.Deprecated = "use `sessions purge` instead"
+	return reap
+}
@@ -0,0 +1,45 @@
+package cli_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+)
+
+// TestSessionsPurge tests that purging deletes expired sessions only, also under the old
+// `reap-sessions` name
+func TestSessionsPurge(t *testing.T) {
+	is := is.New(t)
+	app := setupMemoryApp()
+	userID := uuid.New()
+
+	createSessions := func(n int, expiresIn time.Duration) {
+		for range n {
+			session, err := models.NewSession(userID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(expiresIn))
+			is.NoErr(err)
+			is.NoErr(app.Sessions.CreateSession(session))
+		}
+	}
+	createSessions(3, -time.Hour)
+	createSessions(1, time.Hour)
+
+	_, err := run(app, "", "sessions", "purge")
+	is.NoErr(err)
+	deleted, err := app.Sessions.DeleteExpiredSessions(time.Now(), 100)
+	is.NoErr(err)
+	is.Equal(deleted, int64(0))
+	sessions, err := app.Sessions.GetUnexpiredSessionsByUserID(userID.String())
+	is.NoErr(err)
+	is.Equal(len(sessions), 1)
+
+	createSessions(2, -time.Hour)
+	_, err = run(app, "", "reap-sessions")
+	is.NoErr(err)
+	deleted, err = app.Sessions.DeleteExpiredSessions(time.Now(), 100)
+	is.NoErr(err)
+	is.Equal(deleted, int64(0))
+}
@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+)
+
+func newUserCommand(app *App) *cobra.Command {
+	user := &cobra.Command{
+		Use:   "user",
+		Short: "Manage user accounts",
+		Long: "Manage user accounts. Users are given by email or ID. New passwords are prompted for on a " +
+			"terminal and read from the first line of stdin otherwise.",
+	}
+	user.AddCommand(
+		newUserCreateCommand(app),
+		newUserLockCommand(app),
+		&cobra.Command{
+			Use:   "unlock <email|id>",
+			Short: "Unlock a user locked by an operator or after failed logins",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				ur, err := app.userStore()
+				if err != nil {
+					return err
+				}
+				user, err := findUser(ur, args[0])
+				if err != nil {
+					return err
+				}
+				if err := ur.UnlockAccount(user.ID.String()); err != nil {
+					return err
+				}
+				log.Info().Str("userID", user.ID.String()).Msg("Unlocked user")
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "delete <email|id>",
+			Short: "Permanently delete a user and their sessions",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				us, err := app.userService()
+				if err != nil {
+					return err
+				}
+				user, err := findUser(us.UserRepo, args[0])
+				if err != nil {
+					return err
+				}
+				if err := us.PermanentlyDeleteUser(user.ID.String()); err != nil {
+					return err
+				}
+				log.Info().Str("userID", user.ID.String()).Msg("Deleted user")
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "set-password <email|id>",
+			Short: "Replace a user's password and end their sessions",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				us, err := app.userService()
+				if err != nil {
+					return err
+				}
+				user, err := findUser(us.UserRepo, args[0])
+				if err != nil {
+					return err
+				}
+				password, err := readPassword(cmd)
+				if err != nil {
+					return err
+				}
+				if err := us.SetPassword(user.ID.String(), password); err != nil {
+					return err
+				}
+				log.Info().Str("userID", user.ID.String()).Msg("Set password")
+				return nil
+			},
+		},
+	)
+	return user
+}
+
+func newUserCreateCommand(app *App) *cobra.Command {
+	var admin, verified bool
+	create := &cobra.Command{
+		Use:   "create <email>",
+		Short: "Register a user and print their ID",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			us, err := app.userService()
+			if err != nil {
+				return err
+			}
+			password, err := readPassword(cmd)
+			if err != nil {
+				return err
+			}
+			if err := us.RegisterUser(args[0], password); err != nil {
+				return err
+			}
+			user, err := us.UserRepo.GetUserByEmail(args[0])
+			if err != nil {
+				return err
+			}
+			userID := user.ID.String()
+
+			if admin {
+				if err := us.UserRepo.UpdateUser(userID, map[string]any{"roles": models.RoleUser + "," + models.RoleAdmin}); err != nil {
+					return err
+				}
+			}
+			if verified {
+				if err := us.UserRepo.MarkEmailVerified(userID, user.Email, time.Now()); err != nil {
+					return err
+				}
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), userID)
+			return nil
+		},
+	}
+	create.Flags().BoolVar(&admin, "admin", false, "give the user the admin role")
+	create.Flags().BoolVar(&verified, "verified", false, "mark the user's email as verified")
+	return create
+}
+
+func newUserLockCommand(app *App) *cobra.Command {
+	var duration time.Duration
+	lock := &cobra.Command{
+		Use:   "lock <email|id>",
+		Short: "Lock a user out and end their sessions",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if duration < 0 {
+				return apperrors.ErrInvalidLockDuration
+			}
+			us, err := app.userService()
+			if err != nil {
+				return err
+			}
+			user, err := findUser(us.UserRepo, args[0])
+			if err != nil {
+				return err
+			}
+			var until *time.Time
+			if duration > 0 {
+				t := time.Now().Add(duration)
+				until = &t
+			}
+			if err := us.LockUser(user.ID.String(), until); err != nil {
+				return err
+			}
+			log.Info().Str("userID", user.ID.String()).Stringer("for", duration).Msg("Locked user")
+			return nil
+		},
+	}
+	lock.Flags().DurationVar(&duration, "for", 0, "how long to lock the user for, until unlocked if 0")
+	return lock
+}
+
+// findUser returns a user by ID, or by email if the reference isn't a UUID
+func findUser(ur repository.UserStore, ref string) (*models.User, error) {
+	var user *models.User
+	var err error
+	if _, parseErr := uuid.Parse(ref); parseErr == nil {
+		user, err = ur.GetUserByID(ref)
+	} else {
+		user, err = ur.GetUserByEmail(ref)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %q", apperrors.ErrUserNotFound, ref)
+	}
+	return user, err
+}
+
+// readPassword reads a new password. On a terminal it's prompted for twice without echoing it,
+// otherwise the first line of stdin is used, e.g. when it's piped from a secret manager.
+func readPassword(cmd *cobra.Command) (string, error) {
+	if f, ok := cmd.InOrStdin().(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		password, err := promptPassword(cmd, f, "Password: ")
+		if err != nil {
+			return "", err
+		}
+		confirmation, err := promptPassword(cmd, f, "Confirm password: ")
+		if err != nil {
+			return "", err
+		}
+		if password != confirmation {
+			return "", apperrors.ErrPasswordMismatch
+		}
+		return password, nil
+	}
+
+	line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// promptPassword prompts for a password on stderr and reads it from the terminal without echoing it
+func promptPassword(cmd *cobra.Command, f *os.File, prompt string) (string, error) {
+	fmt.Fprint(cmd.ErrOrStderr(), prompt)
+	password, err := term.ReadPassword(int(f.Fd()))
+	fmt.Fprintln(cmd.ErrOrStderr())
+	return string(password), err
+}
@@ -0,0 +1,127 @@
+package cli_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+	"golang.org/x/crypto/bcrypt"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestUserCommands tests managing a user's account from the command line
+func TestUserCommands(t *testing.T) {
+	is := is.New(t)
+	app := setupMemoryApp()
+	email := "testUserCommands@test.com"
+
+	out, err := run(app, testutils.TestingPassword+"\n", "user", "create", email, "--admin", "--verified")
+	is.NoErr(err)
+	userID := strings.TrimSpace(out)
+	user, err := app.Users.GetUserByID(userID)
+	is.NoErr(err)
+	is.Equal(user.Email, email)
+	is.Equal(user.RoleList(), []string{models.RoleUser, models.RoleAdmin})
+	is.True(user.IsEmailVerified())
+
+	// createSession logs the user in on a new device
+	createSession := func() {
+		session, err := models.NewSession(user.ID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(time.Hour))
+		is.NoErr(err)
+		is.NoErr(app.Sessions.CreateSession(session))
+	}
+	sessionCount := func() int {
+		sessions, err := app.Sessions.GetUnexpiredSessionsByUserID(userID)
+		is.NoErr(err)
+		return len(sessions)
+	}
+
+	t.Run("create rejects duplicate and weak users", func(t *testing.T) {
+		_, err := run(app, testutils.TestingPassword, "user", "create", email)
+		is.Equal(err, apperrors.ErrDuplicateEmail)
+		_, err = run(app, "short\n", "user", "create", "other-"+email)
+		is.True(err != nil)
+		_, err = run(app, "", "user", "create", "other-"+email)
+		is.Equal(err, apperrors.ErrPasswordIsEmpty)
+	})
+
+	t.Run("lock ends sessions until unlocked", func(t *testing.T) {
+		createSession()
+		_, err := run(app, "", "user", "lock", email)
+		is.NoErr(err)
+		is.Equal(sessionCount(), 0)
+		user, err := app.Users.GetUserByID(userID)
+		is.NoErr(err)
+		is.True(user.IsLocked(time.Now().Add(365 * 24 * time.Hour)))
+
+		_, err = run(app, "", "user", "unlock", userID)
+		is.NoErr(err)
+		user, err = app.Users.GetUserByID(userID)
+		is.NoErr(err)
+		is.True(!user.IsLocked(time.Now()))
+	})
+
+	t.Run("lock for a duration", func(t *testing.T) {
+		_, err := run(app, "", "user", "lock", userID, "--for", "1h")
+		is.NoErr(err)
+		user, err := app.Users.GetUserByID(userID)
+		is.NoErr(err)
+		is.True(user.IsLocked(time.Now().Add(59 * time.Minute)))
+		is.True(!user.IsLocked(time.Now().Add(61 * time.Minute)))
+		is.NoErr(app.Users.UnlockAccount(userID))
+
+		_, err = run(app, "", "user", "lock", userID, "--for", "-1h")
+		is.Equal(err, apperrors.ErrInvalidLockDuration)
+	})
+
+	t.Run("set-password replaces the password and ends sessions", func(t *testing.T) {
+		createSession()
+		newPassword := "new" + testutils.TestingPassword
+		_, err := run(app, newPassword+"\r\n", "user", "set-password", email)
+		is.NoErr(err)
+		is.Equal(sessionCount(), 0)
+		user, err := app.Users.GetUserByID(userID)
+		is.NoErr(err)
+		is.NoErr(bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(newPassword)))
+	})
+
+	t.Run("sessions revoke-user ends sessions", func(t *testing.T) {
+		createSession()
+		createSession()
+		_, err := run(app, "", "sessions", "revoke-user", email)
+		is.NoErr(err)
+		is.Equal(sessionCount(), 0)
+
+		// Users without sessions are fine too
+		_, err = run(app, "", "sessions", "revoke-user", email)
+		is.NoErr(err)
+	})
+
+	t.Run("unknown users are not found", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"user", "lock", "unknown@test.com"},
+			{"user", "unlock", uuid.NewString()},
+			{"user", "delete", "unknown@test.com"},
+			{"user", "set-password", "unknown@test.com"},
+			{"sessions", "revoke-user", "unknown@test.com"},
+		} {
+			_, err := run(app, testutils.TestingPassword, args...)
+			is.True(errors.Is(err, apperrors.ErrUserNotFound))
+		}
+	})
+
+	t.Run("delete removes the user and their sessions", func(t *testing.T) {
+		createSession()
+		_, err := run(app, "", "user", "delete", email)
+		is.NoErr(err)
+		is.Equal(sessionCount(), 0)
+		_, err = app.Users.GetUserByEmail(email)
+		is.True(err != nil)
+	})
+}
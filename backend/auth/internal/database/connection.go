@@ -1,20 +1,15 @@
 package database
 
 import (
-	"os"
+	"context"
 
 	"github.com/rs/zerolog/log"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-
-	"godiscauth/pkg/config"
 )
 
-// NewDB creates a new database connection using GORM and PostgreSQL.
-func NewDB() (*gorm.DB, error) {
-	var db *gorm.DB
-	dsn := os.Getenv(config.DatabaseURL)
-
+// NewDB creates a new database connection to the Postgres database at dsn using GORM.
+func NewDB(dsn string) (*gorm.DB, error) {
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
 		log.Fatal().Err(err).Msg("Error connecting to database")
@@ -22,3 +17,12 @@ func NewDB() (*gorm.DB, error) {
 	}
 	return db, nil
 }
+
+// Ping checks that the database behind db can be reached, until ctx is done
+func Ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
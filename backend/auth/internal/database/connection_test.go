@@ -1,19 +1,25 @@
 package database_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/matryer/is"
 
 	"godiscauth/internal/database"
+	"godiscauth/internal/testutils"
 )
 
 // TestConnectToDB tests the connection to the database.
 func TestConnectToDB(t *testing.T) {
 	is := is.New(t)
+	// `NewDB` exits without a database to connect to
+	testutils.TestDBSetup(t)
+
 	t.Run("connects", func(t *testing.T) {
-		testDB, err := database.NewDB()
+		testDB, err := database.NewDB(testutils.TestConfig().Database.URL)
 		is.NoErr(err)
 		is.True(testDB != nil)
+		is.NoErr(database.Ping(context.Background(), testDB))
 	})
 }
@@ -1,31 +1,361 @@
 package database
 
 import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 
-	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
 )
 
-// Migrate automigrates the database according to the User and Session models
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationFileName matches migration scripts, e.g. 0001_create_users_and_sessions.up.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a versioned change to the schema, with the script applying it and the one rolling it
+// back
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum returns the SHA-256 of the up script, recorded when the migration is applied so that
+// changes to it afterwards are noticed
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// appliedMigration is a row of the `schema_migrations` table
+type appliedMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:text;not null"`
+	Checksum  string    `gorm:"type:varchar(64);not null"`
+	AppliedAt time.Time `gorm:"type:timestamp;not null;default:now()"`
+}
+
+func (appliedMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationState is whether a migration has been applied
+type MigrationState string
+
+const (
+	MigrationPending MigrationState = "pending"
+	MigrationApplied MigrationState = "applied"
+	// MigrationModified is an applied migration whose up script has changed since
+	MigrationModified MigrationState = "modified"
+	// MigrationUnknown is an applied migration this build doesn't have, e.g. from a newer release
+	MigrationUnknown MigrationState = "unknown"
+)
+
+// MigrationStatus describes a migration, known to this build or applied to the database
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	State     MigrationState
+	AppliedAt *time.Time
+}
+
+// Migrator applies and rolls back migrations, recording them in the `schema_migrations` table
+type Migrator struct {
+	DB *gorm.DB
+	// Migrations are sorted by version
+	Migrations []Migration
+}
+
+// NewMigrator returns a Migrator for the migrations embedded in the binary
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	if db == nil {
+		return nil, apperrors.ErrDatabaseIsNil
+	}
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := LoadMigrations(sub)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// LoadMigrations reads the migration scripts in the root of a file system, sorted by version. Every
+// version needs an up and a down script.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%w: %q", apperrors.ErrInvalidMigrationName, entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", apperrors.ErrInvalidMigrationName, entry.Name())
+		}
+		script, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("%w: %d", apperrors.ErrDuplicateMigration, version)
+		}
+		if match[3] == "up" {
+			m.Up = string(script)
+		} else {
+			m.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("%w: %d_%s", apperrors.ErrIncompleteMigration, m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	return migrations, nil
+}
+
+// Migrate applies the pending migrations embedded in the binary
 func Migrate(db *gorm.DB) error {
-	// uuid extension
-	if err := db.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp";`).Error; err != nil {
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error loading migrations")
+		return err
+	}
+	if _, err := migrator.Up(); err != nil {
 		log.Fatal().Err(err).Msg("Error migrating database")
 		return err
 	}
+	return nil
+}
 
-	// make User migrations
-	if err := db.AutoMigrate(&models.User{}); err != nil {
-		log.Fatal().Err(err).Msg("Error migrating User model")
-		return err
+// Up applies the pending migrations in order, each in its own transaction, and returns them. It
+// refuses to run if an applied migration was changed. Migrations applied by a newer build are left
+// alone.
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(func(conn *gorm.DB) error {
+		done, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(done); err != nil {
+			return err
+		}
+		for _, migration := range m.Migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&appliedMigration{
+					Version:  migration.Version,
+					Name:     migration.Name,
+					Checksum: migration.Checksum(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			log.Info().Int64("version", migration.Version).Str("name", migration.Name).Msg("Applied migration")
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last `steps` applied migrations, newest first, each in its own transaction,
+// and returns them. It refuses to roll back a migration it doesn't have or that was changed.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, apperrors.ErrInvalidMigrationSteps
 	}
+	var rolledBack []Migration
+	err := m.locked(func(conn *gorm.DB) error {
+		var rows []appliedMigration
+		if err := conn.Order("version DESC").Limit(steps).Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			migration, err := m.known(row)
+			if err != nil {
+				return err
+			}
+			err = conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&appliedMigration{}, "version = ?", migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			log.Info().Int64("version", migration.Version).Str("name", migration.Name).Msg("Rolled back migration")
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status returns the state of every migration known to this build or applied to the database, by
+// version
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	done := make(map[int64]appliedMigration)
+	if m.DB.Migrator().HasTable(&appliedMigration{}) {
+		var err error
+		if done, err = m.applied(m.DB); err != nil {
+			return nil, err
+		}
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range m.Migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name, State: MigrationPending}
+		if row, ok := done[migration.Version]; ok {
+			status.State = MigrationApplied
+			if row.Checksum != migration.Checksum() {
+				status.State = MigrationModified
+			}
+			status.AppliedAt = &row.AppliedAt
+			delete(done, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range done {
+		statuses = append(statuses, MigrationStatus{
+			Version:   row.Version,
+			Name:      row.Name,
+			State:     MigrationUnknown,
+			AppliedAt: &row.AppliedAt,
+		})
+	}
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int { return cmp.Compare(a.Version, b.Version) })
+	return statuses, nil
+}
 
-	// make Session migrations
-	if err := db.AutoMigrate(&models.Session{}); err != nil {
-		log.Fatal().Err(err).Msg("Error migrating Session model")
+// Check fails unless every migration of this build has been applied unchanged, i.e. the schema is
+// the one this build expects. Migrations applied by a newer build don't matter, as during a
+// rolling update.
+func (m *Migrator) Check(ctx context.Context) error {
+	current := &Migrator{DB: m.DB.WithContext(ctx), Migrations: m.Migrations}
+	statuses, err := current.Status()
+	if err != nil {
 		return err
 	}
+	for _, status := range statuses {
+		switch status.State {
+		case MigrationPending:
+			return fmt.Errorf("%w: %d_%s", apperrors.ErrMigrationPending, status.Version, status.Name)
+		case MigrationModified:
+			return fmt.Errorf("%w: %d_%s", apperrors.ErrMigrationChecksumMismatch, status.Version, status.Name)
+		}
+	}
+	return nil
+}
+
+// locked runs fn on a single connection holding the migration lock, after creating the
+// `schema_migrations` table if needed. Other instances wait for the lock, so they see the
+// migrations applied by this one.
+func (m *Migrator) locked(fn func(conn *gorm.DB) error) error {
+	return m.DB.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", config.MigrationLockID).Error; err != nil {
+			return err
+		}
+		defer func() {
+			if err := conn.Exec("SELECT pg_advisory_unlock(?)", config.MigrationLockID).Error; err != nil {
+				log.Error().Err(err).Msg("Error releasing migration lock")
+			}
+		}()
+		err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			checksum varchar(64) NOT NULL,
+			applied_at timestamp NOT NULL DEFAULT now()
+		)`).Error
+		if err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
+
+// applied returns the applied migrations by version
+func (m *Migrator) applied(db *gorm.DB) (map[int64]appliedMigration, error) {
+	var rows []appliedMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+	return done, nil
+}
 
+// verify fails if an applied migration was changed, and warns about those this build doesn't have
+func (m *Migrator) verify(done map[int64]appliedMigration) error {
+	for _, row := range done {
+		_, err := m.known(row)
+		if errors.Is(err, apperrors.ErrUnknownMigration) {
+			log.Warn().Int64("version", row.Version).Str("name", row.Name).Msg("Database has a migration this build doesn't know")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// known returns the migration of an applied one, provided it wasn't changed since
+func (m *Migrator) known(row appliedMigration) (Migration, error) {
+	i, ok := slices.BinarySearchFunc(m.Migrations, row.Version, func(m Migration, version int64) int {
+		return cmp.Compare(m.Version, version)
+	})
+	if !ok {
+		return Migration{}, fmt.Errorf("%w: %d_%s", apperrors.ErrUnknownMigration, row.Version, row.Name)
+	}
+	if m.Migrations[i].Checksum() != row.Checksum {
+		return Migration{}, fmt.Errorf("%w: %d_%s", apperrors.ErrMigrationChecksumMismatch, row.Version, row.Name)
+	}
+	return m.Migrations[i], nil
+}
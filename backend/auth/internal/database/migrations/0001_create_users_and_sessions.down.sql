@@ -0,0 +1,3 @@
+-- The uuid-ossp extension stays, other schemas in the database may use it
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
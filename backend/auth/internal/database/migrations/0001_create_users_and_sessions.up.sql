@@ -0,0 +1,25 @@
+-- Users and sessions as the first release created them. Tables that already exist, e.g. created by
+-- GORM's AutoMigrate or db/init, are kept as they are.
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE IF NOT EXISTS users (
+    id uuid DEFAULT uuid_generate_v4(),
+    email varchar(255) NOT NULL,
+    password text NOT NULL,
+    last_login timestamp,
+    failed_login_attempts integer DEFAULT 0,
+    account_locked boolean DEFAULT false,
+    account_locked_until timestamp,
+    PRIMARY KEY (id),
+    CONSTRAINT uni_users_email UNIQUE (email)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id uuid DEFAULT uuid_generate_v4(),
+    user_id uuid NOT NULL,
+    expires_at timestamp NOT NULL,
+    created_at timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS roles,
+    DROP COLUMN IF EXISTS verification_sent_at,
+    DROP COLUMN IF EXISTS email_verified_at,
+    DROP COLUMN IF EXISTS lockout_count;
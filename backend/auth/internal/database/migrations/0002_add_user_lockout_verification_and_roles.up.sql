@@ -0,0 +1,6 @@
+-- Progressive lockout, email verification and roles
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS lockout_count integer DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS email_verified_at timestamp,
+    ADD COLUMN IF NOT EXISTS verification_sent_at timestamp,
+    ADD COLUMN IF NOT EXISTS roles text NOT NULL DEFAULT 'user';
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id uuid DEFAULT uuid_generate_v4(),
+    user_id uuid NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    expires_at timestamp NOT NULL,
+    used_at timestamp,
+    created_at timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_password_reset_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
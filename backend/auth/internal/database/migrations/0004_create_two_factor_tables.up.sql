@@ -0,0 +1,46 @@
+-- TOTP credentials, login challenges, recovery codes and the security activity log
+CREATE TABLE IF NOT EXISTS totp_credentials (
+    user_id uuid,
+    encrypted_secret text NOT NULL,
+    confirmed_at timestamp,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id),
+    CONSTRAINT fk_totp_credentials_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+    id uuid DEFAULT uuid_generate_v4(),
+    user_id uuid NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    expires_at timestamp NOT NULL,
+    created_at timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_mfa_challenges_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mfa_challenges_token_hash ON mfa_challenges (token_hash);
+CREATE INDEX IF NOT EXISTS idx_mfa_challenges_user_id ON mfa_challenges (user_id);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id uuid DEFAULT uuid_generate_v4(),
+    user_id uuid NOT NULL,
+    code_hash varchar(60) NOT NULL,
+    used_at timestamp,
+    created_at timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS security_events (
+    id uuid DEFAULT uuid_generate_v4(),
+    user_id uuid NOT NULL,
+    type varchar(64) NOT NULL,
+    detail text NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_security_events_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_security_events_created_at ON security_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_security_events_user_id ON security_events (user_id);
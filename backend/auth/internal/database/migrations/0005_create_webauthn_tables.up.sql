@@ -0,0 +1,34 @@
+-- Passkeys and the state of registration and login ceremonies in progress
+CREATE TABLE IF NOT EXISTS web_authn_credentials (
+    id uuid DEFAULT uuid_generate_v4(),
+    user_id uuid NOT NULL,
+    credential_id bytea NOT NULL,
+    public_key bytea NOT NULL,
+    attestation_type varchar(32) NOT NULL DEFAULT '',
+    transports text NOT NULL DEFAULT '',
+    aaguid bytea,
+    sign_count bigint NOT NULL DEFAULT 0,
+    backup_eligible boolean NOT NULL DEFAULT false,
+    backup_state boolean NOT NULL DEFAULT false,
+    created_at timestamp NOT NULL DEFAULT now(),
+    last_used_at timestamp,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_web_authn_credentials_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_web_authn_credentials_credential_id ON web_authn_credentials (credential_id);
+CREATE INDEX IF NOT EXISTS idx_web_authn_credentials_user_id ON web_authn_credentials (user_id);
+
+-- user_id is NULL for passkey logins, where the user is only known once the passkey answers
+CREATE TABLE IF NOT EXISTS web_authn_ceremonies (
+    id uuid DEFAULT uuid_generate_v4(),
+    user_id uuid,
+    token_hash varchar(64) NOT NULL,
+    kind varchar(32) NOT NULL,
+    session_data text NOT NULL,
+    expires_at timestamp NOT NULL,
+    created_at timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_web_authn_ceremonies_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_web_authn_ceremonies_token_hash ON web_authn_ceremonies (token_hash);
+CREATE INDEX IF NOT EXISTS idx_web_authn_ceremonies_user_id ON web_authn_ceremonies (user_id);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_sessions_expires_at;
+DROP INDEX IF EXISTS idx_sessions_token_hash;
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS remember_me,
+    DROP COLUMN IF EXISTS device_label,
+    DROP COLUMN IF EXISTS client_ip,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS last_seen_at,
+    DROP COLUMN IF EXISTS authenticated_at,
+    DROP COLUMN IF EXISTS mfa,
+    DROP COLUMN IF EXISTS token_hash;
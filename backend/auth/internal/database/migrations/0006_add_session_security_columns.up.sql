@@ -0,0 +1,26 @@
+-- Sessions created before tokens carried a separate secret get the hash of their ID, which was the
+-- secret of their token. They keep working and are rotated to a real secret the next time they are
+-- used.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS token_hash bytea;
+UPDATE sessions SET token_hash = sha256(convert_to(id::text, 'UTF8')) WHERE token_hash IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_token_hash ON sessions (token_hash);
+
+-- Second factor, device and activity of a session
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS mfa boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS authenticated_at timestamp NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS last_seen_at timestamp NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS user_agent text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS client_ip varchar(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS device_label varchar(128) NOT NULL DEFAULT '';
+-- Existing sessions got the time of the migration as their login time. A session is never
+-- authenticated after it was created, so only those sessions match.
+UPDATE sessions SET authenticated_at = created_at, last_seen_at = created_at WHERE authenticated_at > created_at;
+
+-- Sessions created before remember me were promised the old 7 day lifetime, so they get the longer
+-- policy; new sessions default to the shorter one
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS remember_me boolean NOT NULL DEFAULT true;
+ALTER TABLE sessions ALTER COLUMN remember_me SET DEFAULT false;
+
+-- The reaper deletes sessions by expiration time
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
@@ -0,0 +1,5 @@
+UPDATE users SET account_locked = true, account_locked_until = admin_locked_until
+    WHERE admin_locked;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS admin_locked_until,
+    DROP COLUMN IF EXISTS admin_locked;
@@ -0,0 +1,8 @@
+-- Locks set by an operator, kept apart from lockouts after failed logins so that resetting the
+-- password lifts only the latter
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS admin_locked boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS admin_locked_until timestamp;
+-- Failed logins always lock until a set time, so indefinite locks were set by an operator
+UPDATE users SET admin_locked = true, account_locked = false
+    WHERE account_locked AND account_locked_until IS NULL;
@@ -0,0 +1,362 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"godiscauth/internal/database"
+	"godiscauth/internal/models"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// TestLoadMigrations tests reading migration scripts from a file system
+func TestLoadMigrations(t *testing.T) {
+	is := is.New(t)
+
+	script := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+
+	t.Run("sorts by version", func(t *testing.T) {
+		migrations, err := database.LoadMigrations(fstest.MapFS{
+			"0010_second.up.sql":   script("CREATE TABLE b ();"),
+			"0010_second.down.sql": script("DROP TABLE b;"),
+			"0002_first.up.sql":    script("CREATE TABLE a ();"),
+			"0002_first.down.sql":  script("DROP TABLE a;"),
+			"README.md":            script("not a migration"),
+		})
+		is.NoErr(err)
+		is.Equal(len(migrations), 2)
+		is.Equal(migrations[0].Version, int64(2))
+		is.Equal(migrations[0].Name, "first")
+		is.Equal(migrations[0].Up, "CREATE TABLE a ();")
+		is.Equal(migrations[0].Down, "DROP TABLE a;")
+		is.Equal(migrations[1].Version, int64(10))
+	})
+
+	t.Run("checksums the up script", func(t *testing.T) {
+		a := database.Migration{Up: "CREATE TABLE a ();", Down: "DROP TABLE a;"}
+		b := database.Migration{Up: "CREATE TABLE a ();", Down: "DROP TABLE IF EXISTS a;"}
+		c := database.Migration{Up: "CREATE TABLE a (id int);", Down: "DROP TABLE a;"}
+		is.Equal(len(a.Checksum()), 64)
+		is.Equal(a.Checksum(), b.Checksum())
+		is.True(a.Checksum() != c.Checksum())
+	})
+
+	for name, tc := range map[string]struct {
+		files fstest.MapFS
+		err   error
+	}{
+		"invalid name": {
+			files: fstest.MapFS{"first.up.sql": script("SELECT 1;")},
+			err:   apperrors.ErrInvalidMigrationName,
+		},
+		"missing down script": {
+			files: fstest.MapFS{"0001_first.up.sql": script("SELECT 1;")},
+			err:   apperrors.ErrIncompleteMigration,
+		},
+		"duplicate version": {
+			files: fstest.MapFS{
+				"0001_first.up.sql":    script("SELECT 1;"),
+				"0001_first.down.sql":  script("SELECT 1;"),
+				"0001_second.up.sql":   script("SELECT 1;"),
+				"0001_second.down.sql": script("SELECT 1;"),
+			},
+			err: apperrors.ErrDuplicateMigration,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := database.LoadMigrations(tc.files)
+			is.True(errors.Is(err, tc.err))
+		})
+	}
+}
+
+// TestNewMigrator tests loading the migrations embedded in the binary
+func TestNewMigrator(t *testing.T) {
+	is := is.New(t)
+
+	_, err := database.NewMigrator(nil)
+	is.Equal(err, apperrors.ErrDatabaseIsNil)
+
+	migrator, err := database.NewMigrator(&gorm.DB{})
+	is.NoErr(err)
+	is.True(len(migrator.Migrations) > 0)
+	for i, migration := range migrator.Migrations {
+		is.Equal(migration.Version, int64(i+1)) // versions are consecutive
+	}
+}
+
+// TestMigrator tests applying, rolling back and listing migrations
+func TestMigrator(t *testing.T) {
+	is := is.New(t)
+
+	db := setupMigrationSchema(t)
+	migrator, err := database.NewMigrator(db)
+	is.NoErr(err)
+	count := len(migrator.Migrations)
+
+	statuses, err := migrator.Status()
+	is.NoErr(err)
+	is.Equal(len(statuses), count)
+	for _, status := range statuses {
+		is.Equal(status.State, database.MigrationPending)
+		is.Equal(status.AppliedAt, nil)
+	}
+	is.True(errors.Is(migrator.Check(context.Background()), apperrors.ErrMigrationPending))
+
+	applied, err := migrator.Up()
+	is.NoErr(err)
+	is.Equal(len(applied), count)
+	applied, err = migrator.Up()
+	is.NoErr(err)
+	is.Equal(len(applied), 0)
+	is.NoErr(migrator.Check(context.Background()))
+
+	statuses, err = migrator.Status()
+	is.NoErr(err)
+	for _, status := range statuses {
+		is.Equal(status.State, database.MigrationApplied)
+		is.True(status.AppliedAt != nil)
+	}
+
+	rolledBack, err := migrator.Down(1)
+	is.NoErr(err)
+	is.Equal(len(rolledBack), 1)
+	is.Equal(rolledBack[0].Version, int64(count))
+	statuses, err = migrator.Status()
+	is.NoErr(err)
+	is.Equal(statuses[count-1].State, database.MigrationPending)
+	is.Equal(statuses[count-2].State, database.MigrationApplied)
+
+	_, err = migrator.Down(0)
+	is.Equal(err, apperrors.ErrInvalidMigrationSteps)
+
+	// Rolling back more migrations than were applied rolls back all of them
+	rolledBack, err = migrator.Down(count + 1)
+	is.NoErr(err)
+	is.Equal(len(rolledBack), count-1)
+	is.True(!db.Migrator().HasTable(&models.User{}))
+	is.True(!db.Migrator().HasTable(&models.Session{}))
+
+	applied, err = migrator.Up()
+	is.NoErr(err)
+	is.Equal(len(applied), count)
+}
+
+// TestMigrator_MatchesModels tests that the migrated schema has a column for every field of the
+// models
+func TestMigrator_MatchesModels(t *testing.T) {
+	is := is.New(t)
+
+	db := setupMigrationSchema(t)
+	migrator, err := database.NewMigrator(db)
+	is.NoErr(err)
+	_, err = migrator.Up()
+	is.NoErr(err)
+
+	for _, model := range []any{
+		&models.User{},
+		&models.Session{},
+		&models.PasswordResetToken{},
+		&models.TOTPCredential{},
+		&models.MFAChallenge{},
+		&models.RecoveryCode{},
+		&models.SecurityEvent{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnCeremony{},
+	} {
+		stmt := &gorm.Statement{DB: db}
+		is.NoErr(stmt.Parse(model))
+		is.True(db.Migrator().HasTable(stmt.Schema.Table))
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			if !db.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("%s.%s is missing", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+}
+
+// TestMigrator_AdoptsExistingSchema tests migrating a database that was created by AutoMigrate
+// before there were migrations, keeping its data
+func TestMigrator_AdoptsExistingSchema(t *testing.T) {
+	is := is.New(t)
+
+	// The users and sessions tables of the first release
+	type User struct {
+		ID                  uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+		Email               string     `gorm:"type:varchar(255);not null;unique"`
+		Password            string     `gorm:"type:text;not null"`
+		LastLogin           *time.Time `gorm:"type:timestamp"`
+		FailedLoginAttempts int        `gorm:"type:integer;default:0"`
+		AccountLocked       bool       `gorm:"type:boolean;default:false"`
+		AccountLockedUntil  *time.Time `gorm:"type:timestamp"`
+	}
+	type Session struct {
+		ID        uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+		UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+		User      *User     `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`
+		ExpiresAt time.Time `gorm:"type:timestamp;not null"`
+		CreatedAt time.Time `gorm:"type:timestamp;not null;default:now()"`
+	}
+
+	db := setupMigrationSchema(t)
+	is.NoErr(db.AutoMigrate(&User{}, &Session{}))
+	user := &User{Email: "TestMigrator_AdoptsExistingSchema@test.com", Password: "password"}
+	is.NoErr(db.Create(user).Error)
+	session := &Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	is.NoErr(db.Create(session).Error)
+
+	migrator, err := database.NewMigrator(db)
+	is.NoErr(err)
+	_, err = migrator.Up()
+	is.NoErr(err)
+
+	// The session keeps working with its ID as its secret, under the policy it was created with
+	var migrated models.Session
+	is.NoErr(db.First(&migrated, "id = ?", session.ID).Error)
+	is.Equal(migrated.TokenHash, models.HashSessionSecret(session.ID.String()))
+	is.True(migrated.RememberMe)
+	is.True(!migrated.AuthenticatedAt.After(migrated.CreatedAt))
+
+	// New sessions default to the shorter policy
+	fresh, err := models.NewSession(user.ID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(time.Hour))
+	is.NoErr(err)
+	is.NoErr(db.Omit("remember_me").Create(fresh).Error)
+	is.NoErr(db.First(&migrated, "id = ?", fresh.ID).Error)
+	is.True(!migrated.RememberMe)
+
+	var roles string
+	is.NoErr(db.Model(&models.User{}).Select("roles").Where("id = ?", user.ID).Scan(&roles).Error)
+	is.Equal(roles, models.RoleUser)
+}
+
+// TestMigrator_Changed tests refusing to migrate when an applied migration was changed
+func TestMigrator_Changed(t *testing.T) {
+	is := is.New(t)
+
+	db := setupMigrationSchema(t)
+	migrator, err := database.NewMigrator(db)
+	is.NoErr(err)
+	_, err = migrator.Up()
+	is.NoErr(err)
+
+	migrator.Migrations[0].Up += "\n-- changed"
+	_, err = migrator.Up()
+	is.True(errors.Is(err, apperrors.ErrMigrationChecksumMismatch))
+	statuses, err := migrator.Status()
+	is.NoErr(err)
+	is.Equal(statuses[0].State, database.MigrationModified)
+	is.True(errors.Is(migrator.Check(context.Background()), apperrors.ErrMigrationChecksumMismatch))
+}
+
+// TestMigrator_Unknown tests a database migrated by a newer build
+func TestMigrator_Unknown(t *testing.T) {
+	is := is.New(t)
+
+	db := setupMigrationSchema(t)
+	newer, err := database.NewMigrator(db)
+	is.NoErr(err)
+	newer.Migrations = append(newer.Migrations, database.Migration{
+		Version: 999,
+		Name:    "from_the_future",
+		Up:      "CREATE TABLE future ();",
+		Down:    "DROP TABLE future;",
+	})
+	_, err = newer.Up()
+	is.NoErr(err)
+
+	migrator, err := database.NewMigrator(db)
+	is.NoErr(err)
+	applied, err := migrator.Up()
+	is.NoErr(err)
+	is.Equal(len(applied), 0)
+
+	statuses, err := migrator.Status()
+	is.NoErr(err)
+	last := statuses[len(statuses)-1]
+	is.Equal(last.Version, int64(999))
+	is.Equal(last.State, database.MigrationUnknown)
+	is.NoErr(migrator.Check(context.Background()))
+
+	_, err = migrator.Down(1)
+	is.True(errors.Is(err, apperrors.ErrUnknownMigration))
+}
+
+// TestMigrator_Concurrent tests that instances starting at the same time apply each migration once
+func TestMigrator_Concurrent(t *testing.T) {
+	is := is.New(t)
+
+	db := setupMigrationSchema(t)
+	var (
+		mu      sync.Mutex
+		applied int
+		wg      sync.WaitGroup
+	)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			migrator, err := database.NewMigrator(db)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			migrations, err := migrator.Up()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			applied += len(migrations)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	migrator, err := database.NewMigrator(db)
+	is.NoErr(err)
+	is.Equal(applied, len(migrator.Migrations))
+}
+
+// setupMigrationSchema returns a connection to the test database that creates tables in a new,
+// empty schema, so migrations can be applied and rolled back without touching the tables other tests
+// use
+func setupMigrationSchema(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	testDB := testutils.TestDBSetup(t)
+	schema := "migrations_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if err := testDB.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() { testDB.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	// uuid-ossp stays in the public schema
+	dsn := os.Getenv(config.DatabaseURL) + " search_path=" + schema + ",public"
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to connect to schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
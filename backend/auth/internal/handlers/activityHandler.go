@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"godiscauth/internal/services"
+	"godiscauth/pkg/apperrors"
+)
+
+type ActivityHandler struct {
+	AuditService *services.AuditService
+}
+
+func NewActivityHandler(auditService *services.AuditService) (*ActivityHandler, error) {
+	if auditService == nil {
+		return nil, apperrors.ErrAuditServiceIsNil
+	}
+	return &ActivityHandler{AuditService: auditService}, nil
+}
+
+// GetSecurityActivity returns the user's most recent security events, newest first
+func (ah *ActivityHandler) GetSecurityActivity(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		log.Info().
+			Str("clientIP", clientIP).
+			Msg("userID not found in cookie")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{})
+		return
+	}
+	userID := userIDStr.(string)
+
+	events, err := ah.AuditService.ListActivity(userID)
+	if err != nil {
+		log.Error().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Failed to list security activity")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	activity := make([]gin.H, 0, len(events))
+	for _, event := range events {
+		activity = append(activity, gin.H{
+			"type":      event.Type,
+			"detail":    event.Detail,
+			"createdAt": event.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"events": activity})
+}
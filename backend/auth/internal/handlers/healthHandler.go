@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"godiscauth/internal/services"
+	"godiscauth/pkg/apperrors"
+)
+
+type HealthHandler struct {
+	HealthService *services.HealthService
+}
+
+func NewHealthHandler(healthService *services.HealthService) (*HealthHandler, error) {
+	if healthService == nil {
+		return nil, apperrors.ErrHealthServiceIsNil
+	}
+	return &HealthHandler{HealthService: healthService}, nil
+}
+
+// Healthz reports that the process is up and handling requests. It checks no dependencies, so an
+// outage of one doesn't get the process restarted.
+func (hh *HealthHandler) Healthz(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz runs the readiness checks and reports the outcome of each, with `503` if any failed. Why
+// a check failed is logged rather than returned, as it may reveal details of the infrastructure.
+func (hh *HealthHandler) Readyz(c *gin.Context) {
+	results, ready := hh.HealthService.Ready(c.Request.Context())
+
+	checks := make(gin.H, len(results))
+	for name, result := range results {
+		status := "ok"
+		if result.Err != nil {
+			status = "failed"
+			if errors.Is(result.Err, context.DeadlineExceeded) {
+				status = "timeout"
+			}
+			log.Warn().
+				Str("check", name).
+				Dur("duration", result.Duration).
+				Str("error", result.Err.Error()).
+				Msg("Readiness check failed")
+		}
+		checks[name] = gin.H{"status": status, "durationMs": result.Duration.Milliseconds()}
+	}
+
+	c.Header("Cache-Control", "no-store")
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": checks})
+}
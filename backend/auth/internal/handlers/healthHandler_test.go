@@ -0,0 +1,80 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/handlers"
+	"godiscauth/internal/services"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// TestHandlers_NewHealthHandler checks the NewHealthHandler constructor
+func TestHandlers_NewHealthHandler(t *testing.T) {
+	is := is.New(t)
+
+	hh, err := handlers.NewHealthHandler(nil)
+	is.Equal(hh, nil)
+	is.Equal(err, apperrors.ErrHealthServiceIsNil)
+}
+
+// TestHealthHandler checks that `/healthz` always succeeds and `/readyz` reports each check
+func TestHealthHandler(t *testing.T) {
+	is := is.New(t)
+
+	hs := services.NewHealthService(config.ServerConfig{ReadinessTimeout: 10 * time.Millisecond})
+	hs.Checks["database"] = func(context.Context) error { return nil }
+	hh, err := handlers.NewHealthHandler(hs)
+	is.NoErr(err)
+	router := gin.New()
+	router.GET("/healthz", hh.Healthz)
+	router.GET("/readyz", hh.Readyz)
+
+	type response struct {
+		Status string `json:"status"`
+		Checks map[string]struct {
+			Status string `json:"status"`
+		} `json:"checks"`
+	}
+	get := func(path string) (int, response) {
+		req, err := http.NewRequest("GET", path, nil)
+		is.NoErr(err)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		is.Equal(rr.Header().Get("Cache-Control"), "no-store")
+		var body response
+		is.NoErr(json.Unmarshal(rr.Body.Bytes(), &body))
+		return rr.Code, body
+	}
+
+	code, body := get("/readyz")
+	is.Equal(code, http.StatusOK)
+	is.Equal(body.Status, "ok")
+	is.Equal(body.Checks["database"].Status, "ok")
+
+	hs.Checks["migrations"] = func(context.Context) error { return errors.New("pending") }
+	hs.Checks["session_reaper"] = func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	code, body = get("/readyz")
+	is.Equal(code, http.StatusServiceUnavailable)
+	is.Equal(body.Status, "unavailable")
+	is.Equal(body.Checks["database"].Status, "ok")
+	is.Equal(body.Checks["migrations"].Status, "failed")
+	is.Equal(body.Checks["session_reaper"].Status, "timeout")
+
+	// Liveness doesn't depend on the checks
+	code, body = get("/healthz")
+	is.Equal(code, http.StatusOK)
+	is.Equal(body.Status, "ok")
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"godiscauth/internal/services"
+	"godiscauth/pkg/apperrors"
+)
+
+type IntrospectionHandler struct {
+	IntrospectionService *services.IntrospectionService
+}
+
+func NewIntrospectionHandler(introspectionService *services.IntrospectionService) (*IntrospectionHandler, error) {
+	if introspectionService == nil {
+		return nil, apperrors.ErrIntrospectionServiceIsNil
+	}
+	return &IntrospectionHandler{IntrospectionService: introspectionService}, nil
+}
+
+// Introspect reports whether a session token is active and who it belongs to, in the style of
+// RFC 7662. The token is read from a form or JSON body.
+func (ih *IntrospectionHandler) Introspect(c *gin.Context) {
+	var body struct {
+		Token string `form:"token" json:"token" binding:"required"`
+	}
+
+	clientIP := c.ClientIP()
+	serviceID := c.GetString("serviceID")
+
+	if err := c.ShouldBind(&body); err != nil {
+		log.Info().
+			Str("serviceID", serviceID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad introspection request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+		return
+	}
+
+	introspection, err := ih.IntrospectionService.Introspect(body.Token)
+	if err != nil {
+		log.Error().
+			Str("serviceID", serviceID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Introspection failed")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	if !introspection.Active {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+
+	log.Debug().
+		Str("serviceID", serviceID).
+		Str("userID", introspection.UserID.String()).
+		Msg("Introspected active session")
+	c.JSON(http.StatusOK, gin.H{
+		"active":      true,
+		"token_type":  "session",
+		"sub":         introspection.UserID,
+		"roles":       introspection.Roles,
+		"mfa":         introspection.MFA,
+		"remember_me": introspection.RememberMe,
+		"iat":         introspection.IssuedAt.Unix(),
+		"exp":         introspection.ExpiresAt.Unix(),
+	})
+}
@@ -0,0 +1,110 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/handlers"
+	"godiscauth/internal/models"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestHandlers_NewIntrospectionHandler checks the NewIntrospectionHandler constructor
+func TestHandlers_NewIntrospectionHandler(t *testing.T) {
+	is := is.New(t)
+
+	ih, err := handlers.NewIntrospectionHandler(nil)
+	is.Equal(ih, nil)
+	is.Equal(err, apperrors.ErrIntrospectionServiceIsNil)
+}
+
+// TestIntrospectionHandler_Introspect checks that services can introspect session tokens over http
+func TestIntrospectionHandler_Introspect(t *testing.T) {
+	is := is.New(t)
+	server := setupServer(t)
+
+	email := "testIntrospectionHandler@test.com"
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
+	is.NoErr(err)
+	is.NoErr(server.Repos.User.RegisterUser(user))
+
+	rr, err := makeRequest(
+		server.Router,
+		"POST",
+		"/login",
+		UserCredentialsRequest{Email: email, Password: testutils.TestingPassword},
+	)
+	is.NoErr(err)
+	sessionCookie := findSessionCookie(rr)
+	is.True(sessionCookie != nil)
+
+	introspect := func(token, serviceID, secret string) *httptest.ResponseRecorder {
+		form := url.Values{"token": {token}}
+		req, err := http.NewRequest("POST", "/introspect", strings.NewReader(form.Encode()))
+		is.NoErr(err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if serviceID != "" {
+			req.SetBasicAuth(serviceID, secret)
+		}
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("requires service credentials", func(t *testing.T) {
+		w := introspect(sessionCookie.Value, "", "")
+		is.Equal(w.Code, http.StatusUnauthorized)
+
+		w = introspect(sessionCookie.Value, testutils.TestingServiceID, "wrong")
+		is.Equal(w.Code, http.StatusUnauthorized)
+
+		// A user session is not a service credential
+		req, err := http.NewRequest("POST", "/introspect", strings.NewReader("token="+sessionCookie.Value))
+		is.NoErr(err)
+		req.AddCookie(sessionCookie)
+		w = httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		is.Equal(w.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("active token", func(t *testing.T) {
+		w := introspect(sessionCookie.Value, testutils.TestingServiceID, testutils.TestingServiceSecret)
+		is.Equal(w.Code, http.StatusOK)
+		is.Equal(w.Header().Get("Cache-Control"), "no-store")
+
+		var response struct {
+			Active     bool     `json:"active"`
+			Sub        string   `json:"sub"`
+			Roles      []string `json:"roles"`
+			MFA        bool     `json:"mfa"`
+			RememberMe *bool    `json:"remember_me"`
+			Exp        int64    `json:"exp"`
+		}
+		is.NoErr(json.NewDecoder(w.Body).Decode(&response))
+		is.True(response.Active)
+		is.Equal(response.Sub, user.ID.String())
+		is.Equal(response.Roles, []string{models.RoleUser})
+		is.True(response.RememberMe != nil && !*response.RememberMe)
+		is.True(response.Exp > 0)
+	})
+
+	t.Run("inactive token", func(t *testing.T) {
+		w := introspect("invalid", testutils.TestingServiceID, testutils.TestingServiceSecret)
+		is.Equal(w.Code, http.StatusOK)
+		var response map[string]any
+		is.NoErr(json.NewDecoder(w.Body).Decode(&response))
+		is.Equal(response, map[string]any{"active": false})
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		w := introspect("", testutils.TestingServiceID, testutils.TestingServiceSecret)
+		is.Equal(w.Code, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"godiscauth/internal/services"
+	"godiscauth/pkg/apperrors"
+)
+
+type MFAHandler struct {
+	MFAService *services.MFAService
+}
+
+func NewMFAHandler(mfaService *services.MFAService) (*MFAHandler, error) {
+	if mfaService == nil {
+		return nil, apperrors.ErrMFAServiceIsNil
+	}
+	return &MFAHandler{MFAService: mfaService}, nil
+}
+
+// EnrollTOTP starts TOTP enrollment and returns the secret to add to an authenticator app
+func (mh *MFAHandler) EnrollTOTP(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		log.Info().
+			Str("clientIP", clientIP).
+			Msg("userID not found in cookie")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{})
+		return
+	}
+	userID := userIDStr.(string)
+
+	secret, uri, err := mh.MFAService.EnrollTOTP(userID)
+	if err != nil {
+		log.Info().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("TOTP enrollment failed")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Info().
+		Str("userID", userID).
+		Str("clientIP", clientIP).
+		Msg("TOTP enrollment started")
+	c.JSON(http.StatusOK, gin.H{
+		"secret": secret,
+		"uri":    uri,
+	})
+}
+
+// ConfirmTOTP completes TOTP enrollment with a code from the authenticator app
+func (mh *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		log.Info().
+			Str("clientIP", clientIP).
+			Msg("userID not found in cookie")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{})
+		return
+	}
+	userID := userIDStr.(string)
+
+	var body struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad TOTP confirmation request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recoveryCodes, err := mh.MFAService.ConfirmTOTP(userID, body.Code)
+	if err != nil {
+		log.Info().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("TOTP confirmation failed")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Info().
+		Str("userID", userID).
+		Str("clientIP", clientIP).
+		Msg("TOTP enabled")
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "two-factor authentication enabled",
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes. A current second factor code is
+// required.
+func (mh *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		log.Info().
+			Str("clientIP", clientIP).
+			Msg("userID not found in cookie")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{})
+		return
+	}
+	userID := userIDStr.(string)
+
+	var body struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad recovery code request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recoveryCodes, err := mh.MFAService.RegenerateRecoveryCodes(userID, body.Code)
+	if err != nil {
+		log.Info().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Recovery code regeneration failed")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Info().
+		Str("userID", userID).
+		Str("clientIP", clientIP).
+		Msg("Recovery codes regenerated")
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": recoveryCodes})
+}
+
+// GetRecoveryCodeStatus returns how many unused recovery codes the user has left
+func (mh *MFAHandler) GetRecoveryCodeStatus(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		log.Info().
+			Str("clientIP", clientIP).
+			Msg("userID not found in cookie")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{})
+		return
+	}
+	userID := userIDStr.(string)
+
+	remaining, err := mh.MFAService.RemainingRecoveryCodes(userID)
+	if err != nil {
+		log.Error().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Failed to count recovery codes")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"remaining": remaining})
+}
+
+// DisableTOTP removes TOTP enrollment. A current code is required once enrollment is confirmed.
+func (mh *MFAHandler) DisableTOTP(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		log.Info().
+			Str("clientIP", clientIP).
+			Msg("userID not found in cookie")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{})
+		return
+	}
+	userID := userIDStr.(string)
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad TOTP disable request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := mh.MFAService.DisableTOTP(userID, body.Code); err != nil {
+		log.Info().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("TOTP disable failed")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Info().
+		Str("userID", userID).
+		Str("clientIP", clientIP).
+		Msg("TOTP disabled")
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
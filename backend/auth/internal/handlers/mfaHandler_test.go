@@ -0,0 +1,225 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/handlers"
+	"godiscauth/internal/models"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+	"godiscauth/pkg/totp"
+)
+
+type MFACodeRequest struct {
+	Code string `json:"code,omitempty"`
+}
+
+type MFALoginRequest struct {
+	Challenge string `json:"challenge,omitempty"`
+	Code      string `json:"code,omitempty"`
+}
+
+// TestHandlers_NewMFAHandler checks the NewMFAHandler constructor
+func TestHandlers_NewMFAHandler(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("err on nil MFA service", func(t *testing.T) {
+		mh, err := handlers.NewMFAHandler(nil)
+		is.Equal(mh, nil)
+		is.Equal(err, apperrors.ErrMFAServiceIsNil)
+	})
+}
+
+// TestMFAHandler_TOTP checks TOTP enrollment and the two-step login over http
+func TestMFAHandler_TOTP(t *testing.T) {
+	is := is.New(t)
+	server := setupServer(t)
+
+	email := "testMFAHandler@test.com"
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
+	is.NoErr(err)
+	is.NoErr(server.Repos.User.RegisterUser(user))
+
+	// Login without a second factor
+	rr, err := makeRequest(
+		server.Router,
+		"POST",
+		"/login",
+		UserCredentialsRequest{Email: email, Password: testutils.TestingPassword},
+	)
+	is.NoErr(err)
+	is.Equal(rr.Code, http.StatusOK)
+	sessionCookie := findSessionCookie(rr)
+	is.True(sessionCookie != nil)
+
+	var secret string
+	var recoveryCodes []string
+
+	t.Run("enroll requires auth", func(t *testing.T) {
+		rr, err := makeRequest(server.Router, "POST", "/mfa/totp/enroll", nil)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("enroll and confirm", func(t *testing.T) {
+		w := makeAuthedRequest(t, server.Router, "/mfa/totp/enroll", nil, sessionCookie)
+		is.Equal(w.Code, http.StatusOK)
+		var enrollment map[string]string
+		is.NoErr(json.NewDecoder(w.Body).Decode(&enrollment))
+		secret = enrollment["secret"]
+		is.True(secret != "")
+		is.Equal(enrollment["uri"], totp.URI(config.Default().MFA.Issuer, email, secret))
+
+		w = makeAuthedRequest(t, server.Router, "/mfa/totp/confirm", MFACodeRequest{Code: "000000"}, sessionCookie)
+		is.Equal(w.Code, http.StatusBadRequest)
+
+		code, err := totp.CodeAt(secret, totp.Step(time.Now())-1)
+		is.NoErr(err)
+		w = makeAuthedRequest(t, server.Router, "/mfa/totp/confirm", MFACodeRequest{Code: code}, sessionCookie)
+		is.Equal(w.Code, http.StatusOK)
+		var confirmation struct {
+			RecoveryCodes []string `json:"recoveryCodes"`
+		}
+		is.NoErr(json.NewDecoder(w.Body).Decode(&confirmation))
+		is.Equal(len(confirmation.RecoveryCodes), config.RecoveryCodeCount)
+		recoveryCodes = confirmation.RecoveryCodes
+	})
+
+	t.Run("login returns a challenge instead of a session", func(t *testing.T) {
+		rr, err := makeRequest(
+			server.Router,
+			"POST",
+			"/login",
+			UserCredentialsRequest{Email: email, Password: testutils.TestingPassword},
+		)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+		is.Equal(findSessionCookie(rr), nil)
+
+		var response map[string]any
+		is.NoErr(json.NewDecoder(rr.Body).Decode(&response))
+		is.Equal(response["mfaRequired"], true)
+		challenge := response["challenge"].(string)
+		is.True(challenge != "")
+
+		// Wrong code is rejected
+		rr, err = makeRequest(server.Router, "POST", "/login/2fa", MFALoginRequest{Challenge: challenge, Code: "000000"})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusBadRequest)
+
+		// Right code logs in
+		code, err := totp.CodeAt(secret, totp.Step(time.Now()))
+		is.NoErr(err)
+		rr, err = makeRequest(server.Router, "POST", "/login/2fa", MFALoginRequest{Challenge: challenge, Code: code})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+		mfaCookie := findSessionCookie(rr)
+		is.True(mfaCookie != nil)
+
+		// RequireAuth records that the session used a second factor
+		w := httptest.NewRecorder()
+		_, r := gin.CreateTestContext(w)
+		var mfa any
+		r.GET("/mfacheck", server.MiddlewareProvider.Auth.RequireAuth(), func(c *gin.Context) {
+			mfa, _ = c.Get("mfa")
+		})
+		req, err := http.NewRequest(http.MethodGet, "/mfacheck", nil)
+		is.NoErr(err)
+		req.AddCookie(mfaCookie)
+		r.ServeHTTP(w, req)
+		is.Equal(w.Code, http.StatusOK)
+		is.Equal(mfa, true)
+	})
+
+	t.Run("recovery code completes login and shows in activity", func(t *testing.T) {
+		rr, err := makeRequest(
+			server.Router,
+			"POST",
+			"/login",
+			UserCredentialsRequest{Email: email, Password: testutils.TestingPassword},
+		)
+		is.NoErr(err)
+		var response map[string]any
+		is.NoErr(json.NewDecoder(rr.Body).Decode(&response))
+		challenge := response["challenge"].(string)
+
+		rr, err = makeRequest(server.Router, "POST", "/login/2fa", MFALoginRequest{Challenge: challenge, Code: recoveryCodes[0]})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+
+		req, err := http.NewRequest(http.MethodGet, "/security/activity", nil)
+		is.NoErr(err)
+		req.AddCookie(sessionCookie)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		is.Equal(w.Code, http.StatusOK)
+		var activity struct {
+			Events []struct {
+				Type string `json:"type"`
+			} `json:"events"`
+		}
+		is.NoErr(json.NewDecoder(w.Body).Decode(&activity))
+		is.True(len(activity.Events) > 0)
+		is.Equal(activity.Events[0].Type, string(models.SecurityEventRecoveryCodeUsed))
+	})
+
+	t.Run("disable requires a valid code", func(t *testing.T) {
+		w := makeAuthedRequest(t, server.Router, "/mfa/totp/disable", MFACodeRequest{Code: "000000"}, sessionCookie)
+		is.Equal(w.Code, http.StatusBadRequest)
+
+		code, err := totp.CodeAt(secret, totp.Step(time.Now())+1)
+		is.NoErr(err)
+		w = makeAuthedRequest(t, server.Router, "/mfa/totp/disable", MFACodeRequest{Code: code}, sessionCookie)
+		is.Equal(w.Code, http.StatusOK)
+
+		// Login no longer needs a second factor
+		rr, err := makeRequest(
+			server.Router,
+			"POST",
+			"/login",
+			UserCredentialsRequest{Email: email, Password: testutils.TestingPassword},
+		)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+		is.True(findSessionCookie(rr) != nil)
+	})
+}
+
+// findSessionCookie returns the session cookie set by a response, or nil
+func findSessionCookie(rr *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == config.SessionCookieName {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// makeAuthedRequest makes a JSON POST request with a session cookie
+func makeAuthedRequest(t *testing.T, router *gin.Engine, path string, body any, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("failed to marshal request body: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(cookie)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"godiscauth/internal/services"
+	"godiscauth/pkg/apperrors"
+)
+
+type PasskeyHandler struct {
+	WebAuthnService *services.WebAuthnService
+	UserService     *services.UserService
+}
+
+func NewPasskeyHandler(webAuthnService *services.WebAuthnService, userService *services.UserService) (*PasskeyHandler, error) {
+	if webAuthnService == nil {
+		return nil, apperrors.ErrWebAuthnServiceIsNil
+	}
+	if userService == nil {
+		return nil, apperrors.ErrUserServiceIsNil
+	}
+	return &PasskeyHandler{WebAuthnService: webAuthnService, UserService: userService}, nil
+}
+
+// BeginRegistration starts adding a passkey and returns the options for
+// `navigator.credentials.create()`
+func (ph *PasskeyHandler) BeginRegistration(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		log.Info().
+			Str("clientIP", clientIP).
+			Msg("userID not found in cookie")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{})
+		return
+	}
+	userID := userIDStr.(string)
+
+	// Only users with two-factor authentication have to send a code
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad passkey registration request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ceremony, options, err := ph.WebAuthnService.BeginRegistration(userID, body.Code)
+	if errors.Is(err, apperrors.ErrMFACodeIsEmpty) ||
+		errors.Is(err, apperrors.ErrInvalidMFACode) ||
+		errors.Is(err, apperrors.ErrAccountIsLocked) {
+		log.Info().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Passkey registration refused")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Error().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Passkey registration failed to start")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ceremony": ceremony,
+		"options":  options,
+	})
+}
+
+// FinishRegistration stores a passkey created by the browser
+func (ph *PasskeyHandler) FinishRegistration(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		log.Info().
+			Str("clientIP", clientIP).
+			Msg("userID not found in cookie")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{})
+		return
+	}
+	userID := userIDStr.(string)
+
+	var body struct {
+		Ceremony   string          `json:"ceremony" binding:"required"`
+		Credential json.RawMessage `json:"credential" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad passkey registration request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cred, err := ph.WebAuthnService.FinishRegistration(userID, body.Ceremony, body.Credential)
+	if err != nil {
+		log.Info().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Passkey registration failed")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Info().
+		Str("userID", userID).
+		Str("clientIP", clientIP).
+		Msg("Passkey registered")
+	c.JSON(http.StatusOK, gin.H{
+		"message": "passkey added",
+		"id":      cred.ID,
+	})
+}
+
+// ListPasskeys returns the user's passkeys, oldest first
+func (ph *PasskeyHandler) ListPasskeys(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		log.Info().
+			Str("clientIP", clientIP).
+			Msg("userID not found in cookie")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{})
+		return
+	}
+	userID := userIDStr.(string)
+
+	creds, err := ph.WebAuthnService.ListCredentials(userID)
+	if err != nil {
+		log.Error().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Failed to list passkeys")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	passkeys := make([]gin.H, 0, len(creds))
+	for _, cred := range creds {
+		passkeys = append(passkeys, gin.H{
+			"id":         cred.ID,
+			"backedUp":   cred.BackupState,
+			"createdAt":  cred.CreatedAt,
+			"lastUsedAt": cred.LastUsedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"passkeys": passkeys})
+}
+
+// DeletePasskey removes one of the user's passkeys
+func (ph *PasskeyHandler) DeletePasskey(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		log.Info().
+			Str("clientIP", clientIP).
+			Msg("userID not found in cookie")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{})
+		return
+	}
+	userID := userIDStr.(string)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": apperrors.ErrPasskeyNotFound.Error()})
+		return
+	}
+
+	if err := ph.WebAuthnService.DeleteCredential(userID, id); err != nil {
+		log.Info().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Failed to delete passkey")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Info().
+		Str("userID", userID).
+		Str("clientIP", clientIP).
+		Msg("Passkey deleted")
+	c.JSON(http.StatusOK, gin.H{"message": "passkey removed"})
+}
+
+// BeginLogin starts a passwordless login and returns the options for
+// `navigator.credentials.get()`
+func (ph *PasskeyHandler) BeginLogin(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	ceremony, options, err := ph.WebAuthnService.BeginLogin()
+	if err != nil {
+		log.Error().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Passkey login failed to start")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ceremony": ceremony,
+		"options":  options,
+	})
+}
+
+// FinishLogin logs the user in with the passkey the browser signed with
+func (ph *PasskeyHandler) FinishLogin(c *gin.Context) {
+	var body struct {
+		Ceremony   string          `json:"ceremony" binding:"required"`
+		Credential json.RawMessage `json:"credential" binding:"required"`
+		Mode       string          `json:"mode" binding:"omitempty,oneof=cookie token"`
+		RememberMe bool            `json:"rememberMe"`
+	}
+
+	clientIP := c.ClientIP()
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad passkey login request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessionToken, err := ph.UserService.LoginWithPasskey(body.Ceremony, body.Credential, loginClient(c, body.RememberMe))
+	if err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Passkey login failed")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Info().
+		Str("clientIP", clientIP).
+		Msg("login success")
+	respondWithSession(c, ph.UserService.SessionPolicies, body.Mode, sessionToken, body.RememberMe)
+}
+
+// BeginSecondFactor starts answering a two-factor login challenge with a passkey and returns the
+// options for `navigator.credentials.get()`
+func (ph *PasskeyHandler) BeginSecondFactor(c *gin.Context) {
+	var body struct {
+		Challenge string `json:"challenge" binding:"required"`
+	}
+
+	clientIP := c.ClientIP()
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad second factor passkey request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if ph.UserService.MFA == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": apperrors.ErrMFAServiceIsNil.Error()})
+		return
+	}
+
+	ceremony, options, err := ph.UserService.MFA.BeginPasskeyChallenge(body.Challenge)
+	if err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Second factor passkey failed to start")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ceremony": ceremony,
+		"options":  options,
+	})
+}
+
+// FinishSecondFactor completes a two-factor login with the passkey the browser signed with
+func (ph *PasskeyHandler) FinishSecondFactor(c *gin.Context) {
+	var body struct {
+		Challenge  string          `json:"challenge" binding:"required"`
+		Ceremony   string          `json:"ceremony" binding:"required"`
+		Credential json.RawMessage `json:"credential" binding:"required"`
+		Mode       string          `json:"mode" binding:"omitempty,oneof=cookie token"`
+		RememberMe bool            `json:"rememberMe"`
+	}
+
+	clientIP := c.ClientIP()
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad second factor passkey request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessionToken, err := ph.UserService.CompleteMFALoginWithPasskey(body.Challenge, body.Ceremony, body.Credential, loginClient(c, body.RememberMe))
+	if err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Second factor login failed")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Info().
+		Str("clientIP", clientIP).
+		Msg("login success")
+	respondWithSession(c, ph.UserService.SessionPolicies, body.Mode, sessionToken, body.RememberMe)
+}
@@ -0,0 +1,221 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/handlers"
+	"godiscauth/internal/models"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+	"godiscauth/pkg/totp"
+)
+
+type PasskeyFinishRequest struct {
+	Challenge  string          `json:"challenge,omitempty"`
+	Ceremony   string          `json:"ceremony,omitempty"`
+	Credential json.RawMessage `json:"credential,omitempty"`
+}
+
+// TestHandlers_NewPasskeyHandler checks the NewPasskeyHandler constructor
+func TestHandlers_NewPasskeyHandler(t *testing.T) {
+	is := is.New(t)
+
+	server := setupServer(t)
+	_, err := handlers.NewPasskeyHandler(nil, server.HandlerRegistry.User.UserService)
+	is.Equal(err, apperrors.ErrWebAuthnServiceIsNil)
+	_, err = handlers.NewPasskeyHandler(server.HandlerRegistry.Passkey.WebAuthnService, nil)
+	is.Equal(err, apperrors.ErrUserServiceIsNil)
+}
+
+// TestPasskeyHandler checks passkey registration, passwordless login and passkeys as a second
+// factor over http
+func TestPasskeyHandler(t *testing.T) {
+	is := is.New(t)
+	server := setupServer(t)
+
+	email := "testPasskeyHandler@test.com"
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
+	is.NoErr(err)
+	is.NoErr(server.Repos.User.RegisterUser(user))
+
+	rr, err := makeRequest(
+		server.Router,
+		"POST",
+		"/login",
+		UserCredentialsRequest{Email: email, Password: testutils.TestingPassword},
+	)
+	is.NoErr(err)
+	is.Equal(rr.Code, http.StatusOK)
+	sessionCookie := findSessionCookie(rr)
+	is.True(sessionCookie != nil)
+
+	authenticator, err := testutils.NewSoftAuthenticator(config.Default().WebAuthn.RPOrigins[0])
+	is.NoErr(err)
+
+	t.Run("registration requires auth", func(t *testing.T) {
+		rr, err := makeRequest(server.Router, "POST", "/passkeys/register/begin", nil)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("register a passkey", func(t *testing.T) {
+		w := makeAuthedRequest(t, server.Router, "/passkeys/register/begin", nil, sessionCookie)
+		is.Equal(w.Code, http.StatusOK)
+		var begin struct {
+			Ceremony string                      `json:"ceremony"`
+			Options  protocol.CredentialCreation `json:"options"`
+		}
+		is.NoErr(json.NewDecoder(w.Body).Decode(&begin))
+		is.True(begin.Ceremony != "")
+		is.Equal(begin.Options.Response.RelyingParty.ID, config.Default().WebAuthn.RPID)
+
+		credential, err := authenticator.CreateCredential(&begin.Options)
+		is.NoErr(err)
+		w = makeAuthedRequest(t, server.Router, "/passkeys/register/finish", PasskeyFinishRequest{Ceremony: begin.Ceremony, Credential: credential}, sessionCookie)
+		is.Equal(w.Code, http.StatusOK)
+
+		passkeys := listPasskeys(t, server.Router, sessionCookie)
+		is.Equal(len(passkeys), 1)
+	})
+
+	t.Run("log in with the passkey", func(t *testing.T) {
+		rr, err := makeRequest(server.Router, "POST", "/login/passkey/begin", nil)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+		var begin struct {
+			Ceremony string                       `json:"ceremony"`
+			Options  protocol.CredentialAssertion `json:"options"`
+		}
+		is.NoErr(json.NewDecoder(rr.Body).Decode(&begin))
+		is.Equal(begin.Options.Response.UserVerification, protocol.VerificationRequired)
+
+		credential, err := authenticator.GetAssertion(&begin.Options)
+		is.NoErr(err)
+		rr, err = makeRequest(server.Router, "POST", "/login/passkey/finish", PasskeyFinishRequest{Ceremony: begin.Ceremony, Credential: credential})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+		is.True(findSessionCookie(rr) != nil)
+
+		// The same response can't be used again
+		rr, err = makeRequest(server.Router, "POST", "/login/passkey/finish", PasskeyFinishRequest{Ceremony: begin.Ceremony, Credential: credential})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusBadRequest)
+		is.Equal(findSessionCookie(rr), nil)
+	})
+
+	t.Run("use the passkey as a second factor", func(t *testing.T) {
+		w := makeAuthedRequest(t, server.Router, "/mfa/totp/enroll", nil, sessionCookie)
+		is.Equal(w.Code, http.StatusOK)
+		var enrollment map[string]string
+		is.NoErr(json.NewDecoder(w.Body).Decode(&enrollment))
+		code, err := totp.CodeAt(enrollment["secret"], totp.Step(time.Now())-1)
+		is.NoErr(err)
+		w = makeAuthedRequest(t, server.Router, "/mfa/totp/confirm", MFACodeRequest{Code: code}, sessionCookie)
+		is.Equal(w.Code, http.StatusOK)
+
+		rr, err := makeRequest(
+			server.Router,
+			"POST",
+			"/login",
+			UserCredentialsRequest{Email: email, Password: testutils.TestingPassword},
+		)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+		var login map[string]any
+		is.NoErr(json.NewDecoder(rr.Body).Decode(&login))
+		challenge := login["challenge"].(string)
+
+		rr, err = makeRequest(server.Router, "POST", "/login/2fa/passkey/begin", MFALoginRequest{Challenge: challenge})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+		var begin struct {
+			Ceremony string                       `json:"ceremony"`
+			Options  protocol.CredentialAssertion `json:"options"`
+		}
+		is.NoErr(json.NewDecoder(rr.Body).Decode(&begin))
+		is.Equal(len(begin.Options.Response.AllowedCredentials), 1)
+
+		credential, err := authenticator.GetAssertion(&begin.Options)
+		is.NoErr(err)
+		rr, err = makeRequest(server.Router, "POST", "/login/2fa/passkey/finish", PasskeyFinishRequest{
+			Challenge:  challenge,
+			Ceremony:   begin.Ceremony,
+			Credential: credential,
+		})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+		is.True(findSessionCookie(rr) != nil)
+	})
+
+	t.Run("adding a passkey needs a second factor once enabled", func(t *testing.T) {
+		w := makeAuthedRequest(t, server.Router, "/passkeys/register/begin", nil, sessionCookie)
+		is.Equal(w.Code, http.StatusBadRequest)
+
+		w = makeAuthedRequest(t, server.Router, "/passkeys/register/begin", MFACodeRequest{Code: "000000"}, sessionCookie)
+		is.Equal(w.Code, http.StatusBadRequest)
+	})
+
+	t.Run("delete the passkey", func(t *testing.T) {
+		passkeys := listPasskeys(t, server.Router, sessionCookie)
+		is.Equal(len(passkeys), 1)
+
+		req, err := http.NewRequest(http.MethodDelete, "/passkeys/"+passkeys[0].ID, nil)
+		is.NoErr(err)
+		req.AddCookie(sessionCookie)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		is.Equal(w.Code, http.StatusOK)
+
+		is.Equal(len(listPasskeys(t, server.Router, sessionCookie)), 0)
+
+		// The passkey no longer logs in
+		rr, err := makeRequest(server.Router, "POST", "/login/passkey/begin", nil)
+		is.NoErr(err)
+		var begin struct {
+			Ceremony string                       `json:"ceremony"`
+			Options  protocol.CredentialAssertion `json:"options"`
+		}
+		is.NoErr(json.NewDecoder(rr.Body).Decode(&begin))
+		credential, err := authenticator.GetAssertion(&begin.Options)
+		is.NoErr(err)
+		rr, err = makeRequest(server.Router, "POST", "/login/passkey/finish", PasskeyFinishRequest{Ceremony: begin.Ceremony, Credential: credential})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusBadRequest)
+	})
+}
+
+// listPasskeys returns the passkeys of the user a session cookie belongs to
+func listPasskeys(t *testing.T, router http.Handler, cookie *http.Cookie) []struct {
+	ID string `json:"id"`
+} {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, "/passkeys", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to list passkeys: %d", w.Code)
+	}
+
+	var response struct {
+		Passkeys []struct {
+			ID string `json:"id"`
+		} `json:"passkeys"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode passkeys: %v", err)
+	}
+	return response.Passkeys
+}
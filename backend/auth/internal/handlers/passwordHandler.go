@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"godiscauth/internal/services"
+	"godiscauth/pkg/apperrors"
+)
+
+type PasswordHandler struct {
+	PasswordResetService *services.PasswordResetService
+}
+
+func NewPasswordHandler(passwordResetService *services.PasswordResetService) (*PasswordHandler, error) {
+	if passwordResetService == nil {
+		return nil, apperrors.ErrPasswordResetServiceIsNil
+	}
+	return &PasswordHandler{PasswordResetService: passwordResetService}, nil
+}
+
+func (ph *PasswordHandler) ForgotPassword(c *gin.Context) {
+	var body struct {
+		Email string `json:"email" binding:"required"`
+	}
+
+	clientIP := c.ClientIP()
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad forgot password request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Respond the same way whether or not the email is registered or mail delivery failed, so the
+	// endpoint can't be used to discover accounts
+	if err := ph.PasswordResetService.RequestPasswordReset(body.Email); err != nil {
+		log.Error().
+			Str("email", body.Email).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Password reset request failed")
+	} else {
+		log.Info().
+			Str("email", body.Email).
+			Str("clientIP", clientIP).
+			Msg("Password reset requested")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "if an account exists for that email, a password reset link has been sent",
+	})
+}
+
+func (ph *PasswordHandler) ResetPassword(c *gin.Context) {
+	var body struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	clientIP := c.ClientIP()
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad password reset request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ph.PasswordResetService.ResetPassword(body.Token, body.Password); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Password reset failed")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Info().
+		Str("clientIP", clientIP).
+		Msg("Password reset success")
+	c.JSON(http.StatusOK, gin.H{"message": "password reset, please log in again"})
+}
@@ -0,0 +1,139 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/handlers"
+	"godiscauth/internal/models"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+type PasswordResetRequest struct {
+	Token    string `json:"token,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// TestHandlers_NewPasswordHandler checks the NewPasswordHandler constructor
+func TestHandlers_NewPasswordHandler(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("err on nil password reset service", func(t *testing.T) {
+		ph, err := handlers.NewPasswordHandler(nil)
+		is.Equal(ph, nil)
+		is.Equal(err, apperrors.ErrPasswordResetServiceIsNil)
+	})
+}
+
+// TestPasswordHandler_ForgotAndResetPassword checks the full forgot/reset password flow over http
+func TestPasswordHandler_ForgotAndResetPassword(t *testing.T) {
+	is := is.New(t)
+
+	mailDir := t.TempDir()
+	t.Setenv(config.EnvMailer, "file")
+	t.Setenv(config.EnvMailDir, mailDir)
+	server := setupServer(t)
+
+	email := "testPasswordHandlerReset@test.com"
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
+	is.NoErr(err)
+	err = server.Repos.User.RegisterUser(user)
+	is.NoErr(err)
+
+	newPassword := "brand new " + testutils.TestingPassword
+
+	t.Run("forgot without email", func(t *testing.T) {
+		rr, err := makeRequest(server.Router, "POST", "/password/forgot", UserCredentialsRequest{})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusBadRequest)
+	})
+
+	t.Run("forgot with unknown email looks the same", func(t *testing.T) {
+		rr, err := makeRequest(
+			server.Router,
+			"POST",
+			"/password/forgot",
+			UserCredentialsRequest{Email: "doesNotExist@test.com"},
+		)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+		is.Equal(len(readMailDir(t, mailDir)), 0)
+	})
+
+	t.Run("reset with invalid token", func(t *testing.T) {
+		rr, err := makeRequest(
+			server.Router,
+			"POST",
+			"/password/reset",
+			PasswordResetRequest{Token: "notARealToken", Password: newPassword},
+		)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusBadRequest)
+	})
+
+	t.Run("reset with mailed token", func(t *testing.T) {
+		rr, err := makeRequest(
+			server.Router,
+			"POST",
+			"/password/forgot",
+			UserCredentialsRequest{Email: email},
+		)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+
+		mail := readMailDir(t, mailDir)
+		is.Equal(len(mail), 1)
+		token := testutils.ExtractToken(mail[0])
+		is.True(token != "")
+
+		rr, err = makeRequest(
+			server.Router,
+			"POST",
+			"/password/reset",
+			PasswordResetRequest{Token: token, Password: newPassword},
+		)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+
+		var response map[string]string
+		err = json.NewDecoder(rr.Body).Decode(&response)
+		is.NoErr(err)
+		is.Equal(response["message"], "password reset, please log in again")
+
+		// Can log in with the new password
+		rr, err = makeRequest(
+			server.Router,
+			"POST",
+			"/login",
+			UserCredentialsRequest{Email: email, Password: newPassword},
+		)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+	})
+}
+
+// readMailDir returns the contents of every message written by the file mailer
+func readMailDir(t *testing.T, dir string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatalf("failed to list mail: %v", err)
+	}
+	var mail []string
+	for _, f := range files {
+		contents, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatalf("failed to read mail: %v", err)
+		}
+		mail = append(mail, string(contents))
+	}
+	return mail
+}
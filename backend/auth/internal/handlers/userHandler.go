@@ -1,17 +1,30 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 
+	"godiscauth/internal/middleware"
+	"godiscauth/internal/models"
 	"godiscauth/internal/services"
 	"godiscauth/pkg/apperrors"
 	"godiscauth/pkg/config"
 )
 
+// Session modes select how a successful login hands out the session token
+const (
+	// SessionModeCookie sets the token as an http-only cookie, the default for browsers
+	SessionModeCookie = "cookie"
+	// SessionModeToken returns the token in the response body for clients that send it back in an
+	// `Authorization: Bearer` header
+	SessionModeToken = "token"
+)
+
 type UserHandler struct {
 	UserService *services.UserService
 }
@@ -66,8 +79,10 @@ func (uh *UserHandler) RegisterUser(c *gin.Context) {
 
 func (uh *UserHandler) Login(c *gin.Context) {
 	var body struct {
-		Email    string `json:"email" binding:"required"`
-		Password string `json:"password" binding:"required"`
+		Email      string `json:"email" binding:"required"`
+		Password   string `json:"password" binding:"required"`
+		Mode       string `json:"mode" binding:"omitempty,oneof=cookie token"`
+		RememberMe bool   `json:"rememberMe"`
 	}
 
 	clientIP := c.ClientIP()
@@ -84,7 +99,7 @@ func (uh *UserHandler) Login(c *gin.Context) {
 	}
 
 	// Attempt login
-	sessionToken, err := uh.UserService.LoginUser(body.Email, body.Password)
+	result, err := uh.UserService.LoginUser(body.Email, body.Password, loginClient(c, body.RememberMe))
 	if err != nil {
 		log.Info().
 			Str("email", body.Email).
@@ -96,28 +111,108 @@ func (uh *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Set session cookie
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie(config.SessionCookieName, sessionToken, config.SessionExpiration, "", "", true, true)
+	// Second factor required, no session until /login/2fa succeeds
+	if result.MFAChallenge != "" {
+		log.Info().
+			Str("email", body.Email).
+			Str("clientIP", clientIP).
+			Msg("login second factor required")
+		c.JSON(http.StatusOK, gin.H{
+			"message":     "second factor required",
+			"mfaRequired": true,
+			"challenge":   result.MFAChallenge,
+		})
+		return
+	}
 
 	log.Info().
 		Str("email", body.Email).
 		Str("clientIP", clientIP).
 		Msg("login success")
+	respondWithSession(c, uh.UserService.SessionPolicies, body.Mode, result.SessionToken, body.RememberMe)
+}
+
+// loginClient describes the client logging in, and whether the user asked to be remembered, for
+// its new session
+func loginClient(c *gin.Context, rememberMe bool) models.ClientInfo {
+	client := middleware.ClientInfo(c)
+	client.RememberMe = rememberMe
+	return client
+}
+
+// respondWithSession hands a new session token to the client, as a cookie or in the response
+// body depending on the requested session mode. Only users who asked to be remembered get a
+// cookie that outlasts the browser session.
+func respondWithSession(c *gin.Context, policies models.SessionPolicies, mode, sessionToken string, rememberMe bool) {
+	policy := policies.For(rememberMe)
+	if mode == SessionModeToken {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{
+			"message":     "login success",
+			"token":       sessionToken,
+			"expiresIn":   int(policy.IdleTimeout.Seconds()),
+			"maxLifetime": int(policy.MaxLifetime.Seconds()),
+		})
+		return
+	}
+
+	// Set session cookie
+	maxAge := 0
+	if rememberMe {
+		maxAge = int(policy.MaxLifetime.Seconds())
+	}
+	middleware.SetSessionCookie(c, sessionToken, maxAge)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "login success",
 	})
 }
 
+// LoginSecondFactor completes a login started by `Login` for users with two-factor
+// authentication enabled
+func (uh *UserHandler) LoginSecondFactor(c *gin.Context) {
+	var body struct {
+		Challenge  string `json:"challenge" binding:"required"`
+		Code       string `json:"code" binding:"required"`
+		Mode       string `json:"mode" binding:"omitempty,oneof=cookie token"`
+		RememberMe bool   `json:"rememberMe"`
+	}
+
+	clientIP := c.ClientIP()
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad second factor login request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessionToken, err := uh.UserService.CompleteMFALogin(body.Challenge, body.Code, loginClient(c, body.RememberMe))
+	if err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Second factor login failed")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Info().
+		Str("clientIP", clientIP).
+		Msg("login success")
+	respondWithSession(c, uh.UserService.SessionPolicies, body.Mode, sessionToken, body.RememberMe)
+}
+
 func (uh *UserHandler) Logout(c *gin.Context) {
 	clientIP := c.ClientIP()
 
-	sessionToken, err := c.Cookie(config.SessionCookieName)
+	sessionToken, bearer, err := middleware.SessionToken(c)
 	if err != nil {
 		log.Info().
 			Str("clientIP", clientIP).
 			Str("error", err.Error()).
-			Msg("Cookie not found")
+			Msg("Session token not found")
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
@@ -134,7 +229,9 @@ func (uh *UserHandler) Logout(c *gin.Context) {
 	log.Info().
 		Str("clientIP", clientIP).
 		Msg("Logout success")
-	c.SetCookie(config.SessionCookieName, "", -1, "", "", true, true)
+	if !bearer {
+		middleware.SetSessionCookie(c, "", -1)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
 }
 
@@ -162,10 +259,137 @@ func (uh *UserHandler) LogoutEverywhere(c *gin.Context) {
 		return
 	}
 
-	c.SetCookie(config.SessionCookieName, "", -1, "", "", true, true)
+	middleware.SetSessionCookie(c, "", -1)
 	c.JSON(http.StatusOK, gin.H{"message": "logged out everywhere"})
 }
 
+// ListSessions returns the user's active sessions with the device they are used from, flagging the
+// one making the request
+func (uh *UserHandler) ListSessions(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		log.Info().
+			Str("clientIP", clientIP).
+			Msg("userID not found in cookie")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{})
+		return
+	}
+	userID := userIDStr.(string)
+
+	sessions, err := uh.UserService.ListSessions(userID)
+	if err != nil {
+		log.Error().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Failed to list sessions")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	currentSessionID := c.GetString("sessionID")
+	response := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, gin.H{
+			"id":              session.ID,
+			"device":          session.DeviceLabel,
+			"userAgent":       session.UserAgent,
+			"ipAddress":       session.ClientIP,
+			"mfa":             session.MFA,
+			"authenticatedAt": session.AuthenticatedAt,
+			"lastSeenAt":      session.LastSeenAt,
+			"expiresAt":       session.ExpiresAt,
+			"current":         session.ID.String() == currentSessionID,
+		})
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+// RevokeSession ends one of the user's other sessions, e.g. on a lost device. The current session
+// is ended with `/logout` instead.
+func (uh *UserHandler) RevokeSession(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		log.Info().
+			Str("clientIP", clientIP).
+			Msg("userID not found in cookie")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{})
+		return
+	}
+	userID := userIDStr.(string)
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": apperrors.ErrSessionNotFound.Error()})
+		return
+	}
+	currentSessionID, _ := uuid.Parse(c.GetString("sessionID"))
+
+	err = uh.UserService.RevokeSession(userID, sessionID, currentSessionID)
+	switch {
+	case errors.Is(err, apperrors.ErrSessionNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, apperrors.ErrCannotRevokeCurrentSession):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Error().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Failed to revoke session")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Info().
+		Str("userID", userID).
+		Str("clientIP", clientIP).
+		Str("sessionID", sessionID.String()).
+		Msg("Session revoked")
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
+
+// ForwardAuth lets a reverse proxy (nginx `auth_request`, Traefik `forwardAuth`) decide whether a
+// request may reach another service. It runs behind `RequireAuth`, so a missing or invalid session
+// is rejected before this handler and rotated sessions come back as `Set-Cookie` headers for the
+// proxy to pass on. The user is identified to the proxy in response headers.
+func (uh *UserHandler) ForwardAuth(c *gin.Context) {
+	clientIP := c.ClientIP()
+
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		log.Info().
+			Str("clientIP", clientIP).
+			Msg("userID not found in cookie")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	userID := userIDStr.(string)
+
+	userProfile, err := uh.UserService.GetUserProfile(userID)
+	if err != nil {
+		log.Info().
+			Str("userID", userID).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Forward auth failed to get user")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header(config.ForwardAuthUserIDHeader, userID)
+	c.Header(config.ForwardAuthUserEmailHeader, userProfile.Email)
+	c.Status(http.StatusOK)
+}
+
 func (uh *UserHandler) GetUserProfile(c *gin.Context) {
 	clientIP := c.ClientIP()
 
@@ -194,8 +418,9 @@ func (uh *UserHandler) GetUserProfile(c *gin.Context) {
 		Msg("user profile request successful")
 
 	c.JSON(http.StatusOK, gin.H{
-		"email":     userProfile.Email,
-		"lastLogin": userProfile.LastLogin,
+		"email":           userProfile.Email,
+		"lastLogin":       userProfile.LastLogin,
+		"emailVerifiedAt": userProfile.EmailVerifiedAt,
 	})
 }
 
@@ -286,7 +511,7 @@ func (uh *UserHandler) PermanentlyDeleteUser(c *gin.Context) {
 	// Account no longer exists, so we can clear cookie
 	// NOTE: we are assuming the database will delete all associated sessions once the
 	// corresponding user row is deleted
-	c.SetCookie(config.SessionCookieName, "", -1, "", "", true, true)
+	middleware.SetSessionCookie(c, "", -1)
 
 	log.Info().
 		Str("clientIP", clientIP).
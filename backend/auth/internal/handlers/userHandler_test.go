@@ -5,8 +5,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -78,10 +78,9 @@ func TestUserHandler_RegisterUser(t *testing.T) {
 		is.NoErr(err)
 		is.Equal(rr.Code, http.StatusOK)
 
-		// Check user is actually in database
-		var user models.User
-		result := server.DB.First(&user, "email = ?", email)
-		is.NoErr(result.Error)
+		// Check user is actually in the store
+		user, err := server.Repos.User.GetUserByEmail(email)
+		is.NoErr(err)
 		is.Equal(user.Email, email)
 	})
 }
@@ -96,13 +95,13 @@ func TestUserHandler_Login(t *testing.T) {
 	password1 := testutils.TestingPassword // strong password for validator
 	email2 := "SECONDARYtestUserHandlerLoginUser@test.com"
 	password2 := "SECONDARY" + testutils.TestingPassword
-	user1, err := models.NewUser(email1, password1)
+	user1, err := models.NewUser(email1, password1, testutils.TestingMinEntropyBits)
 	is.NoErr(err)
-	user2, err := models.NewUser(email2, password2)
+	user2, err := models.NewUser(email2, password2, testutils.TestingMinEntropyBits)
 	is.NoErr(err)
-	err = server.DB.Create(user1).Error
+	err = server.Repos.User.RegisterUser(user1)
 	is.NoErr(err)
-	err = server.DB.Create(user2).Error
+	err = server.Repos.User.RegisterUser(user2)
 	is.NoErr(err)
 
 	t.Run("valid request", func(t *testing.T) {
@@ -128,12 +127,8 @@ func TestUserHandler_Login(t *testing.T) {
 
 		// Session Token is valid
 		sessionToken := sessionCookie.Value
-		parts := strings.Split(sessionToken, ".")
-		is.True(len(parts) == 2)
-		sessionID, signature := parts[0], parts[1]
-		parsedID, err := uuid.Parse(sessionID)
+		_, err = models.ParseSessionToken(testutils.TestSessionKeys(), sessionToken)
 		is.NoErr(err)
-		is.True(models.ValidateSessionID(parsedID, signature))
 	})
 
 	t.Run("no email", func(t *testing.T) {
@@ -188,15 +183,216 @@ func TestUserHandler_Login(t *testing.T) {
 	})
 }
 
+// TestUserHandler_LoginRememberMe checks that "remember me" selects the longer session policy and
+// a cookie that outlasts the browser session
+func TestUserHandler_LoginRememberMe(t *testing.T) {
+	is := is.New(t)
+	server := setupServer(t)
+
+	email := "testUserHandlerLoginRememberMe@test.com"
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
+	is.NoErr(err)
+	err = server.Repos.User.RegisterUser(user)
+	is.NoErr(err)
+
+	login := func(rememberMe bool) (*http.Cookie, *models.Session) {
+		rr, err := makeRequest(server.Router, "POST", "/login", map[string]any{
+			"email":      email,
+			"password":   testutils.TestingPassword,
+			"rememberMe": rememberMe,
+		})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+		cookie := findSessionCookie(rr)
+		is.True(cookie != nil)
+
+		tokenHash, err := models.ParseSessionToken(testutils.TestSessionKeys(), cookie.Value)
+		is.NoErr(err)
+		session, err := server.Repos.Session.GetUnexpiredSessionByTokenHash(tokenHash)
+		is.NoErr(err)
+		return cookie, session
+	}
+
+	t.Run("browser session by default", func(t *testing.T) {
+		cookie, session := login(false)
+		is.Equal(cookie.MaxAge, 0)
+		is.True(!session.RememberMe)
+		is.True(!session.ExpiresAt.After(time.Now().Add(config.Default().Sessions.IdleTimeout)))
+	})
+
+	t.Run("remembered", func(t *testing.T) {
+		cookie, session := login(true)
+		is.Equal(cookie.MaxAge, int(config.Default().Sessions.RememberMeMaxLifetime.Seconds()))
+		is.True(session.RememberMe)
+		is.True(session.ExpiresAt.After(time.Now().Add(config.Default().Sessions.IdleTimeout)))
+	})
+}
+
+// TestUserHandler_LoginTokenMode checks that the token session mode returns the session token in
+// the body and that it authorizes requests as a bearer token
+func TestUserHandler_LoginTokenMode(t *testing.T) {
+	is := is.New(t)
+	server := setupServer(t)
+
+	email := "testUserHandlerLoginTokenMode@test.com"
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
+	is.NoErr(err)
+	err = server.Repos.User.RegisterUser(user)
+	is.NoErr(err)
+
+	type LoginRequest struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Mode     string `json:"mode"`
+	}
+
+	makeBearerRequest := func(method, path, token string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, nil)
+		is.NoErr(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("invalid mode", func(t *testing.T) {
+		rr, err := makeRequest(server.Router, "POST", "/login", LoginRequest{
+			Email:    email,
+			Password: testutils.TestingPassword,
+			Mode:     "header",
+		})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusBadRequest)
+	})
+
+	t.Run("token in body", func(t *testing.T) {
+		rr, err := makeRequest(server.Router, "POST", "/login", LoginRequest{
+			Email:    email,
+			Password: testutils.TestingPassword,
+			Mode:     handlers.SessionModeToken,
+		})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+		is.Equal(rr.Header().Get("Cache-Control"), "no-store")
+
+		// No cookie is set
+		for _, cookie := range rr.Result().Cookies() {
+			is.True(cookie.Name != config.SessionCookieName)
+		}
+
+		var response struct {
+			Token       string `json:"token"`
+			ExpiresIn   int    `json:"expiresIn"`
+			MaxLifetime int    `json:"maxLifetime"`
+		}
+		is.NoErr(json.NewDecoder(rr.Body).Decode(&response))
+		is.Equal(response.ExpiresIn, int(config.Default().Sessions.IdleTimeout.Seconds()))
+		is.Equal(response.MaxLifetime, int(config.Default().Sessions.MaxLifetime.Seconds()))
+		_, err = models.ParseSessionToken(testutils.TestSessionKeys(), response.Token)
+		is.NoErr(err)
+
+		// The token authorizes protected routes
+		w := makeBearerRequest("GET", "/profile", response.Token)
+		is.Equal(w.Code, http.StatusOK)
+
+		// Logging out with the token ends the session without touching cookies
+		w = makeBearerRequest("POST", "/logout", response.Token)
+		is.Equal(w.Code, http.StatusOK)
+		is.Equal(len(w.Result().Cookies()), 0)
+
+		w = makeBearerRequest("GET", "/profile", response.Token)
+		is.Equal(w.Code, http.StatusUnauthorized)
+	})
+}
+
+// TestUserHandler_ForwardAuth checks that `/verify` identifies the user to a reverse proxy and
+// rotates sessions through `Set-Cookie`
+func TestUserHandler_ForwardAuth(t *testing.T) {
+	is := is.New(t)
+	server := setupServer(t)
+
+	email := "testUserHandlerForwardAuth@test.com"
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
+	is.NoErr(err)
+	err = server.Repos.User.RegisterUser(user)
+	is.NoErr(err)
+
+	verify := func(method string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, "/verify", nil)
+		is.NoErr(err)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("valid session", func(t *testing.T) {
+		rr, err := makeRequest(
+			server.Router,
+			"POST",
+			"/login",
+			UserCredentialsRequest{Email: email, Password: testutils.TestingPassword},
+		)
+		is.NoErr(err)
+		sessionCookie := findSessionCookie(rr)
+		is.True(sessionCookie != nil)
+
+		// Proxies forward the method of the original request
+		for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+			w := verify(method, sessionCookie)
+			is.Equal(w.Code, http.StatusOK)
+			is.Equal(w.Header().Get(config.ForwardAuthUserIDHeader), user.ID.String())
+			is.Equal(w.Header().Get(config.ForwardAuthUserEmailHeader), email)
+			is.Equal(findSessionCookie(w), nil)
+		}
+	})
+
+	t.Run("no session", func(t *testing.T) {
+		w := verify(http.MethodGet, nil)
+		is.Equal(w.Code, http.StatusUnauthorized)
+		is.Equal(w.Header().Get(config.ForwardAuthUserIDHeader), "")
+	})
+
+	t.Run("invalid session", func(t *testing.T) {
+		w := verify(http.MethodGet, &http.Cookie{Name: config.SessionCookieName, Value: uuid.NewString() + ".invalid"})
+		is.Equal(w.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("rotates halfway expired session", func(t *testing.T) {
+		sessionToken, tokenHash, err := models.GenerateSessionToken(testutils.TestSessionKeys())
+		is.NoErr(err)
+		session, err := models.NewSession(user.ID, tokenHash, time.Now().UTC().Add(4*time.Minute))
+		is.NoErr(err)
+		session.CreatedAt = time.Now().Add(-6 * time.Minute)
+		is.NoErr(server.Repos.Session.CreateSession(session))
+
+		w := verify(http.MethodGet, &http.Cookie{Name: config.SessionCookieName, Value: sessionToken})
+		is.Equal(w.Code, http.StatusOK)
+		is.Equal(w.Header().Get(config.ForwardAuthUserIDHeader), user.ID.String())
+
+		rotated := findSessionCookie(w)
+		is.True(rotated != nil)
+		is.True(rotated.Value != sessionToken)
+
+		// The old session no longer passes, the rotated one does
+		w = verify(http.MethodGet, &http.Cookie{Name: config.SessionCookieName, Value: sessionToken})
+		is.Equal(w.Code, http.StatusUnauthorized)
+		w = verify(http.MethodGet, rotated)
+		is.Equal(w.Code, http.StatusOK)
+	})
+}
+
 func TestUserHandler_Logout(t *testing.T) {
 	is := is.New(t)
 	server := setupServer(t)
 
 	// Register a test user
 	email := "testUserHandlerLogoutUser@test.com"
-	user, err := models.NewUser(email, testutils.TestingPassword)
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
 	is.NoErr(err)
-	err = server.DB.Create(user).Error
+	err = server.Repos.User.RegisterUser(user)
 	is.NoErr(err)
 
 	t.Run("valid token", func(t *testing.T) {
@@ -243,6 +439,23 @@ func TestUserHandler_Logout(t *testing.T) {
 		err = json.NewDecoder(w.Body).Decode(&response)
 		is.NoErr(err)
 		is.Equal(response["message"], "logged out successfully")
+
+		// Logging out of the ended session still clears the cookie
+		req, err = http.NewRequest("POST", "/logout", nil)
+		is.NoErr(err)
+		req.AddCookie(sessionCookie)
+		w = httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		is.Equal(w.Code, http.StatusOK)
+		logoutCookie = nil
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == config.SessionCookieName {
+				logoutCookie = cookie
+				break
+			}
+		}
+		is.True(logoutCookie != nil)
+		is.Equal(logoutCookie.MaxAge, -1)
 	})
 
 	t.Run("no token", func(t *testing.T) {
@@ -280,9 +493,9 @@ func TestUserHandler_LogoutEverywhere(t *testing.T) {
 
 	// Register a test user
 	email := "testUserHandlerLogoutEverywhere@test.com"
-	user, err := models.NewUser(email, testutils.TestingPassword)
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
 	is.NoErr(err)
-	err = server.DB.Create(user).Error
+	err = server.Repos.User.RegisterUser(user)
 	is.NoErr(err)
 
 	var firstToken string
@@ -422,6 +635,131 @@ func TestUserHandler_LogoutEverywhere(t *testing.T) {
 	})
 }
 
+// TestUserHandler_Sessions tests listing the user's sessions and revoking other ones
+func TestUserHandler_Sessions(t *testing.T) {
+	is := is.New(t)
+	server := setupServer(t)
+
+	email := "testUserHandlerSessions@test.com"
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
+	is.NoErr(err)
+	is.NoErr(server.Repos.User.RegisterUser(user))
+
+	// loginFrom logs in with a user agent and returns the session token
+	loginFrom := func(userAgent string) string {
+		body, err := json.Marshal(map[string]string{
+			"email":    email,
+			"password": testutils.TestingPassword,
+			"mode":     handlers.SessionModeToken,
+		})
+		is.NoErr(err)
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body))
+		is.NoErr(err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		is.Equal(w.Code, http.StatusOK)
+		var response struct {
+			Token string `json:"token"`
+		}
+		is.NoErr(json.NewDecoder(w.Body).Decode(&response))
+		return response.Token
+	}
+	makeBearerRequest := func(method, path, token string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, nil)
+		is.NoErr(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+	type sessionResponse struct {
+		ID        string `json:"id"`
+		Device    string `json:"device"`
+		UserAgent string `json:"userAgent"`
+		IPAddress string `json:"ipAddress"`
+		Current   bool   `json:"current"`
+	}
+	listSessions := func(token string) []sessionResponse {
+		w := makeBearerRequest(http.MethodGet, "/sessions", token)
+		is.Equal(w.Code, http.StatusOK)
+		var response struct {
+			Sessions []sessionResponse `json:"sessions"`
+		}
+		is.NoErr(json.NewDecoder(w.Body).Decode(&response))
+		return response.Sessions
+	}
+
+	firefox := "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	safari := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+	laptopToken := loginFrom(firefox)
+	phoneToken := loginFrom(safari)
+
+	t.Run("requires auth", func(t *testing.T) {
+		rr, err := makeRequest(server.Router, "GET", "/sessions", nil)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusUnauthorized)
+	})
+
+	var phoneSessionID string
+	t.Run("lists sessions with their device", func(t *testing.T) {
+		sessions := listSessions(laptopToken)
+		is.Equal(len(sessions), 2)
+		for _, session := range sessions {
+			is.True(session.IPAddress != "")
+			switch session.UserAgent {
+			case firefox:
+				is.Equal(session.Device, "Firefox on Linux")
+				is.True(session.Current)
+			case safari:
+				is.Equal(session.Device, "Safari on iOS")
+				is.True(!session.Current)
+				phoneSessionID = session.ID
+			default:
+				t.Fatalf("unexpected user agent %q", session.UserAgent)
+			}
+		}
+	})
+
+	t.Run("can't revoke the current session", func(t *testing.T) {
+		current := listSessions(phoneToken)
+		for _, session := range current {
+			if session.Current {
+				w := makeBearerRequest(http.MethodDelete, "/sessions/"+session.ID, phoneToken)
+				is.Equal(w.Code, http.StatusBadRequest)
+			}
+		}
+	})
+
+	t.Run("can't revoke other users' sessions", func(t *testing.T) {
+		other, err := models.NewUser("testUserHandlerSessionsOther@test.com", testutils.TestingPassword, testutils.TestingMinEntropyBits)
+		is.NoErr(err)
+		is.NoErr(server.Repos.User.RegisterUser(other))
+		otherSession, err := models.NewSession(other.ID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(time.Hour))
+		is.NoErr(err)
+		is.NoErr(server.Repos.Session.CreateSession(otherSession))
+
+		w := makeBearerRequest(http.MethodDelete, "/sessions/"+otherSession.ID.String(), laptopToken)
+		is.Equal(w.Code, http.StatusNotFound)
+		w = makeBearerRequest(http.MethodDelete, "/sessions/not-a-session", laptopToken)
+		is.Equal(w.Code, http.StatusNotFound)
+	})
+
+	t.Run("revokes another session", func(t *testing.T) {
+		w := makeBearerRequest(http.MethodDelete, "/sessions/"+phoneSessionID, laptopToken)
+		is.Equal(w.Code, http.StatusOK)
+
+		is.Equal(makeBearerRequest(http.MethodGet, "/profile", phoneToken).Code, http.StatusUnauthorized)
+		is.Equal(len(listSessions(laptopToken)), 1)
+
+		w = makeBearerRequest(http.MethodDelete, "/sessions/"+phoneSessionID, laptopToken)
+		is.Equal(w.Code, http.StatusNotFound)
+	})
+}
+
 func TestUserHandler_PermanentlyDeleteUser(t *testing.T) {
 	is := is.New(t)
 
@@ -429,14 +767,14 @@ func TestUserHandler_PermanentlyDeleteUser(t *testing.T) {
 
 	// Register a test user
 	email := "TestUserHandler_PermanentlyDeleteUser@test.com"
-	user, err := models.NewUser(email, testutils.TestingPassword)
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
 	is.NoErr(err)
-	err = server.DB.Create(user).Error
+	err = server.Repos.User.RegisterUser(user)
 	is.NoErr(err)
 
-	// Read registered user from DB so we can get its ID
-	var dbUser models.User
-	server.DB.First(&dbUser, "email = ?", user.Email)
+	// Read registered user from the store so we can get its ID
+	dbUser, err := server.Repos.User.GetUserByEmail(user.Email)
+	is.NoErr(err)
 
 	t.Run("set userID in gin context", func(t *testing.T) {
 		path := "/deleteAccountValid"
@@ -494,9 +832,9 @@ func TestUserHandler_UpdateUser(t *testing.T) {
 
 	// Register a test user
 	email := "testUpdateUser@test.com"
-	user, err := models.NewUser(email, testutils.TestingPassword)
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
 	is.NoErr(err)
-	err = server.DB.Create(user).Error
+	err = server.Repos.User.RegisterUser(user)
 	is.NoErr(err)
 
 	var sessionToken string
@@ -626,19 +964,7 @@ func TestUserHandler_UpdateUser(t *testing.T) {
 func setupUserHandler(t *testing.T) *handlers.UserHandler {
 	t.Helper()
 
-	testDB := testutils.TestDBSetup()
-	tx := testDB.Begin()
-	t.Cleanup(func() { tx.Rollback() })
-
-	ur, err := repository.NewUserRepository(tx)
-	if err != nil {
-		t.Fatalf("failed to create user repository: %v", err)
-	}
-	sr, err := repository.NewSessionRepository(tx)
-	if err != nil {
-		t.Fatalf("failed to create session repository: %v", err)
-	}
-	us, err := services.NewUserService(ur, sr)
+	us, err := services.NewUserService(repository.NewMemoryUserStore(), repository.NewMemorySessionStore(), testutils.TestSessionKeys(), testutils.TestConfig())
 	if err != nil {
 		t.Fatalf("failed to create user service: %v", err)
 	}
@@ -649,12 +975,11 @@ func setupUserHandler(t *testing.T) *handlers.UserHandler {
 	return uh
 }
 
+// setupServer returns an API server with in-memory stores and its routes set up
 func setupServer(t *testing.T) *server.APIServer {
-	testDB := testutils.TestDBSetup()
-	tx := testDB.Begin()
-	t.Cleanup(func() { tx.Rollback() })
+	t.Helper()
 
-	server, err := server.NewAPIServer(tx)
+	server, err := server.NewMemoryAPIServer(testutils.TestConfig())
 	if err != nil {
 		t.Fatalf("failed to init api server: %v", err)
 	}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"godiscauth/internal/services"
+	"godiscauth/pkg/apperrors"
+)
+
+type VerificationHandler struct {
+	VerificationService *services.VerificationService
+}
+
+func NewVerificationHandler(verificationService *services.VerificationService) (*VerificationHandler, error) {
+	if verificationService == nil {
+		return nil, apperrors.ErrVerificationServiceIsNil
+	}
+	return &VerificationHandler{VerificationService: verificationService}, nil
+}
+
+func (vh *VerificationHandler) VerifyEmail(c *gin.Context) {
+	var body struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	clientIP := c.ClientIP()
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad email verification request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := vh.VerificationService.VerifyEmail(body.Token); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Email verification failed")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Info().
+		Str("clientIP", clientIP).
+		Msg("Email verification success")
+	c.JSON(http.StatusOK, gin.H{"message": "email verified"})
+}
+
+func (vh *VerificationHandler) ResendVerification(c *gin.Context) {
+	var body struct {
+		Email string `json:"email" binding:"required"`
+	}
+
+	clientIP := c.ClientIP()
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Info().
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Bad verification resend request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := vh.VerificationService.ResendVerification(body.Email)
+	switch {
+	case errors.Is(err, apperrors.ErrVerificationThrottled):
+		log.Info().
+			Str("email", body.Email).
+			Str("clientIP", clientIP).
+			Msg("Verification resend throttled")
+	case err != nil && !errors.Is(err, apperrors.ErrEmailAlreadyVerified):
+		log.Error().
+			Str("email", body.Email).
+			Str("clientIP", clientIP).
+			Str("error", err.Error()).
+			Msg("Verification resend failed")
+	default:
+		log.Info().
+			Str("email", body.Email).
+			Str("clientIP", clientIP).
+			Msg("Verification resend requested")
+	}
+
+	// Throttled, already verified and unknown emails get the same response as a successful send, so
+	// the response doesn't tell whether an unverified account exists
+	c.JSON(http.StatusOK, gin.H{
+		"message": "if an unverified account exists for that email, a verification link has been sent",
+	})
+}
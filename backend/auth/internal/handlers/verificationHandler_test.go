@@ -0,0 +1,121 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/handlers"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+type VerifyEmailRequest struct {
+	Token string `json:"token,omitempty"`
+}
+
+// TestHandlers_NewVerificationHandler checks the NewVerificationHandler constructor
+func TestHandlers_NewVerificationHandler(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("err on nil verification service", func(t *testing.T) {
+		vh, err := handlers.NewVerificationHandler(nil)
+		is.Equal(vh, nil)
+		is.Equal(err, apperrors.ErrVerificationServiceIsNil)
+	})
+}
+
+// TestVerificationHandler_VerifyEmail checks the registration to verification flow over http
+func TestVerificationHandler_VerifyEmail(t *testing.T) {
+	is := is.New(t)
+
+	mailDir := t.TempDir()
+	t.Setenv(config.EnvMailer, "file")
+	t.Setenv(config.EnvMailDir, mailDir)
+	t.Setenv(config.EnvEmailVerification, "login")
+	server := setupServer(t)
+
+	email := "testVerificationHandler@test.com"
+
+	rr, err := makeRequest(
+		server.Router,
+		"POST",
+		"/register",
+		UserCredentialsRequest{Email: email, Password: testutils.TestingPassword},
+	)
+	is.NoErr(err)
+	is.Equal(rr.Code, http.StatusOK)
+
+	t.Run("login rejected before verification", func(t *testing.T) {
+		rr, err := makeRequest(
+			server.Router,
+			"POST",
+			"/login",
+			UserCredentialsRequest{Email: email, Password: testutils.TestingPassword},
+		)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusBadRequest)
+	})
+
+	t.Run("resend is throttled silently", func(t *testing.T) {
+		rr, err := makeRequest(
+			server.Router,
+			"POST",
+			"/verify-email/resend",
+			UserCredentialsRequest{Email: email},
+		)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+		is.Equal(len(readMailDir(t, mailDir)), 1)
+	})
+
+	t.Run("resend for unknown email looks like success", func(t *testing.T) {
+		rr, err := makeRequest(
+			server.Router,
+			"POST",
+			"/verify-email/resend",
+			UserCredentialsRequest{Email: "doesNotExist@test.com"},
+		)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		rr, err := makeRequest(server.Router, "POST", "/verify-email", VerifyEmailRequest{Token: "not.aToken"})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusBadRequest)
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		rr, err := makeRequest(server.Router, "POST", "/verify-email", VerifyEmailRequest{})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusBadRequest)
+	})
+
+	t.Run("verifies with mailed token", func(t *testing.T) {
+		mail := readMailDir(t, mailDir)
+		is.Equal(len(mail), 1)
+		token := testutils.ExtractVerificationToken(mail[0])
+		is.True(token != "")
+
+		rr, err := makeRequest(server.Router, "POST", "/verify-email", VerifyEmailRequest{Token: token})
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+
+		user, err := server.Repos.User.GetUserByEmail(email)
+		is.NoErr(err)
+		is.True(user.IsEmailVerified())
+
+		// Login now succeeds
+		rr, err = makeRequest(
+			server.Router,
+			"POST",
+			"/login",
+			UserCredentialsRequest{Email: email, Password: testutils.TestingPassword},
+		)
+		is.NoErr(err)
+		is.Equal(rr.Code, http.StatusOK)
+	})
+}
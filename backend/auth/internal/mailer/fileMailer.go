@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"godiscauth/pkg/apperrors"
+)
+
+// FileMailer writes each message as an `.eml` file to a directory instead of sending it, so
+// messages can be inspected or opened in a mail client during local development and testing
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// unsafeFileChars matches characters that are replaced when a recipient is used in a file name
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9@._-]`)
+
+// NewFileMailer returns a value for the FileMailer struct, creating the output directory if needed
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if dir == "" {
+		return nil, apperrors.ErrMailDirIsEmpty
+	}
+	if from == "" {
+		from = "noreply@localhost"
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileMailer{Dir: dir, From: from}, nil
+}
+
+// Send writes the message to a new file in the output directory
+func (m *FileMailer) Send(msg Message) error {
+	body, err := formatMessage(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	return os.WriteFile(filepath.Join(m.Dir, name), body, 0o600)
+}
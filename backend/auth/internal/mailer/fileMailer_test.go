@@ -0,0 +1,76 @@
+package mailer_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/mailer"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestFileMailer_NewFileMailer tests creation of FileMailer structs
+func TestFileMailer_NewFileMailer(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("fails on empty dir", func(t *testing.T) {
+		m, err := mailer.NewFileMailer("", "from@test.com")
+		is.Equal(m, nil)
+		is.Equal(err, apperrors.ErrMailDirIsEmpty)
+	})
+
+	t.Run("creates missing dir", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "mail")
+		m, err := mailer.NewFileMailer(dir, "from@test.com")
+		is.NoErr(err)
+		is.True(m != nil)
+
+		info, err := os.Stat(dir)
+		is.NoErr(err)
+		is.True(info.IsDir())
+	})
+}
+
+// TestFileMailer_Send tests that messages are written as files
+func TestFileMailer_Send(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("writes message", func(t *testing.T) {
+		dir := t.TempDir()
+		m, err := mailer.NewFileMailer(dir, "from@test.com")
+		is.NoErr(err)
+
+		err = m.Send(mailer.Message{
+			To:      "to@test.com",
+			Subject: "Test subject",
+			Body:    "line one\nline two",
+		})
+		is.NoErr(err)
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+		is.NoErr(err)
+		is.Equal(len(files), 1)
+
+		contents, err := os.ReadFile(files[0])
+		is.NoErr(err)
+		is.True(strings.Contains(string(contents), "From: from@test.com\r\n"))
+		is.True(strings.Contains(string(contents), "To: to@test.com\r\n"))
+		is.True(strings.Contains(string(contents), "Subject: Test subject\r\n"))
+		is.True(strings.HasSuffix(string(contents), "\r\n\r\nline one\r\nline two"))
+	})
+
+	t.Run("rejects header injection", func(t *testing.T) {
+		m, err := mailer.NewFileMailer(t.TempDir(), "from@test.com")
+		is.NoErr(err)
+
+		err = m.Send(mailer.Message{
+			To:      "to@test.com\r\nBcc: everyone@test.com",
+			Subject: "Test subject",
+			Body:    "Body",
+		})
+		is.Equal(err, apperrors.ErrInvalidMailHeader)
+	})
+}
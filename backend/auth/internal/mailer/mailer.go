@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email messages on behalf of the auth service
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// NewMailerFromConfig returns the mailer selected by `cfg.Mailer`. The log mailer is used when
+// nothing is selected, which sends nothing and logs messages with their tokens redacted.
+func NewMailerFromConfig(cfg config.MailConfig) (Mailer, error) {
+	switch kind := cfg.Mailer; kind {
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From)
+	case "file":
+		return NewFileMailer(cfg.Dir, cfg.From)
+	case "log", "":
+		return NewLogMailer(), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", apperrors.ErrUnknownMailer, kind)
+	}
+}
+
+// formatMessage renders a message as an RFC 5322 email with the headers needed by mail clients
+func formatMessage(from string, msg Message) ([]byte, error) {
+	for _, header := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, apperrors.ErrInvalidMailHeader
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,99 @@
+package mailer_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"godiscauth/internal/mailer"
+	"godiscauth/internal/models"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// TestMain sets up the test environment for all tests in the `mailer_test` package.
+func TestMain(m *testing.M) {
+	testutils.TestEnvSetup()
+	os.Exit(m.Run())
+}
+
+// TestMailer_NewMailerFromConfig tests mailer selection from the config
+func TestMailer_NewMailerFromConfig(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("defaults to log mailer", func(t *testing.T) {
+		m, err := mailer.NewMailerFromConfig(config.MailConfig{})
+		is.NoErr(err)
+		_, ok := m.(*mailer.LogMailer)
+		is.True(ok)
+	})
+
+	t.Run("file mailer", func(t *testing.T) {
+		m, err := mailer.NewMailerFromConfig(config.MailConfig{Mailer: "file", Dir: t.TempDir()})
+		is.NoErr(err)
+		_, ok := m.(*mailer.FileMailer)
+		is.True(ok)
+	})
+
+	t.Run("smtp mailer", func(t *testing.T) {
+		m, err := mailer.NewMailerFromConfig(config.MailConfig{
+			Mailer:   "smtp",
+			SMTPHost: "localhost",
+			From:     "noreply@test.com",
+		})
+		is.NoErr(err)
+		smtpMailer, ok := m.(*mailer.SMTPMailer)
+		is.True(ok)
+		is.Equal(smtpMailer.Port, "587")
+	})
+
+	t.Run("smtp mailer without host", func(t *testing.T) {
+		_, err := mailer.NewMailerFromConfig(config.MailConfig{Mailer: "smtp"})
+		is.Equal(err, apperrors.ErrSMTPHostIsEmpty)
+	})
+
+	t.Run("unknown mailer", func(t *testing.T) {
+		_, err := mailer.NewMailerFromConfig(config.MailConfig{Mailer: "carrierpigeon"})
+		is.True(errors.Is(err, apperrors.ErrUnknownMailer))
+	})
+}
+
+// TestMailer_LogMailer tests that the log mailer accepts messages and keeps their tokens out of
+// the log
+func TestMailer_LogMailer(t *testing.T) {
+	is := is.New(t)
+
+	var logged bytes.Buffer
+	previous, level := log.Logger, zerolog.GlobalLevel()
+	log.Logger = zerolog.New(&logged)
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	t.Cleanup(func() {
+		log.Logger = previous
+		zerolog.SetGlobalLevel(level)
+	})
+
+	resetToken, _, err := models.GenerateToken()
+	is.NoErr(err)
+	verificationToken, err := models.NewEmailVerificationToken(testutils.TestSessionKeys(), uuid.New(), "to@test.com", time.Now().Add(time.Hour))
+	is.NoErr(err)
+	body := "Follow this link:\n\nhttps://discussion.test/reset?token=" + resetToken +
+		"\n\nOr use this token:\n\n" + verificationToken + "\n"
+
+	m := mailer.NewLogMailer()
+	err = m.Send(mailer.Message{To: "to@test.com", Subject: "Subject", Body: body})
+	is.NoErr(err)
+	is.True(strings.Contains(logged.String(), "to@test.com"))
+	is.True(strings.Contains(logged.String(), "https://discussion.test/reset?token=[REDACTED]"))
+	is.True(!strings.Contains(logged.String(), resetToken))
+	is.True(!strings.Contains(logged.String(), verificationToken))
+	is.True(!strings.Contains(logged.String(), strings.Split(verificationToken, ".")[2]))
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+
+	"godiscauth/pkg/apperrors"
+)
+
+// defaultSMTPPort is the mail submission port used when no port is configured
+const defaultSMTPPort = "587"
+
+// SMTPMailer sends mail through an SMTP server. STARTTLS is used whenever the server offers it.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPMailer returns a value for the SMTPMailer struct
+func NewSMTPMailer(host, port, username, password, from string) (*SMTPMailer, error) {
+	if host == "" {
+		return nil, apperrors.ErrSMTPHostIsEmpty
+	}
+	if from == "" {
+		return nil, apperrors.ErrMailFromIsEmpty
+	}
+	if port == "" {
+		port = defaultSMTPPort
+	}
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+		From:     from,
+	}, nil
+}
+
+// Send delivers a message to the SMTP server
+func (m *SMTPMailer) Send(msg Message) error {
+	body, err := formatMessage(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	// Skip authentication for relays that don't need it, e.g. a local dev mail catcher
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{msg.To}, body)
+}
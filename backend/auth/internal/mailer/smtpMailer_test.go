@@ -0,0 +1,115 @@
+package mailer_test
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/mailer"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestSMTPMailer_NewSMTPMailer tests creation of SMTPMailer structs
+func TestSMTPMailer_NewSMTPMailer(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("fails on empty host", func(t *testing.T) {
+		m, err := mailer.NewSMTPMailer("", "25", "", "", "from@test.com")
+		is.Equal(m, nil)
+		is.Equal(err, apperrors.ErrSMTPHostIsEmpty)
+	})
+
+	t.Run("fails on empty sender", func(t *testing.T) {
+		m, err := mailer.NewSMTPMailer("localhost", "25", "", "", "")
+		is.Equal(m, nil)
+		is.Equal(err, apperrors.ErrMailFromIsEmpty)
+	})
+
+	t.Run("defaults port", func(t *testing.T) {
+		m, err := mailer.NewSMTPMailer("localhost", "", "", "", "from@test.com")
+		is.NoErr(err)
+		is.Equal(m.Port, "587")
+	})
+}
+
+// TestSMTPMailer_Send tests delivery to an SMTP server
+func TestSMTPMailer_Send(t *testing.T) {
+	is := is.New(t)
+
+	addr, received := startFakeSMTPServer(t)
+	host, port, err := net.SplitHostPort(addr)
+	is.NoErr(err)
+
+	m, err := mailer.NewSMTPMailer(host, port, "", "", "from@test.com")
+	is.NoErr(err)
+
+	err = m.Send(mailer.Message{To: "to@test.com", Subject: "Test subject", Body: "Hello"})
+	is.NoErr(err)
+
+	data := <-received
+	is.True(strings.Contains(data, "MAIL FROM:<from@test.com>"))
+	is.True(strings.Contains(data, "RCPT TO:<to@test.com>"))
+	is.True(strings.Contains(data, "Subject: Test subject"))
+	is.True(strings.Contains(data, "Hello"))
+}
+
+// startFakeSMTPServer accepts a single SMTP conversation and sends everything the client wrote
+// on the returned channel
+func startFakeSMTPServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var transcript strings.Builder
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			transcript.WriteString(line)
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+
+			switch {
+			case inData:
+				if cmd == "." {
+					inData = false
+					reply("250 OK")
+				}
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				inData = true
+				reply("354 End data with <CR><LF>.<CR><LF>")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				received <- transcript.String()
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+		received <- transcript.String()
+	}()
+
+	return ln.Addr().String(), received
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of all metrics
+const namespace = "godiscauth"
+
+// Outcomes of a login attempt, the `outcome` label of `Logins`
+const (
+	LoginSuccess = "success"
+	LoginInvalid = "invalid"
+	LoginLocked  = "locked"
+)
+
+var (
+	// Registry holds every metric served by `Handler`, including the Go runtime and process ones
+	Registry = prometheus.NewRegistry()
+
+	// HTTPRequests counts the requests handled by method, route and status code
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+	// HTTPRequestDuration times the requests handled by method and route
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// Logins counts login attempts by outcome. Every login that creates a session is a success,
+	// whatever its factors; a correct password that still needs a second factor isn't counted yet.
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts, by outcome: success, invalid or locked.",
+	}, []string{"outcome"})
+	// Registrations counts the users registered
+	Registrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Users registered.",
+	})
+	// SessionRotations counts the sessions `RequireAuth` replaced with a new token
+	SessionRotations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "session_rotations_total",
+		Help:      "Sessions rotated to a new token while in use.",
+	})
+	// ActiveSessions is the number of unexpired sessions of all users. Counting them can be
+	// expensive, so it is set by the session reaper after each run rather than at every scrape.
+	ActiveSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_sessions",
+		Help:      "Sessions that haven't expired, of all users, as of the last session reaper run.",
+	})
+	// Lockouts counts the accounts locked after too many failed logins
+	Lockouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lockouts_total",
+		Help:      "Accounts locked after too many failed logins.",
+	})
+
+	// DBQueryDuration times the statements run through GORM by operation and table, see
+	// `GormPlugin`
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by database statements, by operation and table.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"operation", "table"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		Logins,
+		Registrations,
+		SessionRotations,
+		ActiveSessions,
+		Lockouts,
+		DBQueryDuration,
+	)
+}
+
+// Handler serves the metrics in `Registry` to Prometheus. A metric that can't be collected is left
+// out and the others are still served.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+}
@@ -0,0 +1,118 @@
+package metrics_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"godiscauth/internal/metrics"
+	"godiscauth/internal/models"
+	"godiscauth/internal/testutils"
+)
+
+func TestMain(m *testing.M) {
+	testutils.TestEnvSetup()
+
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	os.Exit(m.Run())
+}
+
+// scrape returns the metrics served by `metrics.Handler`
+func scrape(t *testing.T) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("scrape failed with %d: %s", rr.Code, rr.Body.String())
+	}
+	return rr.Body.String()
+}
+
+// TestMetrics_Middleware tests that requests are counted by route pattern and status
+func TestMetrics_Middleware(t *testing.T) {
+	is := is.New(t)
+
+	router := gin.New()
+	router.Use(metrics.Middleware())
+	router.GET("/sessions/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	requests := func(method, route, status string) float64 {
+		return testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(method, route, status))
+	}
+	matched := requests("GET", "/sessions/:id", "204")
+	unmatched := requests("GET", "unmatched", "404")
+	other := requests("OTHER", "unmatched", "404")
+
+	for _, r := range []struct{ method, path string }{
+		{"GET", "/sessions/" + uuid.NewString()},
+		{"GET", "/sessions/" + uuid.NewString()},
+		{"GET", "/wp-login.php"},
+		{"BREW", "/coffee"},
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(r.method, r.path, nil))
+	}
+
+	is.Equal(requests("GET", "/sessions/:id", "204"), matched+2)
+	is.Equal(requests("GET", "unmatched", "404"), unmatched+1)
+	is.Equal(requests("OTHER", "unmatched", "404"), other+1)
+	is.True(strings.Contains(scrape(t), `godiscauth_http_request_duration_seconds_count{method="GET",route="/sessions/:id"}`))
+}
+
+// TestMetrics_ActiveSessions tests that the active sessions are served as last set, without
+// counting them at the scrape
+func TestMetrics_ActiveSessions(t *testing.T) {
+	is := is.New(t)
+	t.Cleanup(func() { metrics.ActiveSessions.Set(0) })
+
+	metrics.ActiveSessions.Set(2)
+	is.True(strings.Contains(scrape(t), "godiscauth_active_sessions 2"))
+}
+
+// TestMetrics_GormPlugin tests that statements are timed by operation and table, without running
+// them against a database
+func TestMetrics_GormPlugin(t *testing.T) {
+	is := is.New(t)
+
+	db, err := gorm.Open(postgres.Open(testutils.TestConfig().Database.URL), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	is.NoErr(err)
+	is.NoErr(db.Use(metrics.GormPlugin{}))
+
+	queries := func(operation, table string) uint64 {
+		var count uint64
+		for _, line := range strings.Split(scrape(t), "\n") {
+			if strings.HasPrefix(line, `godiscauth_db_query_duration_seconds_count{operation="`+operation+`",table="`+table+`"}`) {
+				_, err := fmt.Sscan(line[strings.LastIndex(line, " ")+1:], &count)
+				is.NoErr(err)
+			}
+		}
+		return count
+	}
+	before := queries("query", "users")
+	var users []models.User
+	is.NoErr(db.Where("email = ?", "testMetricsGormPlugin@test.com").Find(&users).Error)
+	is.NoErr(db.Where("email = ?", "testMetricsGormPlugin@test.com").Find(&users).Error)
+	is.Equal(queries("query", "users"), before+2)
+
+	before = queries("delete", "sessions")
+	is.NoErr(db.Where("expires_at < ?", time.Now()).Delete(&models.Session{}).Error)
+	is.Equal(queries("delete", "sessions"), before+1)
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute is the `route` label of requests that match no route
+const unmatchedRoute = "unmatched"
+
+// knownMethods are the methods used as the `method` label as they are; any other is `OTHER`
+var knownMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// Middleware counts and times the requests of a gin router by their route pattern, e.g.
+// `/sessions/:id`, rather than their path. Requests that match no route are all counted as
+// `unmatched`, so scanning for paths can't create a series per path.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+		if !slices.Contains(knownMethods, method) {
+			method = "OTHER"
+		}
+		HTTPRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		HTTPRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
@@ -2,27 +2,38 @@ package middleware
 
 import (
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 
+	"godiscauth/internal/metrics"
 	"godiscauth/internal/models"
 	"godiscauth/internal/repository"
 	"godiscauth/internal/services"
 	"godiscauth/pkg/apperrors"
 	"godiscauth/pkg/config"
+	"godiscauth/pkg/keyring"
 )
 
 type AuthMiddleware struct {
-	UserRepo    *repository.UserRepository
-	SessionRepo *repository.SessionRepository
+	UserRepo    repository.UserStore
+	SessionRepo repository.SessionStore
+	// SessionKeys verify session tokens
+	SessionKeys *keyring.KeyRing
+	// SessionPolicies decide how long sessions last
+	SessionPolicies models.SessionPolicies
+	// UserService rotates sessions
+	UserService *services.UserService
+	// VerificationPolicy decides whether unverified accounts can use protected routes
+	VerificationPolicy services.VerificationPolicy
+	// LastSeenInterval is the minimum time between recording that a session is in use
+	LastSeenInterval time.Duration
 }
 
-func NewAuthMiddleware(db *gorm.DB) (*AuthMiddleware, error) {
+func NewAuthMiddleware(db *gorm.DB, keys *keyring.KeyRing, cfg *config.Config) (*AuthMiddleware, error) {
 	if db == nil {
 		return nil, apperrors.ErrDatabaseIsNil
 	}
@@ -34,83 +45,122 @@ func NewAuthMiddleware(db *gorm.DB) (*AuthMiddleware, error) {
 	if err != nil {
 		return nil, err
 	}
+	return NewAuthMiddlewareFromStores(ur, sr, keys, cfg)
+}
+
+// NewAuthMiddlewareFromStores returns an AuthMiddleware that checks sessions in the given stores
+// with keys, under the session and email verification policies of cfg
+func NewAuthMiddlewareFromStores(
+	ur repository.UserStore,
+	sr repository.SessionStore,
+	keys *keyring.KeyRing,
+	cfg *config.Config,
+) (*AuthMiddleware, error) {
+	us, err := services.NewUserService(ur, sr, keys, cfg)
+	if err != nil {
+		return nil, err
+	}
 	return &AuthMiddleware{
-		UserRepo:    ur,
-		SessionRepo: sr,
+		UserRepo:           ur,
+		SessionRepo:        sr,
+		SessionKeys:        keys,
+		SessionPolicies:    us.SessionPolicies,
+		UserService:        us,
+		VerificationPolicy: us.VerificationPolicy,
+		LastSeenInterval:   cfg.Sessions.LastSeenInterval,
 	}, nil
 }
 
 // RequireAuth is a middleware used to authorize users with session tokens from
-// the cookie, checking if the session in the database matching the token is
-// valid and not expired. The session is rotated if it is halfway expired.
+// the cookie or an `Authorization: Bearer` header, checking if the session in the
+// database matching the token is valid and has neither been idle for too long nor
+// outlived its maximum lifetime. Using a session pushes back its idle timeout. The
+// session is rotated if it is halfway expired or was created before session secrets
+// were hashed; bearer clients receive the new token in the `config.SessionTokenHeader`
+// response header instead of a cookie.
+// Unverified accounts are rejected if the verification policy is "protected". Whether the
+// session was created with a second factor is set as "mfa" in the context, and the ID of the
+// session, after any rotation, as "sessionID".
 func (am *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get cookie from request
-		sessionToken, err := c.Cookie(config.SessionCookieName)
+		// Get token from the request
+		sessionToken, bearer, err := SessionToken(c)
 		if err != nil {
-			log.Debug().Err(err).Msg("No auth cookie found")
+			log.Debug().Err(err).Msg("No session token found")
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 
-		// Split the session token
-		parts := strings.Split(sessionToken, ".")
-		if len(parts) != 2 {
-			log.Debug().Msg("Invalid token format")
-			c.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
-		sessionID, signature := parts[0], parts[1]
-		parsedID, err := uuid.Parse(sessionID)
+		// Verify the token format and HMAC signature
+		tokenHash, err := models.ParseSessionToken(am.SessionKeys, sessionToken)
 		if err != nil {
-			log.Debug().Msg("Invalid token format")
-			c.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
-
-		// Verify the HMAC signature
-		if !models.ValidateSessionID(parsedID, signature) {
-			log.Debug().Msg("Invalid token signature")
+			log.Debug().Err(err).Msg("Invalid session token")
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 
-		// Get session from database
-		session, err := am.SessionRepo.GetUnexpiredSessionByID(parsedID)
+		// Get session from database by the hash of the token's secret
+		session, err := am.SessionRepo.GetUnexpiredSessionByTokenHash(tokenHash)
 		if err != nil {
 			log.Debug().Err(err).Msg("Session not found")
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 
-		// Check if session is expired
-		if time.Now().UTC().After(session.ExpiresAt) {
+		// Check if session is expired, idle or past its maximum lifetime
+		if session.IsExpired(am.SessionPolicies, time.Now().UTC()) {
 			log.Debug().Msg("Session expired")
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 
-		c.Set("userID", session.UserID.String())
-
-		// Rotate session if halfway expired
-		halfway := session.CreatedAt.Add(session.ExpiresAt.Sub(session.CreatedAt) / 2)
-		if time.Now().After(halfway) {
-			userService, err := services.NewUserService(am.UserRepo, am.SessionRepo)
+		// Check email verification if the policy requires it on protected routes
+		if am.VerificationPolicy == services.VerificationPolicyProtected {
+			user, err := am.UserRepo.GetUserByID(session.UserID.String())
 			if err != nil {
-				log.Debug().Err(err).Msg("Failed to rotate session")
+				log.Debug().Err(err).Msg("User not found")
 				c.AbortWithStatus(http.StatusUnauthorized)
 				return
 			}
+			if !user.IsEmailVerified() {
+				log.Debug().Msg("Email not verified")
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": apperrors.ErrEmailNotVerified.Error()})
+				return
+			}
+		}
 
+		c.Set("userID", session.UserID.String())
+		c.Set("mfa", session.MFA)
+		c.Set("sessionID", session.ID.String())
+
+		// Record that the session is in use, at most every `LastSeenInterval`, restarting its idle
+		// timeout
+		now := time.Now()
+		clientIP := c.ClientIP()
+		if now.Sub(session.LastSeenAt) >= am.LastSeenInterval || session.ClientIP != clientIP {
+			expiresAt := session.Policy(am.SessionPolicies).ExpiresAt(session.AuthenticatedAt, now)
+			if err := am.SessionRepo.TouchSession(session.ID, clientIP, now, expiresAt); err != nil {
+				log.Error().Err(err).Msg("Failed to update session last seen time")
+			}
+		}
+
+		// Rotate session if halfway expired, or right away if its token predates hashed secrets
+		halfway := session.CreatedAt.Add(session.ExpiresAt.Sub(session.CreatedAt) / 2)
+		if now.After(halfway) || session.HasLegacyToken() {
 			// Rotate session
-			newSessionToken, err := userService.RotateSession(parsedID)
+			newSessionToken, newSessionID, err := am.UserService.RotateSession(session.ID)
 			if err != nil {
 				log.Debug().Err(err).Msg("Failed to rotate session")
 				c.AbortWithStatus(http.StatusUnauthorized)
 				return
+			}
+			metrics.SessionRotations.Inc()
+			c.Set("sessionID", newSessionID.String())
+			if bearer {
+				c.Header(config.SessionTokenHeader, newSessionToken)
+				c.Header(config.SessionMaxAgeHeader, strconv.Itoa(session.CookieMaxAge(am.SessionPolicies, now)))
 			} else {
-				c.SetSameSite(http.SameSiteStrictMode)
-				c.SetCookie(config.SessionCookieName, newSessionToken, int(config.SessionExpiration), "", "", true, true)
+				SetSessionCookie(c, newSessionToken, session.CookieMaxAge(am.SessionPolicies, now))
 			}
 		}
 
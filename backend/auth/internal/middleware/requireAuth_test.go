@@ -1,19 +1,25 @@
 package middleware_test
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
-	"strings"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/matryer/is"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
+	"godiscauth/internal/metrics"
 	"godiscauth/internal/middleware"
 	"godiscauth/internal/models"
 	"godiscauth/internal/repository"
+	"godiscauth/internal/services"
 	"godiscauth/internal/testutils"
 	"godiscauth/pkg/config"
 )
@@ -21,12 +27,12 @@ import (
 func TestMiddlewareAuth_RequireAuth(t *testing.T) {
 	is := is.New(t)
 
-	testDB := testutils.TestDBSetup()
+	testDB := testutils.TestDBSetup(t)
 	tx := testDB.Begin()
 	defer tx.Rollback()
 
 	// Setup repositories and middleware
-	authMw, err := middleware.NewAuthMiddleware(tx)
+	authMw, err := middleware.NewAuthMiddleware(tx, testutils.TestSessionKeys(), testutils.TestConfig())
 	is.NoErr(err)
 	sessionRepo, err := repository.NewSessionRepository(tx) // Required for session management
 	is.NoErr(err)
@@ -43,20 +49,19 @@ func TestMiddlewareAuth_RequireAuth(t *testing.T) {
 
 	// Register a test user
 	email := "TestMiddlewareAuth_RequireAuth@test.com"
-	user, err := models.NewUser(email, testutils.TestingPassword)
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
 	is.NoErr(err)
 	err = tx.Create(user).Error
 	is.NoErr(err)
 
 	// Generate a test token
-	sessionID, signature, err := models.GenerateSessionID()
+	sessionToken, tokenHash, err := models.GenerateSessionToken(testutils.TestSessionKeys())
 	is.NoErr(err)
-	sessionToken := sessionID.String() + "." + signature
 
 	// Create a session record for this token
 	session, err := models.NewSession(
 		user.ID,
-		sessionID,
+		tokenHash,
 		time.Now().Add(time.Hour*24),
 	)
 	is.NoErr(err)
@@ -96,14 +101,13 @@ func TestMiddlewareAuth_RequireAuth(t *testing.T) {
 
 	t.Run("with expired token in db", func(t *testing.T) {
 		// Generate new session token with same claims
-		sessionID, signature, err := models.GenerateSessionID()
+		expiredSessionToken, tokenHash, err := models.GenerateSessionToken(testutils.TestSessionKeys())
 		is.NoErr(err)
-		expiredSessionToken := sessionID.String() + "." + signature
 
 		// Create a session with an expired token
 		expiredSession, err := models.NewSession(
 			user.ID,
-			sessionID,
+			tokenHash,
 			time.Now().Add(-1*time.Hour),
 		)
 		is.NoErr(err)
@@ -124,17 +128,43 @@ func TestMiddlewareAuth_RequireAuth(t *testing.T) {
 		// Request should be unauthorized with an expired token
 		is.Equal(http.StatusUnauthorized, rr.Code)
 	})
+
+	// Sessions also expire when unused for longer than their idle timeout, or when their maximum
+	// lifetime since logging in is up, even if they were used recently
+	idle := config.Default().Sessions.IdleTimeout
+	lifetime := config.Default().Sessions.MaxLifetime
+	for name, times := range map[string][2]time.Duration{
+		"with idle session":                  {idle + time.Minute, idle + time.Minute},
+		"with session past maximum lifetime": {lifetime + time.Minute, time.Minute},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sessionToken, tokenHash, err := models.GenerateSessionToken(testutils.TestSessionKeys())
+			is.NoErr(err)
+			session, err := models.NewSession(user.ID, tokenHash, time.Now().Add(time.Hour*24))
+			is.NoErr(err)
+			session.AuthenticatedAt = time.Now().Add(-times[0])
+			session.LastSeenAt = time.Now().Add(-times[1])
+			err = sessionRepo.CreateSession(session)
+			is.NoErr(err)
+
+			req, _ := http.NewRequest("GET", "/protected", nil)
+			req.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: sessionToken})
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			is.Equal(http.StatusUnauthorized, rr.Code)
+		})
+	}
 }
 
 // TestMiddlewareAuth_RequireAuth_SessionRotation tests the session rotation functionality
 func TestMiddlewareAuth_RequireAuth_SessionRotation(t *testing.T) {
 	is := is.New(t)
-	testDB := testutils.TestDBSetup()
+	testDB := testutils.TestDBSetup(t)
 	tx := testDB.Begin()
 	defer tx.Rollback()
 
 	// Setup repositories and middleware
-	authMw, err := middleware.NewAuthMiddleware(tx)
+	authMw, err := middleware.NewAuthMiddleware(tx, testutils.TestSessionKeys(), testutils.TestConfig())
 	is.NoErr(err)
 	sessionRepo, err := repository.NewSessionRepository(tx)
 	is.NoErr(err)
@@ -150,24 +180,24 @@ func TestMiddlewareAuth_RequireAuth_SessionRotation(t *testing.T) {
 
 	// Register a test user
 	email := "TestMiddlewareAuth_RequireAuth_SessionRotation@test.com"
-	user, err := models.NewUser(email, testutils.TestingPassword)
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
 	is.NoErr(err)
 	err = tx.Create(user).Error
 	is.NoErr(err)
 
 	// Generate a test token
-	oldSessionID, signature, err := models.GenerateSessionID()
+	sessionToken, tokenHash, err := models.GenerateSessionToken(testutils.TestSessionKeys())
 	is.NoErr(err)
-	sessionToken := oldSessionID.String() + "." + signature
 
 	// Create a session record for this token
 	expiresAt := time.Now().UTC().Add(10 * time.Minute)
 	session, err := models.NewSession(
 		user.ID,
-		oldSessionID,
+		tokenHash,
 		expiresAt,
 	)
 	is.NoErr(err)
+	oldSessionID := session.ID
 
 	// Set the created_at timestamp to 6 minutes ago to simulate a halfway expired session
 	session.CreatedAt = time.Now().Add(-6 * time.Minute)
@@ -211,12 +241,8 @@ func TestMiddlewareAuth_RequireAuth_SessionRotation(t *testing.T) {
 		is.True(newTokenFromCookie != "")
 
 		// New Session Token is valid
-		parts := strings.Split(newTokenFromCookie, ".")
-		is.True(len(parts) == 2)
-		newSessionID, newSignature := parts[0], parts[1]
-		parsedID, err := uuid.Parse(newSessionID)
+		newTokenHash, err := models.ParseSessionToken(testutils.TestSessionKeys(), newTokenFromCookie)
 		is.NoErr(err)
-		is.True(models.ValidateSessionID(parsedID, newSignature))
 
 		// Check that the new token is different from the old one
 		is.True(newTokenFromCookie != "")
@@ -227,7 +253,7 @@ func TestMiddlewareAuth_RequireAuth_SessionRotation(t *testing.T) {
 		is.True(err != nil)
 
 		// Check that the new, rotated session is created
-		newSession, err := sessionRepo.GetUnexpiredSessionByID(parsedID)
+		newSession, err := sessionRepo.GetUnexpiredSessionByTokenHash(newTokenHash)
 		is.NoErr(err)
 		is.Equal(user.ID, newSession.UserID)
 
@@ -240,3 +266,464 @@ func TestMiddlewareAuth_RequireAuth_SessionRotation(t *testing.T) {
 		is.True(newSession.ID != oldSessionID)
 	})
 }
+
+// TestMiddlewareAuth_RequireAuth_VerificationPolicy tests that unverified accounts are rejected on
+// protected routes when the policy requires it
+func TestMiddlewareAuth_RequireAuth_VerificationPolicy(t *testing.T) {
+	is := is.New(t)
+	testDB := testutils.TestDBSetup(t)
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	authMw, err := middleware.NewAuthMiddleware(tx, testutils.TestSessionKeys(), testutils.TestConfig())
+	is.NoErr(err)
+	authMw.VerificationPolicy = services.VerificationPolicyProtected
+	sessionRepo, err := repository.NewSessionRepository(tx)
+	is.NoErr(err)
+
+	router := gin.New()
+	router.GET("/protected", authMw.RequireAuth(), func(c *gin.Context) {
+		c.String(http.StatusOK, "test handler called")
+	})
+
+	// Register a test user with a session
+	email := "TestMiddlewareAuth_RequireAuth_VerificationPolicy@test.com"
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
+	is.NoErr(err)
+	err = tx.Create(user).Error
+	is.NoErr(err)
+
+	sessionToken, tokenHash, err := models.GenerateSessionToken(testutils.TestSessionKeys())
+	is.NoErr(err)
+	session, err := models.NewSession(user.ID, tokenHash, time.Now().Add(time.Hour*24))
+	is.NoErr(err)
+	err = sessionRepo.CreateSession(session)
+	is.NoErr(err)
+
+	makeProtectedRequest := func() *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/protected", nil)
+		is.NoErr(err)
+		req.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: sessionToken})
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("rejects unverified account", func(t *testing.T) {
+		rr := makeProtectedRequest()
+		is.Equal(http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("allows verified account", func(t *testing.T) {
+		err := authMw.UserRepo.MarkEmailVerified(user.ID.String(), email, time.Now())
+		is.NoErr(err)
+
+		rr := makeProtectedRequest()
+		is.Equal(http.StatusOK, rr.Code)
+	})
+}
+
+// TestMiddlewareAuth_RequireAuth_Bearer tests authorizing with an `Authorization: Bearer` header
+// and returning rotated tokens in a response header
+func TestMiddlewareAuth_RequireAuth_Bearer(t *testing.T) {
+	is := is.New(t)
+	testDB := testutils.TestDBSetup(t)
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	authMw, err := middleware.NewAuthMiddleware(tx, testutils.TestSessionKeys(), testutils.TestConfig())
+	is.NoErr(err)
+	sessionRepo, err := repository.NewSessionRepository(tx)
+	is.NoErr(err)
+
+	router := gin.New()
+	router.GET("/protected", authMw.RequireAuth(), func(c *gin.Context) {
+		c.String(http.StatusOK, "test handler called")
+	})
+
+	email := "TestMiddlewareAuth_RequireAuth_Bearer@test.com"
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
+	is.NoErr(err)
+	err = tx.Create(user).Error
+	is.NoErr(err)
+
+	// createSessionToken stores a session created `age` ago that expires in `ttl`
+	createSessionToken := func(age, ttl time.Duration) string {
+		sessionToken, tokenHash, err := models.GenerateSessionToken(testutils.TestSessionKeys())
+		is.NoErr(err)
+		session, err := models.NewSession(user.ID, tokenHash, time.Now().UTC().Add(ttl))
+		is.NoErr(err)
+		session.CreatedAt = time.Now().Add(-age)
+		err = sessionRepo.CreateSession(session)
+		is.NoErr(err)
+		return sessionToken
+	}
+
+	makeProtectedRequest := func(authorization string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/protected", nil)
+		is.NoErr(err)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("with valid bearer token", func(t *testing.T) {
+		rr := makeProtectedRequest("Bearer "+createSessionToken(0, time.Hour*24), nil)
+		is.Equal(http.StatusOK, rr.Code)
+		is.Equal(rr.Header().Get(config.SessionTokenHeader), "")
+	})
+
+	t.Run("with invalid bearer token", func(t *testing.T) {
+		rr := makeProtectedRequest("Bearer "+uuid.NewString()+".invalidsignature", nil)
+		is.Equal(http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("with other authorization scheme", func(t *testing.T) {
+		rr := makeProtectedRequest("Basic dXNlcjpwYXNz", nil)
+		is.Equal(http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("bearer token takes precedence over cookie", func(t *testing.T) {
+		cookie := &http.Cookie{Name: config.SessionCookieName, Value: createSessionToken(0, time.Hour*24)}
+		rr := makeProtectedRequest("Bearer invalid", cookie)
+		is.Equal(http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("rotates halfway expired session into header", func(t *testing.T) {
+		sessionToken := createSessionToken(6*time.Minute, 4*time.Minute)
+		rr := makeProtectedRequest("Bearer "+sessionToken, nil)
+		is.Equal(http.StatusOK, rr.Code)
+
+		// No cookie for bearer clients
+		for _, cookie := range rr.Result().Cookies() {
+			is.True(cookie.Name != config.SessionCookieName)
+		}
+
+		newSessionToken := rr.Header().Get(config.SessionTokenHeader)
+		is.True(newSessionToken != "")
+		is.True(newSessionToken != sessionToken)
+		// The session isn't remembered, so a cookie carrying it would end with the browser session
+		is.Equal(rr.Header().Get(config.SessionMaxAgeHeader), "0")
+
+		// The rotated token works and the old one doesn't
+		rr = makeProtectedRequest("Bearer "+newSessionToken, nil)
+		is.Equal(http.StatusOK, rr.Code)
+		rr = makeProtectedRequest("Bearer "+sessionToken, nil)
+		is.Equal(http.StatusUnauthorized, rr.Code)
+	})
+}
+
+// TestMiddlewareAuth_RequireAuth_LegacySession tests that sessions from before secrets were hashed,
+// migrated with the hash of their ID, keep working and are rotated on first use
+func TestMiddlewareAuth_RequireAuth_LegacySession(t *testing.T) {
+	is := is.New(t)
+	testDB := testutils.TestDBSetup(t)
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	authMw, err := middleware.NewAuthMiddleware(tx, testutils.TestSessionKeys(), testutils.TestConfig())
+	is.NoErr(err)
+	sessionRepo, err := repository.NewSessionRepository(tx)
+	is.NoErr(err)
+
+	router := gin.New()
+	router.GET("/protected", authMw.RequireAuth(), func(c *gin.Context) {
+		c.String(http.StatusOK, "test handler called")
+	})
+
+	email := "TestMiddlewareAuth_RequireAuth_LegacySession@test.com"
+	user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
+	is.NoErr(err)
+	err = tx.Create(user).Error
+	is.NoErr(err)
+
+	// A migrated session and its old `sessionID.mac` cookie
+	sessionID := uuid.New()
+	session, err := models.NewSession(user.ID, models.HashSessionSecret(sessionID.String()), time.Now().Add(time.Hour*24))
+	is.NoErr(err)
+	session.ID = sessionID
+	is.True(session.HasLegacyToken())
+	err = sessionRepo.CreateSession(session)
+	is.NoErr(err)
+	mac := hmac.New(sha256.New, []byte(os.Getenv(config.SessionKey)))
+	mac.Write([]byte(sessionID.String()))
+	legacyToken := sessionID.String() + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	makeProtectedRequest := func(sessionToken string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/protected", nil)
+		is.NoErr(err)
+		req.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: sessionToken})
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := makeProtectedRequest(legacyToken)
+	is.Equal(http.StatusOK, rr.Code)
+
+	// The session is rotated right away although it is new
+	var newSessionToken string
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == config.SessionCookieName {
+			newSessionToken = cookie.Value
+		}
+	}
+	is.True(newSessionToken != "")
+	newTokenHash, err := models.ParseSessionToken(testutils.TestSessionKeys(), newSessionToken)
+	is.NoErr(err)
+	newSession, err := sessionRepo.GetUnexpiredSessionByTokenHash(newTokenHash)
+	is.NoErr(err)
+	is.True(!newSession.HasLegacyToken())
+
+	is.Equal(makeProtectedRequest(legacyToken).Code, http.StatusUnauthorized)
+	is.Equal(makeProtectedRequest(newSessionToken).Code, http.StatusOK)
+}
+
+// TestMiddlewareAuth_RequireAuth_SessionCache tests that sessions ended through the services sharing
+// the middleware's cache are rejected right away
+func TestMiddlewareAuth_RequireAuth_SessionCache(t *testing.T) {
+	is := is.New(t)
+	testDB := testutils.TestDBSetup(t)
+
+	for _, tc := range []struct {
+		name   string
+		logout func(us *services.UserService, token string, userID uuid.UUID) error
+	}{
+		{
+			name: "logout",
+			logout: func(us *services.UserService, token string, _ uuid.UUID) error {
+				return us.Logout(token)
+			},
+		},
+		{
+			name: "logout everywhere",
+			logout: func(us *services.UserService, _ string, userID uuid.UUID) error {
+				return us.LogoutEverywhere(userID.String())
+			},
+		},
+		{
+			name: "account deletion",
+			logout: func(us *services.UserService, _ string, userID uuid.UUID) error {
+				return us.PermanentlyDeleteUser(userID.String())
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tx := testDB.Begin()
+			defer tx.Rollback()
+
+			authMw, err := middleware.NewAuthMiddleware(tx, testutils.TestSessionKeys(), testutils.TestConfig())
+			is.NoErr(err)
+			sessionRepo, err := repository.NewSessionRepository(tx)
+			is.NoErr(err)
+			sessionRepo.Cache = repository.NewSessionCache(time.Minute, 100)
+			authMw.SessionRepo = sessionRepo
+			userService, err := services.NewUserService(authMw.UserRepo, sessionRepo, testutils.TestSessionKeys(), testutils.TestConfig())
+			is.NoErr(err)
+			authMw.UserService = userService
+
+			router := gin.New()
+			router.GET("/protected", authMw.RequireAuth(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			user, err := models.NewUser("TestMiddlewareAuth_RequireAuth_SessionCache@test.com", testutils.TestingPassword, testutils.TestingMinEntropyBits)
+			is.NoErr(err)
+			is.NoErr(tx.Create(user).Error)
+			sessionToken, tokenHash, err := models.GenerateSessionToken(testutils.TestSessionKeys())
+			is.NoErr(err)
+			session, err := models.NewSession(user.ID, tokenHash, time.Now().Add(time.Hour))
+			is.NoErr(err)
+			is.NoErr(sessionRepo.CreateSession(session))
+
+			request := func() int {
+				req, err := http.NewRequest("GET", "/protected", nil)
+				is.NoErr(err)
+				req.Header.Set("Authorization", "Bearer "+sessionToken)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+				return rr.Code
+			}
+
+			is.Equal(request(), http.StatusOK)
+			is.Equal(sessionRepo.Cache.Len(), 1)
+
+			is.NoErr(tc.logout(userService, sessionToken, user.ID))
+			is.Equal(request(), http.StatusUnauthorized)
+		})
+	}
+}
+
+// TestMiddlewareAuth_RequireAuth_MemoryStores tests authenticating with in-memory stores, which
+// needs no database
+func TestMiddlewareAuth_RequireAuth_MemoryStores(t *testing.T) {
+	is := is.New(t)
+
+	userStore := repository.NewMemoryUserStore()
+	sessionStore := repository.NewMemorySessionStore()
+	authMw, err := middleware.NewAuthMiddlewareFromStores(userStore, sessionStore, testutils.TestSessionKeys(), testutils.TestConfig())
+	is.NoErr(err)
+	userService := authMw.UserService
+
+	router := gin.New()
+	router.GET("/protected", authMw.RequireAuth(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("userID"))
+	})
+
+	email := "TestMiddlewareAuth_RequireAuth_MemoryStores@test.com"
+	is.NoErr(userService.RegisterUser(email, testutils.TestingPassword))
+	user, err := userStore.GetUserByEmail(email)
+	is.NoErr(err)
+	result, err := userService.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+	is.NoErr(err)
+
+	request := func() *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/protected", nil)
+		is.NoErr(err)
+		req.Header.Set("Authorization", "Bearer "+result.SessionToken)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := request()
+	is.Equal(rr.Code, http.StatusOK)
+	is.Equal(rr.Body.String(), user.ID.String())
+
+	is.NoErr(userService.PermanentlyDeleteUser(user.ID.String()))
+	is.Equal(request().Code, http.StatusUnauthorized)
+}
+
+// TestMiddlewareAuth_RequireAuth_CountsRotations tests that rotated sessions are counted in the
+// metrics
+func TestMiddlewareAuth_RequireAuth_CountsRotations(t *testing.T) {
+	is := is.New(t)
+
+	userStore := repository.NewMemoryUserStore()
+	sessionStore := repository.NewMemorySessionStore()
+	authMw, err := middleware.NewAuthMiddlewareFromStores(userStore, sessionStore, testutils.TestSessionKeys(), testutils.TestConfig())
+	is.NoErr(err)
+	userService := authMw.UserService
+	router := gin.New()
+	router.GET("/protected", authMw.RequireAuth(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	email := "TestMiddlewareAuth_RequireAuth_CountsRotations@test.com"
+	is.NoErr(userService.RegisterUser(email, testutils.TestingPassword))
+	result, err := userService.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+	is.NoErr(err)
+	request := func(token string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/protected", nil)
+		is.NoErr(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rotations := testutil.ToFloat64(metrics.SessionRotations)
+	rr := request(result.SessionToken)
+	is.Equal(rr.Code, http.StatusOK)
+	is.Equal(rr.Header().Get(config.SessionTokenHeader), "")
+	is.Equal(testutil.ToFloat64(metrics.SessionRotations), rotations)
+
+	// A session past halfway to expiring
+	user, err := userStore.GetUserByEmail(email)
+	is.NoErr(err)
+	token, tokenHash, err := models.GenerateSessionToken(testutils.TestSessionKeys())
+	is.NoErr(err)
+	session, err := models.NewSession(user.ID, tokenHash, time.Now().Add(time.Hour))
+	is.NoErr(err)
+	session.CreatedAt = time.Now().Add(-time.Hour)
+	is.NoErr(sessionStore.CreateSession(session))
+
+	rr = request(token)
+	is.Equal(rr.Code, http.StatusOK)
+	is.True(rr.Header().Get(config.SessionTokenHeader) != "")
+	is.Equal(testutil.ToFloat64(metrics.SessionRotations), rotations+1)
+
+	// Sessions rotated through the cookie keep the SameSite mode of the login cookie
+	token, tokenHash, err = models.GenerateSessionToken(testutils.TestSessionKeys())
+	is.NoErr(err)
+	session, err = models.NewSession(user.ID, tokenHash, time.Now().Add(time.Hour))
+	is.NoErr(err)
+	session.CreatedAt = time.Now().Add(-time.Hour)
+	is.NoErr(sessionStore.CreateSession(session))
+
+	req, err := http.NewRequest("GET", "/protected", nil)
+	is.NoErr(err)
+	req.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: token})
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusOK)
+	cookies := rr.Result().Cookies()
+	is.Equal(len(cookies), 1)
+	is.True(cookies[0].Value != token)
+	is.Equal(cookies[0].SameSite, config.SessionCookieSameSite)
+	is.Equal(testutil.ToFloat64(metrics.SessionRotations), rotations+2)
+}
+
+// BenchmarkMiddlewareAuth_RequireAuth compares authenticating parallel requests with and without the
+// session cache
+func BenchmarkMiddlewareAuth_RequireAuth(b *testing.B) {
+	is := is.New(b)
+	// Not in a transaction, which would be a single connection for all the goroutines
+	testDB := testutils.TestDBSetup(b)
+
+	user, err := models.NewUser("BenchmarkMiddlewareAuth_RequireAuth@test.com", testutils.TestingPassword, testutils.TestingMinEntropyBits)
+	is.NoErr(err)
+	is.NoErr(testDB.Create(user).Error)
+	b.Cleanup(func() { testDB.Unscoped().Where("id = ?", user.ID).Delete(&models.User{}) })
+
+	sessionRepo, err := repository.NewSessionRepository(testDB)
+	is.NoErr(err)
+	var tokens []string
+	for range 100 {
+		sessionToken, tokenHash, err := models.GenerateSessionToken(testutils.TestSessionKeys())
+		is.NoErr(err)
+		session, err := models.NewSession(user.ID, tokenHash, time.Now().Add(time.Hour))
+		is.NoErr(err)
+		is.NoErr(sessionRepo.CreateSession(session))
+		tokens = append(tokens, sessionToken)
+	}
+
+	for _, bc := range []struct {
+		name  string
+		cache *repository.SessionCache
+	}{
+		{name: "database"},
+		{name: "cached", cache: repository.NewSessionCache(time.Minute, 1000)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			authMw, err := middleware.NewAuthMiddleware(testDB, testutils.TestSessionKeys(), testutils.TestConfig())
+			is.NoErr(err)
+			authMw.SessionRepo = &repository.SessionRepository{DB: testDB, Cache: bc.cache}
+
+			router := gin.New()
+			router.GET("/protected", authMw.RequireAuth(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					req := httptest.NewRequest("GET", "/protected", nil)
+					req.Header.Set("Authorization", "Bearer "+tokens[i%len(tokens)])
+					rr := httptest.NewRecorder()
+					router.ServeHTTP(rr, req)
+					if rr.Code != http.StatusOK {
+						b.Errorf("unexpected status %d", rr.Code)
+						return
+					}
+					i++
+				}
+			})
+		})
+	}
+}
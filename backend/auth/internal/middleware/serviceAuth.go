@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// ServiceAuthMiddleware authenticates internal backend services with HTTP Basic credentials
+type ServiceAuthMiddleware struct {
+	// secrets maps service IDs to the SHA-256 of their secret, so comparisons take the same time
+	// regardless of the length of the presented secret
+	secrets map[string][sha256.Size]byte
+}
+
+// NewServiceAuthMiddleware returns a ServiceAuthMiddleware accepting the given service ID to secret
+// pairs. Without any credentials every request is rejected.
+func NewServiceAuthMiddleware(credentials map[string]string) (*ServiceAuthMiddleware, error) {
+	secrets := make(map[string][sha256.Size]byte, len(credentials))
+	for id, secret := range credentials {
+		if len(secret) < config.MinServiceSecretLength {
+			return nil, fmt.Errorf("%w: %q needs at least %d characters", apperrors.ErrServiceSecretTooShort, id, config.MinServiceSecretLength)
+		}
+		secrets[id] = sha256.Sum256([]byte(secret))
+	}
+	return &ServiceAuthMiddleware{secrets: secrets}, nil
+}
+
+// ParseServiceCredentials parses the value of the `config.EnvServiceCredentials` env variable, a
+// comma separated list of `id:secret` pairs
+func ParseServiceCredentials(s string) (map[string]string, error) {
+	credentials := make(map[string]string)
+	for pair := range strings.SplitSeq(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, apperrors.ErrInvalidServiceCredentials
+		}
+		if _, exists := credentials[id]; exists {
+			return nil, fmt.Errorf("%w: %q is listed twice", apperrors.ErrInvalidServiceCredentials, id)
+		}
+		credentials[id] = secret
+	}
+	return credentials, nil
+}
+
+// RequireServiceAuth is a middleware that only lets known services through. The authenticated
+// service ID is set as "serviceID" in the context.
+func (sm *ServiceAuthMiddleware) RequireServiceAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, secret, ok := c.Request.BasicAuth()
+		if !ok || !sm.valid(id, secret) {
+			log.Info().
+				Str("serviceID", id).
+				Str("clientIP", c.ClientIP()).
+				Msg("Service authentication failed")
+			c.Header("WWW-Authenticate", `Basic realm="auth"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+			return
+		}
+
+		c.Set("serviceID", id)
+		c.Next()
+	}
+}
+
+// valid reports whether a secret belongs to a service
+func (sm *ServiceAuthMiddleware) valid(id, secret string) bool {
+	expected, exists := sm.secrets[id]
+	presented := sha256.Sum256([]byte(secret))
+	return subtle.ConstantTimeCompare(presented[:], expected[:]) == 1 && exists
+}
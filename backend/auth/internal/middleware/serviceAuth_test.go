@@ -0,0 +1,81 @@
+package middleware_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/middleware"
+	"godiscauth/pkg/apperrors"
+)
+
+const testServiceSecret = "aservicesecretthatislongenoughtobeaccepted"
+
+// TestMiddleware_ParseServiceCredentials tests parsing of the service credentials setting
+func TestMiddleware_ParseServiceCredentials(t *testing.T) {
+	is := is.New(t)
+
+	credentials, err := middleware.ParseServiceCredentials("")
+	is.NoErr(err)
+	is.Equal(len(credentials), 0)
+
+	credentials, err = middleware.ParseServiceCredentials("discussion:secret:with:colons, worker:other ,")
+	is.NoErr(err)
+	is.Equal(credentials, map[string]string{"discussion": "secret:with:colons", "worker": "other"})
+
+	for _, s := range []string{"discussion", ":secret", "discussion:", "a:one,a:two"} {
+		_, err := middleware.ParseServiceCredentials(s)
+		is.True(errors.Is(err, apperrors.ErrInvalidServiceCredentials))
+	}
+}
+
+// TestMiddleware_RequireServiceAuth tests that only known services with the right secret get
+// through
+func TestMiddleware_RequireServiceAuth(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("rejects short secrets", func(t *testing.T) {
+		_, err := middleware.NewServiceAuthMiddleware(map[string]string{"discussion": "short"})
+		is.True(errors.Is(err, apperrors.ErrServiceSecretTooShort))
+	})
+
+	sm, err := middleware.NewServiceAuthMiddleware(map[string]string{"discussion": testServiceSecret})
+	is.NoErr(err)
+	router := gin.New()
+	router.POST("/internal", sm.RequireServiceAuth(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("serviceID"))
+	})
+
+	makeRequest := func(setAuth func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/internal", nil)
+		setAuth(req)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("valid credentials", func(t *testing.T) {
+		rr := makeRequest(func(r *http.Request) { r.SetBasicAuth("discussion", testServiceSecret) })
+		is.Equal(rr.Code, http.StatusOK)
+		is.Equal(rr.Body.String(), "discussion")
+	})
+
+	invalid := map[string]func(*http.Request){
+		"no credentials":  func(r *http.Request) {},
+		"wrong secret":    func(r *http.Request) { r.SetBasicAuth("discussion", strings.ToUpper(testServiceSecret)) },
+		"unknown service": func(r *http.Request) { r.SetBasicAuth("worker", testServiceSecret) },
+		"bearer token":    func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+testServiceSecret) },
+	}
+	for name, setAuth := range invalid {
+		t.Run(name, func(t *testing.T) {
+			rr := makeRequest(setAuth)
+			is.Equal(rr.Code, http.StatusUnauthorized)
+			is.True(rr.Header().Get("WWW-Authenticate") != "")
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// bearerPrefix is the scheme prefix of an `Authorization` header carrying a session token
+const bearerPrefix = "Bearer "
+
+// SessionToken returns the session token of a request and whether it was sent as a bearer token.
+// An `Authorization: Bearer` header takes precedence over the session cookie. Any other
+// authorization scheme is rejected rather than falling back to the cookie.
+func SessionToken(c *gin.Context) (string, bool, error) {
+	if header := c.GetHeader("Authorization"); header != "" {
+		if len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+			return "", false, apperrors.ErrInvalidTokenFormat
+		}
+		token := strings.TrimSpace(header[len(bearerPrefix):])
+		if token == "" {
+			return "", false, apperrors.ErrSessionIdIsEmpty
+		}
+		return token, true, nil
+	}
+
+	token, err := c.Cookie(config.SessionCookieName)
+	if err != nil || token == "" {
+		return "", false, apperrors.ErrSessionIdIsEmpty
+	}
+	return token, false, nil
+}
+
+// SetSessionCookie sets the session cookie to token for maxAge seconds. A maxAge of 0 makes a cookie
+// that ends with the browser session, and a negative one deletes the cookie.
+func SetSessionCookie(c *gin.Context, token string, maxAge int) {
+	c.SetSameSite(config.SessionCookieSameSite)
+	c.SetCookie(config.SessionCookieName, token, maxAge, "", "", true, true)
+}
+
+// ClientInfo describes the client making a request, to be recorded with its session
+func ClientInfo(c *gin.Context) models.ClientInfo {
+	return models.ClientInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
@@ -0,0 +1,76 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/middleware"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// TestMiddleware_SessionToken tests reading session tokens from the cookie and bearer header
+func TestMiddleware_SessionToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		cookie        string
+		token         string
+		bearer        bool
+		err           error
+	}{
+		{name: "cookie", cookie: "cookie.token", token: "cookie.token"},
+		{name: "bearer", authorization: "Bearer bearer.token", token: "bearer.token", bearer: true},
+		{name: "lowercase scheme", authorization: "bearer bearer.token", token: "bearer.token", bearer: true},
+		{name: "bearer over cookie", authorization: "Bearer bearer.token", cookie: "cookie.token", token: "bearer.token", bearer: true},
+		{name: "other scheme", authorization: "Basic dXNlcjpwYXNz", cookie: "cookie.token", err: apperrors.ErrInvalidTokenFormat},
+		{name: "empty bearer", authorization: "Bearer ", err: apperrors.ErrSessionIdIsEmpty},
+		{name: "nothing", err: apperrors.ErrSessionIdIsEmpty},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: tt.cookie})
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = req
+
+			token, bearer, err := middleware.SessionToken(c)
+			is.Equal(err, tt.err)
+			is.Equal(token, tt.token)
+			is.Equal(bearer, tt.bearer)
+		})
+	}
+}
+
+// TestMiddleware_SetSessionCookie tests that session cookies are set and deleted with the same
+// attributes
+func TestMiddleware_SetSessionCookie(t *testing.T) {
+	is := is.New(t)
+
+	for _, maxAge := range []int{3600, 0, -1} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		middleware.SetSessionCookie(c, "session.token", maxAge)
+
+		cookies := w.Result().Cookies()
+		is.Equal(len(cookies), 1)
+		is.Equal(cookies[0].Name, config.SessionCookieName)
+		is.Equal(cookies[0].SameSite, config.SessionCookieSameSite)
+		is.Equal(cookies[0].MaxAge, maxAge)
+		is.Equal(cookies[0].Path, "/")
+		is.True(cookies[0].Secure)
+		is.True(cookies[0].HttpOnly)
+	}
+}
@@ -0,0 +1,60 @@
+package models
+
+import "strings"
+
+// userAgentPattern maps a substring of a user agent to a name. Patterns are checked in order, so
+// more specific ones come first: Edge and Opera claim to be Chrome, and Chrome claims to be Safari.
+type userAgentPattern struct {
+	substring string
+	name      string
+}
+
+var browserPatterns = []userAgentPattern{
+	{"Edg", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"Go-http-client/", "Go HTTP client"},
+}
+
+var osPatterns = []userAgentPattern{
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// DeviceLabel returns a short, human-readable description of a user agent such as
+// "Firefox on Linux", for users to recognize their sessions by
+func DeviceLabel(userAgent string) string {
+	browser := matchUserAgent(userAgent, browserPatterns)
+	os := matchUserAgent(userAgent, osPatterns)
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os + " device"
+	default:
+		return "Unknown device"
+	}
+}
+
+func matchUserAgent(userAgent string, patterns []userAgentPattern) string {
+	for _, p := range patterns {
+		if strings.Contains(userAgent, p.substring) {
+			return p.name
+		}
+	}
+	return ""
+}
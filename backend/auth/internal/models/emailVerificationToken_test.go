@@ -0,0 +1,76 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestEmailVerificationToken_NewEmailVerificationToken tests email verification token creation
+func TestEmailVerificationToken_NewEmailVerificationToken(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("fails when user ID is empty", func(t *testing.T) {
+		_, err := models.NewEmailVerificationToken(testutils.TestSessionKeys(), uuid.Nil, "a@test.com", time.Now().Add(time.Hour))
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("fails when email is empty", func(t *testing.T) {
+		_, err := models.NewEmailVerificationToken(testutils.TestSessionKeys(), uuid.New(), "", time.Now().Add(time.Hour))
+		is.Equal(err, apperrors.ErrEmailIsEmpty)
+	})
+
+	t.Run("fails when expiration time is empty", func(t *testing.T) {
+		_, err := models.NewEmailVerificationToken(testutils.TestSessionKeys(), uuid.New(), "a@test.com", time.Time{})
+		is.Equal(err, apperrors.ErrExpiresAtIsEmpty)
+	})
+}
+
+// TestEmailVerificationToken_ParseEmailVerificationToken tests email verification token checks
+func TestEmailVerificationToken_ParseEmailVerificationToken(t *testing.T) {
+	is := is.New(t)
+
+	userID := uuid.New()
+	email := "testVerificationToken@test.com"
+	token, err := models.NewEmailVerificationToken(testutils.TestSessionKeys(), userID, email, time.Now().Add(time.Hour))
+	is.NoErr(err)
+
+	t.Run("valid token", func(t *testing.T) {
+		parsedID, parsedEmail, err := models.ParseEmailVerificationToken(testutils.TestSessionKeys(), token, time.Now())
+		is.NoErr(err)
+		is.Equal(parsedID, userID)
+		is.Equal(parsedEmail, email)
+	})
+
+	t.Run("empty token", func(t *testing.T) {
+		_, _, err := models.ParseEmailVerificationToken(testutils.TestSessionKeys(), "", time.Now())
+		is.Equal(err, apperrors.ErrVerificationTokenIsEmpty)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		_, _, err := models.ParseEmailVerificationToken(testutils.TestSessionKeys(), token, time.Now().Add(2*time.Hour))
+		is.Equal(err, apperrors.ErrInvalidVerificationToken)
+	})
+
+	t.Run("tampered payload", func(t *testing.T) {
+		otherToken, err := models.NewEmailVerificationToken(testutils.TestSessionKeys(), uuid.New(), email, time.Now().Add(time.Hour))
+		is.NoErr(err)
+		otherPayload, _, _ := strings.Cut(otherToken, ".")
+		_, signature, _ := strings.Cut(token, ".")
+
+		_, _, err = models.ParseEmailVerificationToken(testutils.TestSessionKeys(), otherPayload+"."+signature, time.Now())
+		is.Equal(err, apperrors.ErrInvalidVerificationToken)
+	})
+
+	t.Run("malformed token", func(t *testing.T) {
+		_, _, err := models.ParseEmailVerificationToken(testutils.TestSessionKeys(), "not-a-token", time.Now())
+		is.Equal(err, apperrors.ErrInvalidVerificationToken)
+	})
+}
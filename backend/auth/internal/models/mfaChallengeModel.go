@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/pkg/apperrors"
+)
+
+// MFAChallenge represents a pending two-factor login in the `mfa_challenges` table. It is
+// created once a user has entered a correct password and is exchanged for a session when they
+// enter a valid second factor. Only the hash of the challenge token is stored.
+type MFAChallenge struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	User      *User     `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`
+	TokenHash string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Attempts  int       `gorm:"type:integer;not null;default:0"`
+	ExpiresAt time.Time `gorm:"type:timestamp;not null"`
+	CreatedAt time.Time `gorm:"type:timestamp;not null;default:now()"`
+}
+
+// NewMFAChallenge creates a new MFAChallenge value from a user id, a token hash, and an
+// expiration time
+func NewMFAChallenge(userID uuid.UUID, tokenHash string, expiresAt time.Time) (*MFAChallenge, error) {
+	if userID == uuid.Nil {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	if tokenHash == "" {
+		return nil, apperrors.ErrMFAChallengeIsEmpty
+	}
+	if expiresAt.IsZero() {
+		return nil, apperrors.ErrExpiresAtIsEmpty
+	}
+
+	return &MFAChallenge{
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt.UTC(), // ensure UTC
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
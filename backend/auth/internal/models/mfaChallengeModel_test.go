@@ -0,0 +1,41 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestMFAChallengeModel_NewMFAChallenge tests new MFAChallenge creation in the `models` package
+func TestMFAChallengeModel_NewMFAChallenge(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("new valid challenge", func(t *testing.T) {
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		challenge, err := models.NewMFAChallenge(uuid.New(), tokenHash, time.Now().Add(time.Minute))
+		is.NoErr(err)
+		is.Equal(challenge.TokenHash, tokenHash)
+		is.Equal(challenge.Attempts, 0)
+	})
+
+	t.Run("fails when user ID is empty", func(t *testing.T) {
+		_, err := models.NewMFAChallenge(uuid.Nil, "hash", time.Now().Add(time.Minute))
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("fails when token hash is empty", func(t *testing.T) {
+		_, err := models.NewMFAChallenge(uuid.New(), "", time.Now().Add(time.Minute))
+		is.Equal(err, apperrors.ErrMFAChallengeIsEmpty)
+	})
+
+	t.Run("fails when expiration time is empty", func(t *testing.T) {
+		_, err := models.NewMFAChallenge(uuid.New(), "hash", time.Time{})
+		is.Equal(err, apperrors.ErrExpiresAtIsEmpty)
+	})
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/pkg/apperrors"
+)
+
+// PasswordResetToken represents a single-use password reset token in the `password_reset_tokens`
+// table. Only the hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index"`
+	User      *User      `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`
+	TokenHash string     `gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"type:timestamp;not null"`
+	UsedAt    *time.Time `gorm:"type:timestamp"`
+	CreatedAt time.Time  `gorm:"type:timestamp;not null;default:now()"`
+}
+
+// NewPasswordResetToken creates a new PasswordResetToken value from a user id, a token hash, and an
+// expiration time
+func NewPasswordResetToken(userID uuid.UUID, tokenHash string, expiresAt time.Time) (*PasswordResetToken, error) {
+	if userID == uuid.Nil {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	if tokenHash == "" {
+		return nil, apperrors.ErrResetTokenIsEmpty
+	}
+	if expiresAt.IsZero() {
+		return nil, apperrors.ErrExpiresAtIsEmpty
+	}
+
+	return &PasswordResetToken{
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt.UTC(), // ensure UTC
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
@@ -0,0 +1,42 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestPasswordResetTokenModel_NewPasswordResetToken tests new PasswordResetToken creation in the
+// `models` package
+func TestPasswordResetTokenModel_NewPasswordResetToken(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("new valid token", func(t *testing.T) {
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		token, err := models.NewPasswordResetToken(uuid.New(), tokenHash, time.Now().Add(time.Hour))
+		is.NoErr(err)
+		is.Equal(token.TokenHash, tokenHash)
+		is.Equal(token.UsedAt, nil)
+	})
+
+	t.Run("fails when user ID is empty", func(t *testing.T) {
+		_, err := models.NewPasswordResetToken(uuid.Nil, "hash", time.Now().Add(time.Hour))
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("fails when token hash is empty", func(t *testing.T) {
+		_, err := models.NewPasswordResetToken(uuid.New(), "", time.Now().Add(time.Hour))
+		is.Equal(err, apperrors.ErrResetTokenIsEmpty)
+	})
+
+	t.Run("fails when expiration time is empty", func(t *testing.T) {
+		_, err := models.NewPasswordResetToken(uuid.New(), "hash", time.Time{})
+		is.Equal(err, apperrors.ErrExpiresAtIsEmpty)
+	})
+}
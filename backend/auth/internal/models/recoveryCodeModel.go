@@ -0,0 +1,75 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"godiscauth/pkg/apperrors"
+)
+
+// recoveryCodeBytes is the number of random bytes in a recovery code, 10 characters in base32
+const recoveryCodeBytes = 6
+
+// recoveryCodeEncoding is lowercase base32 so codes are easy to read back and type
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// RecoveryCode represents a one-time code in the `recovery_codes` table that can stand in for a
+// second factor if the user loses their authenticator. Only the bcrypt hash of the code is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index"`
+	User      *User      `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`
+	CodeHash  string     `gorm:"type:varchar(60);not null"`
+	UsedAt    *time.Time `gorm:"type:timestamp"`
+	CreatedAt time.Time  `gorm:"type:timestamp;not null;default:now()"`
+}
+
+// GenerateRecoveryCodes creates `n` random recovery codes formatted as "xxxxx-xxxxx"
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for range n {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := recoveryCodeEncoding.EncodeToString(b)
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode strips the separator, whitespace and case from a code as typed by a user
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
+
+// NewRecoveryCode creates a new RecoveryCode value from a user id and a plaintext code
+func NewRecoveryCode(userID uuid.UUID, code string) (*RecoveryCode, error) {
+	if userID == uuid.Nil {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	code = NormalizeRecoveryCode(code)
+	if code == "" {
+		return nil, apperrors.ErrMFACodeIsEmpty
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryCode{
+		UserID:    userID,
+		CodeHash:  string(hash),
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Matches reports whether a code as typed by a user is this recovery code
+func (rc *RecoveryCode) Matches(code string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(rc.CodeHash), []byte(NormalizeRecoveryCode(code))) == nil
+}
@@ -0,0 +1,59 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestRecoveryCodeModel_GenerateRecoveryCodes tests recovery code generation
+func TestRecoveryCodeModel_GenerateRecoveryCodes(t *testing.T) {
+	is := is.New(t)
+
+	codes, err := models.GenerateRecoveryCodes(10)
+	is.NoErr(err)
+	is.Equal(len(codes), 10)
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		is.Equal(len(code), 11) // "xxxxx-xxxxx"
+		is.Equal(code[5], byte('-'))
+		is.True(!seen[code])
+		seen[code] = true
+	}
+}
+
+// TestRecoveryCodeModel_NewRecoveryCode tests new RecoveryCode creation and matching
+func TestRecoveryCodeModel_NewRecoveryCode(t *testing.T) {
+	is := is.New(t)
+
+	codes, err := models.GenerateRecoveryCodes(2)
+	is.NoErr(err)
+
+	t.Run("matches the code however it is typed", func(t *testing.T) {
+		rc, err := models.NewRecoveryCode(uuid.New(), codes[0])
+		is.NoErr(err)
+		is.True(!strings.Contains(rc.CodeHash, codes[0]))
+
+		is.True(rc.Matches(codes[0]))
+		is.True(rc.Matches(strings.ToUpper(codes[0])))
+		is.True(rc.Matches(strings.ReplaceAll(codes[0], "-", "")))
+		is.True(rc.Matches(" " + codes[0] + " "))
+		is.True(!rc.Matches(codes[1]))
+	})
+
+	t.Run("fails when user ID is empty", func(t *testing.T) {
+		_, err := models.NewRecoveryCode(uuid.Nil, codes[0])
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("fails when code is empty", func(t *testing.T) {
+		_, err := models.NewRecoveryCode(uuid.New(), " - ")
+		is.Equal(err, apperrors.ErrMFACodeIsEmpty)
+	})
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/pkg/apperrors"
+)
+
+// SecurityEventType names a security-relevant change to an account
+type SecurityEventType string
+
+const (
+	SecurityEventTOTPEnabled            SecurityEventType = "totp_enabled"
+	SecurityEventTOTPDisabled           SecurityEventType = "totp_disabled"
+	SecurityEventRecoveryCodesGenerated SecurityEventType = "recovery_codes_generated"
+	SecurityEventRecoveryCodeUsed       SecurityEventType = "recovery_code_used"
+	SecurityEventPasskeyAdded           SecurityEventType = "passkey_added"
+	SecurityEventPasskeyRemoved         SecurityEventType = "passkey_removed"
+	SecurityEventSessionEvicted         SecurityEventType = "session_evicted"
+)
+
+// SecurityEvent represents an entry in a user's security activity in the `security_events` table
+type SecurityEvent struct {
+	ID        uuid.UUID         `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	UserID    uuid.UUID         `gorm:"type:uuid;not null;index"`
+	User      *User             `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`
+	Type      SecurityEventType `gorm:"type:varchar(64);not null"`
+	Detail    string            `gorm:"type:text;not null;default:''"`
+	CreatedAt time.Time         `gorm:"type:timestamp;not null;default:now();index"`
+}
+
+// NewSecurityEvent creates a new SecurityEvent value from a user id, an event type and a
+// human-readable detail
+func NewSecurityEvent(userID uuid.UUID, eventType SecurityEventType, detail string) (*SecurityEvent, error) {
+	if userID == uuid.Nil {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	if eventType == "" {
+		return nil, apperrors.ErrSecurityEventTypeIsEmpty
+	}
+
+	return &SecurityEvent{
+		UserID:    userID,
+		Type:      eventType,
+		Detail:    detail,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
@@ -0,0 +1,33 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestSecurityEventModel_NewSecurityEvent tests new SecurityEvent creation in the `models` package
+func TestSecurityEventModel_NewSecurityEvent(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("new valid event", func(t *testing.T) {
+		event, err := models.NewSecurityEvent(uuid.New(), models.SecurityEventTOTPEnabled, "detail")
+		is.NoErr(err)
+		is.Equal(event.Type, models.SecurityEventTOTPEnabled)
+		is.Equal(event.Detail, "detail")
+	})
+
+	t.Run("fails when user ID is empty", func(t *testing.T) {
+		_, err := models.NewSecurityEvent(uuid.Nil, models.SecurityEventTOTPEnabled, "")
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("fails when type is empty", func(t *testing.T) {
+		_, err := models.NewSecurityEvent(uuid.New(), "", "")
+		is.Equal(err, apperrors.ErrSecurityEventTypeIsEmpty)
+	})
+}
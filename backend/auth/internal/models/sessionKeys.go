@@ -0,0 +1,95 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"strings"
+
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+	"godiscauth/pkg/keyring"
+)
+
+// CheckSessionKeyRing returns a readiness check that fails if there is no session key ring, i.e.
+// sessions can't be signed
+func CheckSessionKeyRing(keys *keyring.KeyRing) func(context.Context) error {
+	return func(context.Context) error {
+		if keys == nil {
+			return apperrors.ErrSessionKeyMissing
+		}
+		return nil
+	}
+}
+
+// LoadSessionKeyRing builds the session key ring from the keys in `cfg.KeysDir`, `cfg.Keys` and the
+// legacy `cfg.Key`. The primary key is `cfg.PrimaryKeyID`, or else the first key of `cfg.Keys`, or
+// else the legacy key.
+func LoadSessionKeyRing(cfg config.SessionConfig) (*keyring.KeyRing, error) {
+	keys := make(map[string][]byte)
+	primaryID := cfg.PrimaryKeyID
+
+	if dir := cfg.KeysDir; dir != "" {
+		dirKeys, err := keyring.LoadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(keys, dirKeys)
+	}
+
+	ids, envKeys, err := keyring.ParseKeys(cfg.Keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if _, exists := keys[id]; exists {
+			return nil, fmt.Errorf("%w: %q", apperrors.ErrDuplicateKeyID, id)
+		}
+		keys[id] = envKeys[id]
+	}
+	if primaryID == "" && len(ids) > 0 {
+		primaryID = ids[0]
+	}
+
+	if legacy := cfg.Key; legacy != "" {
+		if _, exists := keys[config.LegacySessionKeyID]; exists {
+			return nil, fmt.Errorf("%w: %q", apperrors.ErrDuplicateKeyID, config.LegacySessionKeyID)
+		}
+		keys[config.LegacySessionKeyID] = []byte(legacy)
+		if primaryID == "" {
+			primaryID = config.LegacySessionKeyID
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, apperrors.ErrSessionKeyMissing
+	}
+	return keyring.New(primaryID, keys)
+}
+
+// signWithSessionKey signs a message with the primary session key and returns `keyID.mac`
+func signWithSessionKey(keys *keyring.KeyRing, message string) (string, error) {
+	if keys == nil {
+		return "", apperrors.ErrSessionKeyMissing
+	}
+	keyID, sum := keys.Sign([]byte(message))
+	return keyID + "." + base64.RawURLEncoding.EncodeToString(sum), nil
+}
+
+// verifySessionKeySignature checks a signature made by `signWithSessionKey` with any key in the
+// ring. Signatures without a key ID predate the key ring and are checked against the legacy key.
+func verifySessionKeySignature(keys *keyring.KeyRing, message, signature string) bool {
+	if keys == nil {
+		return false
+	}
+	keyID, encoded, found := strings.Cut(signature, ".")
+	if !found {
+		keyID, encoded = config.LegacySessionKeyID, signature
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	return keys.Verify(keyID, []byte(message), sum)
+}
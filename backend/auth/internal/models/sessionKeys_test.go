@@ -0,0 +1,139 @@
+package models_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+	"godiscauth/pkg/keyring"
+)
+
+const (
+	oldSessionKey = "anoldsessionkeythatislongenoughtobeused"
+	newSessionKey = "anewsessionkeythatislongenoughtobeused!"
+)
+
+// sessionKeys returns a key ring of the given keys
+func sessionKeys(t *testing.T, primaryID string, keys map[string][]byte) *keyring.KeyRing {
+	t.Helper()
+	ring, err := keyring.New(primaryID, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+// TestSessionKeys_Rotation tests that tokens keep working while their key is in the ring and stop
+// working once it is removed
+func TestSessionKeys_Rotation(t *testing.T) {
+	is := is.New(t)
+
+	keys := sessionKeys(t, "old", map[string][]byte{"old": []byte(oldSessionKey)})
+	oldToken, oldHash, err := models.GenerateSessionToken(keys)
+	is.NoErr(err)
+
+	// The new key signs, the old one still verifies
+	keys = sessionKeys(t, "new", map[string][]byte{"old": []byte(oldSessionKey), "new": []byte(newSessionKey)})
+	tokenHash, err := models.ParseSessionToken(keys, oldToken)
+	is.NoErr(err)
+	is.Equal(tokenHash, oldHash)
+
+	newToken, _, err := models.GenerateSessionToken(keys)
+	is.NoErr(err)
+	_, err = models.ParseSessionToken(keys, newToken)
+	is.NoErr(err)
+
+	// Once the old key is gone, so are its tokens
+	keys = sessionKeys(t, "new", map[string][]byte{"new": []byte(newSessionKey)})
+	_, err = models.ParseSessionToken(keys, oldToken)
+	is.Equal(err, apperrors.ErrInvalidSessionSignature)
+	_, err = models.ParseSessionToken(keys, newToken)
+	is.NoErr(err)
+}
+
+// TestSessionKeys_LegacyTokens tests that tokens signed before key IDs existed verify against the
+// legacy key only
+func TestSessionKeys_LegacyTokens(t *testing.T) {
+	is := is.New(t)
+
+	sessionID := uuid.New()
+	h := hmac.New(sha256.New, []byte(oldSessionKey))
+	h.Write([]byte(sessionID.String()))
+	legacyToken := sessionID.String() + "." + base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+
+	keys := sessionKeys(t, "new", map[string][]byte{
+		config.LegacySessionKeyID: []byte(oldSessionKey),
+		"new":                     []byte(newSessionKey),
+	})
+	tokenHash, err := models.ParseSessionToken(keys, legacyToken)
+	is.NoErr(err)
+	is.Equal(tokenHash, models.HashSessionSecret(sessionID.String()))
+
+	keys = sessionKeys(t, "new", map[string][]byte{"new": []byte(oldSessionKey)})
+	_, err = models.ParseSessionToken(keys, legacyToken)
+	is.Equal(err, apperrors.ErrInvalidSessionSignature)
+}
+
+// TestSessionKeys_LoadSessionKeyRing tests building the key ring from the session config
+func TestSessionKeys_LoadSessionKeyRing(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("legacy key only", func(t *testing.T) {
+		ring, err := models.LoadSessionKeyRing(config.SessionConfig{Key: oldSessionKey})
+		is.NoErr(err)
+		is.Equal(ring.PrimaryID(), config.LegacySessionKeyID)
+	})
+
+	t.Run("first listed key is primary", func(t *testing.T) {
+		ring, err := models.LoadSessionKeyRing(config.SessionConfig{
+			Key:  oldSessionKey,
+			Keys: "b:" + newSessionKey + ",a:" + newSessionKey,
+		})
+		is.NoErr(err)
+		is.Equal(ring.PrimaryID(), "b")
+		is.Equal(ring.IDs(), []string{"a", "b", config.LegacySessionKeyID})
+	})
+
+	t.Run("explicit primary and key directory", func(t *testing.T) {
+		dir := t.TempDir()
+		is.NoErr(os.WriteFile(filepath.Join(dir, "2025-06"), []byte(newSessionKey+"\n"), 0o600))
+		ring, err := models.LoadSessionKeyRing(config.SessionConfig{
+			Keys:         "a:" + oldSessionKey,
+			KeysDir:      dir,
+			PrimaryKeyID: "2025-06",
+		})
+		is.NoErr(err)
+		is.Equal(ring.PrimaryID(), "2025-06")
+	})
+
+	t.Run("unknown primary", func(t *testing.T) {
+		_, err := models.LoadSessionKeyRing(config.SessionConfig{Keys: "a:" + oldSessionKey, PrimaryKeyID: "b"})
+		is.True(errors.Is(err, apperrors.ErrPrimaryKeyNotFound))
+	})
+
+	t.Run("no keys", func(t *testing.T) {
+		_, err := models.LoadSessionKeyRing(config.SessionConfig{})
+		is.Equal(err, apperrors.ErrSessionKeyMissing)
+	})
+}
+
+// TestSessionKeys_CheckSessionKeyRing tests that the check fails without a key ring
+func TestSessionKeys_CheckSessionKeyRing(t *testing.T) {
+	is := is.New(t)
+
+	keys := sessionKeys(t, "a", map[string][]byte{"a": []byte(newSessionKey)})
+	is.NoErr(models.CheckSessionKeyRing(keys)(context.Background()))
+
+	is.Equal(models.CheckSessionKeyRing(nil)(context.Background()), apperrors.ErrSessionKeyMissing)
+}
@@ -1,64 +1,129 @@
 package models
 
 import (
-	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
 	"godiscauth/pkg/apperrors"
 	"godiscauth/pkg/config"
+	"godiscauth/pkg/keyring"
 )
 
-// Session represents a session in the `sesisons` table
+// Session represents a session in the `sesisons` table. The session token carries a random secret
+// and only its SHA-256 is stored, so reading the table doesn't reveal usable tokens.
 type Session struct {
-	ID        uuid.UUID    `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
 	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
 	User      *User     `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`
-	ExpiresAt time.Time `gorm:"type:timestamp;not null"`
+	TokenHash []byte    `gorm:"type:bytea;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"type:timestamp;not null;index"`
 	CreatedAt time.Time `gorm:"type:timestamp;not null;default:now()"`
+	// MFA records whether the session was created with a second factor
+	MFA bool `gorm:"column:mfa;type:boolean;not null;default:false"`
+	// AuthenticatedAt is when the user logged in. Unlike CreatedAt it is kept when the session is
+	// rotated.
+	AuthenticatedAt time.Time `gorm:"type:timestamp;not null;default:now()"`
+	// LastSeenAt is updated at most every `SessionConfig.LastSeenInterval`
+	LastSeenAt  time.Time `gorm:"type:timestamp;not null;default:now()"`
+	UserAgent   string    `gorm:"type:text;not null;default:''"`
+	ClientIP    string    `gorm:"type:varchar(64);not null;default:''"`
+	DeviceLabel string    `gorm:"type:varchar(128);not null;default:''"`
+	// RememberMe selects the longer session policy, see `Policy`
+	RememberMe bool `gorm:"type:boolean;not null;default:false"`
 }
 
-// NewSession creates a new Session value from a user id, a session id, and an expiration time
-func NewSession(userID uuid.UUID, sessionID uuid.UUID, expiresAt time.Time) (*Session, error) {
+// ClientInfo describes the client a session is used from, and whether the user asked to be
+// remembered on it when logging in
+type ClientInfo struct {
+	UserAgent  string
+	IP         string
+	RememberMe bool
+}
+
+// sessionSecretBytes is the number of random bytes in a session secret
+const sessionSecretBytes = 32
+
+// NewSession creates a new Session value from a user id, the hash of its token's secret, and an
+// expiration time
+func NewSession(userID uuid.UUID, tokenHash []byte, expiresAt time.Time) (*Session, error) {
 	if userID == uuid.Nil {
 		return nil, apperrors.ErrUserIdEmpty
 	}
-	if sessionID == uuid.Nil {
+	if len(tokenHash) == 0 {
 		return nil, apperrors.ErrSessionIdIsEmpty
 	}
 	if expiresAt.IsZero() {
 		return nil, apperrors.ErrExpiresAtIsEmpty
 	}
 
+	now := time.Now()
 	return &Session{
-		UserID:    userID,
-		ID:        sessionID,
-		ExpiresAt: expiresAt.UTC(), // ensure UTC
-		CreatedAt: time.Now(),
+		ID:              uuid.New(),
+		UserID:          userID,
+		TokenHash:       tokenHash,
+		ExpiresAt:       expiresAt.UTC(), // ensure UTC
+		CreatedAt:       now,
+		AuthenticatedAt: now,
+		LastSeenAt:      now,
 	}, nil
 }
 
-// GenerateSessionID creates a new random session ID
-func GenerateSessionID() (uuid.UUID, string, error) {
-	sessionID := uuid.New()
-	signature := createHMAC(sessionID.String())
-	return sessionID, signature, nil
+// SetClient records the client a session is used from, labelling the device from its user agent
+func (s *Session) SetClient(client ClientInfo) {
+	userAgent := client.UserAgent
+	if len(userAgent) > config.MaxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:config.MaxUserAgentLength], "")
+	}
+	s.UserAgent = userAgent
+	s.ClientIP = client.IP
+	s.DeviceLabel = DeviceLabel(userAgent)
+}
+
+// HasLegacyToken reports whether the session was created before tokens carried a separate secret.
+// Such sessions were migrated with the hash of their ID, which is also stored in the table, so
+// they should be rotated as soon as they are used.
+func (s *Session) HasLegacyToken() bool {
+	return subtle.ConstantTimeCompare(s.TokenHash, HashSessionSecret(s.ID.String())) == 1
 }
 
-// ValidateSessionID verifies that a session ID matches its signature
-func ValidateSessionID(sessionID uuid.UUID, signature string) bool {
-	expectedSignature := createHMAC(sessionID.String())
-	return hmac.Equal([]byte(signature), []byte(expectedSignature))
+// GenerateSessionToken creates a new session token, `secret.keyID.mac`, and the hash of its secret
+// to store in the session. The secret is signed with the primary key of keys.
+func GenerateSessionToken(keys *keyring.KeyRing) (string, []byte, error) {
+	b := make([]byte, sessionSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	signature, err := signWithSessionKey(keys, secret)
+	if err != nil {
+		return "", nil, err
+	}
+	return secret + "." + signature, HashSessionSecret(secret), nil
+}
+
+// HashSessionSecret returns the SHA-256 of a session secret, the value sessions are stored and
+// looked up by
+func HashSessionSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
 }
 
-// createHMAC generates an HMAC signature for a session ID
-// Ref: https://www.okta.com/identity-101/hmac/
-func createHMAC(sessionID string) string {
-	h := hmac.New(sha256.New, []byte(os.Getenv(config.SessionKey)))
-	h.Write([]byte(sessionID))
-	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+// ParseSessionToken splits a `secret.keyID.mac` session token, or a legacy `secret.mac` one, and
+// returns the hash of its secret if the signature is valid under keys. Tokens from before secrets
+// were hashed use the session ID as their secret.
+func ParseSessionToken(keys *keyring.KeyRing, sessionToken string) ([]byte, error) {
+	secret, signature, found := strings.Cut(sessionToken, ".")
+	if !found || secret == "" || signature == "" || strings.Count(signature, ".") > 1 {
+		return nil, apperrors.ErrInvalidTokenFormat
+	}
+	if !verifySessionKeySignature(keys, secret, signature) {
+		return nil, apperrors.ErrInvalidSessionSignature
+	}
+	return HashSessionSecret(secret), nil
 }
@@ -1,6 +1,8 @@
 package models_test
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,39 +12,63 @@ import (
 	"godiscauth/internal/models"
 	"godiscauth/internal/testutils"
 	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
 )
 
 // TestSessionModel_NewSession tests new Session creation in the `models`
 // package
 func TestSessionModel_NewSession(t *testing.T) {
 	is := is.New(t)
+	tokenHash := models.HashSessionSecret("secret")
 
-	// Valid uuid and non-empty session id should return non-nil Session value, nil error
+	// Valid uuid and non-empty token hash should return non-nil Session value, nil error
 	t.Run("new valid session", func(t *testing.T) {
-		session, err := models.NewSession(uuid.New(), uuid.New(), time.Now().Add(24*time.Hour))
+		session, err := models.NewSession(uuid.New(), tokenHash, time.Now().Add(24*time.Hour))
 		is.True(session != nil)
 		is.NoErr(err)
+		is.True(session.ID != uuid.Nil)
+		is.True(!session.HasLegacyToken())
 	})
 
 	t.Run("fails when user ID is empty", func(t *testing.T) {
-		_, err := models.NewSession(uuid.Nil, uuid.New(), time.Now().Add(24*time.Hour))
+		_, err := models.NewSession(uuid.Nil, tokenHash, time.Now().Add(24*time.Hour))
 		is.Equal(err, apperrors.ErrUserIdEmpty)
 	})
 
-	t.Run("fails when session is empty", func(t *testing.T) {
-		_, err := models.NewSession(uuid.New(), uuid.Nil, time.Now().Add(24*time.Hour))
+	t.Run("fails when token hash is empty", func(t *testing.T) {
+		_, err := models.NewSession(uuid.New(), nil, time.Now().Add(24*time.Hour))
 		is.Equal(err, apperrors.ErrSessionIdIsEmpty)
 	})
 	t.Run("fails when expiration time is empty", func(t *testing.T) {
-		_, err := models.NewSession(uuid.New(), uuid.New(), time.Time{})
+		_, err := models.NewSession(uuid.New(), tokenHash, time.Time{})
 		is.Equal(err, apperrors.ErrExpiresAtIsEmpty)
 	})
 }
 
+// TestSessionModel_SetClient tests recording the client a session is used from
+func TestSessionModel_SetClient(t *testing.T) {
+	is := is.New(t)
+
+	session, err := models.NewSession(uuid.New(), models.HashSessionSecret("secret"), time.Now().Add(time.Hour))
+	is.NoErr(err)
+	is.Equal(session.AuthenticatedAt, session.CreatedAt)
+	is.Equal(session.LastSeenAt, session.CreatedAt)
+
+	session.SetClient(models.ClientInfo{UserAgent: "curl/8.5.0", IP: "192.0.2.1"})
+	is.Equal(session.UserAgent, "curl/8.5.0")
+	is.Equal(session.ClientIP, "192.0.2.1")
+	is.Equal(session.DeviceLabel, "curl")
+
+	// Long user agents are cut off
+	session.SetClient(models.ClientInfo{UserAgent: strings.Repeat("a", config.MaxUserAgentLength+10)})
+	is.Equal(len(session.UserAgent), config.MaxUserAgentLength)
+	is.Equal(session.DeviceLabel, "Unknown device")
+}
+
 // TestSessionModel_CascadeToSessions tests that deleting a user in the
 // database scrubs any associated sessions by OnDelete-Cascade
 func TestSessionModel_CascadeToSessions(t *testing.T) {
-	testDB := testutils.TestDBSetup()
+	testDB := testutils.TestDBSetup(t)
 	is := is.New(t)
 
 	t.Run("user sessions are deleted when user is deleted", func(t *testing.T) {
@@ -51,7 +77,7 @@ func TestSessionModel_CascadeToSessions(t *testing.T) {
 
 		// Create test user for sessions (required foreign key reference)
 		userName := "testCascadeDeleteSessions@test.com"
-		testUser, err := models.NewUser(userName, testutils.TestingPassword)
+		testUser, err := models.NewUser(userName, testutils.TestingPassword, testutils.TestingMinEntropyBits)
 		is.NoErr(err)
 
 		err = tx.Create(testUser).Error
@@ -61,7 +87,7 @@ func TestSessionModel_CascadeToSessions(t *testing.T) {
 		for range 3 {
 			session, err := models.NewSession(
 				testUser.ID,
-				uuid.New(),
+				models.HashSessionSecret(uuid.NewString()),
 				time.Now().Add(1*time.Hour),
 			)
 			is.NoErr(err)
@@ -83,3 +109,37 @@ func TestSessionModel_CascadeToSessions(t *testing.T) {
 		is.Equal(count, int64(0))
 	})
 }
+
+// TestSessionModel_ParseSessionToken tests splitting and verifying session tokens
+func TestSessionModel_ParseSessionToken(t *testing.T) {
+	is := is.New(t)
+
+	sessionToken, tokenHash, err := models.GenerateSessionToken(testutils.TestSessionKeys())
+	is.NoErr(err)
+	secret, signature, _ := strings.Cut(sessionToken, ".")
+
+	t.Run("valid token", func(t *testing.T) {
+		parsedHash, err := models.ParseSessionToken(testutils.TestSessionKeys(), sessionToken)
+		is.NoErr(err)
+		is.Equal(parsedHash, tokenHash)
+	})
+
+	t.Run("tokens are unique", func(t *testing.T) {
+		otherToken, otherHash, err := models.GenerateSessionToken(testutils.TestSessionKeys())
+		is.NoErr(err)
+		is.True(otherToken != sessionToken)
+		is.True(!bytes.Equal(otherHash, tokenHash))
+	})
+
+	t.Run("malformed token", func(t *testing.T) {
+		for _, token := range []string{"", "invalid", "." + signature, secret + ".", sessionToken + ".extra"} {
+			_, err := models.ParseSessionToken(testutils.TestSessionKeys(), token)
+			is.Equal(err, apperrors.ErrInvalidTokenFormat)
+		}
+	})
+
+	t.Run("signature of another session", func(t *testing.T) {
+		_, err := models.ParseSessionToken(testutils.TestSessionKeys(), uuid.NewString()+"."+signature)
+		is.Equal(err, apperrors.ErrInvalidSessionSignature)
+	})
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"godiscauth/pkg/config"
+)
+
+// SessionPolicy decides how long a session lasts
+type SessionPolicy struct {
+	// IdleTimeout is how long a session can go unused before it expires
+	IdleTimeout time.Duration
+	// MaxLifetime is how long a session lasts after logging in, however often it is used or rotated
+	MaxLifetime time.Duration
+}
+
+// SessionPolicies are the policies of sessions with and without "remember me"
+type SessionPolicies struct {
+	Default    SessionPolicy
+	RememberMe SessionPolicy
+}
+
+// NewSessionPolicies returns the session policies configured in cfg
+func NewSessionPolicies(cfg config.SessionConfig) SessionPolicies {
+	return SessionPolicies{
+		Default:    SessionPolicy{IdleTimeout: cfg.IdleTimeout, MaxLifetime: cfg.MaxLifetime},
+		RememberMe: SessionPolicy{IdleTimeout: cfg.RememberMeIdleTimeout, MaxLifetime: cfg.RememberMeMaxLifetime},
+	}
+}
+
+// For returns the policy of a session, the longer one if the user asked to be remembered
+func (p SessionPolicies) For(rememberMe bool) SessionPolicy {
+	if rememberMe {
+		return p.RememberMe
+	}
+	return p.Default
+}
+
+// ExpiresAt returns when a session that was authenticated and last used at the given times
+// expires: after the idle timeout, but never later than the maximum lifetime
+func (p SessionPolicy) ExpiresAt(authenticatedAt, lastSeenAt time.Time) time.Time {
+	idle := lastSeenAt.Add(p.IdleTimeout)
+	absolute := authenticatedAt.Add(p.MaxLifetime)
+	if absolute.Before(idle) {
+		return absolute.UTC()
+	}
+	return idle.UTC()
+}
+
+// Policy returns the policy of policies the session was created with
+func (s *Session) Policy(policies SessionPolicies) SessionPolicy {
+	return policies.For(s.RememberMe)
+}
+
+// IsExpired reports whether the session has expired at now, either at its ExpiresAt or under its
+// policy
+func (s *Session) IsExpired(policies SessionPolicies, now time.Time) bool {
+	return !now.Before(s.ExpiresAt) || !now.Before(s.Policy(policies).ExpiresAt(s.AuthenticatedAt, s.LastSeenAt))
+}
+
+// CookieMaxAge returns the Max-Age in seconds of a cookie carrying the session's token: the rest of
+// its maximum lifetime if the user asked to be remembered, otherwise 0 so the cookie ends with the
+// browser session
+func (s *Session) CookieMaxAge(policies SessionPolicies, now time.Time) int {
+	if !s.RememberMe {
+		return 0
+	}
+	return max(int(s.AuthenticatedAt.Add(s.Policy(policies).MaxLifetime).Sub(now).Seconds()), 1)
+}
@@ -0,0 +1,102 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/config"
+)
+
+// defaults are the session settings of the default config, which the tests run with
+var defaults = config.Default().Sessions
+
+// policies are the session policies of `defaults`
+var policies = models.NewSessionPolicies(defaults)
+
+// TestSessionPolicy_ExpiresAt tests that sessions expire after the idle timeout, capped by the
+// maximum lifetime
+func TestSessionPolicy_ExpiresAt(t *testing.T) {
+	is := is.New(t)
+	policy := models.SessionPolicy{IdleTimeout: time.Hour, MaxLifetime: 24 * time.Hour}
+	login := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	is.Equal(policy.ExpiresAt(login, login), login.Add(time.Hour))
+	is.Equal(policy.ExpiresAt(login, login.Add(10*time.Hour)), login.Add(11*time.Hour))
+	is.Equal(policy.ExpiresAt(login, login.Add(23*time.Hour+30*time.Minute)), login.Add(24*time.Hour))
+
+	short, long := policies.For(false), policies.For(true)
+	is.Equal(short.IdleTimeout, defaults.IdleTimeout)
+	is.Equal(short.MaxLifetime, defaults.MaxLifetime)
+	is.Equal(long.IdleTimeout, defaults.RememberMeIdleTimeout)
+	is.Equal(long.MaxLifetime, defaults.RememberMeMaxLifetime)
+	is.True(long.IdleTimeout > short.IdleTimeout)
+	is.True(long.MaxLifetime > short.MaxLifetime)
+}
+
+// TestSessionPolicy_NewSessionPolicies tests building the session policies from the config
+func TestSessionPolicy_NewSessionPolicies(t *testing.T) {
+	is := is.New(t)
+
+	cfg := defaults
+	cfg.IdleTimeout = time.Minute
+	cfg.RememberMeMaxLifetime = 90 * 24 * time.Hour
+	configured := models.NewSessionPolicies(cfg)
+
+	is.Equal(configured.For(false), models.SessionPolicy{IdleTimeout: time.Minute, MaxLifetime: defaults.MaxLifetime})
+	is.Equal(configured.For(true).MaxLifetime, 90*24*time.Hour)
+}
+
+// TestSessionModel_IsExpired tests that a session expires when idle or too old even if its
+// ExpiresAt hasn't passed
+func TestSessionModel_IsExpired(t *testing.T) {
+	is := is.New(t)
+	now := time.Now().UTC()
+	idle := defaults.IdleTimeout
+
+	newSession := func(authenticatedAt, lastSeenAt time.Time) *models.Session {
+		session, err := models.NewSession(uuid.New(), models.HashSessionSecret("secret"), now.Add(time.Hour))
+		is.NoErr(err)
+		session.AuthenticatedAt = authenticatedAt
+		session.LastSeenAt = lastSeenAt
+		return session
+	}
+
+	is.True(!newSession(now, now).IsExpired(policies, now))
+	is.True(newSession(now, now).IsExpired(policies, now.Add(time.Hour)))
+
+	t.Run("idle", func(t *testing.T) {
+		session := newSession(now.Add(-idle-time.Minute), now.Add(-idle-time.Minute))
+		is.True(session.IsExpired(policies, now))
+
+		// The longer policy allows the same gap
+		session.RememberMe = true
+		is.True(!session.IsExpired(policies, now))
+	})
+
+	t.Run("absolute", func(t *testing.T) {
+		session := newSession(now.Add(-defaults.MaxLifetime), now.Add(-time.Minute))
+		is.True(session.IsExpired(policies, now))
+
+		session.RememberMe = true
+		is.True(!session.IsExpired(policies, now))
+	})
+}
+
+// TestSessionModel_CookieMaxAge tests that only remembered sessions get a persistent cookie that
+// ends with their maximum lifetime
+func TestSessionModel_CookieMaxAge(t *testing.T) {
+	is := is.New(t)
+	now := time.Now().UTC()
+
+	session, err := models.NewSession(uuid.New(), models.HashSessionSecret("secret"), now.Add(time.Hour))
+	is.NoErr(err)
+	session.AuthenticatedAt = now.Add(-24 * time.Hour)
+	is.Equal(session.CookieMaxAge(policies, now), 0)
+
+	session.RememberMe = true
+	is.Equal(session.CookieMaxAge(policies, now), int((defaults.RememberMeMaxLifetime - 24*time.Hour).Seconds()))
+}
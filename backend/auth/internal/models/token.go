@@ -0,0 +1,29 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// tokenBytes is the number of random bytes in an opaque token
+const tokenBytes = 32
+
+// GenerateToken creates a random, URL-safe opaque token along with the hash of the token that
+// should be stored in the database in its place
+func GenerateToken() (token string, tokenHash string, err error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex-encoded SHA-256 hash of an opaque token. Tokens have enough entropy
+// that a fast hash is sufficient, unlike passwords.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,39 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+)
+
+// TestToken_GenerateToken tests opaque token generation in the `models` package
+func TestToken_GenerateToken(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("returns token and matching hash", func(t *testing.T) {
+		token, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		is.Equal(len(token), 43)
+		is.Equal(len(tokenHash), 64)
+		is.Equal(models.HashToken(token), tokenHash)
+	})
+
+	t.Run("tokens are unique", func(t *testing.T) {
+		seen := map[string]bool{}
+		for range 100 {
+			token, _, err := models.GenerateToken()
+			is.NoErr(err)
+			is.True(!seen[token])
+			seen[token] = true
+		}
+	})
+
+	t.Run("hash differs from token", func(t *testing.T) {
+		token, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		is.True(token != tokenHash)
+		is.True(models.HashToken(token+"x") != tokenHash)
+	})
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/pkg/apperrors"
+)
+
+// TOTPCredential represents a user's authenticator app enrollment in the `totp_credentials`
+// table. A user has at most one. The secret is stored encrypted; see `pkg/secretbox`.
+type TOTPCredential struct {
+	UserID          uuid.UUID  `gorm:"type:uuid;primary_key"`
+	User            *User      `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`
+	EncryptedSecret string     `gorm:"type:text;not null"`
+	ConfirmedAt     *time.Time `gorm:"type:timestamp"`
+	// LastUsedStep is the TOTP time step of the last accepted code, so a code can't be replayed
+	LastUsedStep int64     `gorm:"type:bigint;not null;default:0"`
+	CreatedAt    time.Time `gorm:"type:timestamp;not null;default:now()"`
+}
+
+// NewTOTPCredential creates a new, unconfirmed TOTPCredential value from a user id and an
+// encrypted secret
+func NewTOTPCredential(userID uuid.UUID, encryptedSecret string) (*TOTPCredential, error) {
+	if userID == uuid.Nil {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	if encryptedSecret == "" {
+		return nil, apperrors.ErrTOTPSecretIsEmpty
+	}
+
+	return &TOTPCredential{
+		UserID:          userID,
+		EncryptedSecret: encryptedSecret,
+		CreatedAt:       time.Now().UTC(),
+	}, nil
+}
+
+// IsConfirmed reports whether the user has proven their authenticator works by entering a code.
+// Unconfirmed credentials are not required at login.
+func (c *TOTPCredential) IsConfirmed() bool {
+	return c.ConfirmedAt != nil
+}
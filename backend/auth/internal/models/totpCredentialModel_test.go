@@ -0,0 +1,39 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestTOTPCredentialModel_NewTOTPCredential tests new TOTPCredential creation in the `models`
+// package
+func TestTOTPCredentialModel_NewTOTPCredential(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("new unconfirmed credential", func(t *testing.T) {
+		cred, err := models.NewTOTPCredential(uuid.New(), "sealed")
+		is.NoErr(err)
+		is.Equal(cred.EncryptedSecret, "sealed")
+		is.True(!cred.IsConfirmed())
+
+		now := time.Now()
+		cred.ConfirmedAt = &now
+		is.True(cred.IsConfirmed())
+	})
+
+	t.Run("fails when user ID is empty", func(t *testing.T) {
+		_, err := models.NewTOTPCredential(uuid.Nil, "sealed")
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("fails when secret is empty", func(t *testing.T) {
+		_, err := models.NewTOTPCredential(uuid.New(), "")
+		is.Equal(err, apperrors.ErrTOTPSecretIsEmpty)
+	})
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,7 +10,12 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"godiscauth/pkg/apperrors"
-	"godiscauth/pkg/config"
+)
+
+// Roles granted to users. Every user has `RoleUser`.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
 )
 
 // User represents a user in the `users` table.
@@ -21,10 +27,26 @@ type User struct {
 	FailedLoginAttempts int        `gorm:"type:integer;default:0"`
 	AccountLocked       bool       `gorm:"type:boolean;default:false"`
 	AccountLockedUntil  *time.Time `gorm:"type:timestamp"`
+	LockoutCount        int        `gorm:"type:integer;default:0"`
+	// AdminLocked is set when an operator locks the user out, until AdminLockedUntil or
+	// indefinitely if that is nil. Unlike a lockout after failed logins, resetting the password
+	// doesn't lift it.
+	AdminLocked        bool       `gorm:"type:boolean;not null;default:false"`
+	AdminLockedUntil   *time.Time `gorm:"type:timestamp"`
+	EmailVerifiedAt    *time.Time `gorm:"type:timestamp"`
+	VerificationSentAt *time.Time `gorm:"type:timestamp"`
+	// Roles is a comma separated list of the user's roles
+	Roles string `gorm:"type:text;not null;default:'user'"`
+}
+
+// ValidatePassword enforces minimum password complexity
+func ValidatePassword(password string, minEntropyBits float64) error {
+	return passwordvalidator.Validate(password, minEntropyBits)
 }
 
-// NewUser creates a new User value from an email and password.
-func NewUser(email string, password string) (*User, error) {
+// NewUser creates a new User value from an email and a password with at least minEntropyBits bits
+// of entropy.
+func NewUser(email string, password string, minEntropyBits float64) (*User, error) {
 	// Hash password
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -40,10 +62,34 @@ func NewUser(email string, password string) (*User, error) {
 		return nil, apperrors.ErrEmailMaxLength
 	}
 
-	// Enforce minimum password complexity
-	if err = passwordvalidator.Validate(password, config.MinEntropyBits); err != nil {
+	if err = ValidatePassword(password, minEntropyBits); err != nil {
 		return nil, err
 	}
 
-	return &User{Email: email, Password: string(hash)}, err
+	return &User{Email: email, Password: string(hash), Roles: RoleUser}, err
+}
+
+// IsLocked reports whether the account is locked at the given time, after failed logins or by an
+// operator. A lock without an until time never expires on its own.
+func (u *User) IsLocked(at time.Time) bool {
+	return lockActive(u.AccountLocked, u.AccountLockedUntil, at) ||
+		lockActive(u.AdminLocked, u.AdminLockedUntil, at)
+}
+
+// lockActive reports whether a lock that is set until the given time is in effect at `at`
+func lockActive(locked bool, until *time.Time, at time.Time) bool {
+	return locked && (until == nil || at.Before(*until))
+}
+
+// IsEmailVerified reports whether the user has proven they own their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// RoleList returns the user's roles as a slice
+func (u *User) RoleList() []string {
+	if u.Roles == "" {
+		return []string{RoleUser}
+	}
+	return strings.Split(u.Roles, ",")
 }
@@ -18,7 +18,7 @@ func TestNewUser(t *testing.T) {
 	// Valid email and password should return nil err, non-nil user value
 	validEmail := "test@newuser.com"
 	t.Run("valid email and password", func(t *testing.T) {
-		user, err := models.NewUser(validEmail, testutils.TestingPassword)
+		user, err := models.NewUser(validEmail, testutils.TestingPassword, testutils.TestingMinEntropyBits)
 		is.True(user != nil)
 		is.NoErr(err)
 
@@ -27,6 +27,8 @@ func TestNewUser(t *testing.T) {
 		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(testutils.TestingPassword))
 		is.NoErr(err)
 
+		// New users only have the user role
+		is.Equal(user.RoleList(), []string{models.RoleUser})
 	})
 
 	// Emails should not exceed 254 chars per RFC3696
@@ -38,7 +40,7 @@ func TestNewUser(t *testing.T) {
 		}
 		exceeds254Chars += ".com"
 
-		user, err := models.NewUser(exceeds254Chars, testutils.TestingPassword)
+		user, err := models.NewUser(exceeds254Chars, testutils.TestingPassword, testutils.TestingMinEntropyBits)
 		is.Equal(user, nil)
 		is.True(err == apperrors.ErrEmailMaxLength)
 	})
@@ -58,7 +60,7 @@ func TestNewUser(t *testing.T) {
 
 	for name, email := range invalidFormats {
 		t.Run(name, func(t *testing.T) {
-			user, err := models.NewUser(email, testutils.TestingPassword)
+			user, err := models.NewUser(email, testutils.TestingPassword, testutils.TestingMinEntropyBits)
 			is.Equal(user, nil)
 			is.True(err != nil)
 		})
@@ -74,7 +76,7 @@ func TestNewUser(t *testing.T) {
 
 	for name, password := range invalidPasswords {
 		t.Run(name, func(t *testing.T) {
-			_, err := models.NewUser(validEmail, password)
+			_, err := models.NewUser(validEmail, password, testutils.TestingMinEntropyBits)
 			is.True(err != nil)
 		})
 	}
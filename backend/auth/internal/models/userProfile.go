@@ -5,4 +5,6 @@ import "time"
 type UserProfile struct {
 	Email     string     `gorm:"type:varchar(255);not null;unique"`
 	LastLogin *time.Time `gorm:"type:timestamp"`
+
+	EmailVerifiedAt *time.Time `gorm:"type:timestamp"`
 }
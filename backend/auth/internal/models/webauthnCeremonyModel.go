@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/pkg/apperrors"
+)
+
+// WebAuthnCeremonyKind names the passkey ceremony a WebAuthnCeremony was started for
+type WebAuthnCeremonyKind string
+
+const (
+	// WebAuthnCeremonyRegistration adds a passkey to a logged in user's account
+	WebAuthnCeremonyRegistration WebAuthnCeremonyKind = "registration"
+	// WebAuthnCeremonyLogin logs in with a passkey instead of a password
+	WebAuthnCeremonyLogin WebAuthnCeremonyKind = "login"
+	// WebAuthnCeremonySecondFactor answers a two-factor login challenge with a passkey
+	WebAuthnCeremonySecondFactor WebAuthnCeremonyKind = "second_factor"
+)
+
+// WebAuthnCeremony represents a passkey registration or login that has been started but not yet
+// finished in the `webauthn_ceremonies` table. It holds the challenge sent to the browser so the
+// response can be checked against it. Only the hash of the ceremony token is stored.
+type WebAuthnCeremony struct {
+	ID uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	// UserID is nil for passkey logins, where the user is only known once the passkey answers
+	UserID    *uuid.UUID           `gorm:"type:uuid;index"`
+	User      *User                `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`
+	TokenHash string               `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Kind      WebAuthnCeremonyKind `gorm:"type:varchar(32);not null"`
+	// SessionData is the JSON encoded state of the ceremony
+	SessionData string    `gorm:"type:text;not null"`
+	ExpiresAt   time.Time `gorm:"type:timestamp;not null"`
+	CreatedAt   time.Time `gorm:"type:timestamp;not null;default:now()"`
+}
+
+// NewWebAuthnCeremony creates a new WebAuthnCeremony value from an optional user id, a token
+// hash, the kind of ceremony, its encoded state and an expiration time
+func NewWebAuthnCeremony(userID *uuid.UUID, tokenHash string, kind WebAuthnCeremonyKind, sessionData string, expiresAt time.Time) (*WebAuthnCeremony, error) {
+	if userID != nil && *userID == uuid.Nil {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	if tokenHash == "" || kind == "" || sessionData == "" {
+		return nil, apperrors.ErrWebAuthnCeremonyIsEmpty
+	}
+	if expiresAt.IsZero() {
+		return nil, apperrors.ErrExpiresAtIsEmpty
+	}
+
+	return &WebAuthnCeremony{
+		UserID:      userID,
+		TokenHash:   tokenHash,
+		Kind:        kind,
+		SessionData: sessionData,
+		ExpiresAt:   expiresAt.UTC(), // ensure UTC
+		CreatedAt:   time.Now().UTC(),
+	}, nil
+}
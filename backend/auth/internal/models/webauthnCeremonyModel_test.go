@@ -0,0 +1,53 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestWebAuthnCeremonyModel_NewWebAuthnCeremony tests new WebAuthnCeremony creation in the
+// `models` package
+func TestWebAuthnCeremonyModel_NewWebAuthnCeremony(t *testing.T) {
+	is := is.New(t)
+
+	expiresAt := time.Now().Add(time.Minute)
+
+	t.Run("new valid ceremony for a user", func(t *testing.T) {
+		userID := uuid.New()
+		ceremony, err := models.NewWebAuthnCeremony(&userID, "hash", models.WebAuthnCeremonyRegistration, "{}", expiresAt)
+		is.NoErr(err)
+		is.Equal(*ceremony.UserID, userID)
+		is.Equal(ceremony.Kind, models.WebAuthnCeremonyRegistration)
+	})
+
+	t.Run("new valid ceremony without a user", func(t *testing.T) {
+		ceremony, err := models.NewWebAuthnCeremony(nil, "hash", models.WebAuthnCeremonyLogin, "{}", expiresAt)
+		is.NoErr(err)
+		is.True(ceremony.UserID == nil)
+	})
+
+	t.Run("fails when user ID is empty", func(t *testing.T) {
+		_, err := models.NewWebAuthnCeremony(&uuid.Nil, "hash", models.WebAuthnCeremonyLogin, "{}", expiresAt)
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("fails when token hash, kind or data is empty", func(t *testing.T) {
+		_, err := models.NewWebAuthnCeremony(nil, "", models.WebAuthnCeremonyLogin, "{}", expiresAt)
+		is.Equal(err, apperrors.ErrWebAuthnCeremonyIsEmpty)
+		_, err = models.NewWebAuthnCeremony(nil, "hash", "", "{}", expiresAt)
+		is.Equal(err, apperrors.ErrWebAuthnCeremonyIsEmpty)
+		_, err = models.NewWebAuthnCeremony(nil, "hash", models.WebAuthnCeremonyLogin, "", expiresAt)
+		is.Equal(err, apperrors.ErrWebAuthnCeremonyIsEmpty)
+	})
+
+	t.Run("fails when expiration time is empty", func(t *testing.T) {
+		_, err := models.NewWebAuthnCeremony(nil, "hash", models.WebAuthnCeremonyLogin, "{}", time.Time{})
+		is.Equal(err, apperrors.ErrExpiresAtIsEmpty)
+	})
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/pkg/apperrors"
+)
+
+// WebAuthnCredential represents a passkey registered to a user in the `webauthn_credentials`
+// table. A user can have any number of them. Only the public key is stored.
+type WebAuthnCredential struct {
+	ID     uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+	User   *User     `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`
+	// CredentialID is the ID the authenticator assigned to the credential
+	CredentialID    []byte `gorm:"type:bytea;not null;uniqueIndex"`
+	PublicKey       []byte `gorm:"type:bytea;not null"`
+	AttestationType string `gorm:"type:varchar(32);not null;default:''"`
+	// Transports is a comma separated list of the ways the browser can reach the authenticator
+	Transports string `gorm:"type:text;not null;default:''"`
+	AAGUID     []byte `gorm:"column:aaguid;type:bytea"`
+	// SignCount is the authenticator's signature counter from the last accepted assertion. It has
+	// to increase with every use unless the authenticator doesn't keep one, in which case it
+	// stays 0.
+	SignCount      int64      `gorm:"type:bigint;not null;default:0"`
+	BackupEligible bool       `gorm:"type:boolean;not null;default:false"`
+	BackupState    bool       `gorm:"type:boolean;not null;default:false"`
+	CreatedAt      time.Time  `gorm:"type:timestamp;not null;default:now()"`
+	LastUsedAt     *time.Time `gorm:"type:timestamp"`
+}
+
+// NewWebAuthnCredential creates a new WebAuthnCredential value from a user id, the credential
+// ID assigned by the authenticator and its public key
+func NewWebAuthnCredential(userID uuid.UUID, credentialID []byte, publicKey []byte) (*WebAuthnCredential, error) {
+	if userID == uuid.Nil {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	if len(credentialID) == 0 {
+		return nil, apperrors.ErrPasskeyCredentialIDIsEmpty
+	}
+	if len(publicKey) == 0 {
+		return nil, apperrors.ErrPasskeyPublicKeyIsEmpty
+	}
+
+	return &WebAuthnCredential{
+		UserID:       userID,
+		CredentialID: credentialID,
+		PublicKey:    publicKey,
+		CreatedAt:    time.Now().UTC(),
+	}, nil
+}
+
+// TransportList returns the credential's transports as a slice
+func (c *WebAuthnCredential) TransportList() []string {
+	if c.Transports == "" {
+		return nil
+	}
+	return strings.Split(c.Transports, ",")
+}
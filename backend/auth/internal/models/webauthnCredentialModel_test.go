@@ -0,0 +1,52 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestWebAuthnCredentialModel_NewWebAuthnCredential tests new WebAuthnCredential creation in the
+// `models` package
+func TestWebAuthnCredentialModel_NewWebAuthnCredential(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("new valid credential", func(t *testing.T) {
+		userID := uuid.New()
+		cred, err := models.NewWebAuthnCredential(userID, []byte("credential"), []byte("key"))
+		is.NoErr(err)
+		is.Equal(cred.UserID, userID)
+		is.Equal(cred.SignCount, int64(0))
+		is.True(cred.LastUsedAt == nil)
+	})
+
+	t.Run("fails when user ID is empty", func(t *testing.T) {
+		_, err := models.NewWebAuthnCredential(uuid.Nil, []byte("credential"), []byte("key"))
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("fails when credential ID is empty", func(t *testing.T) {
+		_, err := models.NewWebAuthnCredential(uuid.New(), nil, []byte("key"))
+		is.Equal(err, apperrors.ErrPasskeyCredentialIDIsEmpty)
+	})
+
+	t.Run("fails when public key is empty", func(t *testing.T) {
+		_, err := models.NewWebAuthnCredential(uuid.New(), []byte("credential"), nil)
+		is.Equal(err, apperrors.ErrPasskeyPublicKeyIsEmpty)
+	})
+}
+
+// TestWebAuthnCredentialModel_TransportList tests splitting the stored transports
+func TestWebAuthnCredentialModel_TransportList(t *testing.T) {
+	is := is.New(t)
+
+	cred := &models.WebAuthnCredential{}
+	is.Equal(len(cred.TransportList()), 0)
+
+	cred.Transports = "usb,nfc"
+	is.Equal(cred.TransportList(), []string{"usb", "nfc"})
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// MemoryMFAChallengeStore keeps login challenges in the process, for tests and local development.
+// It behaves like `MFAChallengeRepository` without a database.
+type MemoryMFAChallengeStore struct {
+	mu         sync.Mutex
+	challenges map[uuid.UUID]models.MFAChallenge
+	byToken    map[string]uuid.UUID
+}
+
+// NewMemoryMFAChallengeStore returns an empty MemoryMFAChallengeStore
+func NewMemoryMFAChallengeStore() *MemoryMFAChallengeStore {
+	return &MemoryMFAChallengeStore{
+		challenges: make(map[uuid.UUID]models.MFAChallenge),
+		byToken:    make(map[string]uuid.UUID),
+	}
+}
+
+// CreateChallenge stores a new challenge
+func (ms *MemoryMFAChallengeStore) CreateChallenge(challenge *models.MFAChallenge) error {
+	if challenge == nil || challenge.TokenHash == "" {
+		return apperrors.ErrMFAChallengeIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if challenge.ID == uuid.Nil {
+		challenge.ID = uuid.New()
+	}
+	if challenge.CreatedAt.IsZero() {
+		challenge.CreatedAt = time.Now().UTC()
+	}
+	stored := *challenge
+	stored.User = nil
+	ms.challenges[stored.ID] = stored
+	ms.byToken[stored.TokenHash] = stored.ID
+	return nil
+}
+
+// GetChallenge returns an unexpired challenge that still has attempts left without counting an
+// attempt against it
+func (ms *MemoryMFAChallengeStore) GetChallenge(tokenHash string, maxAttempts int) (*models.MFAChallenge, error) {
+	if tokenHash == "" {
+		return nil, apperrors.ErrMFAChallengeIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	challenge, ok := ms.open(tokenHash, maxAttempts)
+	if !ok {
+		return nil, apperrors.ErrInvalidMFAChallenge
+	}
+	return &challenge, nil
+}
+
+// RecordAttempt counts an attempt against an unexpired challenge that still has attempts left and
+// returns it
+func (ms *MemoryMFAChallengeStore) RecordAttempt(tokenHash string, maxAttempts int) (*models.MFAChallenge, error) {
+	if tokenHash == "" {
+		return nil, apperrors.ErrMFAChallengeIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	challenge, ok := ms.open(tokenHash, maxAttempts)
+	if !ok {
+		return nil, apperrors.ErrInvalidMFAChallenge
+	}
+	challenge.Attempts++
+	ms.challenges[challenge.ID] = challenge
+	return &challenge, nil
+}
+
+// DeleteChallenge deletes a challenge, failing if it was already deleted
+func (ms *MemoryMFAChallengeStore) DeleteChallenge(id uuid.UUID) error {
+	if id == uuid.Nil {
+		return apperrors.ErrMFAChallengeIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	challenge, ok := ms.challenges[id]
+	if !ok {
+		return apperrors.ErrInvalidMFAChallenge
+	}
+	delete(ms.challenges, id)
+	delete(ms.byToken, challenge.TokenHash)
+	return nil
+}
+
+// DeleteChallengesByUserID deletes all of a user's challenges
+func (ms *MemoryMFAChallengeStore) DeleteChallengesByUserID(userID string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	id := parseUserID(userID)
+	for challengeID, challenge := range ms.challenges {
+		if challenge.UserID == id {
+			delete(ms.challenges, challengeID)
+			delete(ms.byToken, challenge.TokenHash)
+		}
+	}
+	return nil
+}
+
+// open returns a copy of an unexpired challenge that still has attempts left. The caller holds the
+// lock.
+func (ms *MemoryMFAChallengeStore) open(tokenHash string, maxAttempts int) (models.MFAChallenge, bool) {
+	challenge, ok := ms.challenges[ms.byToken[tokenHash]]
+	if !ok || !challenge.ExpiresAt.After(time.Now()) || challenge.Attempts >= maxAttempts {
+		return models.MFAChallenge{}, false
+	}
+	return challenge, true
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// MemoryPasswordResetStore keeps password reset tokens in the process, for tests and local
+// development. It behaves like `PasswordResetRepository` without a database. Unlike Postgres, it
+// doesn't know which users exist.
+type MemoryPasswordResetStore struct {
+	mu     sync.Mutex
+	tokens map[string]models.PasswordResetToken
+}
+
+// NewMemoryPasswordResetStore returns an empty MemoryPasswordResetStore
+func NewMemoryPasswordResetStore() *MemoryPasswordResetStore {
+	return &MemoryPasswordResetStore{tokens: make(map[string]models.PasswordResetToken)}
+}
+
+// CreateToken stores a new password reset token
+func (ms *MemoryPasswordResetStore) CreateToken(token *models.PasswordResetToken) error {
+	if token == nil || token.TokenHash == "" {
+		return apperrors.ErrResetTokenIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now().UTC()
+	}
+	stored := *token
+	stored.User = nil
+	ms.tokens[stored.TokenHash] = stored
+	return nil
+}
+
+// ConsumeToken marks an unused, unexpired token as used and returns it
+func (ms *MemoryPasswordResetStore) ConsumeToken(tokenHash string) (*models.PasswordResetToken, error) {
+	if tokenHash == "" {
+		return nil, apperrors.ErrResetTokenIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	now := time.Now().UTC()
+	token, ok := ms.tokens[tokenHash]
+	if !ok || token.UsedAt != nil || !token.ExpiresAt.After(now) {
+		return nil, apperrors.ErrInvalidResetToken
+	}
+	token.UsedAt = &now
+	ms.tokens[tokenHash] = token
+	return &token, nil
+}
+
+// DeleteTokensByUserID deletes all password reset tokens belonging to a user
+func (ms *MemoryPasswordResetStore) DeleteTokensByUserID(userID string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for hash, token := range ms.tokens {
+		if token.UserID.String() == userID {
+			delete(ms.tokens, hash)
+		}
+	}
+	return nil
+}
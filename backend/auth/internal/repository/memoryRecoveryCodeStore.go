@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// MemoryRecoveryCodeStore keeps recovery codes in the process, for tests and local development.
+// It behaves like `RecoveryCodeRepository` without a database. Unlike Postgres, it doesn't know
+// which users exist.
+type MemoryRecoveryCodeStore struct {
+	mu    sync.Mutex
+	codes map[uuid.UUID][]models.RecoveryCode
+}
+
+// NewMemoryRecoveryCodeStore returns an empty MemoryRecoveryCodeStore
+func NewMemoryRecoveryCodeStore() *MemoryRecoveryCodeStore {
+	return &MemoryRecoveryCodeStore{codes: make(map[uuid.UUID][]models.RecoveryCode)}
+}
+
+// ReplaceCodes replaces all of a user's recovery codes, used or not, with new ones
+func (ms *MemoryRecoveryCodeStore) ReplaceCodes(userID uuid.UUID, codes []*models.RecoveryCode) error {
+	if userID == uuid.Nil {
+		return apperrors.ErrUserIdEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	stored := make([]models.RecoveryCode, 0, len(codes))
+	now := time.Now().UTC()
+	for _, code := range codes {
+		if code.ID == uuid.Nil {
+			code.ID = uuid.New()
+		}
+		if code.CreatedAt.IsZero() {
+			code.CreatedAt = now
+		}
+		copied := *code
+		copied.User = nil
+		stored = append(stored, copied)
+	}
+	ms.codes[userID] = stored
+	return nil
+}
+
+// GetUnusedCodes returns all of a user's recovery codes that haven't been used
+func (ms *MemoryRecoveryCodeStore) GetUnusedCodes(userID string) ([]models.RecoveryCode, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var unused []models.RecoveryCode
+	for _, code := range ms.codes[parseUserID(userID)] {
+		if code.UsedAt == nil {
+			unused = append(unused, code)
+		}
+	}
+	return unused, nil
+}
+
+// CountUnusedCodes returns the number of recovery codes a user has left
+func (ms *MemoryRecoveryCodeStore) CountUnusedCodes(userID string) (int64, error) {
+	codes, err := ms.GetUnusedCodes(userID)
+	return int64(len(codes)), err
+}
+
+// MarkCodeUsed marks an unused recovery code as used, failing if it was already used
+func (ms *MemoryRecoveryCodeStore) MarkCodeUsed(id uuid.UUID) error {
+	if id == uuid.Nil {
+		return apperrors.ErrMFACodeIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, codes := range ms.codes {
+		for i := range codes {
+			if codes[i].ID == id && codes[i].UsedAt == nil {
+				now := time.Now().UTC()
+				codes[i].UsedAt = &now
+				return nil
+			}
+		}
+	}
+	return apperrors.ErrInvalidMFACode
+}
+
+// DeleteCodesByUserID deletes all recovery codes belonging to a user
+func (ms *MemoryRecoveryCodeStore) DeleteCodesByUserID(userID string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.codes, parseUserID(userID))
+	return nil
+}
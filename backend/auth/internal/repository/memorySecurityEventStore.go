@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// MemorySecurityEventStore keeps security events in the process, for tests and local
+// development. It behaves like `SecurityEventRepository` without a database. Unlike Postgres, it
+// doesn't know which users exist.
+type MemorySecurityEventStore struct {
+	mu     sync.Mutex
+	events []models.SecurityEvent
+}
+
+// NewMemorySecurityEventStore returns an empty MemorySecurityEventStore
+func NewMemorySecurityEventStore() *MemorySecurityEventStore {
+	return &MemorySecurityEventStore{}
+}
+
+// CreateEvent stores a new event
+func (ms *MemorySecurityEventStore) CreateEvent(event *models.SecurityEvent) error {
+	if event == nil {
+		return apperrors.ErrSecurityEventTypeIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+	stored := *event
+	stored.User = nil
+	ms.events = append(ms.events, stored)
+	return nil
+}
+
+// ListEventsByUserID returns a user's most recent events, newest first
+func (ms *MemorySecurityEventStore) ListEventsByUserID(userID string, limit int) ([]models.SecurityEvent, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var events []models.SecurityEvent
+	for _, event := range ms.events {
+		if event.UserID.String() == userID {
+			events = append(events, event)
+		}
+	}
+	slices.SortStableFunc(events, func(a, b models.SecurityEvent) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	if limit >= 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
@@ -0,0 +1,303 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// MemorySessionStore keeps sessions in the process. They are lost when it stops and can't be shared
+// between instances, so it is only suitable for a single instance or local development. Unlike
+// Postgres, it doesn't know which users exist.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]models.Session
+	byToken  map[[sha256.Size]byte]uuid.UUID
+	byUser   map[uuid.UUID]map[uuid.UUID]struct{}
+}
+
+// NewMemorySessionStore returns an empty MemorySessionStore
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[uuid.UUID]models.Session),
+		byToken:  make(map[[sha256.Size]byte]uuid.UUID),
+		byUser:   make(map[uuid.UUID]map[uuid.UUID]struct{}),
+	}
+}
+
+// CreateSession stores a new session
+func (ms *MemorySessionStore) CreateSession(session *models.Session) error {
+	if session == nil {
+		return apperrors.ErrSessionIsNil
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.insert(session)
+}
+
+// CreateSessionWithinLimit stores a new session unless its user already has `limit` unexpired
+// sessions, see `SessionStore`
+func (ms *MemorySessionStore) CreateSessionWithinLimit(session *models.Session, limit int, evictOldest bool) ([]models.Session, error) {
+	if session == nil {
+		return nil, apperrors.ErrSessionIsNil
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if limit <= 0 {
+		return nil, ms.insert(session)
+	}
+
+	active := ms.unexpired(session.UserID, time.Now())
+	slices.SortFunc(active, compareAuthenticatedAt)
+	evicted, err := sessionsToEvict(active, limit, evictOldest)
+	if err != nil {
+		return nil, err
+	}
+	if err := ms.checkUnique(session); err != nil {
+		return nil, err
+	}
+	for _, s := range evicted {
+		ms.remove(s.ID)
+	}
+	return evicted, ms.insert(session)
+}
+
+// GetUnexpiredSessionByID returns an unexpired session by its ID
+func (ms *MemorySessionStore) GetUnexpiredSessionByID(sessionID uuid.UUID) (*models.Session, error) {
+	if sessionID == uuid.Nil {
+		return nil, apperrors.ErrSessionIdIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	session, ok := ms.sessions[sessionID]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &session, nil
+}
+
+// GetUnexpiredSessionByTokenHash returns an unexpired session by the hash of its token's secret
+func (ms *MemorySessionStore) GetUnexpiredSessionByTokenHash(tokenHash []byte) (*models.Session, error) {
+	if len(tokenHash) == 0 {
+		return nil, apperrors.ErrSessionIdIsEmpty
+	}
+	if len(tokenHash) != sha256.Size {
+		return nil, gorm.ErrRecordNotFound
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	session, ok := ms.sessions[ms.byToken[[sha256.Size]byte(tokenHash)]]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	// The map lookup isn't constant time, so don't trust it alone
+	if subtle.ConstantTimeCompare(session.TokenHash, tokenHash) != 1 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &session, nil
+}
+
+// GetUnexpiredSessionsByUserID returns a user's unexpired sessions, most recently seen first
+func (ms *MemorySessionStore) GetUnexpiredSessionsByUserID(userID string) ([]models.Session, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	sessions := ms.unexpired(id, time.Now())
+	slices.SortFunc(sessions, compareLastSeenAtDesc)
+	return sessions, nil
+}
+
+// TouchSession records that a session was just used from an IP address and moves its expiration
+// time
+func (ms *MemorySessionStore) TouchSession(sessionID uuid.UUID, clientIP string, seenAt, expiresAt time.Time) error {
+	if sessionID == uuid.Nil {
+		return apperrors.ErrSessionIdIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	session, ok := ms.sessions[sessionID]
+	if !ok {
+		return nil
+	}
+	session.LastSeenAt = seenAt
+	session.ClientIP = clientIP
+	session.ExpiresAt = expiresAt
+	ms.sessions[sessionID] = session
+	return nil
+}
+
+// ReplaceSession deletes a session and stores the one replacing it at once
+func (ms *MemorySessionStore) ReplaceSession(oldSessionID uuid.UUID, session *models.Session) error {
+	if oldSessionID == uuid.Nil {
+		return apperrors.ErrSessionIdIsEmpty
+	}
+	if session == nil {
+		return apperrors.ErrSessionIsNil
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if err := ms.insert(session); err != nil {
+		return err
+	}
+	ms.remove(oldSessionID)
+	return nil
+}
+
+// DeleteUserSession deletes one of a user's sessions. Sessions of other users are not found.
+func (ms *MemorySessionStore) DeleteUserSession(userID string, sessionID uuid.UUID) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	if sessionID == uuid.Nil {
+		return apperrors.ErrSessionIdIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	session, ok := ms.sessions[sessionID]
+	if !ok || session.UserID.String() != userID {
+		return gorm.ErrRecordNotFound
+	}
+	ms.remove(sessionID)
+	return nil
+}
+
+// DeleteSessionByID deletes a session
+func (ms *MemorySessionStore) DeleteSessionByID(sessionID uuid.UUID) error {
+	if sessionID == uuid.Nil {
+		return apperrors.ErrSessionIdIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.sessions[sessionID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	ms.remove(sessionID)
+	return nil
+}
+
+// DeleteSessionsByUserID deletes all of a user's sessions
+func (ms *MemorySessionStore) DeleteSessionsByUserID(userID string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if len(ms.byUser[id]) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	for sessionID := range ms.byUser[id] {
+		ms.remove(sessionID)
+	}
+	return nil
+}
+
+// DeleteExpiredSessions deletes up to limit sessions that expired before the given time, oldest
+// first, and returns how many were deleted
+func (ms *MemorySessionStore) DeleteExpiredSessions(before time.Time, limit int) (int64, error) {
+	if limit <= 0 {
+		return 0, apperrors.ErrInvalidBatchSize
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var expired []models.Session
+	for _, session := range ms.sessions {
+		if !session.ExpiresAt.After(before) {
+			expired = append(expired, session)
+		}
+	}
+	slices.SortFunc(expired, func(a, b models.Session) int { return a.ExpiresAt.Compare(b.ExpiresAt) })
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+	for _, session := range expired {
+		ms.remove(session.ID)
+	}
+	return int64(len(expired)), nil
+}
+
+// CountUnexpiredSessions returns the number of sessions that haven't expired at the given time
+func (ms *MemorySessionStore) CountUnexpiredSessions(now time.Time) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var count int64
+	for _, session := range ms.sessions {
+		if session.ExpiresAt.After(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// checkUnique fails if a session's ID or token hash is taken. The caller holds the lock.
+func (ms *MemorySessionStore) checkUnique(session *models.Session) error {
+	if _, ok := ms.sessions[session.ID]; ok {
+		return apperrors.ErrSessionAlreadyExists
+	}
+	if len(session.TokenHash) != sha256.Size {
+		return apperrors.ErrSessionIdIsEmpty
+	}
+	if _, ok := ms.byToken[[sha256.Size]byte(session.TokenHash)]; ok {
+		return apperrors.ErrSessionAlreadyExists
+	}
+	return nil
+}
+
+// insert stores a copy of a new session. The caller holds the lock.
+func (ms *MemorySessionStore) insert(session *models.Session) error {
+	prepareNewSession(session, time.Now())
+	if err := ms.checkUnique(session); err != nil {
+		return err
+	}
+	stored := *session
+	stored.User = nil
+	ms.sessions[stored.ID] = stored
+	ms.byToken[[sha256.Size]byte(stored.TokenHash)] = stored.ID
+	if ms.byUser[stored.UserID] == nil {
+		ms.byUser[stored.UserID] = make(map[uuid.UUID]struct{})
+	}
+	ms.byUser[stored.UserID][stored.ID] = struct{}{}
+	return nil
+}
+
+// remove deletes a session and its index entries. The caller holds the lock.
+func (ms *MemorySessionStore) remove(sessionID uuid.UUID) {
+	session, ok := ms.sessions[sessionID]
+	if !ok {
+		return
+	}
+	delete(ms.sessions, sessionID)
+	delete(ms.byToken, [sha256.Size]byte(session.TokenHash))
+	delete(ms.byUser[session.UserID], sessionID)
+	if len(ms.byUser[session.UserID]) == 0 {
+		delete(ms.byUser, session.UserID)
+	}
+}
+
+// unexpired returns copies of a user's unexpired sessions. The caller holds the lock.
+func (ms *MemorySessionStore) unexpired(userID uuid.UUID, now time.Time) []models.Session {
+	var sessions []models.Session
+	for sessionID := range ms.byUser[userID] {
+		if session := ms.sessions[sessionID]; session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// MemoryTOTPStore keeps TOTP credentials in the process, for tests and local development. It
+// behaves like `TOTPRepository`, including its conditional updates, without a database. Unlike
+// Postgres, it doesn't know which users exist.
+type MemoryTOTPStore struct {
+	mu          sync.Mutex
+	credentials map[uuid.UUID]models.TOTPCredential
+}
+
+// NewMemoryTOTPStore returns an empty MemoryTOTPStore
+func NewMemoryTOTPStore() *MemoryTOTPStore {
+	return &MemoryTOTPStore{credentials: make(map[uuid.UUID]models.TOTPCredential)}
+}
+
+// GetCredentialByUserID returns a user's credential, confirmed or not
+func (ms *MemoryTOTPStore) GetCredentialByUserID(userID string) (*models.TOTPCredential, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	cred, ok := ms.credentials[parseUserID(userID)]
+	if !ok {
+		return nil, apperrors.ErrMFANotEnrolled
+	}
+	return &cred, nil
+}
+
+// SavePendingCredential stores an unconfirmed credential, replacing an unconfirmed one
+func (ms *MemoryTOTPStore) SavePendingCredential(cred *models.TOTPCredential) error {
+	if cred == nil {
+		return apperrors.ErrTOTPSecretIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if existing, ok := ms.credentials[cred.UserID]; ok && existing.IsConfirmed() {
+		return apperrors.ErrMFAAlreadyEnabled
+	}
+	if cred.CreatedAt.IsZero() {
+		cred.CreatedAt = time.Now().UTC()
+	}
+	stored := *cred
+	stored.User = nil
+	ms.credentials[stored.UserID] = stored
+	return nil
+}
+
+// ConfirmCredential confirms a user's pending credential with a code from a later time step than
+// any used before
+func (ms *MemoryTOTPStore) ConfirmCredential(userID string, step int64, at time.Time) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	id := parseUserID(userID)
+	cred, ok := ms.credentials[id]
+	if !ok || cred.IsConfirmed() || cred.LastUsedStep >= step {
+		return apperrors.ErrInvalidMFACode
+	}
+	at = at.UTC()
+	cred.ConfirmedAt = &at
+	cred.LastUsedStep = step
+	ms.credentials[id] = cred
+	return nil
+}
+
+// UseStep records that a code from a later time step than any used before was accepted for a
+// user's confirmed credential
+func (ms *MemoryTOTPStore) UseStep(userID string, step int64) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	id := parseUserID(userID)
+	cred, ok := ms.credentials[id]
+	if !ok || !cred.IsConfirmed() || cred.LastUsedStep >= step {
+		return apperrors.ErrInvalidMFACode
+	}
+	cred.LastUsedStep = step
+	ms.credentials[id] = cred
+	return nil
+}
+
+// DeleteCredential deletes a user's credential
+func (ms *MemoryTOTPStore) DeleteCredential(userID string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	id := parseUserID(userID)
+	if _, ok := ms.credentials[id]; !ok {
+		return apperrors.ErrMFANotEnrolled
+	}
+	delete(ms.credentials, id)
+	return nil
+}
+
+// parseUserID parses the ID of a user the memory stores look up. Invalid IDs belong to no user, so
+// they parse as `uuid.Nil`, which no record has.
+func parseUserID(userID string) uuid.UUID {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
@@ -0,0 +1,338 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// MemoryUserStore keeps users in the process, for tests and local development. It behaves like
+// `UserRepository`, including its conditional updates, without a database.
+type MemoryUserStore struct {
+	mu      sync.Mutex
+	users   map[uuid.UUID]models.User
+	byEmail map[string]uuid.UUID
+}
+
+// NewMemoryUserStore returns an empty MemoryUserStore
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		users:   make(map[uuid.UUID]models.User),
+		byEmail: make(map[string]uuid.UUID),
+	}
+}
+
+// RegisterUser stores a new user
+func (ms *MemoryUserStore) RegisterUser(u *models.User) error {
+	if u == nil {
+		return apperrors.ErrUserIsNil
+	}
+	if u.Email == "" {
+		return apperrors.ErrEmailIsEmpty
+	}
+	if u.Password == "" {
+		return apperrors.ErrPasswordIsEmpty
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	if u.Roles == "" {
+		u.Roles = models.RoleUser
+	}
+	_, idTaken := ms.users[u.ID]
+	_, emailTaken := ms.byEmail[u.Email]
+	if idTaken || emailTaken {
+		return apperrors.ErrDuplicateEmail
+	}
+	ms.users[u.ID] = *u
+	ms.byEmail[u.Email] = u.ID
+	return nil
+}
+
+// GetUserByEmail returns a user by email
+func (ms *MemoryUserStore) GetUserByEmail(email string) (*models.User, error) {
+	if email == "" {
+		return nil, apperrors.ErrEmailIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	user, ok := ms.users[ms.byEmail[email]]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+// GetUserByID returns a user by ID
+func (ms *MemoryUserStore) GetUserByID(userID string) (*models.User, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	user, ok := ms.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+// PermanentlyDeleteUser deletes a user and returns how many users were deleted
+func (ms *MemoryUserStore) PermanentlyDeleteUser(userID string) (int64, error) {
+	if userID == "" {
+		return 0, apperrors.ErrUserIdEmpty
+	}
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return 0, err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	user, ok := ms.users[id]
+	if !ok {
+		return 0, nil
+	}
+	delete(ms.users, id)
+	delete(ms.byEmail, user.Email)
+	return 1, nil
+}
+
+// UpdateUser sets a user's columns, keyed by column name like the `users` table. The whole update
+// fails if a value doesn't fit its column.
+func (ms *MemoryUserStore) UpdateUser(userID string, request map[string]any) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	return ms.update(userID, func(user *models.User) error {
+		if len(request) == 0 {
+			return apperrors.ErrCouldNotUpdateUser
+		}
+		for column, value := range request {
+			if err := setUserColumn(user, column, value); err != nil {
+				return err
+			}
+		}
+		if id, ok := ms.byEmail[user.Email]; ok && id != user.ID {
+			return apperrors.ErrDuplicateEmail
+		}
+		return nil
+	})
+}
+
+// IncrementFailedLogins counts a failed login of a user who is not locked out and returns the new
+// count
+func (ms *MemoryUserStore) IncrementFailedLogins(userID string) (int, error) {
+	if userID == "" {
+		return 0, apperrors.ErrUserIdEmpty
+	}
+	var attempts int
+	err := ms.update(userID, func(user *models.User) error {
+		if user.IsLocked(time.Now().UTC()) {
+			return apperrors.ErrAccountIsLocked
+		}
+		user.FailedLoginAttempts++
+		attempts = user.FailedLoginAttempts
+		return nil
+	})
+	return attempts, err
+}
+
+// LockAccount locks a user until the given time, unless they are already locked out
+func (ms *MemoryUserStore) LockAccount(userID string, until time.Time) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	return ms.update(userID, func(user *models.User) error {
+		if user.IsLocked(time.Now().UTC()) {
+			return nil
+		}
+		until := until.UTC()
+		user.AccountLocked = true
+		user.AccountLockedUntil = &until
+		user.FailedLoginAttempts = 0
+		user.LockoutCount++
+		return nil
+	})
+}
+
+// RecordSuccessfulLogin sets a user's last login time and resets their lockout counters, provided
+// they are not locked out
+func (ms *MemoryUserStore) RecordSuccessfulLogin(userID string, at time.Time) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	return ms.update(userID, func(user *models.User) error {
+		if user.IsLocked(time.Now().UTC()) {
+			return apperrors.ErrAccountIsLocked
+		}
+		at := at.UTC()
+		user.LastLogin = &at
+		unlock(user)
+		return nil
+	})
+}
+
+// UnlockAccount lifts any lock on a user, including one set by an operator, and resets their
+// lockout counters
+func (ms *MemoryUserStore) UnlockAccount(userID string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	return ms.update(userID, func(user *models.User) error {
+		unlock(user)
+		user.AdminLocked = false
+		user.AdminLockedUntil = nil
+		return nil
+	})
+}
+
+// ClearLockout lifts a lock after failed logins and resets the lockout counters, leaving a lock set
+// by an operator in place
+func (ms *MemoryUserStore) ClearLockout(userID string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	return ms.update(userID, func(user *models.User) error {
+		unlock(user)
+		return nil
+	})
+}
+
+// ClaimVerificationSend records that a verification email is being sent to an unverified user,
+// unless one was sent after throttleBefore
+func (ms *MemoryUserStore) ClaimVerificationSend(userID string, throttleBefore time.Time) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	return ms.update(userID, func(user *models.User) error {
+		if user.IsEmailVerified() {
+			return apperrors.ErrEmailAlreadyVerified
+		}
+		if user.VerificationSentAt != nil && user.VerificationSentAt.After(throttleBefore) {
+			return apperrors.ErrVerificationThrottled
+		}
+		now := time.Now().UTC()
+		user.VerificationSentAt = &now
+		return nil
+	})
+}
+
+// MarkEmailVerified records that a user verified their email, provided they still have it. Verifying
+// an already verified email keeps the original verification time.
+func (ms *MemoryUserStore) MarkEmailVerified(userID string, email string, at time.Time) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	if email == "" {
+		return apperrors.ErrEmailIsEmpty
+	}
+	return ms.update(userID, func(user *models.User) error {
+		if user.Email != email {
+			return apperrors.ErrUserNotFound
+		}
+		if user.EmailVerifiedAt == nil {
+			at := at.UTC()
+			user.EmailVerifiedAt = &at
+		}
+		return nil
+	})
+}
+
+// update applies fn to a copy of a user and stores the copy if fn succeeds
+func (ms *MemoryUserStore) update(userID string, fn func(*models.User) error) error {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return apperrors.ErrUserNotFound
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	user, ok := ms.users[id]
+	if !ok {
+		return apperrors.ErrUserNotFound
+	}
+	oldEmail := user.Email
+	if err := fn(&user); err != nil {
+		return err
+	}
+	delete(ms.byEmail, oldEmail)
+	ms.byEmail[user.Email] = user.ID
+	ms.users[id] = user
+	return nil
+}
+
+// unlock lifts a user's lock after failed logins and resets their lockout counters
+func unlock(user *models.User) {
+	user.FailedLoginAttempts = 0
+	user.LockoutCount = 0
+	user.AccountLocked = false
+	user.AccountLockedUntil = nil
+}
+
+// setUserColumn sets the field of a user stored in a column of the `users` table
+func setUserColumn(user *models.User, column string, value any) error {
+	var ok bool
+	switch column {
+	case "email":
+		user.Email, ok = value.(string)
+	case "password":
+		user.Password, ok = value.(string)
+	case "roles":
+		user.Roles, ok = value.(string)
+	case "failed_login_attempts":
+		user.FailedLoginAttempts, ok = value.(int)
+	case "lockout_count":
+		user.LockoutCount, ok = value.(int)
+	case "account_locked":
+		user.AccountLocked, ok = value.(bool)
+	case "last_login":
+		user.LastLogin, ok = timeColumn(value)
+	case "account_locked_until":
+		user.AccountLockedUntil, ok = timeColumn(value)
+	case "admin_locked":
+		user.AdminLocked, ok = value.(bool)
+	case "admin_locked_until":
+		user.AdminLockedUntil, ok = timeColumn(value)
+	case "email_verified_at":
+		user.EmailVerifiedAt, ok = timeColumn(value)
+	case "verification_sent_at":
+		user.VerificationSentAt, ok = timeColumn(value)
+	default:
+		return fmt.Errorf("%w: %q", apperrors.ErrUnknownUserColumn, column)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %q", apperrors.ErrInvalidUserColumnValue, column)
+	}
+	return nil
+}
+
+// timeColumn converts the value of a nullable timestamp column
+func timeColumn(value any) (*time.Time, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, true
+	case time.Time:
+		v = v.UTC()
+		return &v, true
+	case *time.Time:
+		if v == nil {
+			return nil, true
+		}
+		t := v.UTC()
+		return &t, true
+	default:
+		return nil, false
+	}
+}
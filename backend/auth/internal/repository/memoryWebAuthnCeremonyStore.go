@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// MemoryWebAuthnCeremonyStore keeps started passkey ceremonies in the process, for tests and local
+// development. It behaves like `WebAuthnCeremonyRepository` without a database.
+type MemoryWebAuthnCeremonyStore struct {
+	mu         sync.Mutex
+	ceremonies map[string]models.WebAuthnCeremony
+}
+
+// NewMemoryWebAuthnCeremonyStore returns an empty MemoryWebAuthnCeremonyStore
+func NewMemoryWebAuthnCeremonyStore() *MemoryWebAuthnCeremonyStore {
+	return &MemoryWebAuthnCeremonyStore{ceremonies: make(map[string]models.WebAuthnCeremony)}
+}
+
+// CreateCeremony stores a newly started passkey ceremony
+func (ms *MemoryWebAuthnCeremonyStore) CreateCeremony(ceremony *models.WebAuthnCeremony) error {
+	if ceremony == nil || ceremony.TokenHash == "" {
+		return apperrors.ErrWebAuthnCeremonyIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ceremony.ID == uuid.Nil {
+		ceremony.ID = uuid.New()
+	}
+	if ceremony.CreatedAt.IsZero() {
+		ceremony.CreatedAt = time.Now().UTC()
+	}
+	stored := *ceremony
+	stored.User = nil
+	ms.ceremonies[stored.TokenHash] = stored
+	return nil
+}
+
+// ConsumeCeremony deletes and returns an unexpired ceremony of the given kind
+func (ms *MemoryWebAuthnCeremonyStore) ConsumeCeremony(tokenHash string, kind models.WebAuthnCeremonyKind) (*models.WebAuthnCeremony, error) {
+	if tokenHash == "" {
+		return nil, apperrors.ErrWebAuthnCeremonyIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ceremony, ok := ms.ceremonies[tokenHash]
+	if !ok || ceremony.Kind != kind || !ceremony.ExpiresAt.After(time.Now()) {
+		return nil, apperrors.ErrInvalidWebAuthnCeremony
+	}
+	delete(ms.ceremonies, tokenHash)
+	return &ceremony, nil
+}
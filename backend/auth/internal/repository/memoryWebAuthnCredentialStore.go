@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// MemoryWebAuthnCredentialStore keeps passkeys in the process, for tests and local development.
+// It behaves like `WebAuthnCredentialRepository` without a database. Unlike Postgres, it doesn't
+// know which users exist.
+type MemoryWebAuthnCredentialStore struct {
+	mu sync.Mutex
+	// credentials are kept in the order they were registered, which is oldest first
+	credentials []models.WebAuthnCredential
+}
+
+// NewMemoryWebAuthnCredentialStore returns an empty MemoryWebAuthnCredentialStore
+func NewMemoryWebAuthnCredentialStore() *MemoryWebAuthnCredentialStore {
+	return &MemoryWebAuthnCredentialStore{}
+}
+
+// CreateCredential stores a newly registered passkey, failing if the authenticator's credential
+// ID is already registered to any user
+func (ms *MemoryWebAuthnCredentialStore) CreateCredential(cred *models.WebAuthnCredential) error {
+	if cred == nil || len(cred.CredentialID) == 0 {
+		return apperrors.ErrPasskeyCredentialIDIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, existing := range ms.credentials {
+		if bytes.Equal(existing.CredentialID, cred.CredentialID) {
+			return apperrors.ErrPasskeyAlreadyRegistered
+		}
+	}
+	if cred.ID == uuid.Nil {
+		cred.ID = uuid.New()
+	}
+	if cred.CreatedAt.IsZero() {
+		cred.CreatedAt = time.Now().UTC()
+	}
+	stored := *cred
+	stored.User = nil
+	ms.credentials = append(ms.credentials, stored)
+	return nil
+}
+
+// GetCredentialsByUserID returns all of a user's passkeys, oldest first
+func (ms *MemoryWebAuthnCredentialStore) GetCredentialsByUserID(userID string) ([]models.WebAuthnCredential, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var creds []models.WebAuthnCredential
+	for _, cred := range ms.credentials {
+		if cred.UserID.String() == userID {
+			creds = append(creds, cred)
+		}
+	}
+	return creds, nil
+}
+
+// CountCredentialsByUserID returns the number of passkeys a user has registered
+func (ms *MemoryWebAuthnCredentialStore) CountCredentialsByUserID(userID string) (int64, error) {
+	creds, err := ms.GetCredentialsByUserID(userID)
+	return int64(len(creds)), err
+}
+
+// UpdateSignCount records a successful assertion by storing the authenticator's new signature
+// counter, which has to be greater than the stored one unless both are 0
+func (ms *MemoryWebAuthnCredentialStore) UpdateSignCount(id uuid.UUID, signCount uint32, backupState bool, usedAt time.Time) error {
+	if id == uuid.Nil {
+		return apperrors.ErrPasskeyCredentialIDIsEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for i := range ms.credentials {
+		cred := &ms.credentials[i]
+		if cred.ID != id {
+			continue
+		}
+		if cred.SignCount >= int64(signCount) && (cred.SignCount != 0 || signCount != 0) {
+			break
+		}
+		usedAt = usedAt.UTC()
+		cred.SignCount = int64(signCount)
+		cred.BackupState = backupState
+		cred.LastUsedAt = &usedAt
+		return nil
+	}
+	return apperrors.ErrPasskeySignCountRejected
+}
+
+// DeleteCredential deletes one of a user's passkeys
+func (ms *MemoryWebAuthnCredentialStore) DeleteCredential(userID string, id uuid.UUID) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for i, cred := range ms.credentials {
+		if cred.ID == id && id != uuid.Nil && cred.UserID.String() == userID {
+			ms.credentials = append(ms.credentials[:i], ms.credentials[i+1:]...)
+			return nil
+		}
+	}
+	return apperrors.ErrPasskeyNotFound
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// MFAChallengeRepository represents the entry point into the database for managing the
+// `mfa_challenges` table
+type MFAChallengeRepository struct {
+	DB *gorm.DB
+}
+
+// NewMFAChallengeRepository returns a value for the MFAChallengeRepository struct
+func NewMFAChallengeRepository(db *gorm.DB) (*MFAChallengeRepository, error) {
+	if db == nil {
+		return nil, apperrors.ErrDatabaseIsNil
+	}
+	return &MFAChallengeRepository{DB: db}, nil
+}
+
+// CreateChallenge inserts a new login challenge into the `mfa_challenges` table
+func (mr *MFAChallengeRepository) CreateChallenge(challenge *models.MFAChallenge) error {
+	if challenge == nil || challenge.TokenHash == "" {
+		return apperrors.ErrMFAChallengeIsEmpty
+	}
+	return mr.DB.Create(challenge).Error
+}
+
+// GetChallenge gets an unexpired challenge that still has attempts left without counting an
+// attempt against it. Returns `apperrors.ErrInvalidMFAChallenge` if there is no such challenge.
+func (mr *MFAChallengeRepository) GetChallenge(tokenHash string, maxAttempts int) (*models.MFAChallenge, error) {
+	if tokenHash == "" {
+		return nil, apperrors.ErrMFAChallengeIsEmpty
+	}
+
+	var challenge models.MFAChallenge
+	err := mr.DB.
+		Where("token_hash = ? AND expires_at > ? AND attempts < ?", tokenHash, time.Now().UTC(), maxAttempts).
+		First(&challenge).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apperrors.ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// RecordAttempt atomically counts an attempt against an unexpired challenge and returns it.
+// Returns `apperrors.ErrInvalidMFAChallenge` if the challenge doesn't exist, has expired or has
+// already had `maxAttempts` attempts, so codes can't be guessed faster by racing requests.
+func (mr *MFAChallengeRepository) RecordAttempt(tokenHash string, maxAttempts int) (*models.MFAChallenge, error) {
+	if tokenHash == "" {
+		return nil, apperrors.ErrMFAChallengeIsEmpty
+	}
+
+	var challenges []models.MFAChallenge
+	result := mr.DB.Model(&challenges).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND expires_at > ? AND attempts < ?", tokenHash, time.Now().UTC(), maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || len(challenges) == 0 {
+		return nil, apperrors.ErrInvalidMFAChallenge
+	}
+	return &challenges[0], nil
+}
+
+// DeleteChallenge deletes a challenge once it has been used. Returns
+// `apperrors.ErrInvalidMFAChallenge` if it was already deleted, so a challenge can only be
+// exchanged for one session.
+func (mr *MFAChallengeRepository) DeleteChallenge(id uuid.UUID) error {
+	if id == uuid.Nil {
+		return apperrors.ErrMFAChallengeIsEmpty
+	}
+
+	result := mr.DB.Where("id = ?", id).Delete(&models.MFAChallenge{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.ErrInvalidMFAChallenge
+	}
+	return nil
+}
+
+// DeleteChallengesByUserID deletes all pending login challenges belonging to a user
+func (mr *MFAChallengeRepository) DeleteChallengesByUserID(userID string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	return mr.DB.Where("user_id = ?", userID).Delete(&models.MFAChallenge{}).Error
+}
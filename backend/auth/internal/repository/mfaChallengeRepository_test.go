@@ -0,0 +1,140 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestMFAChallengeRepository_NewMFAChallengeRepository tests creation of MFAChallengeRepository
+// structs in the `repository` package
+func TestMFAChallengeRepository_NewMFAChallengeRepository(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("returns err with nil db", func(t *testing.T) {
+		cr, err := repository.NewMFAChallengeRepository(nil)
+		is.Equal(cr, nil)
+		is.Equal(err, apperrors.ErrDatabaseIsNil)
+	})
+
+	t.Run("creates new MFA challenge repo", func(t *testing.T) {
+		cr := setupMFAChallengeRepository(t)
+		is.True(cr != nil)
+	})
+}
+
+func TestMFAChallengeRepository_GetChallenge(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("does not count an attempt", func(t *testing.T) {
+		cr := setupMFAChallengeRepository(t)
+		user := createTestUser(t, cr.DB, "testGetChallenge@test.com")
+
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		challenge, err := models.NewMFAChallenge(user.ID, tokenHash, time.Now().Add(time.Minute))
+		is.NoErr(err)
+		is.NoErr(cr.CreateChallenge(challenge))
+
+		found, err := cr.GetChallenge(tokenHash, 1)
+		is.NoErr(err)
+		is.Equal(found.UserID, user.ID)
+		is.Equal(found.Attempts, 0)
+
+		// Out of attempts
+		_, err = cr.RecordAttempt(tokenHash, 1)
+		is.NoErr(err)
+		_, err = cr.GetChallenge(tokenHash, 1)
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+	})
+
+	t.Run("fails on expired challenge", func(t *testing.T) {
+		cr := setupMFAChallengeRepository(t)
+		user := createTestUser(t, cr.DB, "testGetChallenge@test.com")
+
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		challenge, err := models.NewMFAChallenge(user.ID, tokenHash, time.Now().Add(-time.Minute))
+		is.NoErr(err)
+		is.NoErr(cr.CreateChallenge(challenge))
+
+		_, err = cr.GetChallenge(tokenHash, 1)
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+	})
+}
+
+func TestMFAChallengeRepository_RecordAttempt(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("counts attempts up to the limit", func(t *testing.T) {
+		cr := setupMFAChallengeRepository(t)
+		user := createTestUser(t, cr.DB, "testRecordAttempt@test.com")
+
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		challenge, err := models.NewMFAChallenge(user.ID, tokenHash, time.Now().Add(time.Minute))
+		is.NoErr(err)
+		is.NoErr(cr.CreateChallenge(challenge))
+
+		for attempt := 1; attempt <= 3; attempt++ {
+			recorded, err := cr.RecordAttempt(tokenHash, 3)
+			is.NoErr(err)
+			is.Equal(recorded.Attempts, attempt)
+			is.Equal(recorded.UserID, user.ID)
+		}
+		_, err = cr.RecordAttempt(tokenHash, 3)
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+	})
+
+	t.Run("fails on expired challenge", func(t *testing.T) {
+		cr := setupMFAChallengeRepository(t)
+		user := createTestUser(t, cr.DB, "testRecordAttempt@test.com")
+
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		challenge, err := models.NewMFAChallenge(user.ID, tokenHash, time.Now().Add(-time.Minute))
+		is.NoErr(err)
+		is.NoErr(cr.CreateChallenge(challenge))
+
+		_, err = cr.RecordAttempt(tokenHash, 3)
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+	})
+}
+
+func TestMFAChallengeRepository_DeleteChallenge(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("deletes challenge only once", func(t *testing.T) {
+		cr := setupMFAChallengeRepository(t)
+		user := createTestUser(t, cr.DB, "testDeleteChallenge@test.com")
+
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		challenge, err := models.NewMFAChallenge(user.ID, tokenHash, time.Now().Add(time.Minute))
+		is.NoErr(err)
+		is.NoErr(cr.CreateChallenge(challenge))
+
+		is.NoErr(cr.DeleteChallenge(challenge.ID))
+		is.Equal(cr.DeleteChallenge(challenge.ID), apperrors.ErrInvalidMFAChallenge)
+	})
+}
+
+func setupMFAChallengeRepository(t *testing.T) *repository.MFAChallengeRepository {
+	t.Helper()
+
+	testDB := testutils.TestDBSetup(t)
+	tx := testDB.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+
+	cr, err := repository.NewMFAChallengeRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create MFA challenge repository: %v", err)
+	}
+	return cr
+}
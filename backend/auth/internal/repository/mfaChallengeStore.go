@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"github.com/google/uuid"
+
+	"godiscauth/internal/models"
+)
+
+// MFAChallengeStore stores the login challenges of users who entered a correct password and still
+// have to enter their second factor. `MFAChallengeRepository` keeps them in Postgres and
+// `MemoryMFAChallengeStore` in the process. Challenges that don't exist, have expired or have no
+// attempts left are reported as `apperrors.ErrInvalidMFAChallenge`.
+type MFAChallengeStore interface {
+	// CreateChallenge stores a new challenge
+	CreateChallenge(challenge *models.MFAChallenge) error
+	// GetChallenge returns a challenge by the hash of its token without counting an attempt
+	GetChallenge(tokenHash string, maxAttempts int) (*models.MFAChallenge, error)
+	// RecordAttempt counts an attempt against a challenge and returns it, at most maxAttempts times
+	RecordAttempt(tokenHash string, maxAttempts int) (*models.MFAChallenge, error)
+	// DeleteChallenge deletes a challenge, failing if it was already deleted
+	DeleteChallenge(id uuid.UUID) error
+	// DeleteChallengesByUserID deletes all of a user's challenges
+	DeleteChallengesByUserID(userID string) error
+}
+
+var (
+	_ MFAChallengeStore = (*MFAChallengeRepository)(nil)
+	_ MFAChallengeStore = (*MemoryMFAChallengeStore)(nil)
+)
@@ -0,0 +1,96 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+)
+
+// mfaChallengeStoreSetup returns an empty MFA challenge store and a way to create its users
+type mfaChallengeStoreSetup func(t *testing.T) (repository.MFAChallengeStore, storeUsers)
+
+func setupMemoryMFAChallengeStore(t *testing.T) (repository.MFAChallengeStore, storeUsers) {
+	return repository.NewMemoryMFAChallengeStore(), memoryStoreUsers
+}
+
+func setupPostgresMFAChallengeStore(t *testing.T) (repository.MFAChallengeStore, storeUsers) {
+	t.Helper()
+
+	tx := beginTestTx(t)
+	cr, err := repository.NewMFAChallengeRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create MFA challenge repository: %v", err)
+	}
+	return cr, postgresStoreUsers(tx)
+}
+
+// TestMFAChallengeStore_Memory tests the in-memory MFA challenge store
+func TestMFAChallengeStore_Memory(t *testing.T) {
+	testMFAChallengeStore(t, setupMemoryMFAChallengeStore)
+}
+
+// TestMFAChallengeStore_Postgres tests that the Postgres MFA challenge store behaves like the
+// in-memory one
+func TestMFAChallengeStore_Postgres(t *testing.T) {
+	testMFAChallengeStore(t, setupPostgresMFAChallengeStore)
+}
+
+// testMFAChallengeStore tests the behavior all MFA challenge stores share
+func testMFAChallengeStore(t *testing.T, setup mfaChallengeStoreSetup) {
+	is := is.New(t)
+
+	create := func(t *testing.T, store repository.MFAChallengeStore, userID uuid.UUID, expiresIn time.Duration) *models.MFAChallenge {
+		t.Helper()
+		challenge, err := models.NewMFAChallenge(userID, uuid.NewString(), time.Now().UTC().Add(expiresIn))
+		is.NoErr(err)
+		is.NoErr(store.CreateChallenge(challenge))
+		is.True(challenge.ID != uuid.Nil)
+		return challenge
+	}
+
+	t.Run("counts attempts up to the maximum", func(t *testing.T) {
+		store, users := setup(t)
+		challenge := create(t, store, users(t), time.Minute)
+
+		for attempt := 1; attempt <= 2; attempt++ {
+			recorded, err := store.RecordAttempt(challenge.TokenHash, 2)
+			is.NoErr(err)
+			is.Equal(recorded.Attempts, attempt)
+		}
+		_, err := store.RecordAttempt(challenge.TokenHash, 2)
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+		_, err = store.GetChallenge(challenge.TokenHash, 2)
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+
+		got, err := store.GetChallenge(challenge.TokenHash, 3)
+		is.NoErr(err)
+		is.Equal(got.ID, challenge.ID)
+	})
+
+	t.Run("expired challenges are invalid", func(t *testing.T) {
+		store, users := setup(t)
+		challenge := create(t, store, users(t), -time.Minute)
+		_, err := store.GetChallenge(challenge.TokenHash, 5)
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+	})
+
+	t.Run("deletes challenges", func(t *testing.T) {
+		store, users := setup(t)
+		userID := users(t)
+		first := create(t, store, userID, time.Minute)
+		second := create(t, store, userID, time.Minute)
+
+		is.NoErr(store.DeleteChallenge(first.ID))
+		is.Equal(store.DeleteChallenge(first.ID), apperrors.ErrInvalidMFAChallenge)
+
+		is.NoErr(store.DeleteChallengesByUserID(userID.String()))
+		_, err := store.GetChallenge(second.TokenHash, 5)
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+	})
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// PasswordResetRepository represents the entry point into the database for managing the
+// `password_reset_tokens` table
+type PasswordResetRepository struct {
+	DB *gorm.DB
+}
+
+// NewPasswordResetRepository returns a value for the PasswordResetRepository struct
+func NewPasswordResetRepository(db *gorm.DB) (*PasswordResetRepository, error) {
+	if db == nil {
+		return nil, apperrors.ErrDatabaseIsNil
+	}
+	return &PasswordResetRepository{DB: db}, nil
+}
+
+// CreateToken inserts a new password reset token into the `password_reset_tokens` table
+func (prr *PasswordResetRepository) CreateToken(token *models.PasswordResetToken) error {
+	if token == nil {
+		return apperrors.ErrResetTokenIsEmpty
+	}
+	if token.TokenHash == "" {
+		return apperrors.ErrResetTokenIsEmpty
+	}
+	return prr.DB.Create(token).Error
+}
+
+// ConsumeToken atomically marks an unused, unexpired token as used and returns it. Returns
+// `apperrors.ErrInvalidResetToken` if no such token exists, so a token can only be redeemed once
+// even under concurrent requests.
+func (prr *PasswordResetRepository) ConsumeToken(tokenHash string) (*models.PasswordResetToken, error) {
+	if tokenHash == "" {
+		return nil, apperrors.ErrResetTokenIsEmpty
+	}
+
+	now := time.Now().UTC()
+	var tokens []models.PasswordResetToken
+	result := prr.DB.Model(&tokens).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || len(tokens) == 0 {
+		return nil, apperrors.ErrInvalidResetToken
+	}
+	return &tokens[0], nil
+}
+
+// DeleteTokensByUserID deletes all password reset tokens belonging to a user
+func (prr *PasswordResetRepository) DeleteTokensByUserID(userID string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	return prr.DB.Where("user_id = ?", userID).Delete(&models.PasswordResetToken{}).Error
+}
@@ -0,0 +1,155 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestPasswordResetRepository_NewPasswordResetRepository tests creation of PasswordResetRepository
+// structs in the `repository` package
+func TestPasswordResetRepository_NewPasswordResetRepository(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("returns err with nil db", func(t *testing.T) {
+		prr, err := repository.NewPasswordResetRepository(nil)
+		is.Equal(prr, nil)
+		is.Equal(err, apperrors.ErrDatabaseIsNil)
+	})
+
+	t.Run("creates new password reset repo", func(t *testing.T) {
+		prr := setupPasswordResetRepository(t)
+		is.True(prr != nil)
+	})
+}
+
+func TestPasswordResetRepository_CreateToken(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("fails on nil token", func(t *testing.T) {
+		prr := setupPasswordResetRepository(t)
+		err := prr.CreateToken(nil)
+		is.Equal(err, apperrors.ErrResetTokenIsEmpty)
+	})
+
+	t.Run("creates token", func(t *testing.T) {
+		prr := setupPasswordResetRepository(t)
+		user := createTestUser(t, prr.DB, "testCreateResetToken@test.com")
+
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		token, err := models.NewPasswordResetToken(user.ID, tokenHash, time.Now().Add(time.Hour))
+		is.NoErr(err)
+
+		err = prr.CreateToken(token)
+		is.NoErr(err)
+
+		var count int64
+		prr.DB.Model(&models.PasswordResetToken{}).Where("user_id = ?", user.ID).Count(&count)
+		is.Equal(count, int64(1))
+	})
+}
+
+func TestPasswordResetRepository_ConsumeToken(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("fails on empty hash", func(t *testing.T) {
+		prr := setupPasswordResetRepository(t)
+		token, err := prr.ConsumeToken("")
+		is.Equal(token, nil)
+		is.Equal(err, apperrors.ErrResetTokenIsEmpty)
+	})
+
+	t.Run("fails on unknown token", func(t *testing.T) {
+		prr := setupPasswordResetRepository(t)
+		token, err := prr.ConsumeToken(models.HashToken("doesNotExist"))
+		is.Equal(token, nil)
+		is.Equal(err, apperrors.ErrInvalidResetToken)
+	})
+
+	t.Run("consumes token only once", func(t *testing.T) {
+		prr := setupPasswordResetRepository(t)
+		user := createTestUser(t, prr.DB, "testConsumeResetToken@test.com")
+
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		token, err := models.NewPasswordResetToken(user.ID, tokenHash, time.Now().Add(time.Hour))
+		is.NoErr(err)
+		err = prr.CreateToken(token)
+		is.NoErr(err)
+
+		consumed, err := prr.ConsumeToken(tokenHash)
+		is.NoErr(err)
+		is.Equal(consumed.UserID, user.ID)
+		is.True(consumed.UsedAt != nil)
+
+		_, err = prr.ConsumeToken(tokenHash)
+		is.Equal(err, apperrors.ErrInvalidResetToken)
+	})
+
+	t.Run("fails on expired token", func(t *testing.T) {
+		prr := setupPasswordResetRepository(t)
+		user := createTestUser(t, prr.DB, "testConsumeExpiredResetToken@test.com")
+
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		token, err := models.NewPasswordResetToken(user.ID, tokenHash, time.Now().Add(-time.Minute))
+		is.NoErr(err)
+		err = prr.CreateToken(token)
+		is.NoErr(err)
+
+		_, err = prr.ConsumeToken(tokenHash)
+		is.Equal(err, apperrors.ErrInvalidResetToken)
+	})
+}
+
+func TestPasswordResetRepository_DeleteTokensByUserID(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("fails on empty user ID", func(t *testing.T) {
+		prr := setupPasswordResetRepository(t)
+		err := prr.DeleteTokensByUserID("")
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("deletes user's tokens", func(t *testing.T) {
+		prr := setupPasswordResetRepository(t)
+		user := createTestUser(t, prr.DB, "testDeleteResetTokens@test.com")
+
+		for range 3 {
+			_, tokenHash, err := models.GenerateToken()
+			is.NoErr(err)
+			token, err := models.NewPasswordResetToken(user.ID, tokenHash, time.Now().Add(time.Hour))
+			is.NoErr(err)
+			err = prr.CreateToken(token)
+			is.NoErr(err)
+		}
+
+		err := prr.DeleteTokensByUserID(user.ID.String())
+		is.NoErr(err)
+
+		var count int64
+		prr.DB.Model(&models.PasswordResetToken{}).Where("user_id = ?", user.ID).Count(&count)
+		is.Equal(count, int64(0))
+	})
+}
+
+func setupPasswordResetRepository(t *testing.T) *repository.PasswordResetRepository {
+	t.Helper()
+
+	testDB := testutils.TestDBSetup(t)
+	tx := testDB.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+
+	prr, err := repository.NewPasswordResetRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create password reset repository: %v", err)
+	}
+	return prr
+}
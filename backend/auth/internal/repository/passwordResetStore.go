@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"godiscauth/internal/models"
+)
+
+// PasswordResetStore stores the hashed password reset tokens mailed to users.
+// `PasswordResetRepository` keeps them in Postgres and `MemoryPasswordResetStore` in the process.
+type PasswordResetStore interface {
+	// CreateToken stores a new token
+	CreateToken(token *models.PasswordResetToken) error
+	// ConsumeToken marks an unused, unexpired token as used and returns it, or fails with
+	// `apperrors.ErrInvalidResetToken`
+	ConsumeToken(tokenHash string) (*models.PasswordResetToken, error)
+	// DeleteTokensByUserID deletes all of a user's tokens
+	DeleteTokensByUserID(userID string) error
+}
+
+var (
+	_ PasswordResetStore = (*PasswordResetRepository)(nil)
+	_ PasswordResetStore = (*MemoryPasswordResetStore)(nil)
+)
@@ -0,0 +1,81 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+)
+
+// passwordResetStoreSetup returns an empty password reset store and a way to create its users
+type passwordResetStoreSetup func(t *testing.T) (repository.PasswordResetStore, storeUsers)
+
+func setupMemoryPasswordResetStore(t *testing.T) (repository.PasswordResetStore, storeUsers) {
+	return repository.NewMemoryPasswordResetStore(), memoryStoreUsers
+}
+
+func setupPostgresPasswordResetStore(t *testing.T) (repository.PasswordResetStore, storeUsers) {
+	t.Helper()
+
+	tx := beginTestTx(t)
+	prr, err := repository.NewPasswordResetRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create password reset repository: %v", err)
+	}
+	return prr, postgresStoreUsers(tx)
+}
+
+// TestPasswordResetStore_Memory tests the in-memory password reset store
+func TestPasswordResetStore_Memory(t *testing.T) {
+	testPasswordResetStore(t, setupMemoryPasswordResetStore)
+}
+
+// TestPasswordResetStore_Postgres tests that the Postgres password reset store behaves like the
+// in-memory one
+func TestPasswordResetStore_Postgres(t *testing.T) {
+	testPasswordResetStore(t, setupPostgresPasswordResetStore)
+}
+
+// testPasswordResetStore tests the behavior all password reset stores share
+func testPasswordResetStore(t *testing.T, setup passwordResetStoreSetup) {
+	is := is.New(t)
+
+	create := func(t *testing.T, store repository.PasswordResetStore, userID uuid.UUID, expiresIn time.Duration) string {
+		t.Helper()
+		token, err := models.NewPasswordResetToken(userID, uuid.NewString(), time.Now().UTC().Add(expiresIn))
+		is.NoErr(err)
+		is.NoErr(store.CreateToken(token))
+		return token.TokenHash
+	}
+
+	t.Run("consumes a token once", func(t *testing.T) {
+		store, users := setup(t)
+		userID := users(t)
+		tokenHash := create(t, store, userID, time.Hour)
+
+		token, err := store.ConsumeToken(tokenHash)
+		is.NoErr(err)
+		is.Equal(token.UserID, userID)
+		is.True(token.UsedAt != nil)
+
+		_, err = store.ConsumeToken(tokenHash)
+		is.Equal(err, apperrors.ErrInvalidResetToken)
+	})
+
+	t.Run("expired and deleted tokens are invalid", func(t *testing.T) {
+		store, users := setup(t)
+		userID := users(t)
+		_, err := store.ConsumeToken(create(t, store, userID, -time.Hour))
+		is.Equal(err, apperrors.ErrInvalidResetToken)
+
+		tokenHash := create(t, store, userID, time.Hour)
+		is.NoErr(store.DeleteTokensByUserID(userID.String()))
+		_, err = store.ConsumeToken(tokenHash)
+		is.Equal(err, apperrors.ErrInvalidResetToken)
+	})
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// RecoveryCodeRepository represents the entry point into the database for managing the
+// `recovery_codes` table
+type RecoveryCodeRepository struct {
+	DB *gorm.DB
+}
+
+// NewRecoveryCodeRepository returns a value for the RecoveryCodeRepository struct
+func NewRecoveryCodeRepository(db *gorm.DB) (*RecoveryCodeRepository, error) {
+	if db == nil {
+		return nil, apperrors.ErrDatabaseIsNil
+	}
+	return &RecoveryCodeRepository{DB: db}, nil
+}
+
+// ReplaceCodes deletes all of a user's recovery codes, used or not, and inserts new ones in a
+// single transaction
+func (rr *RecoveryCodeRepository) ReplaceCodes(userID uuid.UUID, codes []*models.RecoveryCode) error {
+	if userID == uuid.Nil {
+		return apperrors.ErrUserIdEmpty
+	}
+
+	return rr.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(codes).Error
+	})
+}
+
+// GetUnusedCodes gets all of a user's recovery codes that haven't been used
+func (rr *RecoveryCodeRepository) GetUnusedCodes(userID string) ([]models.RecoveryCode, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+
+	var codes []models.RecoveryCode
+	err := rr.DB.Where("user_id = ? AND used_at IS NULL", userID).Find(&codes).Error
+	return codes, err
+}
+
+// CountUnusedCodes returns the number of recovery codes a user has left
+func (rr *RecoveryCodeRepository) CountUnusedCodes(userID string) (int64, error) {
+	if userID == "" {
+		return 0, apperrors.ErrUserIdEmpty
+	}
+
+	var count int64
+	err := rr.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// MarkCodeUsed atomically marks an unused recovery code as used. Returns
+// `apperrors.ErrInvalidMFACode` if it was already used, so a code works only once even under
+// concurrent requests.
+func (rr *RecoveryCodeRepository) MarkCodeUsed(id uuid.UUID) error {
+	if id == uuid.Nil {
+		return apperrors.ErrMFACodeIsEmpty
+	}
+
+	result := rr.DB.Model(&models.RecoveryCode{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now().UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.ErrInvalidMFACode
+	}
+	return nil
+}
+
+// DeleteCodesByUserID deletes all recovery codes belonging to a user
+func (rr *RecoveryCodeRepository) DeleteCodesByUserID(userID string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	return rr.DB.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
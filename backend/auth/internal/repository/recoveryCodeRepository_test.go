@@ -0,0 +1,73 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestRecoveryCodeRepository_NewRecoveryCodeRepository tests creation of RecoveryCodeRepository
+// structs in the `repository` package
+func TestRecoveryCodeRepository_NewRecoveryCodeRepository(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("returns err with nil db", func(t *testing.T) {
+		rr, err := repository.NewRecoveryCodeRepository(nil)
+		is.Equal(rr, nil)
+		is.Equal(err, apperrors.ErrDatabaseIsNil)
+	})
+}
+
+func TestRecoveryCodeRepository_ReplaceCodes(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("replaces all codes and marks them used once", func(t *testing.T) {
+		rr := setupRecoveryCodeRepository(t)
+		user := createTestUser(t, rr.DB, "testReplaceCodes@test.com")
+
+		first, err := models.NewRecoveryCode(user.ID, "aaaaa-aaaaa")
+		is.NoErr(err)
+		is.NoErr(rr.ReplaceCodes(user.ID, []*models.RecoveryCode{first}))
+
+		second, err := models.NewRecoveryCode(user.ID, "bbbbb-bbbbb")
+		is.NoErr(err)
+		third, err := models.NewRecoveryCode(user.ID, "ccccc-ccccc")
+		is.NoErr(err)
+		is.NoErr(rr.ReplaceCodes(user.ID, []*models.RecoveryCode{second, third}))
+
+		codes, err := rr.GetUnusedCodes(user.ID.String())
+		is.NoErr(err)
+		is.Equal(len(codes), 2)
+
+		is.NoErr(rr.MarkCodeUsed(second.ID))
+		is.Equal(rr.MarkCodeUsed(second.ID), apperrors.ErrInvalidMFACode)
+
+		count, err := rr.CountUnusedCodes(user.ID.String())
+		is.NoErr(err)
+		is.Equal(count, int64(1))
+
+		is.NoErr(rr.DeleteCodesByUserID(user.ID.String()))
+		count, err = rr.CountUnusedCodes(user.ID.String())
+		is.NoErr(err)
+		is.Equal(count, int64(0))
+	})
+}
+
+func setupRecoveryCodeRepository(t *testing.T) *repository.RecoveryCodeRepository {
+	t.Helper()
+
+	testDB := testutils.TestDBSetup(t)
+	tx := testDB.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+
+	rr, err := repository.NewRecoveryCodeRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create recovery code repository: %v", err)
+	}
+	return rr
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"github.com/google/uuid"
+
+	"godiscauth/internal/models"
+)
+
+// RecoveryCodeStore stores the hashed one-time recovery codes of users enrolled in two-factor
+// authentication. `RecoveryCodeRepository` keeps them in Postgres and `MemoryRecoveryCodeStore` in
+// the process.
+type RecoveryCodeStore interface {
+	// ReplaceCodes deletes all of a user's codes, used or not, and stores new ones at once
+	ReplaceCodes(userID uuid.UUID, codes []*models.RecoveryCode) error
+	// GetUnusedCodes returns a user's codes that haven't been used
+	GetUnusedCodes(userID string) ([]models.RecoveryCode, error)
+	// CountUnusedCodes returns the number of codes a user has left
+	CountUnusedCodes(userID string) (int64, error)
+	// MarkCodeUsed marks an unused code as used, or fails with `apperrors.ErrInvalidMFACode` if it
+	// was already used
+	MarkCodeUsed(id uuid.UUID) error
+	// DeleteCodesByUserID deletes all of a user's codes
+	DeleteCodesByUserID(userID string) error
+}
+
+var (
+	_ RecoveryCodeStore = (*RecoveryCodeRepository)(nil)
+	_ RecoveryCodeStore = (*MemoryRecoveryCodeStore)(nil)
+)
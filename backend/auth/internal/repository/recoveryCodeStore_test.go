@@ -0,0 +1,86 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+)
+
+// recoveryCodeStoreSetup returns an empty recovery code store and a way to create its users
+type recoveryCodeStoreSetup func(t *testing.T) (repository.RecoveryCodeStore, storeUsers)
+
+func setupMemoryRecoveryCodeStore(t *testing.T) (repository.RecoveryCodeStore, storeUsers) {
+	return repository.NewMemoryRecoveryCodeStore(), memoryStoreUsers
+}
+
+func setupPostgresRecoveryCodeStore(t *testing.T) (repository.RecoveryCodeStore, storeUsers) {
+	t.Helper()
+
+	tx := beginTestTx(t)
+	rr, err := repository.NewRecoveryCodeRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create recovery code repository: %v", err)
+	}
+	return rr, postgresStoreUsers(tx)
+}
+
+// TestRecoveryCodeStore_Memory tests the in-memory recovery code store
+func TestRecoveryCodeStore_Memory(t *testing.T) {
+	testRecoveryCodeStore(t, setupMemoryRecoveryCodeStore)
+}
+
+// TestRecoveryCodeStore_Postgres tests that the Postgres recovery code store behaves like the
+// in-memory one
+func TestRecoveryCodeStore_Postgres(t *testing.T) {
+	testRecoveryCodeStore(t, setupPostgresRecoveryCodeStore)
+}
+
+// testRecoveryCodeStore tests the behavior all recovery code stores share
+func testRecoveryCodeStore(t *testing.T, setup recoveryCodeStoreSetup) {
+	is := is.New(t)
+
+	codes := func(userID uuid.UUID, n int) []*models.RecoveryCode {
+		codes := make([]*models.RecoveryCode, 0, n)
+		for range n {
+			codes = append(codes, &models.RecoveryCode{UserID: userID, CodeHash: uuid.NewString()})
+		}
+		return codes
+	}
+
+	t.Run("uses each code once", func(t *testing.T) {
+		store, users := setup(t)
+		userID := users(t)
+		is.NoErr(store.ReplaceCodes(userID, codes(userID, 3)))
+
+		unused, err := store.GetUnusedCodes(userID.String())
+		is.NoErr(err)
+		is.Equal(len(unused), 3)
+
+		is.NoErr(store.MarkCodeUsed(unused[0].ID))
+		is.Equal(store.MarkCodeUsed(unused[0].ID), apperrors.ErrInvalidMFACode)
+		count, err := store.CountUnusedCodes(userID.String())
+		is.NoErr(err)
+		is.Equal(count, int64(2))
+	})
+
+	t.Run("replaces and deletes codes", func(t *testing.T) {
+		store, users := setup(t)
+		userID := users(t)
+		is.Equal(store.ReplaceCodes(uuid.Nil, nil), apperrors.ErrUserIdEmpty)
+		is.NoErr(store.ReplaceCodes(userID, codes(userID, 3)))
+		is.NoErr(store.ReplaceCodes(userID, codes(userID, 2)))
+		count, err := store.CountUnusedCodes(userID.String())
+		is.NoErr(err)
+		is.Equal(count, int64(2))
+
+		is.NoErr(store.DeleteCodesByUserID(userID.String()))
+		count, err = store.CountUnusedCodes(userID.String())
+		is.NoErr(err)
+		is.Equal(count, int64(0))
+	})
+}
@@ -4,6 +4,10 @@ import (
 	"os"
 	"testing"
 
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/models"
 	"godiscauth/internal/testutils"
 )
 
@@ -12,3 +16,39 @@ func TestMain(m *testing.M) {
 
 	os.Exit(m.Run())
 }
+
+// createTestUser inserts a user directly into the database for tests that need a row to reference
+func createTestUser(t testing.TB, db *gorm.DB, email string) *models.User {
+	t.Helper()
+
+	user := &models.User{Email: email, Password: "password"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	return user
+}
+
+// storeUsers creates the users that records in a store belong to. Postgres needs the users to
+// exist, the in-memory stores don't.
+type storeUsers func(t *testing.T) uuid.UUID
+
+// memoryStoreUsers makes up user IDs for the in-memory stores
+func memoryStoreUsers(t *testing.T) uuid.UUID {
+	return uuid.New()
+}
+
+// postgresStoreUsers returns a storeUsers creating users in db
+func postgresStoreUsers(db *gorm.DB) storeUsers {
+	return func(t *testing.T) uuid.UUID {
+		return createTestUser(t, db, uuid.NewString()+"@test.com").ID
+	}
+}
+
+// beginTestTx begins a transaction on the test database that is rolled back after the test
+func beginTestTx(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	tx := testutils.TestDBSetup(t).Begin()
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// SecurityEventRepository represents the entry point into the database for managing the
+// `security_events` table
+type SecurityEventRepository struct {
+	DB *gorm.DB
+}
+
+// NewSecurityEventRepository returns a value for the SecurityEventRepository struct
+func NewSecurityEventRepository(db *gorm.DB) (*SecurityEventRepository, error) {
+	if db == nil {
+		return nil, apperrors.ErrDatabaseIsNil
+	}
+	return &SecurityEventRepository{DB: db}, nil
+}
+
+// CreateEvent inserts a new event into the `security_events` table
+func (er *SecurityEventRepository) CreateEvent(event *models.SecurityEvent) error {
+	if event == nil {
+		return apperrors.ErrSecurityEventTypeIsEmpty
+	}
+	return er.DB.Create(event).Error
+}
+
+// ListEventsByUserID gets a user's most recent events, newest first
+func (er *SecurityEventRepository) ListEventsByUserID(userID string, limit int) ([]models.SecurityEvent, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+
+	var events []models.SecurityEvent
+	err := er.DB.Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
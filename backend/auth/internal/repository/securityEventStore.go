@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"godiscauth/internal/models"
+)
+
+// SecurityEventStore stores the security activity of users. `SecurityEventRepository` keeps it in
+// Postgres and `MemorySecurityEventStore` in the process.
+type SecurityEventStore interface {
+	// CreateEvent stores a new event
+	CreateEvent(event *models.SecurityEvent) error
+	// ListEventsByUserID returns up to limit of a user's most recent events, newest first
+	ListEventsByUserID(userID string, limit int) ([]models.SecurityEvent, error)
+}
+
+var (
+	_ SecurityEventStore = (*SecurityEventRepository)(nil)
+	_ SecurityEventStore = (*MemorySecurityEventStore)(nil)
+)
@@ -0,0 +1,69 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+)
+
+// securityEventStoreSetup returns an empty security event store and a way to create its users
+type securityEventStoreSetup func(t *testing.T) (repository.SecurityEventStore, storeUsers)
+
+func setupMemorySecurityEventStore(t *testing.T) (repository.SecurityEventStore, storeUsers) {
+	return repository.NewMemorySecurityEventStore(), memoryStoreUsers
+}
+
+func setupPostgresSecurityEventStore(t *testing.T) (repository.SecurityEventStore, storeUsers) {
+	t.Helper()
+
+	tx := beginTestTx(t)
+	er, err := repository.NewSecurityEventRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create security event repository: %v", err)
+	}
+	return er, postgresStoreUsers(tx)
+}
+
+// TestSecurityEventStore_Memory tests the in-memory security event store
+func TestSecurityEventStore_Memory(t *testing.T) {
+	testSecurityEventStore(t, setupMemorySecurityEventStore)
+}
+
+// TestSecurityEventStore_Postgres tests that the Postgres security event store behaves like the
+// in-memory one
+func TestSecurityEventStore_Postgres(t *testing.T) {
+	testSecurityEventStore(t, setupPostgresSecurityEventStore)
+}
+
+// testSecurityEventStore tests the behavior all security event stores share
+func testSecurityEventStore(t *testing.T, setup securityEventStoreSetup) {
+	is := is.New(t)
+
+	t.Run("lists a user's newest events first", func(t *testing.T) {
+		store, users := setup(t)
+		userID, otherID := users(t), users(t)
+		is.Equal(store.CreateEvent(nil), apperrors.ErrSecurityEventTypeIsEmpty)
+
+		start := time.Now().UTC().Add(-time.Hour)
+		for i, detail := range []string{"first", "second", "third"} {
+			event, err := models.NewSecurityEvent(userID, models.SecurityEventTOTPEnabled, detail)
+			is.NoErr(err)
+			event.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+			is.NoErr(store.CreateEvent(event))
+		}
+		other, err := models.NewSecurityEvent(otherID, models.SecurityEventTOTPEnabled, "other")
+		is.NoErr(err)
+		is.NoErr(store.CreateEvent(other))
+
+		events, err := store.ListEventsByUserID(userID.String(), 2)
+		is.NoErr(err)
+		is.Equal(len(events), 2)
+		is.Equal(events[0].Detail, "third")
+		is.Equal(events[1].Detail, "second")
+	})
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/internal/models"
+)
+
+// SessionCache keeps recently read sessions in memory for a short time, so authenticating a
+// request doesn't need a database round trip every time. Sessions deleted through a
+// SessionRepository using the cache are dropped from it right away; sessions deleted any other way,
+// e.g. by another instance of the service, are only dropped when their entry expires. A nil cache
+// caches nothing.
+type SessionCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]sessionCacheEntry
+	// byID and byUser index entries for invalidation
+	byID   map[uuid.UUID][sha256.Size]byte
+	byUser map[uuid.UUID]map[uuid.UUID]struct{}
+	// generation counts invalidations, so a session read from the database before one isn't cached
+	// after it
+	generation uint64
+}
+
+type sessionCacheEntry struct {
+	session   models.Session
+	expiresAt time.Time
+}
+
+// NewSessionCache returns a SessionCache that keeps sessions for ttl and holds at most maxEntries
+func NewSessionCache(ttl time.Duration, maxEntries int) *SessionCache {
+	return &SessionCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[[sha256.Size]byte]sessionCacheEntry),
+		byID:       make(map[uuid.UUID][sha256.Size]byte),
+		byUser:     make(map[uuid.UUID]map[uuid.UUID]struct{}),
+	}
+}
+
+// Len returns the number of cached sessions, including expired entries not dropped yet
+func (sc *SessionCache) Len() int {
+	if sc == nil {
+		return 0
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return len(sc.entries)
+}
+
+// get returns a copy of the session cached for a token hash if neither the entry nor the session
+// has expired
+func (sc *SessionCache) get(tokenHash []byte, now time.Time) (*models.Session, bool) {
+	if sc == nil || len(tokenHash) != sha256.Size {
+		return nil, false
+	}
+	key := [sha256.Size]byte(tokenHash)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	entry, ok := sc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(entry.expiresAt) || !now.Before(entry.session.ExpiresAt) {
+		sc.remove(entry.session.ID)
+		return nil, false
+	}
+	session := entry.session
+	return &session, true
+}
+
+// currentGeneration returns the generation to pass to `set` for a session about to be read
+func (sc *SessionCache) currentGeneration() uint64 {
+	if sc == nil {
+		return 0
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.generation
+}
+
+// set caches a copy of a session read at the given generation, unless something was invalidated
+// since. When the cache is full, expired entries are dropped first, then an arbitrary one.
+func (sc *SessionCache) set(session *models.Session, generation uint64, now time.Time) {
+	if sc == nil || sc.ttl <= 0 || sc.maxEntries <= 0 || len(session.TokenHash) != sha256.Size {
+		return
+	}
+	key := [sha256.Size]byte(session.TokenHash)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if generation != sc.generation {
+		return
+	}
+	sc.remove(session.ID)
+	if len(sc.entries) >= sc.maxEntries {
+		for _, entry := range sc.entries {
+			if !now.Before(entry.expiresAt) {
+				sc.remove(entry.session.ID)
+			}
+		}
+		for _, entry := range sc.entries {
+			if len(sc.entries) < sc.maxEntries {
+				break
+			}
+			sc.remove(entry.session.ID)
+		}
+	}
+
+	sc.entries[key] = sessionCacheEntry{session: *session, expiresAt: now.Add(sc.ttl)}
+	sc.byID[session.ID] = key
+	if sc.byUser[session.UserID] == nil {
+		sc.byUser[session.UserID] = make(map[uuid.UUID]struct{})
+	}
+	sc.byUser[session.UserID][session.ID] = struct{}{}
+}
+
+// touch updates the activity of a cached session like `SessionRepository.TouchSession` does in the
+// database
+func (sc *SessionCache) touch(sessionID uuid.UUID, clientIP string, seenAt, expiresAt time.Time) {
+	if sc == nil {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	key, ok := sc.byID[sessionID]
+	if !ok {
+		return
+	}
+	entry := sc.entries[key]
+	entry.session.LastSeenAt = seenAt
+	entry.session.ClientIP = clientIP
+	entry.session.ExpiresAt = expiresAt
+	sc.entries[key] = entry
+}
+
+// InvalidateSession drops a session from the cache
+func (sc *SessionCache) InvalidateSession(sessionID uuid.UUID) {
+	if sc == nil {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.generation++
+	sc.remove(sessionID)
+}
+
+// InvalidateUser drops all of a user's sessions from the cache
+func (sc *SessionCache) InvalidateUser(userID uuid.UUID) {
+	if sc == nil {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.generation++
+	for sessionID := range sc.byUser[userID] {
+		sc.remove(sessionID)
+	}
+}
+
+// remove drops a session and its index entries. The caller holds the lock.
+func (sc *SessionCache) remove(sessionID uuid.UUID) {
+	key, ok := sc.byID[sessionID]
+	if !ok {
+		return
+	}
+	userID := sc.entries[key].session.UserID
+	delete(sc.entries, key)
+	delete(sc.byID, sessionID)
+	delete(sc.byUser[userID], sessionID)
+	if len(sc.byUser[userID]) == 0 {
+		delete(sc.byUser, userID)
+	}
+}
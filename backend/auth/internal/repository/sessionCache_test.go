@@ -0,0 +1,231 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/testutils"
+)
+
+// setupCachedSessionRepository returns a session repository with a cache and a session of a new
+// user in it
+func setupCachedSessionRepository(t testing.TB, email string) (*repository.SessionRepository, *models.Session) {
+	t.Helper()
+
+	sr := setupSessionRepository(t)
+	sr.Cache = repository.NewSessionCache(time.Minute, 100)
+	user := createTestUser(t, sr.DB, email)
+	session := createCachedTestSession(t, sr, user.ID)
+	return sr, session
+}
+
+// createCachedTestSession inserts a session for a user and reads it back through the cache
+func createCachedTestSession(t testing.TB, sr *repository.SessionRepository, userID uuid.UUID) *models.Session {
+	t.Helper()
+
+	session, err := models.NewSession(userID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create test session: %v", err)
+	}
+	if err := sr.CreateSession(session); err != nil {
+		t.Fatalf("failed to insert test session: %v", err)
+	}
+	if _, err := sr.GetUnexpiredSessionByTokenHash(session.TokenHash); err != nil {
+		t.Fatalf("failed to read test session: %v", err)
+	}
+	return session
+}
+
+// TestSessionCache_GetUnexpiredSessionByTokenHash tests that sessions are served from the cache once
+// read, until they expire
+func TestSessionCache_GetUnexpiredSessionByTokenHash(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("serves cached sessions", func(t *testing.T) {
+		sr, session := setupCachedSessionRepository(t, "testSessionCacheHit@test.com")
+		is.Equal(sr.Cache.Len(), 1)
+
+		// Deleted behind the repository's back, so only the cache still has it
+		is.NoErr(sr.DB.Where("id = ?", session.ID).Delete(&models.Session{}).Error)
+		cached, err := sr.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.NoErr(err)
+		is.Equal(cached.ID, session.ID)
+
+		// Callers get a copy
+		cached.UserID = uuid.Nil
+		cached, err = sr.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.NoErr(err)
+		is.Equal(cached.UserID, session.UserID)
+	})
+
+	t.Run("drops entries after the ttl", func(t *testing.T) {
+		sr, session := setupCachedSessionRepository(t, "testSessionCacheTTL@test.com")
+		sr.Cache = repository.NewSessionCache(50*time.Millisecond, 100)
+		_, err := sr.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.NoErr(err)
+
+		is.NoErr(sr.DB.Where("id = ?", session.ID).Delete(&models.Session{}).Error)
+		time.Sleep(100 * time.Millisecond)
+		_, err = sr.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.Equal(err, gorm.ErrRecordNotFound)
+		is.Equal(sr.Cache.Len(), 0)
+	})
+
+	t.Run("drops expired sessions", func(t *testing.T) {
+		sr, session := setupCachedSessionRepository(t, "testSessionCacheExpired@test.com")
+
+		past := time.Now().Add(-time.Minute)
+		is.NoErr(sr.TouchSession(session.ID, "192.0.2.1", past, past))
+		_, err := sr.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.Equal(err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("keeps touches", func(t *testing.T) {
+		sr, session := setupCachedSessionRepository(t, "testSessionCacheTouch@test.com")
+
+		seenAt := time.Now().Add(time.Minute).UTC().Truncate(time.Microsecond)
+		is.NoErr(sr.TouchSession(session.ID, "192.0.2.1", seenAt, seenAt.Add(time.Hour)))
+		cached, err := sr.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.NoErr(err)
+		is.Equal(cached.ClientIP, "192.0.2.1")
+		is.True(cached.LastSeenAt.Equal(seenAt))
+		is.True(cached.ExpiresAt.Equal(seenAt.Add(time.Hour)))
+	})
+
+	t.Run("is bounded", func(t *testing.T) {
+		sr, _ := setupCachedSessionRepository(t, "testSessionCacheBounded@test.com")
+		sr.Cache = repository.NewSessionCache(time.Minute, 3)
+		user := createTestUser(t, sr.DB, "testSessionCacheBounded2@test.com")
+
+		for range 5 {
+			createCachedTestSession(t, sr, user.ID)
+		}
+		is.Equal(sr.Cache.Len(), 3)
+	})
+
+	t.Run("nil cache", func(t *testing.T) {
+		sr, session := setupCachedSessionRepository(t, "testSessionCacheNil@test.com")
+		sr.Cache = nil
+
+		_, err := sr.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.NoErr(err)
+		is.NoErr(sr.DeleteSessionByID(session.ID))
+		_, err = sr.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.Equal(err, gorm.ErrRecordNotFound)
+	})
+}
+
+// TestSessionCache_Invalidation tests that sessions deleted through the repository are dropped from
+// the cache right away
+func TestSessionCache_Invalidation(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("DeleteSessionByID", func(t *testing.T) {
+		sr, session := setupCachedSessionRepository(t, "testSessionCacheDeleteByID@test.com")
+
+		is.NoErr(sr.DeleteSessionByID(session.ID))
+		_, err := sr.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.Equal(err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("DeleteUserSession", func(t *testing.T) {
+		sr, session := setupCachedSessionRepository(t, "testSessionCacheDeleteUserSession@test.com")
+
+		is.NoErr(sr.DeleteUserSession(session.UserID.String(), session.ID))
+		_, err := sr.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.Equal(err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("DeleteSessionsByUserID", func(t *testing.T) {
+		sr, session := setupCachedSessionRepository(t, "testSessionCacheDeleteByUser@test.com")
+		other := createCachedTestSession(t, sr, session.UserID)
+		stranger := createTestUser(t, sr.DB, "testSessionCacheDeleteByUser2@test.com")
+		kept := createCachedTestSession(t, sr, stranger.ID)
+
+		is.NoErr(sr.DeleteSessionsByUserID(session.UserID.String()))
+		for _, s := range []*models.Session{session, other} {
+			_, err := sr.GetUnexpiredSessionByTokenHash(s.TokenHash)
+			is.Equal(err, gorm.ErrRecordNotFound)
+		}
+		is.Equal(sr.Cache.Len(), 1)
+		_, err := sr.GetUnexpiredSessionByTokenHash(kept.TokenHash)
+		is.NoErr(err)
+	})
+
+	t.Run("ReplaceSession", func(t *testing.T) {
+		sr, session := setupCachedSessionRepository(t, "testSessionCacheReplace@test.com")
+
+		replacement, err := models.NewSession(session.UserID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(time.Hour))
+		is.NoErr(err)
+		is.NoErr(sr.ReplaceSession(session.ID, replacement))
+		_, err = sr.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.Equal(err, gorm.ErrRecordNotFound)
+		_, err = sr.GetUnexpiredSessionByTokenHash(replacement.TokenHash)
+		is.NoErr(err)
+	})
+
+	t.Run("CreateSessionWithinLimit", func(t *testing.T) {
+		sr, session := setupCachedSessionRepository(t, "testSessionCacheEvict@test.com")
+
+		newer, err := models.NewSession(session.UserID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(time.Hour))
+		is.NoErr(err)
+		evicted, err := sr.CreateSessionWithinLimit(newer, 1, true)
+		is.NoErr(err)
+		is.Equal(len(evicted), 1)
+		_, err = sr.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.Equal(err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("InvalidateUser", func(t *testing.T) {
+		sr, session := setupCachedSessionRepository(t, "testSessionCacheInvalidateUser@test.com")
+
+		// Deleted by the foreign key when the user is
+		is.NoErr(sr.DB.Where("id = ?", session.ID).Delete(&models.Session{}).Error)
+		sr.Cache.InvalidateUser(session.UserID)
+		_, err := sr.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.Equal(err, gorm.ErrRecordNotFound)
+	})
+}
+
+// BenchmarkSessionRepository_GetUnexpiredSessionByTokenHash compares session lookups from parallel
+// requests with and without the cache
+func BenchmarkSessionRepository_GetUnexpiredSessionByTokenHash(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		cache *repository.SessionCache
+	}{
+		{name: "database"},
+		{name: "cached", cache: repository.NewSessionCache(time.Minute, 1000)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			// Not in a transaction, which would be a single connection for all the goroutines
+			testDB := testutils.TestDBSetup(b)
+			sr := &repository.SessionRepository{DB: testDB}
+			user := createTestUser(b, testDB, "benchmarkSessionLookup@test.com")
+			b.Cleanup(func() { testDB.Unscoped().Where("id = ?", user.ID).Delete(&models.User{}) })
+			var sessions []*models.Session
+			for range 100 {
+				sessions = append(sessions, createCachedTestSession(b, sr, user.ID))
+			}
+			sr.Cache = bc.cache
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, err := sr.GetUnexpiredSessionByTokenHash(sessions[i%len(sessions)].TokenHash); err != nil {
+						b.Error(err)
+						return
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -1,10 +1,12 @@
 package repository
 
 import (
+	"crypto/subtle"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"godiscauth/internal/models"
 	"godiscauth/pkg/apperrors"
@@ -14,6 +16,9 @@ import (
 // the `sessions` table
 type SessionRepository struct {
 	DB *gorm.DB
+	// Cache, if set, serves `GetUnexpiredSessionByTokenHash` from memory. Sessions deleted through
+	// the repository are dropped from it.
+	Cache *SessionCache
 }
 
 // NewSessionRepository returns a value for the SessionRepository struct
@@ -29,9 +34,9 @@ func (sr *SessionRepository) CreateSession(session *models.Session) error {
 	if session == nil {
 		return apperrors.ErrSessionIsNil
 	}
-	// Lookup existing session by ID
+	// Lookup existing session by ID or token
 	var existingSession models.Session
-	result := sr.DB.Where("id = ?", session.ID).First(&existingSession)
+	result := sr.DB.Where("id = ? OR token_hash = ?", session.ID, session.TokenHash).First(&existingSession)
 	if result.Error == nil {
 		// Session already exists
 		return apperrors.ErrSessionAlreadyExists
@@ -42,6 +47,61 @@ func (sr *SessionRepository) CreateSession(session *models.Session) error {
 	return sr.DB.Create(session).Error
 }
 
+// CreateSessionWithinLimit inserts a new session unless its user already has `limit` unexpired
+// sessions. The user's row is locked until the session is inserted, so parallel logins of the same
+// user are counted one at a time. Over the limit, the sessions the user logged in to longest ago are
+// deleted to make room and returned if evictOldest is set, and `apperrors.ErrTooManySessions` is
+// returned otherwise. A limit of 0 means no limit.
+func (sr *SessionRepository) CreateSessionWithinLimit(session *models.Session, limit int, evictOldest bool) ([]models.Session, error) {
+	if session == nil {
+		return nil, apperrors.ErrSessionIsNil
+	}
+	if limit <= 0 {
+		return nil, sr.CreateSession(session)
+	}
+
+	var evicted []models.Session
+	err := sr.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			Where("id = ?", session.UserID).
+			First(&user).Error; err != nil {
+			return err
+		}
+
+		var active []models.Session
+		if err := tx.Where("user_id = ? AND expires_at > ?", session.UserID, time.Now()).
+			Order("authenticated_at ASC, created_at ASC").
+			Find(&active).Error; err != nil {
+			return err
+		}
+		var err error
+		evicted, err = sessionsToEvict(active, limit, evictOldest)
+		if err != nil {
+			return err
+		}
+		if len(evicted) > 0 {
+			ids := make([]uuid.UUID, len(evicted))
+			for i, s := range evicted {
+				ids[i] = s.ID
+			}
+			if err := tx.Where("id IN ?", ids).Delete(&models.Session{}).Error; err != nil {
+				return err
+			}
+		}
+
+		return (&SessionRepository{DB: tx}).CreateSession(session)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range evicted {
+		sr.Cache.InvalidateSession(s.ID)
+	}
+	return evicted, nil
+}
+
 // GetUnexpiredSessionByID retrieves a session from the database by sessionID, but ignores any expired sessions
 func (sr *SessionRepository) GetUnexpiredSessionByID(sessionID uuid.UUID) (*models.Session, error) {
 	if sessionID == uuid.Nil {
@@ -55,12 +115,104 @@ func (sr *SessionRepository) GetUnexpiredSessionByID(sessionID uuid.UUID) (*mode
 	return &session, nil
 }
 
+// GetUnexpiredSessionByTokenHash retrieves an unexpired session by the hash of its token's secret
+func (sr *SessionRepository) GetUnexpiredSessionByTokenHash(tokenHash []byte) (*models.Session, error) {
+	if len(tokenHash) == 0 {
+		return nil, apperrors.ErrSessionIdIsEmpty
+	}
+	now := time.Now()
+	if cached, ok := sr.Cache.get(tokenHash, now); ok {
+		return cached, nil
+	}
+	generation := sr.Cache.currentGeneration()
+	var session models.Session
+	result := sr.DB.Where("token_hash = ? AND expires_at > ?", tokenHash, now).First(&session)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	// The index lookup isn't constant time, so don't trust it alone
+	if subtle.ConstantTimeCompare(session.TokenHash, tokenHash) != 1 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	sr.Cache.set(&session, generation, now)
+	return &session, nil
+}
+
+// GetUnexpiredSessionsByUserID retrieves a user's unexpired sessions, most recently seen first
+func (sr *SessionRepository) GetUnexpiredSessionsByUserID(userID string) ([]models.Session, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	var sessions []models.Session
+	result := sr.DB.
+		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions)
+	return sessions, result.Error
+}
+
+// TouchSession records that a session was just used from an IP address and moves its expiration
+// time to the end of its new idle timeout
+func (sr *SessionRepository) TouchSession(sessionID uuid.UUID, clientIP string, seenAt, expiresAt time.Time) error {
+	if sessionID == uuid.Nil {
+		return apperrors.ErrSessionIdIsEmpty
+	}
+	err := sr.DB.Model(&models.Session{}).
+		Where("id = ?", sessionID).
+		Updates(map[string]any{"last_seen_at": seenAt, "client_ip": clientIP, "expires_at": expiresAt}).Error
+	if err != nil {
+		sr.Cache.InvalidateSession(sessionID)
+		return err
+	}
+	sr.Cache.touch(sessionID, clientIP, seenAt, expiresAt)
+	return nil
+}
+
+// ReplaceSession deletes a session and inserts the one replacing it in a single transaction, so the
+// user is never left with both or neither
+func (sr *SessionRepository) ReplaceSession(oldSessionID uuid.UUID, session *models.Session) error {
+	if oldSessionID == uuid.Nil {
+		return apperrors.ErrSessionIdIsEmpty
+	}
+	if session == nil {
+		return apperrors.ErrSessionIsNil
+	}
+	err := sr.DB.Transaction(func(tx *gorm.DB) error {
+		if err := (&SessionRepository{DB: tx}).CreateSession(session); err != nil {
+			return err
+		}
+		return tx.Where("id = ?", oldSessionID).Delete(&models.Session{}).Error
+	})
+	sr.Cache.InvalidateSession(oldSessionID)
+	return err
+}
+
+// DeleteUserSession deletes one of a user's sessions. Sessions of other users are not found.
+func (sr *SessionRepository) DeleteUserSession(userID string, sessionID uuid.UUID) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	if sessionID == uuid.Nil {
+		return apperrors.ErrSessionIdIsEmpty
+	}
+	result := sr.DB.Where("id = ? AND user_id = ?", sessionID, userID).Delete(&models.Session{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	sr.Cache.InvalidateSession(sessionID)
+	return nil
+}
+
 // DeleteSessionByID deletes a single session from the database by sessionID
 func (sr *SessionRepository) DeleteSessionByID(sessionID uuid.UUID) error {
 	if sessionID == uuid.Nil {
 		return apperrors.ErrSessionIdIsEmpty
 	}
 	result := sr.DB.Where("id = ?", sessionID).Delete(&models.Session{})
+	sr.Cache.InvalidateSession(sessionID)
 	if result.RowsAffected == 0 {
 		return gorm.ErrRecordNotFound
 	}
@@ -73,8 +225,34 @@ func (sr *SessionRepository) DeleteSessionsByUserID(userID string) error {
 		return apperrors.ErrUserIdEmpty
 	}
 	result := sr.DB.Where("user_id = ?", userID).Delete(&models.Session{})
+	if id, err := uuid.Parse(userID); err == nil {
+		sr.Cache.InvalidateUser(id)
+	}
 	if result.RowsAffected == 0 {
 		return gorm.ErrRecordNotFound
 	}
 	return result.Error
 }
+
+// DeleteExpiredSessions deletes up to limit sessions that expired before the given time, oldest
+// first, and returns how many were deleted
+func (sr *SessionRepository) DeleteExpiredSessions(before time.Time, limit int) (int64, error) {
+	if limit <= 0 {
+		return 0, apperrors.ErrInvalidBatchSize
+	}
+	expired := sr.DB.Model(&models.Session{}).
+		Select("id").
+		Where("expires_at <= ?", before).
+		Order("expires_at ASC").
+		Limit(limit)
+	result := sr.DB.Where("id IN (?)", expired).Delete(&models.Session{})
+	return result.RowsAffected, result.Error
+}
+
+// CountUnexpiredSessions returns the number of sessions that haven't expired at the given time,
+// bypassing the cache
+func (sr *SessionRepository) CountUnexpiredSessions(now time.Time) (int64, error) {
+	var count int64
+	err := sr.DB.Model(&models.Session{}).Where("expires_at > ?", now).Count(&count).Error
+	return count, err
+}
@@ -1,6 +1,8 @@
 package repository_test
 
 import (
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -19,7 +21,7 @@ import (
 func TestSessionRepository_NewSessionRepository(t *testing.T) {
 	is := is.New(t)
 
-	testDB := testutils.TestDBSetup()
+	testDB := testutils.TestDBSetup(t)
 
 	t.Run("creates new session repo", func(t *testing.T) {
 		sr, err := repository.NewSessionRepository(testDB)
@@ -58,7 +60,7 @@ func TestSessionRepository_CreateSession(t *testing.T) {
 		err := sr.DB.Create(user).Error
 		is.NoErr(err)
 
-		session, err := models.NewSession(user.ID, uuid.New(), time.Now().Add(1*time.Hour))
+		session, err := models.NewSession(user.ID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(1*time.Hour))
 		is.NoErr(err)
 
 		err = sr.CreateSession(session)
@@ -76,19 +78,19 @@ func TestSessionRepository_CreateSession(t *testing.T) {
 		err := sr.DB.Create(user).Error
 		is.NoErr(err)
 
-		sessionID := uuid.New()
+		tokenHash := models.HashSessionSecret(uuid.NewString())
 
 		// Insert first session
-		sessionOne, err := models.NewSession(user.ID, sessionID, time.Now().Add(1*time.Hour))
+		sessionOne, err := models.NewSession(user.ID, tokenHash, time.Now().Add(1*time.Hour))
 		is.NoErr(err)
 
 		err = sr.CreateSession(sessionOne)
 		is.NoErr(err)
 
-		// Insert second session with same ID (expect error)
+		// Insert second session with same token (expect error)
 		sessionTwo, err := models.NewSession(
 			user.ID,
-			sessionID,
+			tokenHash,
 			time.Now().Add(1*time.Hour),
 		)
 		is.NoErr(err)
@@ -130,7 +132,7 @@ func TestSessionRepository_GetUnexpiredSessionByID(t *testing.T) {
 		is.NoErr(err)
 
 		// Insert associated session
-		session, err := models.NewSession(user.ID, uuid.New(), time.Now().Add(1*time.Hour))
+		session, err := models.NewSession(user.ID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(1*time.Hour))
 		is.NoErr(err)
 		err = sr.CreateSession(session)
 		is.NoErr(err)
@@ -143,6 +145,127 @@ func TestSessionRepository_GetUnexpiredSessionByID(t *testing.T) {
 	})
 }
 
+func TestSessionRepository_GetUnexpiredSessionByTokenHash(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("fails on empty token hash", func(t *testing.T) {
+		sr := setupSessionRepository(t)
+
+		session, err := sr.GetUnexpiredSessionByTokenHash(nil)
+		is.Equal(session, nil)
+		is.Equal(err, apperrors.ErrSessionIdIsEmpty)
+	})
+
+	t.Run("retrieves unexpired sessions only", func(t *testing.T) {
+		sr := setupSessionRepository(t)
+
+		user := &models.User{
+			Email:    "testGetUnexpiredSessionByTokenHash@test.com",
+			Password: "password",
+		}
+		err := sr.DB.Create(user).Error
+		is.NoErr(err)
+
+		tokenHash := models.HashSessionSecret(uuid.NewString())
+		session, err := models.NewSession(user.ID, tokenHash, time.Now().Add(1*time.Hour))
+		is.NoErr(err)
+		err = sr.CreateSession(session)
+		is.NoErr(err)
+
+		retrievedSession, err := sr.GetUnexpiredSessionByTokenHash(tokenHash)
+		is.NoErr(err)
+		is.Equal(retrievedSession.ID, session.ID)
+
+		// The session ID is not the token
+		_, err = sr.GetUnexpiredSessionByTokenHash(models.HashSessionSecret(session.ID.String()))
+		is.Equal(err, gorm.ErrRecordNotFound)
+
+		expiredHash := models.HashSessionSecret(uuid.NewString())
+		expired, err := models.NewSession(user.ID, expiredHash, time.Now().Add(-1*time.Hour))
+		is.NoErr(err)
+		err = sr.CreateSession(expired)
+		is.NoErr(err)
+		_, err = sr.GetUnexpiredSessionByTokenHash(expiredHash)
+		is.Equal(err, gorm.ErrRecordNotFound)
+	})
+}
+
+func TestSessionRepository_GetUnexpiredSessionsByUserID(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("fails on empty user ID", func(t *testing.T) {
+		sr := setupSessionRepository(t)
+
+		_, err := sr.GetUnexpiredSessionsByUserID("")
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("lists unexpired sessions, most recently seen first", func(t *testing.T) {
+		sr := setupSessionRepository(t)
+
+		user := &models.User{
+			Email:    "testGetUnexpiredSessionsByUserID@test.com",
+			Password: "password",
+		}
+		err := sr.DB.Create(user).Error
+		is.NoErr(err)
+
+		var sessions []*models.Session
+		for _, expiresIn := range []time.Duration{time.Hour, time.Hour, -time.Hour} {
+			session, err := models.NewSession(user.ID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(expiresIn))
+			is.NoErr(err)
+			err = sr.CreateSession(session)
+			is.NoErr(err)
+			sessions = append(sessions, session)
+		}
+		touchedExpiresAt := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+		err = sr.TouchSession(sessions[1].ID, "192.0.2.1", time.Now().Add(time.Minute), touchedExpiresAt)
+		is.NoErr(err)
+
+		retrieved, err := sr.GetUnexpiredSessionsByUserID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(len(retrieved), 2)
+		is.Equal(retrieved[0].ID, sessions[1].ID)
+		is.Equal(retrieved[0].ClientIP, "192.0.2.1")
+		is.True(retrieved[0].ExpiresAt.Equal(touchedExpiresAt))
+		is.Equal(retrieved[1].ID, sessions[0].ID)
+	})
+}
+
+func TestSessionRepository_DeleteUserSession(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("fails on empty ids", func(t *testing.T) {
+		sr := setupSessionRepository(t)
+
+		is.Equal(sr.DeleteUserSession("", uuid.New()), apperrors.ErrUserIdEmpty)
+		is.Equal(sr.DeleteUserSession(uuid.NewString(), uuid.Nil), apperrors.ErrSessionIdIsEmpty)
+	})
+
+	t.Run("deletes the user's session only", func(t *testing.T) {
+		sr := setupSessionRepository(t)
+
+		user := &models.User{
+			Email:    "testDeleteUserSession@test.com",
+			Password: "password",
+		}
+		err := sr.DB.Create(user).Error
+		is.NoErr(err)
+		session, err := models.NewSession(user.ID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(time.Hour))
+		is.NoErr(err)
+		err = sr.CreateSession(session)
+		is.NoErr(err)
+
+		err = sr.DeleteUserSession(uuid.NewString(), session.ID)
+		is.Equal(err, gorm.ErrRecordNotFound)
+
+		err = sr.DeleteUserSession(user.ID.String(), session.ID)
+		is.NoErr(err)
+		_, err = sr.GetUnexpiredSessionByID(session.ID)
+		is.Equal(err, gorm.ErrRecordNotFound)
+	})
+}
+
 func TestSessionRepository_DeleteSessionByID(t *testing.T) {
 	is := is.New(t)
 
@@ -172,7 +295,7 @@ func TestSessionRepository_DeleteSessionByID(t *testing.T) {
 		is.NoErr(err)
 
 		// Insert session to delete
-		session, err := models.NewSession(user.ID, uuid.New(), time.Now().Add(1*time.Hour))
+		session, err := models.NewSession(user.ID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(1*time.Hour))
 		is.NoErr(err)
 		err = sr.CreateSession(session)
 		is.NoErr(err)
@@ -217,13 +340,13 @@ func TestSessionRepository_DeleteSessionsByUserID(t *testing.T) {
 		is.NoErr(err)
 
 		// Insert first session associated with user
-		sessionOne, err := models.NewSession(user.ID, uuid.New(), time.Now().Add(1*time.Hour))
+		sessionOne, err := models.NewSession(user.ID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(1*time.Hour))
 		is.NoErr(err)
 		err = sr.CreateSession(sessionOne)
 		is.NoErr(err)
 
 		// Insert second session associated with user
-		sessionTwo, err := models.NewSession(user.ID, uuid.New(), time.Now().Add(1*time.Hour))
+		sessionTwo, err := models.NewSession(user.ID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(1*time.Hour))
 		is.NoErr(err)
 		err = sr.CreateSession(sessionTwo)
 		is.NoErr(err)
@@ -246,10 +369,157 @@ func TestSessionRepository_DeleteSessionsByUserID(t *testing.T) {
 	})
 }
 
-func setupSessionRepository(t *testing.T) *repository.SessionRepository {
+func TestSessionRepository_CreateSessionWithinLimit(t *testing.T) {
+	is := is.New(t)
+
+	newUser := func(sr *repository.SessionRepository, email string) *models.User {
+		user := &models.User{Email: email, Password: "password"}
+		is.NoErr(sr.DB.Create(user).Error)
+		return user
+	}
+	newSession := func(userID uuid.UUID, loggedInAgo time.Duration) *models.Session {
+		session, err := models.NewSession(userID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(time.Hour))
+		is.NoErr(err)
+		session.AuthenticatedAt = time.Now().Add(-loggedInAgo)
+		return session
+	}
+
+	t.Run("fails on nil session", func(t *testing.T) {
+		sr := setupSessionRepository(t)
+		_, err := sr.CreateSessionWithinLimit(nil, 1, true)
+		is.Equal(err, apperrors.ErrSessionIsNil)
+	})
+
+	t.Run("evicts the oldest sessions", func(t *testing.T) {
+		sr := setupSessionRepository(t)
+		user := newUser(sr, "testCreateSessionWithinLimitEvict@test.com")
+
+		newest := newSession(user.ID, time.Minute)
+		oldest := newSession(user.ID, time.Hour)
+		for _, session := range []*models.Session{newest, oldest} {
+			evicted, err := sr.CreateSessionWithinLimit(session, 2, true)
+			is.NoErr(err)
+			is.Equal(len(evicted), 0)
+		}
+		// Expired sessions don't count
+		expired, err := models.NewSession(user.ID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(-time.Minute))
+		is.NoErr(err)
+		is.NoErr(sr.CreateSession(expired))
+
+		evicted, err := sr.CreateSessionWithinLimit(newSession(user.ID, 0), 2, true)
+		is.NoErr(err)
+		is.Equal(len(evicted), 1)
+		is.Equal(evicted[0].ID, oldest.ID)
+
+		sessions, err := sr.GetUnexpiredSessionsByUserID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(len(sessions), 2)
+		_, err = sr.GetUnexpiredSessionByID(oldest.ID)
+		is.Equal(err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("rejects sessions over the limit", func(t *testing.T) {
+		sr := setupSessionRepository(t)
+		user := newUser(sr, "testCreateSessionWithinLimitReject@test.com")
+
+		_, err := sr.CreateSessionWithinLimit(newSession(user.ID, 0), 1, false)
+		is.NoErr(err)
+		rejected := newSession(user.ID, 0)
+		_, err = sr.CreateSessionWithinLimit(rejected, 1, false)
+		is.Equal(err, apperrors.ErrTooManySessions)
+		_, err = sr.GetUnexpiredSessionByID(rejected.ID)
+		is.Equal(err, gorm.ErrRecordNotFound)
+
+		// Other users have their own limit
+		other := newUser(sr, "testCreateSessionWithinLimitRejectOther@test.com")
+		_, err = sr.CreateSessionWithinLimit(newSession(other.ID, 0), 1, false)
+		is.NoErr(err)
+	})
+
+	t.Run("no limit", func(t *testing.T) {
+		sr := setupSessionRepository(t)
+		user := newUser(sr, "testCreateSessionWithinLimitNone@test.com")
+
+		for range 3 {
+			evicted, err := sr.CreateSessionWithinLimit(newSession(user.ID, 0), 0, true)
+			is.NoErr(err)
+			is.Equal(len(evicted), 0)
+		}
+		sessions, err := sr.GetUnexpiredSessionsByUserID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(len(sessions), 3)
+	})
+
+	t.Run("parallel logins can't exceed the limit", func(t *testing.T) {
+		// Outside of a test transaction, so the logins really run in parallel
+		sr, err := repository.NewSessionRepository(testutils.TestDBSetup(t))
+		is.NoErr(err)
+		user := newUser(sr, "testCreateSessionWithinLimitParallel@test.com")
+		t.Cleanup(func() { sr.DB.Delete(user) })
+
+		const limit, logins = 2, 8
+		var wg sync.WaitGroup
+		var created atomic.Int32
+		for range logins {
+			session := newSession(user.ID, 0)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := sr.CreateSessionWithinLimit(session, limit, false); err == nil {
+					created.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		is.Equal(created.Load(), int32(limit))
+
+		sessions, err := sr.GetUnexpiredSessionsByUserID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(len(sessions), limit)
+	})
+}
+
+func TestSessionRepository_DeleteExpiredSessions(t *testing.T) {
+	is := is.New(t)
+	sr := setupSessionRepository(t)
+
+	_, err := sr.DeleteExpiredSessions(time.Now(), 0)
+	is.Equal(err, apperrors.ErrInvalidBatchSize)
+
+	user := &models.User{Email: "testDeleteExpiredSessions@test.com", Password: "password"}
+	is.NoErr(sr.DB.Create(user).Error)
+	var sessions []*models.Session
+	for _, expiresIn := range []time.Duration{-3 * time.Hour, -2 * time.Hour, -time.Hour, time.Hour} {
+		session, err := models.NewSession(user.ID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(expiresIn))
+		is.NoErr(err)
+		is.NoErr(sr.CreateSession(session))
+		sessions = append(sessions, session)
+	}
+
+	// The oldest expired sessions go first, and only up to the batch size
+	deleted, err := sr.DeleteExpiredSessions(time.Now(), 2)
+	is.NoErr(err)
+	is.Equal(deleted, int64(2))
+	var remaining []models.Session
+	is.NoErr(sr.DB.Where("user_id = ?", user.ID).Order("expires_at ASC").Find(&remaining).Error)
+	is.Equal(len(remaining), 2)
+	is.Equal(remaining[0].ID, sessions[2].ID)
+
+	// Unexpired sessions are kept
+	deleted, err = sr.DeleteExpiredSessions(time.Now(), 2)
+	is.NoErr(err)
+	is.Equal(deleted, int64(1))
+	deleted, err = sr.DeleteExpiredSessions(time.Now(), 2)
+	is.NoErr(err)
+	is.Equal(deleted, int64(0))
+	_, err = sr.GetUnexpiredSessionByID(sessions[3].ID)
+	is.NoErr(err)
+}
+
+func setupSessionRepository(t testing.TB) *repository.SessionRepository {
 	t.Helper()
 
-	testDB := testutils.TestDBSetup()
+	testDB := testutils.TestDBSetup(t)
 	tx := testDB.Begin()
 	t.Cleanup(func() { tx.Rollback() })
 
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// SessionStore stores sessions. `SessionRepository` keeps them in Postgres, `MemorySessionStore` in
+// the process and `RedisSessionStore` in a Redis server. Every implementation reports a session that
+// doesn't exist or has expired as `gorm.ErrRecordNotFound`, like the Postgres one.
+type SessionStore interface {
+	// CreateSession stores a new session, failing with `apperrors.ErrSessionAlreadyExists` if its ID
+	// or token hash is taken
+	CreateSession(session *models.Session) error
+	// CreateSessionWithinLimit stores a new session unless its user already has `limit` unexpired
+	// sessions. Over the limit, the sessions the user logged in to longest ago are deleted and
+	// returned if evictOldest is set, and `apperrors.ErrTooManySessions` is returned otherwise. A
+	// limit of 0 means no limit.
+	CreateSessionWithinLimit(session *models.Session, limit int, evictOldest bool) ([]models.Session, error)
+	// GetUnexpiredSessionByID returns an unexpired session by its ID
+	GetUnexpiredSessionByID(sessionID uuid.UUID) (*models.Session, error)
+	// GetUnexpiredSessionByTokenHash returns an unexpired session by the hash of its token's secret
+	GetUnexpiredSessionByTokenHash(tokenHash []byte) (*models.Session, error)
+	// GetUnexpiredSessionsByUserID returns a user's unexpired sessions, most recently seen first
+	GetUnexpiredSessionsByUserID(userID string) ([]models.Session, error)
+	// TouchSession records that a session was just used from an IP address and moves its
+	// expiration time
+	TouchSession(sessionID uuid.UUID, clientIP string, seenAt, expiresAt time.Time) error
+	// ReplaceSession deletes a session and stores the one replacing it at once
+	ReplaceSession(oldSessionID uuid.UUID, session *models.Session) error
+	// DeleteUserSession deletes one of a user's sessions. Sessions of other users are not found.
+	DeleteUserSession(userID string, sessionID uuid.UUID) error
+	// DeleteSessionByID deletes a session
+	DeleteSessionByID(sessionID uuid.UUID) error
+	// DeleteSessionsByUserID deletes all of a user's sessions
+	DeleteSessionsByUserID(userID string) error
+	// DeleteExpiredSessions deletes up to limit sessions that expired before the given time and
+	// returns how many were deleted
+	DeleteExpiredSessions(before time.Time, limit int) (int64, error)
+	// CountUnexpiredSessions returns the number of sessions of all users that haven't expired at
+	// the given time
+	CountUnexpiredSessions(now time.Time) (int64, error)
+}
+
+var (
+	_ SessionStore = (*SessionRepository)(nil)
+	_ SessionStore = (*MemorySessionStore)(nil)
+	_ SessionStore = (*RedisSessionStore)(nil)
+)
+
+// redisPingTimeout is how long `NewSessionStoreFromConfig` waits for a Redis server to answer
+const redisPingTimeout = 5 * time.Second
+
+// NewSessionStoreFromConfig returns the session store selected by `cfg.Store`. Postgres is used when
+// nothing is selected, with a `SessionCache` in front of it.
+func NewSessionStoreFromConfig(db *gorm.DB, cfg config.SessionConfig) (SessionStore, error) {
+	switch kind := cfg.Store; kind {
+	case "postgres", "":
+		sr, err := NewSessionRepository(db)
+		if err != nil {
+			return nil, err
+		}
+		sr.Cache = NewSessionCache(cfg.CacheTTL, cfg.CacheSize)
+		return sr, nil
+	case "memory":
+		return NewMemorySessionStore(), nil
+	case "redis":
+		rs, err := NewRedisSessionStoreFromURL(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), redisPingTimeout)
+		defer cancel()
+		if err := rs.Client.Ping(ctx).Err(); err != nil {
+			return nil, err
+		}
+		return rs, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", apperrors.ErrUnknownSessionStore, kind)
+	}
+}
+
+// prepareNewSession fills in the fields of a new session that Postgres would default, for the
+// stores that don't
+func prepareNewSession(session *models.Session, now time.Time) {
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+	}
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now
+	}
+	if session.AuthenticatedAt.IsZero() {
+		session.AuthenticatedAt = now
+	}
+	if session.LastSeenAt.IsZero() {
+		session.LastSeenAt = now
+	}
+}
+
+// sessionsToEvict returns the sessions to delete so a user with the given active sessions can log in
+// again within limit, the ones they logged in to longest ago first. active must be sorted that way.
+func sessionsToEvict(active []models.Session, limit int, evictOldest bool) ([]models.Session, error) {
+	over := len(active) - limit + 1
+	if over <= 0 {
+		return nil, nil
+	}
+	if !evictOldest {
+		return nil, apperrors.ErrTooManySessions
+	}
+	return active[:over], nil
+}
+
+// compareAuthenticatedAt orders sessions like `CreateSessionWithinLimit` evicts them
+func compareAuthenticatedAt(a, b models.Session) int {
+	if c := a.AuthenticatedAt.Compare(b.AuthenticatedAt); c != 0 {
+		return c
+	}
+	return a.CreatedAt.Compare(b.CreatedAt)
+}
+
+// compareLastSeenAtDesc orders sessions like `GetUnexpiredSessionsByUserID` returns them
+func compareLastSeenAtDesc(a, b models.Session) int {
+	return b.LastSeenAt.Compare(a.LastSeenAt)
+}
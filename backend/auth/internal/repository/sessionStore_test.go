@@ -0,0 +1,333 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// sessionStoreSetup returns an empty session store and a function adding users to it
+type sessionStoreSetup func(t *testing.T) (repository.SessionStore, func() uuid.UUID)
+
+func setupMemorySessionStore(t *testing.T) (repository.SessionStore, func() uuid.UUID) {
+	return repository.NewMemorySessionStore(), uuid.New
+}
+
+func setupRedisSessionStore(t *testing.T) (repository.SessionStore, func() uuid.UUID) {
+	rs, _ := newMiniredisSessionStore(t)
+	return rs, uuid.New
+}
+
+func setupPostgresSessionStore(t *testing.T) (repository.SessionStore, func() uuid.UUID) {
+	sr := setupSessionRepository(t)
+	return sr, func() uuid.UUID {
+		return createTestUser(t, sr.DB, uuid.NewString()+"@test.com").ID
+	}
+}
+
+// newMiniredisSessionStore returns a RedisSessionStore using an embedded Redis server
+func newMiniredisSessionStore(t *testing.T) (*repository.RedisSessionStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	rs, err := repository.NewRedisSessionStore(client)
+	if err != nil {
+		t.Fatalf("failed to create redis session store: %v", err)
+	}
+	return rs, mr
+}
+
+// newStoreSession returns a new session of a user expiring in ttl, not stored yet
+func newStoreSession(t *testing.T, userID uuid.UUID, ttl time.Duration) *models.Session {
+	t.Helper()
+
+	session, err := models.NewSession(userID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(ttl))
+	if err != nil {
+		t.Fatalf("failed to create test session: %v", err)
+	}
+	return session
+}
+
+// TestSessionStore_Memory tests the in-memory session store
+func TestSessionStore_Memory(t *testing.T) {
+	testSessionStore(t, setupMemorySessionStore)
+}
+
+// TestSessionStore_Redis tests the Redis session store against an embedded server
+func TestSessionStore_Redis(t *testing.T) {
+	testSessionStore(t, setupRedisSessionStore)
+}
+
+// TestSessionStore_Postgres tests that the Postgres session store behaves like the others
+func TestSessionStore_Postgres(t *testing.T) {
+	testSessionStore(t, setupPostgresSessionStore)
+}
+
+// testSessionStore tests the behavior all session stores share
+func testSessionStore(t *testing.T, setup sessionStoreSetup) {
+	is := is.New(t)
+
+	t.Run("creates and gets sessions", func(t *testing.T) {
+		store, newUser := setup(t)
+		session := newStoreSession(t, newUser(), time.Hour)
+		session.DeviceLabel = "Firefox on Linux"
+		is.NoErr(store.CreateSession(session))
+
+		byID, err := store.GetUnexpiredSessionByID(session.ID)
+		is.NoErr(err)
+		is.Equal(byID.UserID, session.UserID)
+		is.Equal(byID.DeviceLabel, "Firefox on Linux")
+		is.True(byID.ExpiresAt.Sub(session.ExpiresAt).Abs() < time.Millisecond)
+
+		byToken, err := store.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.NoErr(err)
+		is.Equal(byToken.ID, session.ID)
+
+		_, err = store.GetUnexpiredSessionByTokenHash(models.HashSessionSecret("unknown"))
+		is.Equal(err, gorm.ErrRecordNotFound)
+		_, err = store.GetUnexpiredSessionByID(uuid.New())
+		is.Equal(err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("rejects duplicates", func(t *testing.T) {
+		store, newUser := setup(t)
+		session := newStoreSession(t, newUser(), time.Hour)
+		is.NoErr(store.CreateSession(session))
+
+		sameToken := newStoreSession(t, session.UserID, time.Hour)
+		sameToken.TokenHash = session.TokenHash
+		is.Equal(store.CreateSession(sameToken), apperrors.ErrSessionAlreadyExists)
+		is.Equal(store.CreateSession(nil), apperrors.ErrSessionIsNil)
+	})
+
+	t.Run("ignores expired sessions", func(t *testing.T) {
+		store, newUser := setup(t)
+		session := newStoreSession(t, newUser(), time.Hour)
+		is.NoErr(store.CreateSession(session))
+
+		past := time.Now().Add(-time.Minute)
+		is.NoErr(store.TouchSession(session.ID, "192.0.2.1", past, past))
+		_, err := store.GetUnexpiredSessionByID(session.ID)
+		is.Equal(err, gorm.ErrRecordNotFound)
+		_, err = store.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.Equal(err, gorm.ErrRecordNotFound)
+		sessions, err := store.GetUnexpiredSessionsByUserID(session.UserID.String())
+		is.NoErr(err)
+		is.Equal(len(sessions), 0)
+	})
+
+	t.Run("lists a user's sessions", func(t *testing.T) {
+		store, newUser := setup(t)
+		userID := newUser()
+		older := newStoreSession(t, userID, time.Hour)
+		newer := newStoreSession(t, userID, time.Hour)
+		other := newStoreSession(t, newUser(), time.Hour)
+		for _, s := range []*models.Session{older, newer, other} {
+			is.NoErr(store.CreateSession(s))
+		}
+
+		seenAt := time.Now().Add(time.Minute)
+		is.NoErr(store.TouchSession(newer.ID, "192.0.2.1", seenAt, seenAt.Add(time.Hour)))
+		sessions, err := store.GetUnexpiredSessionsByUserID(userID.String())
+		is.NoErr(err)
+		is.Equal(len(sessions), 2)
+		is.Equal(sessions[0].ID, newer.ID)
+		is.Equal(sessions[0].ClientIP, "192.0.2.1")
+		is.True(sessions[0].ExpiresAt.Sub(seenAt.Add(time.Hour)).Abs() < time.Millisecond)
+		is.Equal(sessions[1].ID, older.ID)
+
+		// Touching a session that doesn't exist does nothing
+		is.NoErr(store.TouchSession(uuid.New(), "192.0.2.1", seenAt, seenAt))
+	})
+
+	t.Run("replaces sessions", func(t *testing.T) {
+		store, newUser := setup(t)
+		session := newStoreSession(t, newUser(), time.Hour)
+		is.NoErr(store.CreateSession(session))
+
+		replacement := newStoreSession(t, session.UserID, time.Hour)
+		is.NoErr(store.ReplaceSession(session.ID, replacement))
+		_, err := store.GetUnexpiredSessionByTokenHash(session.TokenHash)
+		is.Equal(err, gorm.ErrRecordNotFound)
+		_, err = store.GetUnexpiredSessionByTokenHash(replacement.TokenHash)
+		is.NoErr(err)
+
+		// A failed replacement keeps the old session
+		duplicate := newStoreSession(t, session.UserID, time.Hour)
+		duplicate.TokenHash = replacement.TokenHash
+		is.Equal(store.ReplaceSession(replacement.ID, duplicate), apperrors.ErrSessionAlreadyExists)
+		_, err = store.GetUnexpiredSessionByID(replacement.ID)
+		is.NoErr(err)
+	})
+
+	t.Run("deletes sessions", func(t *testing.T) {
+		store, newUser := setup(t)
+		userID := newUser()
+		first := newStoreSession(t, userID, time.Hour)
+		second := newStoreSession(t, userID, time.Hour)
+		third := newStoreSession(t, userID, time.Hour)
+		for _, s := range []*models.Session{first, second, third} {
+			is.NoErr(store.CreateSession(s))
+		}
+
+		is.NoErr(store.DeleteSessionByID(first.ID))
+		_, err := store.GetUnexpiredSessionByID(first.ID)
+		is.Equal(err, gorm.ErrRecordNotFound)
+		is.Equal(store.DeleteSessionByID(first.ID), gorm.ErrRecordNotFound)
+
+		// Other users' sessions aren't found
+		is.Equal(store.DeleteUserSession(uuid.NewString(), second.ID), gorm.ErrRecordNotFound)
+		is.NoErr(store.DeleteUserSession(userID.String(), second.ID))
+		_, err = store.GetUnexpiredSessionByID(second.ID)
+		is.Equal(err, gorm.ErrRecordNotFound)
+
+		is.NoErr(store.DeleteSessionsByUserID(userID.String()))
+		_, err = store.GetUnexpiredSessionByTokenHash(third.TokenHash)
+		is.Equal(err, gorm.ErrRecordNotFound)
+		is.Equal(store.DeleteSessionsByUserID(userID.String()), gorm.ErrRecordNotFound)
+	})
+
+	t.Run("limits sessions", func(t *testing.T) {
+		store, newUser := setup(t)
+		userID := newUser()
+		oldest := newStoreSession(t, userID, time.Hour)
+		oldest.AuthenticatedAt = time.Now().Add(-time.Hour)
+		newest := newStoreSession(t, userID, time.Hour)
+		for _, s := range []*models.Session{oldest, newest} {
+			_, err := store.CreateSessionWithinLimit(s, 2, true)
+			is.NoErr(err)
+		}
+
+		_, err := store.CreateSessionWithinLimit(newStoreSession(t, userID, time.Hour), 2, false)
+		is.True(errors.Is(err, apperrors.ErrTooManySessions))
+
+		evicted, err := store.CreateSessionWithinLimit(newStoreSession(t, userID, time.Hour), 2, true)
+		is.NoErr(err)
+		is.Equal(len(evicted), 1)
+		is.Equal(evicted[0].ID, oldest.ID)
+		sessions, err := store.GetUnexpiredSessionsByUserID(userID.String())
+		is.NoErr(err)
+		is.Equal(len(sessions), 2)
+	})
+
+	t.Run("deletes expired sessions", func(t *testing.T) {
+		store, newUser := setup(t)
+		userID := newUser()
+		active := newStoreSession(t, userID, time.Hour)
+		is.NoErr(store.CreateSession(active))
+		for range 3 {
+			expired := newStoreSession(t, userID, time.Hour)
+			is.NoErr(store.CreateSession(expired))
+			past := time.Now().Add(-time.Minute)
+			is.NoErr(store.TouchSession(expired.ID, "", past, past))
+		}
+
+		_, err := store.DeleteExpiredSessions(time.Now(), 0)
+		is.Equal(err, apperrors.ErrInvalidBatchSize)
+
+		var deleted int64
+		for {
+			n, err := store.DeleteExpiredSessions(time.Now(), 2)
+			is.NoErr(err)
+			deleted += n
+			if n < 2 {
+				break
+			}
+		}
+		is.Equal(deleted, int64(3))
+		_, err = store.GetUnexpiredSessionByID(active.ID)
+		is.NoErr(err)
+	})
+
+	t.Run("counts unexpired sessions", func(t *testing.T) {
+		store, newUser := setup(t)
+		// The Postgres store may have sessions of other tests
+		before, err := store.CountUnexpiredSessions(time.Now())
+		is.NoErr(err)
+
+		for _, userID := range []uuid.UUID{newUser(), newUser()} {
+			is.NoErr(store.CreateSession(newStoreSession(t, userID, time.Hour)))
+			expired := newStoreSession(t, userID, time.Hour)
+			is.NoErr(store.CreateSession(expired))
+			past := time.Now().Add(-time.Minute)
+			is.NoErr(store.TouchSession(expired.ID, "", past, past))
+		}
+
+		count, err := store.CountUnexpiredSessions(time.Now())
+		is.NoErr(err)
+		is.Equal(count, before+2)
+	})
+}
+
+// TestRedisSessionStore_Expiry tests that sessions stored in Redis expire with their keys
+func TestRedisSessionStore_Expiry(t *testing.T) {
+	is := is.New(t)
+	rs, mr := newMiniredisSessionStore(t)
+
+	session := newStoreSession(t, uuid.New(), time.Hour)
+	is.NoErr(rs.CreateSession(session))
+	is.Equal(len(mr.Keys()), 3)
+	is.True(mr.TTL(config.RedisKeyPrefix+"session:"+session.ID.String()) > 59*time.Minute)
+
+	// Touching moves the expiration of the keys
+	is.NoErr(rs.TouchSession(session.ID, "192.0.2.1", time.Now(), time.Now().Add(2*time.Hour)))
+	is.True(mr.TTL(config.RedisKeyPrefix+"session:"+session.ID.String()) > time.Hour)
+
+	mr.FastForward(3 * time.Hour)
+	_, err := rs.GetUnexpiredSessionByTokenHash(session.TokenHash)
+	is.Equal(err, gorm.ErrRecordNotFound)
+	// Only the user's index is left, until it is reaped
+	is.Equal(mr.Keys(), []string{config.RedisKeyPrefix + "user_sessions:" + session.UserID.String()})
+	_, err = rs.DeleteExpiredSessions(time.Now().Add(3*time.Hour), 10)
+	is.NoErr(err)
+	is.Equal(len(mr.Keys()), 0)
+}
+
+// TestSessionStore_NewSessionStoreFromConfig tests selecting the session store in the config
+func TestSessionStore_NewSessionStoreFromConfig(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("memory", func(t *testing.T) {
+		store, err := repository.NewSessionStoreFromConfig(nil, config.SessionConfig{Store: "memory"})
+		is.NoErr(err)
+		_, ok := store.(*repository.MemorySessionStore)
+		is.True(ok)
+	})
+
+	t.Run("redis", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		cfg := config.SessionConfig{Store: "redis", RedisURL: "redis://" + mr.Addr() + "/0"}
+		store, err := repository.NewSessionStoreFromConfig(nil, cfg)
+		is.NoErr(err)
+		rs, ok := store.(*repository.RedisSessionStore)
+		is.True(ok)
+		rs.Client.Close()
+
+		cfg.RedisURL = ""
+		_, err = repository.NewSessionStoreFromConfig(nil, cfg)
+		is.Equal(err, apperrors.ErrRedisURLIsEmpty)
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		_, err := repository.NewSessionStoreFromConfig(nil, config.SessionConfig{})
+		is.Equal(err, apperrors.ErrDatabaseIsNil)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := repository.NewSessionStoreFromConfig(nil, config.SessionConfig{Store: "mongodb"})
+		is.True(errors.Is(err, apperrors.ErrUnknownSessionStore))
+	})
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// TOTPRepository represents the entry point into the database for managing the
+// `totp_credentials` table
+type TOTPRepository struct {
+	DB *gorm.DB
+}
+
+// NewTOTPRepository returns a value for the TOTPRepository struct
+func NewTOTPRepository(db *gorm.DB) (*TOTPRepository, error) {
+	if db == nil {
+		return nil, apperrors.ErrDatabaseIsNil
+	}
+	return &TOTPRepository{DB: db}, nil
+}
+
+// GetCredentialByUserID gets a user's TOTP credential, confirmed or not. Returns
+// `apperrors.ErrMFANotEnrolled` if the user has none.
+func (tr *TOTPRepository) GetCredentialByUserID(userID string) (*models.TOTPCredential, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+
+	var cred models.TOTPCredential
+	err := tr.DB.First(&cred, "user_id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apperrors.ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+// SavePendingCredential inserts an unconfirmed credential, replacing any previous unconfirmed
+// one so an abandoned enrollment can be restarted. Returns `apperrors.ErrMFAAlreadyEnabled` if the
+// user already has a confirmed credential.
+func (tr *TOTPRepository) SavePendingCredential(cred *models.TOTPCredential) error {
+	if cred == nil {
+		return apperrors.ErrTOTPSecretIsEmpty
+	}
+
+	result := tr.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"encrypted_secret", "last_used_step", "created_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "totp_credentials.confirmed_at IS NULL"},
+		}},
+	}).Create(cred)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+// ConfirmCredential marks a pending credential as confirmed and records the time step of the
+// code used to confirm it. Returns `apperrors.ErrInvalidMFACode` if the credential is already
+// confirmed or the step has already been used.
+func (tr *TOTPRepository) ConfirmCredential(userID string, step int64, at time.Time) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+
+	result := tr.DB.Model(&models.TOTPCredential{}).
+		Where("user_id = ? AND confirmed_at IS NULL AND last_used_step < ?", userID, step).
+		Updates(map[string]any{
+			"confirmed_at":   at.UTC(),
+			"last_used_step": step,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.ErrInvalidMFACode
+	}
+	return nil
+}
+
+// UseStep atomically records that a code from the given time step was accepted for a confirmed
+// credential. Returns `apperrors.ErrInvalidMFACode` if that step or a later one was already used,
+// so each code is accepted at most once even under concurrent requests.
+func (tr *TOTPRepository) UseStep(userID string, step int64) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+
+	result := tr.DB.Model(&models.TOTPCredential{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.ErrInvalidMFACode
+	}
+	return nil
+}
+
+// DeleteCredential removes a user's TOTP credential. Returns `apperrors.ErrMFANotEnrolled` if the
+// user has none.
+func (tr *TOTPRepository) DeleteCredential(userID string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+
+	result := tr.DB.Where("user_id = ?", userID).Delete(&models.TOTPCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.ErrMFANotEnrolled
+	}
+	return nil
+}
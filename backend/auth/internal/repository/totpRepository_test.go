@@ -0,0 +1,140 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestTOTPRepository_NewTOTPRepository tests creation of TOTPRepository structs in the
+// `repository` package
+func TestTOTPRepository_NewTOTPRepository(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("returns err with nil db", func(t *testing.T) {
+		tr, err := repository.NewTOTPRepository(nil)
+		is.Equal(tr, nil)
+		is.Equal(err, apperrors.ErrDatabaseIsNil)
+	})
+
+	t.Run("creates new TOTP repo", func(t *testing.T) {
+		tr := setupTOTPRepository(t)
+		is.True(tr != nil)
+	})
+}
+
+func TestTOTPRepository_SavePendingCredential(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("saves and replaces pending credential", func(t *testing.T) {
+		tr := setupTOTPRepository(t)
+		user := createTestUser(t, tr.DB, "testSavePendingCredential@test.com")
+
+		first, err := models.NewTOTPCredential(user.ID, "first")
+		is.NoErr(err)
+		is.NoErr(tr.SavePendingCredential(first))
+
+		second, err := models.NewTOTPCredential(user.ID, "second")
+		is.NoErr(err)
+		is.NoErr(tr.SavePendingCredential(second))
+
+		cred, err := tr.GetCredentialByUserID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(cred.EncryptedSecret, "second")
+	})
+
+	t.Run("does not replace confirmed credential", func(t *testing.T) {
+		tr := setupTOTPRepository(t)
+		user := createTestUser(t, tr.DB, "testSavePendingCredential@test.com")
+
+		cred, err := models.NewTOTPCredential(user.ID, "confirmed")
+		is.NoErr(err)
+		is.NoErr(tr.SavePendingCredential(cred))
+		is.NoErr(tr.ConfirmCredential(user.ID.String(), 10, time.Now()))
+
+		replacement, err := models.NewTOTPCredential(user.ID, "replacement")
+		is.NoErr(err)
+		err = tr.SavePendingCredential(replacement)
+		is.Equal(err, apperrors.ErrMFAAlreadyEnabled)
+
+		stored, err := tr.GetCredentialByUserID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(stored.EncryptedSecret, "confirmed")
+	})
+}
+
+func TestTOTPRepository_UseStep(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("fails on unconfirmed credential", func(t *testing.T) {
+		tr := setupTOTPRepository(t)
+		user := createTestUser(t, tr.DB, "testUseStep@test.com")
+
+		cred, err := models.NewTOTPCredential(user.ID, "sealed")
+		is.NoErr(err)
+		is.NoErr(tr.SavePendingCredential(cred))
+
+		err = tr.UseStep(user.ID.String(), 10)
+		is.Equal(err, apperrors.ErrInvalidMFACode)
+	})
+
+	t.Run("only accepts increasing steps", func(t *testing.T) {
+		tr := setupTOTPRepository(t)
+		user := createTestUser(t, tr.DB, "testUseStep@test.com")
+
+		cred, err := models.NewTOTPCredential(user.ID, "sealed")
+		is.NoErr(err)
+		is.NoErr(tr.SavePendingCredential(cred))
+		is.NoErr(tr.ConfirmCredential(user.ID.String(), 10, time.Now()))
+
+		is.Equal(tr.UseStep(user.ID.String(), 10), apperrors.ErrInvalidMFACode)
+		is.NoErr(tr.UseStep(user.ID.String(), 11))
+		is.Equal(tr.UseStep(user.ID.String(), 11), apperrors.ErrInvalidMFACode)
+		is.Equal(tr.UseStep(user.ID.String(), 9), apperrors.ErrInvalidMFACode)
+	})
+}
+
+func TestTOTPRepository_DeleteCredential(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("fails on missing credential", func(t *testing.T) {
+		tr := setupTOTPRepository(t)
+		user := createTestUser(t, tr.DB, "testDeleteCredential@test.com")
+
+		err := tr.DeleteCredential(user.ID.String())
+		is.Equal(err, apperrors.ErrMFANotEnrolled)
+	})
+
+	t.Run("deletes credential", func(t *testing.T) {
+		tr := setupTOTPRepository(t)
+		user := createTestUser(t, tr.DB, "testDeleteCredential@test.com")
+
+		cred, err := models.NewTOTPCredential(user.ID, "sealed")
+		is.NoErr(err)
+		is.NoErr(tr.SavePendingCredential(cred))
+		is.NoErr(tr.DeleteCredential(user.ID.String()))
+
+		_, err = tr.GetCredentialByUserID(user.ID.String())
+		is.Equal(err, apperrors.ErrMFANotEnrolled)
+	})
+}
+
+func setupTOTPRepository(t *testing.T) *repository.TOTPRepository {
+	t.Helper()
+
+	testDB := testutils.TestDBSetup(t)
+	tx := testDB.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+
+	tr, err := repository.NewTOTPRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create TOTP repository: %v", err)
+	}
+	return tr
+}
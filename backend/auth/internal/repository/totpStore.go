@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"time"
+
+	"godiscauth/internal/models"
+)
+
+// TOTPStore stores the TOTP credentials of users enrolling in or enrolled in two-factor
+// authentication. `TOTPRepository` keeps them in Postgres and `MemoryTOTPStore` in the process.
+type TOTPStore interface {
+	// GetCredentialByUserID returns a user's credential, confirmed or not, or fails with
+	// `apperrors.ErrMFANotEnrolled`
+	GetCredentialByUserID(userID string) (*models.TOTPCredential, error)
+	// SavePendingCredential stores an unconfirmed credential, replacing an unconfirmed one, or fails
+	// with `apperrors.ErrMFAAlreadyEnabled` if the user's credential is confirmed
+	SavePendingCredential(cred *models.TOTPCredential) error
+	// ConfirmCredential confirms a user's pending credential with a code from a later time step than
+	// any used before, or fails with `apperrors.ErrInvalidMFACode`
+	ConfirmCredential(userID string, step int64, at time.Time) error
+	// UseStep records that a code from a later time step than any used before was accepted for a
+	// user's confirmed credential, or fails with `apperrors.ErrInvalidMFACode`
+	UseStep(userID string, step int64) error
+	// DeleteCredential deletes a user's credential, or fails with `apperrors.ErrMFANotEnrolled`
+	DeleteCredential(userID string) error
+}
+
+var (
+	_ TOTPStore = (*TOTPRepository)(nil)
+	_ TOTPStore = (*MemoryTOTPStore)(nil)
+)
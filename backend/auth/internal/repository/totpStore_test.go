@@ -0,0 +1,99 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+)
+
+// totpStoreSetup returns an empty TOTP store and a way to create its users
+type totpStoreSetup func(t *testing.T) (repository.TOTPStore, storeUsers)
+
+func setupMemoryTOTPStore(t *testing.T) (repository.TOTPStore, storeUsers) {
+	return repository.NewMemoryTOTPStore(), memoryStoreUsers
+}
+
+func setupPostgresTOTPStore(t *testing.T) (repository.TOTPStore, storeUsers) {
+	t.Helper()
+
+	tx := beginTestTx(t)
+	tr, err := repository.NewTOTPRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create TOTP repository: %v", err)
+	}
+	return tr, postgresStoreUsers(tx)
+}
+
+// TestTOTPStore_Memory tests the in-memory TOTP store
+func TestTOTPStore_Memory(t *testing.T) {
+	testTOTPStore(t, setupMemoryTOTPStore)
+}
+
+// TestTOTPStore_Postgres tests that the Postgres TOTP store behaves like the in-memory one
+func TestTOTPStore_Postgres(t *testing.T) {
+	testTOTPStore(t, setupPostgresTOTPStore)
+}
+
+// testTOTPStore tests the behavior all TOTP stores share
+func testTOTPStore(t *testing.T, setup totpStoreSetup) {
+	is := is.New(t)
+
+	t.Run("confirms a pending credential once", func(t *testing.T) {
+		store, users := setup(t)
+		userID := users(t)
+
+		_, err := store.GetCredentialByUserID(userID.String())
+		is.Equal(err, apperrors.ErrMFANotEnrolled)
+
+		for _, secret := range []string{"first", "second"} {
+			cred, err := models.NewTOTPCredential(userID, secret)
+			is.NoErr(err)
+			is.NoErr(store.SavePendingCredential(cred))
+		}
+		cred, err := store.GetCredentialByUserID(userID.String())
+		is.NoErr(err)
+		is.Equal(cred.EncryptedSecret, "second")
+		is.True(!cred.IsConfirmed())
+
+		is.NoErr(store.ConfirmCredential(userID.String(), 10, time.Now()))
+		is.Equal(store.ConfirmCredential(userID.String(), 11, time.Now()), apperrors.ErrInvalidMFACode)
+
+		replacement, err := models.NewTOTPCredential(userID, "third")
+		is.NoErr(err)
+		is.Equal(store.SavePendingCredential(replacement), apperrors.ErrMFAAlreadyEnabled)
+	})
+
+	t.Run("accepts each time step once", func(t *testing.T) {
+		store, users := setup(t)
+		userID := users(t)
+		cred, err := models.NewTOTPCredential(userID, "secret")
+		is.NoErr(err)
+		is.NoErr(store.SavePendingCredential(cred))
+
+		// Only confirmed credentials can be used
+		is.Equal(store.UseStep(userID.String(), 10), apperrors.ErrInvalidMFACode)
+		is.NoErr(store.ConfirmCredential(userID.String(), 10, time.Now()))
+
+		is.Equal(store.UseStep(userID.String(), 10), apperrors.ErrInvalidMFACode)
+		is.NoErr(store.UseStep(userID.String(), 11))
+		is.Equal(store.UseStep(userID.String(), 11), apperrors.ErrInvalidMFACode)
+	})
+
+	t.Run("deletes credentials", func(t *testing.T) {
+		store, users := setup(t)
+		userID := users(t)
+		is.Equal(store.DeleteCredential(userID.String()), apperrors.ErrMFANotEnrolled)
+
+		cred, err := models.NewTOTPCredential(userID, "secret")
+		is.NoErr(err)
+		is.NoErr(store.SavePendingCredential(cred))
+		is.NoErr(store.DeleteCredential(userID.String()))
+		_, err = store.GetCredentialByUserID(userID.String())
+		is.Equal(err, apperrors.ErrMFANotEnrolled)
+	})
+}
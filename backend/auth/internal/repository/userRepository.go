@@ -1,15 +1,16 @@
 package repository
 
 import (
+	"database/sql"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"godiscauth/internal/models"
 	"godiscauth/pkg/apperrors"
-	"godiscauth/pkg/config"
 )
 
 // UserRepository represents the entry point into the database for managing the `users` table
@@ -38,8 +39,9 @@ func (ur *UserRepository) RegisterUser(u *models.User) error {
 		return apperrors.ErrPasswordIsEmpty
 	}
 
+	// Emails and IDs are unique, and a taken ID is as good as a taken email to the caller
 	err := ur.DB.Create(u).Error
-	if err != nil && strings.Contains(err.Error(), `duplicate key value violates unique constraint "users_pkey"`) {
+	if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
 		return apperrors.ErrDuplicateEmail
 	}
 	return err
@@ -113,46 +115,141 @@ func (r *UserRepository) UpdateUser(userID string, request map[string]any) error
 	return nil
 }
 
-// IncrementFailedLogins increments failed login attempts and locks account every
-// `config.MaxLoginAttempts` failed attempts.
-func (r *UserRepository) IncrementFailedLogins(userID string) error {
+// activeLockCondition matches users that are currently serving an account lock after failed logins
+// or by an operator. A lock without an until time is treated as indefinite. It takes the current
+// time as its named argument `now`.
+const activeLockCondition = "(COALESCE(account_locked, false) AND (account_locked_until IS NULL OR account_locked_until > @now))" +
+	" OR (admin_locked AND (admin_locked_until IS NULL OR admin_locked_until > @now))"
+
+// IncrementFailedLogins atomically increments failed login attempts for a user who is not currently
+// locked out and returns the new number of failed attempts. Returns `apperrors.ErrAccountIsLocked`
+// if the account is serving an active lock, in which case the attempt is not counted.
+func (r *UserRepository) IncrementFailedLogins(userID string) (int, error) {
+	// Validate user ID
+	if userID == "" {
+		return 0, apperrors.ErrUserIdEmpty
+	}
+
+	// Increment in a single statement so concurrent failures can't read the same stale count
+	var user models.User
+	result := r.DB.Model(&user).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "failed_login_attempts"}}}).
+		Where("id = ?", userID).
+		Where("NOT ("+activeLockCondition+")", sql.Named("now", time.Now().UTC())).
+		UpdateColumn("failed_login_attempts", gorm.Expr("COALESCE(failed_login_attempts, 0) + 1"))
+
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, r.lockedOrNotFound(userID)
+	}
+
+	return user.FailedLoginAttempts, nil
+}
+
+// LockAccount locks a user account until the given time, clears the failed login counter so the
+// next window starts fresh, and records the lockout for progressive backoff. Locking an account
+// that is already serving an active lock is a no-op, so concurrent failures lock it only once.
+func (r *UserRepository) LockAccount(userID string, until time.Time) error {
 	// Validate user ID
 	if userID == "" {
 		return apperrors.ErrUserIdEmpty
 	}
 
-	// Lookup user
-	user, err := r.GetUserByID(userID)
-	if err != nil {
-		return apperrors.ErrUserNotFound
+	result := r.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Where("NOT ("+activeLockCondition+")", sql.Named("now", time.Now().UTC())).
+		UpdateColumns(map[string]any{
+			"account_locked":        true,
+			"account_locked_until":  until.UTC(),
+			"failed_login_attempts": 0,
+			"lockout_count":         gorm.Expr("COALESCE(lockout_count, 0) + 1"),
+		})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := r.lockedOrNotFound(userID); err != apperrors.ErrAccountIsLocked {
+			return err
+		}
 	}
 
-	// Increment login attempts
-	result := r.DB.Model(&models.User{}).Where("id = ?", user.ID).
-		Updates(map[string]any{"failed_login_attempts": user.FailedLoginAttempts + 1})
+	return nil
+}
+
+// RecordSuccessfulLogin sets the last login time and resets the lockout counters for a user,
+// provided the account is not serving an active lock. Returns `apperrors.ErrAccountIsLocked` if the
+// account was locked, e.g. by a concurrent failed login, so that no session is issued.
+func (r *UserRepository) RecordSuccessfulLogin(userID string, at time.Time) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+
+	result := r.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Where("NOT ("+activeLockCondition+")", sql.Named("now", time.Now().UTC())).
+		UpdateColumns(map[string]any{
+			"last_login":            at.UTC(),
+			"failed_login_attempts": 0,
+			"lockout_count":         0,
+			"account_locked":        false,
+			"account_locked_until":  nil,
+		})
 
 	if result.Error != nil {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		// Unsure under what circumstances this could happen, but handle the case anyway
-		return apperrors.ErrCouldNotIncrementFailedLogins
+		return r.lockedOrNotFound(userID)
 	}
 
 	return nil
 }
 
-// LockAccount locks a user account until the time spec'd in `config`
-func (r *UserRepository) LockAccount(userID string) error {
-	// Validate user ID
+// UnlockAccount unconditionally lifts any lock on a user account, including one set by an
+// operator, and resets the lockout counters
+func (r *UserRepository) UnlockAccount(userID string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+
+	result := r.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		UpdateColumns(map[string]any{
+			"failed_login_attempts": 0,
+			"lockout_count":         0,
+			"account_locked":        false,
+			"account_locked_until":  nil,
+			"admin_locked":          false,
+			"admin_locked_until":    nil,
+		})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// ClearLockout lifts a lock after failed logins and resets the lockout counters, leaving a lock set
+// by an operator in place
+func (r *UserRepository) ClearLockout(userID string) error {
 	if userID == "" {
 		return apperrors.ErrUserIdEmpty
 	}
 
-	result := r.DB.Model(&models.User{}).Where("id = ?", userID).
-		Updates(map[string]any{
-			"account_locked":       true,
-			"account_locked_until": time.Now().Add(config.AccountLockoutLength * time.Minute),
+	result := r.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		UpdateColumns(map[string]any{
+			"failed_login_attempts": 0,
+			"lockout_count":         0,
+			"account_locked":        false,
+			"account_locked_until":  nil,
 		})
 
 	if result.Error != nil {
@@ -164,3 +261,65 @@ func (r *UserRepository) LockAccount(userID string) error {
 
 	return nil
 }
+
+// ClaimVerificationSend records that a verification email is being sent to an unverified user,
+// unless one was already sent after `throttleBefore`. Claiming the send in a single statement keeps
+// concurrent resend requests from both sending mail.
+func (r *UserRepository) ClaimVerificationSend(userID string, throttleBefore time.Time) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+
+	result := r.DB.Model(&models.User{}).
+		Where("id = ? AND email_verified_at IS NULL", userID).
+		Where("verification_sent_at IS NULL OR verification_sent_at <= ?", throttleBefore.UTC()).
+		UpdateColumn("verification_sent_at", time.Now().UTC())
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		user, err := r.GetUserByID(userID)
+		if err != nil {
+			return apperrors.ErrUserNotFound
+		}
+		if user.IsEmailVerified() {
+			return apperrors.ErrEmailAlreadyVerified
+		}
+		return apperrors.ErrVerificationThrottled
+	}
+
+	return nil
+}
+
+// MarkEmailVerified records that a user verified their email, provided the user still has that
+// email. Verifying an already verified email keeps the original verification time.
+func (r *UserRepository) MarkEmailVerified(userID string, email string, at time.Time) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	if email == "" {
+		return apperrors.ErrEmailIsEmpty
+	}
+
+	result := r.DB.Model(&models.User{}).
+		Where("id = ? AND email = ?", userID, email).
+		UpdateColumn("email_verified_at", gorm.Expr("COALESCE(email_verified_at, ?)", at.UTC()))
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// lockedOrNotFound explains why a conditional update on an unlocked user matched no rows
+func (r *UserRepository) lockedOrNotFound(userID string) error {
+	if _, err := r.GetUserByID(userID); err != nil {
+		return apperrors.ErrUserNotFound
+	}
+	return apperrors.ErrAccountIsLocked
+}
@@ -20,7 +20,7 @@ import (
 func TestUserRepository_NewUserRepository(t *testing.T) {
 	is := is.New(t)
 
-	testDB := testutils.TestDBSetup()
+	testDB := testutils.TestDBSetup(t)
 
 	t.Run("creates new user repo", func(t *testing.T) {
 		ur, err := repository.NewUserRepository(testDB)
@@ -314,7 +314,7 @@ func TestUserRepository_IncrementFailedLogins(t *testing.T) {
 		ur, err := setupUserRepository(t)
 		is.NoErr(err)
 
-		err = ur.IncrementFailedLogins("")
+		_, err = ur.IncrementFailedLogins("")
 		is.Equal(err, apperrors.ErrUserIdEmpty)
 	})
 
@@ -323,7 +323,7 @@ func TestUserRepository_IncrementFailedLogins(t *testing.T) {
 		ur, err := setupUserRepository(t)
 		is.NoErr(err)
 
-		err = ur.IncrementFailedLogins(uuid.New().String())
+		_, err = ur.IncrementFailedLogins(uuid.New().String())
 		is.Equal(err, apperrors.ErrUserNotFound)
 	})
 
@@ -343,19 +343,69 @@ func TestUserRepository_IncrementFailedLogins(t *testing.T) {
 
 		// Increment login attempts
 		for i := range 10 {
-			err = ur.IncrementFailedLogins(user.ID.String())
+			attempts, err := ur.IncrementFailedLogins(user.ID.String())
 			is.NoErr(err)
+			is.Equal(attempts, i+1)
 
 			user, err = ur.GetUserByEmail(user.Email)
 			is.NoErr(err)
 			is.Equal(user.FailedLoginAttempts, i+1)
 		}
 	})
+
+	// Does not count attempts against a locked account
+	t.Run("fails on locked account", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		user := &models.User{
+			Email:    "testIncrementFailedLoginsLocked@test.com",
+			Password: testutils.TestingPassword,
+		}
+		err = ur.RegisterUser(user)
+		is.NoErr(err)
+		err = ur.LockAccount(user.ID.String(), time.Now().Add(time.Hour))
+		is.NoErr(err)
+
+		_, err = ur.IncrementFailedLogins(user.ID.String())
+		is.Equal(err, apperrors.ErrAccountIsLocked)
+
+		user, err = ur.GetUserByID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(user.FailedLoginAttempts, 0)
+	})
+
+	// Counts attempts again once the lock has expired
+	t.Run("counts attempts after lock expires", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		user := &models.User{
+			Email:    "testIncrementFailedLoginsExpired@test.com",
+			Password: testutils.TestingPassword,
+		}
+		err = ur.RegisterUser(user)
+		is.NoErr(err)
+		err = ur.LockAccount(user.ID.String(), time.Now().Add(-time.Minute))
+		is.NoErr(err)
+
+		attempts, err := ur.IncrementFailedLogins(user.ID.String())
+		is.NoErr(err)
+		is.Equal(attempts, 1)
+	})
 }
 
 func TestUserRepository_LockAccount(t *testing.T) {
 	is := is.New(t)
 
+	t.Run("empty user ID", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		err = ur.LockAccount("", time.Now().Add(time.Hour))
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
 	t.Run("locks on existing user", func(t *testing.T) {
 		ur, err := setupUserRepository(t)
 		is.NoErr(err)
@@ -363,34 +413,270 @@ func TestUserRepository_LockAccount(t *testing.T) {
 		// Register test user
 		email := "testLockAccount@test.com"
 		user := &models.User{
-			Email:    email,
-			Password: testutils.TestingPassword,
+			Email:               email,
+			Password:            testutils.TestingPassword,
+			FailedLoginAttempts: config.Default().Lockout.MaxAttempts,
 		}
 		err = ur.RegisterUser(user)
 		is.NoErr(err)
 
 		// Lock account
-		err = ur.LockAccount(user.ID.String())
+		lockedUntil := time.Now().Add(config.Default().Lockout.Length)
+		err = ur.LockAccount(user.ID.String(), lockedUntil)
+		is.NoErr(err)
 		user, err = ur.GetUserByEmail(user.Email)
 		is.NoErr(err)
 
 		is.True(user.AccountLocked)
-		// HACK: assumes test won't be blocked for 2 seconds, unlock time is > 2 seconds from now
-		approxLockMax := time.Now().Add(config.AccountLockoutLength*time.Second - 2)
-		is.True(user.AccountLockedUntil.After(approxLockMax))
+		is.True(user.IsLocked(time.Now()))
+		is.True(!user.IsLocked(lockedUntil.Add(time.Second)))
+		// Starts a fresh window of attempts and records the lockout
+		is.Equal(user.FailedLoginAttempts, 0)
+		is.Equal(user.LockoutCount, 1)
+	})
+
+	t.Run("does not relock an actively locked account", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		user := &models.User{
+			Email:    "testLockAccountTwice@test.com",
+			Password: testutils.TestingPassword,
+		}
+		err = ur.RegisterUser(user)
+		is.NoErr(err)
+
+		firstUntil := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		err = ur.LockAccount(user.ID.String(), firstUntil)
+		is.NoErr(err)
+		err = ur.LockAccount(user.ID.String(), firstUntil.Add(time.Hour))
+		is.NoErr(err)
+
+		user, err = ur.GetUserByID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(user.LockoutCount, 1)
+		is.True(user.AccountLockedUntil.Equal(firstUntil))
+	})
+
+	t.Run("fails on non-existent user", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		err = ur.LockAccount(uuid.New().String(), time.Now().Add(time.Hour))
+		is.Equal(err, apperrors.ErrUserNotFound)
+	})
+}
+
+func TestUserRepository_RecordSuccessfulLogin(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("empty user ID", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		err = ur.RecordSuccessfulLogin("", time.Now())
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("fails on non-existent user", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		err = ur.RecordSuccessfulLogin(uuid.New().String(), time.Now())
+		is.Equal(err, apperrors.ErrUserNotFound)
+	})
+
+	t.Run("resets counters and expired lock", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		expired := time.Now().Add(-time.Minute)
+		user := &models.User{
+			Email:               "testRecordSuccessfulLogin@test.com",
+			Password:            testutils.TestingPassword,
+			FailedLoginAttempts: 3,
+			AccountLocked:       true,
+			AccountLockedUntil:  &expired,
+			LockoutCount:        2,
+		}
+		err = ur.RegisterUser(user)
+		is.NoErr(err)
+
+		loginTime := time.Now().UTC().Truncate(time.Second)
+		err = ur.RecordSuccessfulLogin(user.ID.String(), loginTime)
+		is.NoErr(err)
+
+		user, err = ur.GetUserByID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(user.LastLogin, &loginTime)
+		is.Equal(user.FailedLoginAttempts, 0)
+		is.Equal(user.LockoutCount, 0)
+		is.True(!user.AccountLocked)
+		is.Equal(user.AccountLockedUntil, nil)
+	})
+
+	t.Run("fails on locked account", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		user := &models.User{
+			Email:    "testRecordSuccessfulLoginLocked@test.com",
+			Password: testutils.TestingPassword,
+		}
+		err = ur.RegisterUser(user)
+		is.NoErr(err)
+		err = ur.LockAccount(user.ID.String(), time.Now().Add(time.Hour))
+		is.NoErr(err)
+
+		err = ur.RecordSuccessfulLogin(user.ID.String(), time.Now())
+		is.Equal(err, apperrors.ErrAccountIsLocked)
 	})
+}
+
+func TestUserRepository_UnlockAccount(t *testing.T) {
+	is := is.New(t)
 
 	t.Run("fails on non-existent user", func(t *testing.T) {
 		ur, err := setupUserRepository(t)
 		is.NoErr(err)
 
-		err = ur.LockAccount(uuid.New().String())
+		err = ur.UnlockAccount(uuid.New().String())
 		is.Equal(err, apperrors.ErrUserNotFound)
 	})
+
+	t.Run("unlocks locked account", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		user := &models.User{
+			Email:    "testUnlockAccount@test.com",
+			Password: testutils.TestingPassword,
+		}
+		err = ur.RegisterUser(user)
+		is.NoErr(err)
+		err = ur.LockAccount(user.ID.String(), time.Now().Add(time.Hour))
+		is.NoErr(err)
+
+		err = ur.UnlockAccount(user.ID.String())
+		is.NoErr(err)
+
+		user, err = ur.GetUserByID(user.ID.String())
+		is.NoErr(err)
+		is.True(!user.IsLocked(time.Now()))
+		is.Equal(user.LockoutCount, 0)
+	})
+}
+
+func TestUserRepository_ClaimVerificationSend(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("empty user ID", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		err = ur.ClaimVerificationSend("", time.Now())
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("fails on non-existent user", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		err = ur.ClaimVerificationSend(uuid.New().String(), time.Now())
+		is.Equal(err, apperrors.ErrUserNotFound)
+	})
+
+	t.Run("throttles repeated sends", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		user := &models.User{
+			Email:    "testClaimVerificationSend@test.com",
+			Password: testutils.TestingPassword,
+		}
+		err = ur.RegisterUser(user)
+		is.NoErr(err)
+
+		err = ur.ClaimVerificationSend(user.ID.String(), time.Now().Add(-time.Minute))
+		is.NoErr(err)
+		err = ur.ClaimVerificationSend(user.ID.String(), time.Now().Add(-time.Minute))
+		is.Equal(err, apperrors.ErrVerificationThrottled)
+
+		// Allowed once the previous send is older than the throttle window
+		err = ur.ClaimVerificationSend(user.ID.String(), time.Now().Add(time.Minute))
+		is.NoErr(err)
+	})
+
+	t.Run("fails on verified email", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		verifiedAt := time.Now()
+		user := &models.User{
+			Email:           "testClaimVerificationSendVerified@test.com",
+			Password:        testutils.TestingPassword,
+			EmailVerifiedAt: &verifiedAt,
+		}
+		err = ur.RegisterUser(user)
+		is.NoErr(err)
+
+		err = ur.ClaimVerificationSend(user.ID.String(), time.Now())
+		is.Equal(err, apperrors.ErrEmailAlreadyVerified)
+	})
+}
+
+func TestUserRepository_MarkEmailVerified(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("empty user ID", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		err = ur.MarkEmailVerified("", "a@test.com", time.Now())
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("fails on mismatched email", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		user := &models.User{
+			Email:    "testMarkEmailVerifiedMismatch@test.com",
+			Password: testutils.TestingPassword,
+		}
+		err = ur.RegisterUser(user)
+		is.NoErr(err)
+
+		err = ur.MarkEmailVerified(user.ID.String(), "someoneElse@test.com", time.Now())
+		is.Equal(err, apperrors.ErrUserNotFound)
+	})
+
+	t.Run("marks email verified once", func(t *testing.T) {
+		ur, err := setupUserRepository(t)
+		is.NoErr(err)
+
+		user := &models.User{
+			Email:    "testMarkEmailVerified@test.com",
+			Password: testutils.TestingPassword,
+		}
+		err = ur.RegisterUser(user)
+		is.NoErr(err)
+
+		verifiedAt := time.Now().UTC().Truncate(time.Second)
+		err = ur.MarkEmailVerified(user.ID.String(), user.Email, verifiedAt)
+		is.NoErr(err)
+		err = ur.MarkEmailVerified(user.ID.String(), user.Email, verifiedAt.Add(time.Hour))
+		is.NoErr(err)
+
+		user, err = ur.GetUserByID(user.ID.String())
+		is.NoErr(err)
+		is.True(user.IsEmailVerified())
+		is.Equal(user.EmailVerifiedAt, &verifiedAt)
+	})
 }
 
 func setupUserRepository(t *testing.T) (*repository.UserRepository, error) {
-	testDB := testutils.TestDBSetup()
+	testDB := testutils.TestDBSetup(t)
 	ur, err := repository.NewUserRepository(testDB)
 	tx := testDB.Begin()
 	t.Cleanup(func() { tx.Rollback() })
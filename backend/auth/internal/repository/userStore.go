@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"time"
+
+	"godiscauth/internal/models"
+)
+
+// UserStore stores users. `UserRepository` keeps them in Postgres and `MemoryUserStore` in the
+// process. Lookups of a user that doesn't exist fail with `gorm.ErrRecordNotFound`, updates with
+// `apperrors.ErrUserNotFound`, in every implementation.
+type UserStore interface {
+	// RegisterUser stores a new user, failing with `apperrors.ErrDuplicateEmail` if the email is
+	// taken
+	RegisterUser(u *models.User) error
+	// GetUserByEmail returns a user by email
+	GetUserByEmail(email string) (*models.User, error)
+	// GetUserByID returns a user by ID
+	GetUserByID(userID string) (*models.User, error)
+	// PermanentlyDeleteUser deletes a user and returns how many users were deleted
+	PermanentlyDeleteUser(userID string) (int64, error)
+	// UpdateUser sets a user's columns, keyed by column name
+	UpdateUser(userID string, request map[string]any) error
+	// IncrementFailedLogins counts a failed login of a user who is not locked out and returns the
+	// new count, or fails with `apperrors.ErrAccountIsLocked`
+	IncrementFailedLogins(userID string) (int, error)
+	// LockAccount locks a user who is not locked out until the given time, clearing their failed
+	// logins and counting the lockout
+	LockAccount(userID string, until time.Time) error
+	// RecordSuccessfulLogin sets a user's last login time and resets their lockout counters, or fails
+	// with `apperrors.ErrAccountIsLocked`
+	RecordSuccessfulLogin(userID string, at time.Time) error
+	// UnlockAccount lifts any lock on a user, including one set by an operator, and resets their
+	// lockout counters
+	UnlockAccount(userID string) error
+	// ClearLockout lifts a lock after failed logins and resets the lockout counters, leaving a lock
+	// set by an operator in place
+	ClearLockout(userID string) error
+	// ClaimVerificationSend records that a verification email is being sent to an unverified user,
+	// unless one was sent after throttleBefore
+	ClaimVerificationSend(userID string, throttleBefore time.Time) error
+	// MarkEmailVerified records that a user verified their email, provided they still have it
+	MarkEmailVerified(userID string, email string, at time.Time) error
+}
+
+var (
+	_ UserStore = (*UserRepository)(nil)
+	_ UserStore = (*MemoryUserStore)(nil)
+)
@@ -0,0 +1,305 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// userStoreSetup returns an empty user store
+type userStoreSetup func(t *testing.T) repository.UserStore
+
+func setupMemoryUserStore(t *testing.T) repository.UserStore {
+	return repository.NewMemoryUserStore()
+}
+
+func setupPostgresUserStore(t *testing.T) repository.UserStore {
+	t.Helper()
+
+	tx := testutils.TestDBSetup(t).Begin()
+	t.Cleanup(func() { tx.Rollback() })
+	ur, err := repository.NewUserRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create user repository: %v", err)
+	}
+	return ur
+}
+
+// registerStoreUser registers a new user with a unique email
+func registerStoreUser(t *testing.T, store repository.UserStore) *models.User {
+	t.Helper()
+
+	user := &models.User{Email: uuid.NewString() + "@test.com", Password: testutils.TestingPassword}
+	if err := store.RegisterUser(user); err != nil {
+		t.Fatalf("failed to register test user: %v", err)
+	}
+	return user
+}
+
+// getStoreUser returns a registered user by ID
+func getStoreUser(t *testing.T, store repository.UserStore, userID uuid.UUID) *models.User {
+	t.Helper()
+
+	user, err := store.GetUserByID(userID.String())
+	if err != nil {
+		t.Fatalf("failed to get test user: %v", err)
+	}
+	return user
+}
+
+// TestUserStore_Memory tests the in-memory user store
+func TestUserStore_Memory(t *testing.T) {
+	testUserStore(t, setupMemoryUserStore)
+}
+
+// TestUserStore_Postgres tests that the Postgres user store behaves like the in-memory one
+func TestUserStore_Postgres(t *testing.T) {
+	testUserStore(t, setupPostgresUserStore)
+}
+
+// testUserStore tests the behavior all user stores share
+func testUserStore(t *testing.T, setup userStoreSetup) {
+	is := is.New(t)
+
+	t.Run("registers and gets users", func(t *testing.T) {
+		store := setup(t)
+		user := registerStoreUser(t, store)
+		is.True(user.ID != uuid.Nil)
+
+		byEmail, err := store.GetUserByEmail(user.Email)
+		is.NoErr(err)
+		is.Equal(byEmail.ID, user.ID)
+		is.Equal(byEmail.Password, testutils.TestingPassword)
+		is.Equal(byEmail.Roles, models.RoleUser)
+		is.Equal(byEmail.FailedLoginAttempts, 0)
+		is.True(!byEmail.AccountLocked)
+		is.Equal(byEmail.LastLogin, nil)
+		is.Equal(byEmail.EmailVerifiedAt, nil)
+
+		byID, err := store.GetUserByID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(byID.Email, user.Email)
+
+		_, err = store.GetUserByEmail("unknown@test.com")
+		is.Equal(err, gorm.ErrRecordNotFound)
+		_, err = store.GetUserByID(uuid.NewString())
+		is.Equal(err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("validates users", func(t *testing.T) {
+		store := setup(t)
+		is.Equal(store.RegisterUser(nil), apperrors.ErrUserIsNil)
+		is.Equal(store.RegisterUser(&models.User{Password: "password"}), apperrors.ErrEmailIsEmpty)
+		is.Equal(store.RegisterUser(&models.User{Email: "test@test.com"}), apperrors.ErrPasswordIsEmpty)
+		_, err := store.GetUserByEmail("")
+		is.Equal(err, apperrors.ErrEmailIsEmpty)
+		_, err = store.GetUserByID("")
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("rejects duplicate emails", func(t *testing.T) {
+		store := setup(t)
+		user := registerStoreUser(t, store)
+
+		err := store.RegisterUser(&models.User{Email: user.Email, Password: "other"})
+		is.Equal(err, apperrors.ErrDuplicateEmail)
+	})
+
+	t.Run("returns copies", func(t *testing.T) {
+		store := setup(t)
+		user := registerStoreUser(t, store)
+
+		got := getStoreUser(t, store, user.ID)
+		got.Email = "changed@test.com"
+		got.FailedLoginAttempts = 3
+		got = getStoreUser(t, store, user.ID)
+		is.Equal(got.Email, user.Email)
+		is.Equal(got.FailedLoginAttempts, 0)
+	})
+
+	t.Run("updates users", func(t *testing.T) {
+		store := setup(t)
+		user := registerStoreUser(t, store)
+
+		at := time.Now().UTC().Truncate(time.Second)
+		err := store.UpdateUser(user.ID.String(), map[string]any{
+			"email":                "updated-" + user.Email,
+			"password":             "newpassword",
+			"last_login":           at,
+			"roles":                models.RoleUser + "," + models.RoleAdmin,
+			"account_locked":       true,
+			"account_locked_until": at,
+		})
+		is.NoErr(err)
+
+		got := getStoreUser(t, store, user.ID)
+		is.Equal(got.Email, "updated-"+user.Email)
+		is.Equal(got.Password, "newpassword")
+		is.True(got.LastLogin.Equal(at))
+		is.Equal(got.RoleList(), []string{models.RoleUser, models.RoleAdmin})
+		is.True(got.AccountLocked)
+		is.True(got.AccountLockedUntil.Equal(at))
+
+		// The old email is free again
+		_, err = store.GetUserByEmail(user.Email)
+		is.Equal(err, gorm.ErrRecordNotFound)
+		is.NoErr(store.RegisterUser(&models.User{Email: user.Email, Password: "password"}))
+
+		err = store.UpdateUser(uuid.NewString(), map[string]any{"password": "password"})
+		is.Equal(err, apperrors.ErrUserNotFound)
+		err = store.UpdateUser("", map[string]any{"password": "password"})
+		is.Equal(err, apperrors.ErrUserIdEmpty)
+	})
+
+	t.Run("locks accounts after failed logins", func(t *testing.T) {
+		store := setup(t)
+		user := registerStoreUser(t, store)
+		userID := user.ID.String()
+
+		for want := 1; want <= 3; want++ {
+			attempts, err := store.IncrementFailedLogins(userID)
+			is.NoErr(err)
+			is.Equal(attempts, want)
+		}
+
+		until := time.Now().Add(time.Hour)
+		is.NoErr(store.LockAccount(userID, until))
+		got := getStoreUser(t, store, user.ID)
+		is.True(got.IsLocked(time.Now()))
+		is.Equal(got.FailedLoginAttempts, 0)
+		is.Equal(got.LockoutCount, 1)
+
+		// A locked account doesn't count failures, log in or get locked again
+		_, err := store.IncrementFailedLogins(userID)
+		is.Equal(err, apperrors.ErrAccountIsLocked)
+		is.Equal(store.RecordSuccessfulLogin(userID, time.Now()), apperrors.ErrAccountIsLocked)
+		is.NoErr(store.LockAccount(userID, until.Add(time.Hour)))
+		got = getStoreUser(t, store, user.ID)
+		is.Equal(got.LockoutCount, 1)
+		is.True(got.AccountLockedUntil.Sub(until).Abs() < time.Second)
+	})
+
+	t.Run("lifts expired locks on login", func(t *testing.T) {
+		store := setup(t)
+		user := registerStoreUser(t, store)
+		userID := user.ID.String()
+
+		is.NoErr(store.LockAccount(userID, time.Now().Add(-time.Minute)))
+		attempts, err := store.IncrementFailedLogins(userID)
+		is.NoErr(err)
+		is.Equal(attempts, 1)
+
+		at := time.Now().UTC().Truncate(time.Second)
+		is.NoErr(store.RecordSuccessfulLogin(userID, at))
+		got := getStoreUser(t, store, user.ID)
+		is.True(got.LastLogin.Equal(at))
+		is.True(!got.AccountLocked)
+		is.Equal(got.AccountLockedUntil, nil)
+		is.Equal(got.FailedLoginAttempts, 0)
+		is.Equal(got.LockoutCount, 0)
+	})
+
+	t.Run("unlocks accounts", func(t *testing.T) {
+		store := setup(t)
+		user := registerStoreUser(t, store)
+		userID := user.ID.String()
+
+		is.NoErr(store.LockAccount(userID, time.Now().Add(time.Hour)))
+		is.NoErr(store.UnlockAccount(userID))
+		got := getStoreUser(t, store, user.ID)
+		is.True(!got.IsLocked(time.Now()))
+		is.Equal(got.LockoutCount, 0)
+		is.NoErr(store.RecordSuccessfulLogin(userID, time.Now()))
+	})
+
+	t.Run("clearing a lockout keeps an operator's lock", func(t *testing.T) {
+		store := setup(t)
+		user := registerStoreUser(t, store)
+		userID := user.ID.String()
+
+		is.NoErr(store.LockAccount(userID, time.Now().Add(time.Hour)))
+		is.NoErr(store.UpdateUser(userID, map[string]any{"admin_locked": true, "admin_locked_until": nil}))
+		is.NoErr(store.ClearLockout(userID))
+		got := getStoreUser(t, store, user.ID)
+		is.True(!got.AccountLocked)
+		is.Equal(got.LockoutCount, 0)
+		is.True(got.IsLocked(time.Now().Add(365 * 24 * time.Hour)))
+		is.Equal(store.RecordSuccessfulLogin(userID, time.Now()), apperrors.ErrAccountIsLocked)
+
+		is.NoErr(store.UnlockAccount(userID))
+		got = getStoreUser(t, store, user.ID)
+		is.True(!got.AdminLocked)
+		is.True(!got.IsLocked(time.Now()))
+		is.NoErr(store.RecordSuccessfulLogin(userID, time.Now()))
+	})
+
+	t.Run("fails lockout changes of unknown users", func(t *testing.T) {
+		store := setup(t)
+		userID := uuid.NewString()
+
+		_, err := store.IncrementFailedLogins(userID)
+		is.Equal(err, apperrors.ErrUserNotFound)
+		is.Equal(store.LockAccount(userID, time.Now().Add(time.Hour)), apperrors.ErrUserNotFound)
+		is.Equal(store.RecordSuccessfulLogin(userID, time.Now()), apperrors.ErrUserNotFound)
+		is.Equal(store.UnlockAccount(userID), apperrors.ErrUserNotFound)
+		is.Equal(store.ClearLockout(userID), apperrors.ErrUserNotFound)
+	})
+
+	t.Run("throttles verification emails", func(t *testing.T) {
+		store := setup(t)
+		user := registerStoreUser(t, store)
+		userID := user.ID.String()
+
+		is.NoErr(store.ClaimVerificationSend(userID, time.Now().Add(-time.Minute)))
+		is.True(getStoreUser(t, store, user.ID).VerificationSentAt != nil)
+		err := store.ClaimVerificationSend(userID, time.Now().Add(-time.Minute))
+		is.Equal(err, apperrors.ErrVerificationThrottled)
+		is.NoErr(store.ClaimVerificationSend(userID, time.Now().Add(time.Minute)))
+
+		is.Equal(store.ClaimVerificationSend(uuid.NewString(), time.Now()), apperrors.ErrUserNotFound)
+	})
+
+	t.Run("verifies emails", func(t *testing.T) {
+		store := setup(t)
+		user := registerStoreUser(t, store)
+		userID := user.ID.String()
+
+		// The email has to match, so a link for an old email doesn't verify a new one
+		at := time.Now().UTC().Truncate(time.Second)
+		is.Equal(store.MarkEmailVerified(userID, "other@test.com", at), apperrors.ErrUserNotFound)
+		is.NoErr(store.MarkEmailVerified(userID, user.Email, at))
+		is.NoErr(store.MarkEmailVerified(userID, user.Email, at.Add(time.Hour)))
+		got := getStoreUser(t, store, user.ID)
+		is.True(got.IsEmailVerified())
+		is.True(got.EmailVerifiedAt.Equal(at))
+
+		err := store.ClaimVerificationSend(userID, time.Now())
+		is.Equal(err, apperrors.ErrEmailAlreadyVerified)
+	})
+
+	t.Run("deletes users", func(t *testing.T) {
+		store := setup(t)
+		user := registerStoreUser(t, store)
+
+		deleted, err := store.PermanentlyDeleteUser(user.ID.String())
+		is.NoErr(err)
+		is.Equal(deleted, int64(1))
+		_, err = store.GetUserByID(user.ID.String())
+		is.Equal(err, gorm.ErrRecordNotFound)
+
+		deleted, err = store.PermanentlyDeleteUser(user.ID.String())
+		is.NoErr(err)
+		is.Equal(deleted, int64(0))
+
+		// The email can be used again
+		is.NoErr(store.RegisterUser(&models.User{Email: user.Email, Password: "password"}))
+	})
+}
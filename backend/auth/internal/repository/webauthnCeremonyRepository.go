@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// WebAuthnCeremonyRepository represents the entry point into the database for managing the
+// `webauthn_ceremonies` table
+type WebAuthnCeremonyRepository struct {
+	DB *gorm.DB
+}
+
+// NewWebAuthnCeremonyRepository returns a value for the WebAuthnCeremonyRepository struct
+func NewWebAuthnCeremonyRepository(db *gorm.DB) (*WebAuthnCeremonyRepository, error) {
+	if db == nil {
+		return nil, apperrors.ErrDatabaseIsNil
+	}
+	return &WebAuthnCeremonyRepository{DB: db}, nil
+}
+
+// CreateCeremony inserts a newly started passkey ceremony into the `webauthn_ceremonies` table
+func (wr *WebAuthnCeremonyRepository) CreateCeremony(ceremony *models.WebAuthnCeremony) error {
+	if ceremony == nil || ceremony.TokenHash == "" {
+		return apperrors.ErrWebAuthnCeremonyIsEmpty
+	}
+	return wr.DB.Create(ceremony).Error
+}
+
+// ConsumeCeremony atomically deletes and returns an unexpired ceremony of the given kind. A
+// ceremony can only be finished once, whether or not the passkey's response turns out to be
+// valid. Returns `apperrors.ErrInvalidWebAuthnCeremony` if there is no such ceremony.
+func (wr *WebAuthnCeremonyRepository) ConsumeCeremony(tokenHash string, kind models.WebAuthnCeremonyKind) (*models.WebAuthnCeremony, error) {
+	if tokenHash == "" {
+		return nil, apperrors.ErrWebAuthnCeremonyIsEmpty
+	}
+
+	var ceremonies []models.WebAuthnCeremony
+	result := wr.DB.Clauses(clause.Returning{}).
+		Where("token_hash = ? AND kind = ? AND expires_at > ?", tokenHash, kind, time.Now().UTC()).
+		Delete(&ceremonies)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || len(ceremonies) == 0 {
+		return nil, apperrors.ErrInvalidWebAuthnCeremony
+	}
+	return &ceremonies[0], nil
+}
@@ -0,0 +1,113 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestWebAuthnCeremonyRepository_NewWebAuthnCeremonyRepository tests creation of
+// WebAuthnCeremonyRepository structs in the `repository` package
+func TestWebAuthnCeremonyRepository_NewWebAuthnCeremonyRepository(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("returns err with nil db", func(t *testing.T) {
+		cr, err := repository.NewWebAuthnCeremonyRepository(nil)
+		is.Equal(cr, nil)
+		is.Equal(err, apperrors.ErrDatabaseIsNil)
+	})
+
+	t.Run("creates new WebAuthn ceremony repo", func(t *testing.T) {
+		cr := setupWebAuthnCeremonyRepository(t)
+		is.True(cr != nil)
+	})
+}
+
+func TestWebAuthnCeremonyRepository_ConsumeCeremony(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("ceremony can only be consumed once", func(t *testing.T) {
+		cr := setupWebAuthnCeremonyRepository(t)
+		user := createTestUser(t, cr.DB, "testConsumeCeremony@test.com")
+
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		ceremony, err := models.NewWebAuthnCeremony(&user.ID, tokenHash, models.WebAuthnCeremonyRegistration, `{"challenge":"abc"}`, time.Now().Add(time.Minute))
+		is.NoErr(err)
+		is.NoErr(cr.CreateCeremony(ceremony))
+
+		consumed, err := cr.ConsumeCeremony(tokenHash, models.WebAuthnCeremonyRegistration)
+		is.NoErr(err)
+		is.Equal(*consumed.UserID, user.ID)
+		is.Equal(consumed.SessionData, `{"challenge":"abc"}`)
+
+		_, err = cr.ConsumeCeremony(tokenHash, models.WebAuthnCeremonyRegistration)
+		is.Equal(err, apperrors.ErrInvalidWebAuthnCeremony)
+	})
+
+	t.Run("ceremony without a user", func(t *testing.T) {
+		cr := setupWebAuthnCeremonyRepository(t)
+
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		ceremony, err := models.NewWebAuthnCeremony(nil, tokenHash, models.WebAuthnCeremonyLogin, "{}", time.Now().Add(time.Minute))
+		is.NoErr(err)
+		is.NoErr(cr.CreateCeremony(ceremony))
+
+		consumed, err := cr.ConsumeCeremony(tokenHash, models.WebAuthnCeremonyLogin)
+		is.NoErr(err)
+		is.True(consumed.UserID == nil)
+	})
+
+	t.Run("fails on a different kind of ceremony", func(t *testing.T) {
+		cr := setupWebAuthnCeremonyRepository(t)
+
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		ceremony, err := models.NewWebAuthnCeremony(nil, tokenHash, models.WebAuthnCeremonyLogin, "{}", time.Now().Add(time.Minute))
+		is.NoErr(err)
+		is.NoErr(cr.CreateCeremony(ceremony))
+
+		_, err = cr.ConsumeCeremony(tokenHash, models.WebAuthnCeremonySecondFactor)
+		is.Equal(err, apperrors.ErrInvalidWebAuthnCeremony)
+	})
+
+	t.Run("fails on expired ceremony", func(t *testing.T) {
+		cr := setupWebAuthnCeremonyRepository(t)
+
+		_, tokenHash, err := models.GenerateToken()
+		is.NoErr(err)
+		ceremony, err := models.NewWebAuthnCeremony(nil, tokenHash, models.WebAuthnCeremonyLogin, "{}", time.Now().Add(-time.Minute))
+		is.NoErr(err)
+		is.NoErr(cr.CreateCeremony(ceremony))
+
+		_, err = cr.ConsumeCeremony(tokenHash, models.WebAuthnCeremonyLogin)
+		is.Equal(err, apperrors.ErrInvalidWebAuthnCeremony)
+	})
+
+	t.Run("fails on empty token hash", func(t *testing.T) {
+		cr := setupWebAuthnCeremonyRepository(t)
+		_, err := cr.ConsumeCeremony("", models.WebAuthnCeremonyLogin)
+		is.Equal(err, apperrors.ErrWebAuthnCeremonyIsEmpty)
+	})
+}
+
+func setupWebAuthnCeremonyRepository(t *testing.T) *repository.WebAuthnCeremonyRepository {
+	t.Helper()
+
+	testDB := testutils.TestDBSetup(t)
+	tx := testDB.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+
+	cr, err := repository.NewWebAuthnCeremonyRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create WebAuthn ceremony repository: %v", err)
+	}
+	return cr
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"godiscauth/internal/models"
+)
+
+// WebAuthnCeremonyStore stores the state of started passkey ceremonies until they are finished.
+// `WebAuthnCeremonyRepository` keeps it in Postgres and `MemoryWebAuthnCeremonyStore` in the
+// process.
+type WebAuthnCeremonyStore interface {
+	// CreateCeremony stores a new ceremony
+	CreateCeremony(ceremony *models.WebAuthnCeremony) error
+	// ConsumeCeremony deletes and returns an unexpired ceremony of the given kind, or fails with
+	// `apperrors.ErrInvalidWebAuthnCeremony`
+	ConsumeCeremony(tokenHash string, kind models.WebAuthnCeremonyKind) (*models.WebAuthnCeremony, error)
+}
+
+var (
+	_ WebAuthnCeremonyStore = (*WebAuthnCeremonyRepository)(nil)
+	_ WebAuthnCeremonyStore = (*MemoryWebAuthnCeremonyStore)(nil)
+)
@@ -0,0 +1,76 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+)
+
+// webauthnCeremonyStoreSetup returns an empty passkey ceremony store and a way to create its users
+type webauthnCeremonyStoreSetup func(t *testing.T) (repository.WebAuthnCeremonyStore, storeUsers)
+
+func setupMemoryWebAuthnCeremonyStore(t *testing.T) (repository.WebAuthnCeremonyStore, storeUsers) {
+	return repository.NewMemoryWebAuthnCeremonyStore(), memoryStoreUsers
+}
+
+func setupPostgresWebAuthnCeremonyStore(t *testing.T) (repository.WebAuthnCeremonyStore, storeUsers) {
+	t.Helper()
+
+	tx := beginTestTx(t)
+	cr, err := repository.NewWebAuthnCeremonyRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create WebAuthn ceremony repository: %v", err)
+	}
+	return cr, postgresStoreUsers(tx)
+}
+
+// TestWebAuthnCeremonyStore_Memory tests the in-memory passkey ceremony store
+func TestWebAuthnCeremonyStore_Memory(t *testing.T) {
+	testWebAuthnCeremonyStore(t, setupMemoryWebAuthnCeremonyStore)
+}
+
+// TestWebAuthnCeremonyStore_Postgres tests that the Postgres passkey ceremony store behaves like
+// the in-memory one
+func TestWebAuthnCeremonyStore_Postgres(t *testing.T) {
+	testWebAuthnCeremonyStore(t, setupPostgresWebAuthnCeremonyStore)
+}
+
+// testWebAuthnCeremonyStore tests the behavior all passkey ceremony stores share
+func testWebAuthnCeremonyStore(t *testing.T, setup webauthnCeremonyStoreSetup) {
+	is := is.New(t)
+
+	create := func(t *testing.T, store repository.WebAuthnCeremonyStore, userID *uuid.UUID, kind models.WebAuthnCeremonyKind, expiresIn time.Duration) string {
+		t.Helper()
+		ceremony, err := models.NewWebAuthnCeremony(userID, uuid.NewString(), kind, "{}", time.Now().UTC().Add(expiresIn))
+		is.NoErr(err)
+		is.NoErr(store.CreateCeremony(ceremony))
+		return ceremony.TokenHash
+	}
+
+	t.Run("consumes a ceremony once", func(t *testing.T) {
+		store, users := setup(t)
+		userID := users(t)
+		tokenHash := create(t, store, &userID, models.WebAuthnCeremonyRegistration, time.Minute)
+
+		_, err := store.ConsumeCeremony(tokenHash, models.WebAuthnCeremonyLogin)
+		is.Equal(err, apperrors.ErrInvalidWebAuthnCeremony)
+		ceremony, err := store.ConsumeCeremony(tokenHash, models.WebAuthnCeremonyRegistration)
+		is.NoErr(err)
+		is.Equal(*ceremony.UserID, userID)
+		_, err = store.ConsumeCeremony(tokenHash, models.WebAuthnCeremonyRegistration)
+		is.Equal(err, apperrors.ErrInvalidWebAuthnCeremony)
+	})
+
+	t.Run("expired ceremonies are invalid", func(t *testing.T) {
+		store, _ := setup(t)
+		tokenHash := create(t, store, nil, models.WebAuthnCeremonyLogin, -time.Minute)
+		_, err := store.ConsumeCeremony(tokenHash, models.WebAuthnCeremonyLogin)
+		is.Equal(err, apperrors.ErrInvalidWebAuthnCeremony)
+	})
+}
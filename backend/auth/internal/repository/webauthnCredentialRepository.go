@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"godiscauth/internal/models"
+	"godiscauth/pkg/apperrors"
+)
+
+// WebAuthnCredentialRepository represents the entry point into the database for managing the
+// `webauthn_credentials` table
+type WebAuthnCredentialRepository struct {
+	DB *gorm.DB
+}
+
+// NewWebAuthnCredentialRepository returns a value for the WebAuthnCredentialRepository struct
+func NewWebAuthnCredentialRepository(db *gorm.DB) (*WebAuthnCredentialRepository, error) {
+	if db == nil {
+		return nil, apperrors.ErrDatabaseIsNil
+	}
+	return &WebAuthnCredentialRepository{DB: db}, nil
+}
+
+// CreateCredential inserts a newly registered passkey. Returns
+// `apperrors.ErrPasskeyAlreadyRegistered` if a passkey with the same credential ID exists, for
+// this or any other user.
+func (wr *WebAuthnCredentialRepository) CreateCredential(cred *models.WebAuthnCredential) error {
+	if cred == nil || len(cred.CredentialID) == 0 {
+		return apperrors.ErrPasskeyCredentialIDIsEmpty
+	}
+
+	result := wr.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "credential_id"}},
+		DoNothing: true,
+	}).Create(cred)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.ErrPasskeyAlreadyRegistered
+	}
+	return nil
+}
+
+// GetCredentialsByUserID gets all of a user's passkeys, oldest first
+func (wr *WebAuthnCredentialRepository) GetCredentialsByUserID(userID string) ([]models.WebAuthnCredential, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+
+	var creds []models.WebAuthnCredential
+	err := wr.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&creds).Error
+	return creds, err
+}
+
+// CountCredentialsByUserID returns the number of passkeys a user has registered
+func (wr *WebAuthnCredentialRepository) CountCredentialsByUserID(userID string) (int64, error) {
+	if userID == "" {
+		return 0, apperrors.ErrUserIdEmpty
+	}
+
+	var count int64
+	err := wr.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// UpdateSignCount records a successful assertion by storing the authenticator's new signature
+// counter. The counter has to be greater than the stored one, unless both are 0 for
+// authenticators without a counter. Checking this in the update itself means the same
+// assertion can't be accepted twice by racing requests. Returns
+// `apperrors.ErrPasskeySignCountRejected` otherwise.
+func (wr *WebAuthnCredentialRepository) UpdateSignCount(id uuid.UUID, signCount uint32, backupState bool, usedAt time.Time) error {
+	if id == uuid.Nil {
+		return apperrors.ErrPasskeyCredentialIDIsEmpty
+	}
+
+	result := wr.DB.Model(&models.WebAuthnCredential{}).
+		Where("id = ? AND (sign_count < ? OR (sign_count = 0 AND ? = 0))", id, int64(signCount), int64(signCount)).
+		Updates(map[string]any{
+			"sign_count":   int64(signCount),
+			"backup_state": backupState,
+			"last_used_at": usedAt.UTC(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.ErrPasskeySignCountRejected
+	}
+	return nil
+}
+
+// DeleteCredential deletes one of a user's passkeys. Returns `apperrors.ErrPasskeyNotFound` if
+// the user has no passkey with that id.
+func (wr *WebAuthnCredentialRepository) DeleteCredential(userID string, id uuid.UUID) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	if id == uuid.Nil {
+		return apperrors.ErrPasskeyNotFound
+	}
+
+	result := wr.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.ErrPasskeyNotFound
+	}
+	return nil
+}
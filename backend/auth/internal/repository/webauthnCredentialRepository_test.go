@@ -0,0 +1,146 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestWebAuthnCredentialRepository_NewWebAuthnCredentialRepository tests creation of
+// WebAuthnCredentialRepository structs in the `repository` package
+func TestWebAuthnCredentialRepository_NewWebAuthnCredentialRepository(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("returns err with nil db", func(t *testing.T) {
+		wr, err := repository.NewWebAuthnCredentialRepository(nil)
+		is.Equal(wr, nil)
+		is.Equal(err, apperrors.ErrDatabaseIsNil)
+	})
+
+	t.Run("creates new WebAuthn credential repo", func(t *testing.T) {
+		wr := setupWebAuthnCredentialRepository(t)
+		is.True(wr != nil)
+	})
+}
+
+func TestWebAuthnCredentialRepository_CreateCredential(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("stores credentials per user", func(t *testing.T) {
+		wr := setupWebAuthnCredentialRepository(t)
+		user := createTestUser(t, wr.DB, "testCreateCredential@test.com")
+
+		for _, credentialID := range []string{"first", "second"} {
+			cred, err := models.NewWebAuthnCredential(user.ID, []byte(credentialID), []byte("key"))
+			is.NoErr(err)
+			is.NoErr(wr.CreateCredential(cred))
+		}
+
+		creds, err := wr.GetCredentialsByUserID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(len(creds), 2)
+		count, err := wr.CountCredentialsByUserID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(count, int64(2))
+	})
+
+	t.Run("fails on duplicate credential ID", func(t *testing.T) {
+		wr := setupWebAuthnCredentialRepository(t)
+		user := createTestUser(t, wr.DB, "testCreateCredential@test.com")
+		other := createTestUser(t, wr.DB, "testCreateCredentialOther@test.com")
+
+		cred, err := models.NewWebAuthnCredential(user.ID, []byte("credential"), []byte("key"))
+		is.NoErr(err)
+		is.NoErr(wr.CreateCredential(cred))
+
+		duplicate, err := models.NewWebAuthnCredential(other.ID, []byte("credential"), []byte("key"))
+		is.NoErr(err)
+		is.Equal(wr.CreateCredential(duplicate), apperrors.ErrPasskeyAlreadyRegistered)
+	})
+
+	t.Run("fails on empty credential", func(t *testing.T) {
+		wr := setupWebAuthnCredentialRepository(t)
+		is.Equal(wr.CreateCredential(nil), apperrors.ErrPasskeyCredentialIDIsEmpty)
+	})
+}
+
+func TestWebAuthnCredentialRepository_UpdateSignCount(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("counter has to increase", func(t *testing.T) {
+		wr := setupWebAuthnCredentialRepository(t)
+		user := createTestUser(t, wr.DB, "testUpdateSignCount@test.com")
+
+		cred, err := models.NewWebAuthnCredential(user.ID, []byte("credential"), []byte("key"))
+		is.NoErr(err)
+		is.NoErr(wr.CreateCredential(cred))
+
+		is.NoErr(wr.UpdateSignCount(cred.ID, 5, true, time.Now()))
+		is.Equal(wr.UpdateSignCount(cred.ID, 5, true, time.Now()), apperrors.ErrPasskeySignCountRejected)
+		is.Equal(wr.UpdateSignCount(cred.ID, 4, true, time.Now()), apperrors.ErrPasskeySignCountRejected)
+		is.Equal(wr.UpdateSignCount(cred.ID, 0, true, time.Now()), apperrors.ErrPasskeySignCountRejected)
+		is.NoErr(wr.UpdateSignCount(cred.ID, 6, true, time.Now()))
+
+		creds, err := wr.GetCredentialsByUserID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(creds[0].SignCount, int64(6))
+		is.True(creds[0].BackupState)
+		is.True(creds[0].LastUsedAt != nil)
+	})
+
+	t.Run("authenticators without a counter stay at 0", func(t *testing.T) {
+		wr := setupWebAuthnCredentialRepository(t)
+		user := createTestUser(t, wr.DB, "testUpdateSignCount@test.com")
+
+		cred, err := models.NewWebAuthnCredential(user.ID, []byte("credential"), []byte("key"))
+		is.NoErr(err)
+		is.NoErr(wr.CreateCredential(cred))
+
+		is.NoErr(wr.UpdateSignCount(cred.ID, 0, false, time.Now()))
+		is.NoErr(wr.UpdateSignCount(cred.ID, 0, false, time.Now()))
+	})
+
+	t.Run("fails on unknown credential", func(t *testing.T) {
+		wr := setupWebAuthnCredentialRepository(t)
+		is.Equal(wr.UpdateSignCount(uuid.New(), 1, false, time.Now()), apperrors.ErrPasskeySignCountRejected)
+	})
+}
+
+func TestWebAuthnCredentialRepository_DeleteCredential(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("only deletes the user's own credential", func(t *testing.T) {
+		wr := setupWebAuthnCredentialRepository(t)
+		user := createTestUser(t, wr.DB, "testDeleteCredential@test.com")
+		other := createTestUser(t, wr.DB, "testDeleteCredentialOther@test.com")
+
+		cred, err := models.NewWebAuthnCredential(user.ID, []byte("credential"), []byte("key"))
+		is.NoErr(err)
+		is.NoErr(wr.CreateCredential(cred))
+
+		is.Equal(wr.DeleteCredential(other.ID.String(), cred.ID), apperrors.ErrPasskeyNotFound)
+		is.NoErr(wr.DeleteCredential(user.ID.String(), cred.ID))
+		is.Equal(wr.DeleteCredential(user.ID.String(), cred.ID), apperrors.ErrPasskeyNotFound)
+	})
+}
+
+func setupWebAuthnCredentialRepository(t *testing.T) *repository.WebAuthnCredentialRepository {
+	t.Helper()
+
+	testDB := testutils.TestDBSetup(t)
+	tx := testDB.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+
+	wr, err := repository.NewWebAuthnCredentialRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create WebAuthn credential repository: %v", err)
+	}
+	return wr
+}
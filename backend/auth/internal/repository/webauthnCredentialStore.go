@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"godiscauth/internal/models"
+)
+
+// WebAuthnCredentialStore stores the passkeys users registered. `WebAuthnCredentialRepository`
+// keeps them in Postgres and `MemoryWebAuthnCredentialStore` in the process.
+type WebAuthnCredentialStore interface {
+	// CreateCredential stores a new passkey, or fails with `apperrors.ErrPasskeyAlreadyRegistered` if
+	// its credential ID is taken by any user
+	CreateCredential(cred *models.WebAuthnCredential) error
+	// GetCredentialsByUserID returns a user's passkeys, oldest first
+	GetCredentialsByUserID(userID string) ([]models.WebAuthnCredential, error)
+	// CountCredentialsByUserID returns the number of passkeys a user has
+	CountCredentialsByUserID(userID string) (int64, error)
+	// UpdateSignCount stores the signature counter of a passkey's assertion if it is greater than
+	// the stored one, or both are 0, and fails with `apperrors.ErrPasskeySignCountRejected`
+	// otherwise
+	UpdateSignCount(id uuid.UUID, signCount uint32, backupState bool, usedAt time.Time) error
+	// DeleteCredential deletes one of a user's passkeys, or fails with `apperrors.ErrPasskeyNotFound`
+	DeleteCredential(userID string, id uuid.UUID) error
+}
+
+var (
+	_ WebAuthnCredentialStore = (*WebAuthnCredentialRepository)(nil)
+	_ WebAuthnCredentialStore = (*MemoryWebAuthnCredentialStore)(nil)
+)
@@ -0,0 +1,104 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+)
+
+// webauthnCredentialStoreSetup returns an empty passkey store and a way to create its users
+type webauthnCredentialStoreSetup func(t *testing.T) (repository.WebAuthnCredentialStore, storeUsers)
+
+func setupMemoryWebAuthnCredentialStore(t *testing.T) (repository.WebAuthnCredentialStore, storeUsers) {
+	return repository.NewMemoryWebAuthnCredentialStore(), memoryStoreUsers
+}
+
+func setupPostgresWebAuthnCredentialStore(t *testing.T) (repository.WebAuthnCredentialStore, storeUsers) {
+	t.Helper()
+
+	tx := beginTestTx(t)
+	wr, err := repository.NewWebAuthnCredentialRepository(tx)
+	if err != nil {
+		t.Fatalf("failed to create WebAuthn credential repository: %v", err)
+	}
+	return wr, postgresStoreUsers(tx)
+}
+
+// TestWebAuthnCredentialStore_Memory tests the in-memory passkey store
+func TestWebAuthnCredentialStore_Memory(t *testing.T) {
+	testWebAuthnCredentialStore(t, setupMemoryWebAuthnCredentialStore)
+}
+
+// TestWebAuthnCredentialStore_Postgres tests that the Postgres passkey store behaves like the
+// in-memory one
+func TestWebAuthnCredentialStore_Postgres(t *testing.T) {
+	testWebAuthnCredentialStore(t, setupPostgresWebAuthnCredentialStore)
+}
+
+// testWebAuthnCredentialStore tests the behavior all passkey stores share
+func testWebAuthnCredentialStore(t *testing.T, setup webauthnCredentialStoreSetup) {
+	is := is.New(t)
+
+	create := func(t *testing.T, store repository.WebAuthnCredentialStore, userID uuid.UUID, credentialID string) *models.WebAuthnCredential {
+		t.Helper()
+		cred, err := models.NewWebAuthnCredential(userID, []byte(credentialID), []byte("public key"))
+		is.NoErr(err)
+		is.NoErr(store.CreateCredential(cred))
+		is.True(cred.ID != uuid.Nil)
+		return cred
+	}
+
+	t.Run("credential IDs are registered once", func(t *testing.T) {
+		store, users := setup(t)
+		userID, otherID := users(t), users(t)
+		credentialID := uuid.NewString()
+		create(t, store, userID, credentialID)
+
+		duplicate, err := models.NewWebAuthnCredential(otherID, []byte(credentialID), []byte("public key"))
+		is.NoErr(err)
+		is.Equal(store.CreateCredential(duplicate), apperrors.ErrPasskeyAlreadyRegistered)
+
+		count, err := store.CountCredentialsByUserID(otherID.String())
+		is.NoErr(err)
+		is.Equal(count, int64(0))
+	})
+
+	t.Run("sign counter has to increase", func(t *testing.T) {
+		store, users := setup(t)
+		cred := create(t, store, users(t), uuid.NewString())
+
+		// Authenticators without a counter always send 0
+		is.NoErr(store.UpdateSignCount(cred.ID, 0, false, time.Now()))
+		is.NoErr(store.UpdateSignCount(cred.ID, 5, true, time.Now()))
+		is.Equal(store.UpdateSignCount(cred.ID, 5, true, time.Now()), apperrors.ErrPasskeySignCountRejected)
+		is.Equal(store.UpdateSignCount(cred.ID, 0, true, time.Now()), apperrors.ErrPasskeySignCountRejected)
+
+		creds, err := store.GetCredentialsByUserID(cred.UserID.String())
+		is.NoErr(err)
+		is.Equal(creds[0].SignCount, int64(5))
+		is.True(creds[0].BackupState)
+		is.True(creds[0].LastUsedAt != nil)
+	})
+
+	t.Run("deletes only the user's own passkeys", func(t *testing.T) {
+		store, users := setup(t)
+		userID, otherID := users(t), users(t)
+		first := create(t, store, userID, uuid.NewString())
+		second := create(t, store, userID, uuid.NewString())
+
+		is.Equal(store.DeleteCredential(otherID.String(), first.ID), apperrors.ErrPasskeyNotFound)
+		is.NoErr(store.DeleteCredential(userID.String(), first.ID))
+		is.Equal(store.DeleteCredential(userID.String(), first.ID), apperrors.ErrPasskeyNotFound)
+
+		creds, err := store.GetCredentialsByUserID(userID.String())
+		is.NoErr(err)
+		is.Equal(len(creds), 1)
+		is.Equal(creds[0].ID, second.ID)
+	})
+}
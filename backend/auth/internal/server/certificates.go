@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CertReloader serves a TLS certificate loaded from files and loads it again when they change, so
+// renewed certificates are picked up without restarting the server
+type CertReloader struct {
+	CertFile string
+	KeyFile  string
+	// Interval is the time between checks for changed files by `Run`
+	Interval time.Duration
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	// modTime is the latest modification time of the files when the certificate was loaded
+	modTime time.Time
+}
+
+// NewCertReloader loads the PEM encoded certificate chain in certFile and its private key in
+// keyFile. The files are checked for changes every interval.
+func NewCertReloader(certFile, keyFile string, interval time.Duration) (*CertReloader, error) {
+	r := &CertReloader{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		Interval: interval,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate from its files. The certificate already loaded is kept if they are
+// invalid, e.g. because only one of them has been replaced so far.
+func (r *CertReloader) Reload() error {
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// GetCertificate returns the current certificate, for `tls.Config.GetCertificate`
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Run checks the files every interval until ctx is done and reloads the certificate when either of
+// them was modified. Failed reloads are logged and retried at the next check.
+func (r *CertReloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modTime, err := r.filesModTime()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to check TLS certificate files")
+			continue
+		}
+		r.mu.RLock()
+		changed := !modTime.Equal(r.modTime)
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			log.Error().Err(err).Msg("Failed to reload TLS certificate")
+			continue
+		}
+		log.Info().Str("cert", r.CertFile).Msg("Reloaded TLS certificate")
+	}
+}
+
+// filesModTime returns the latest modification time of the certificate and key files
+func (r *CertReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.CertFile, r.KeyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
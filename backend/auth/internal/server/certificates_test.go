@@ -0,0 +1,138 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/server"
+)
+
+// writeCertificate writes a self-signed certificate for localhost with the given common name, and
+// its key, to cert.pem and key.pem in dir and returns their paths
+func writeCertificate(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// servedName returns the common name of the certificate the reloader currently serves
+func servedName(t *testing.T, certs *server.CertReloader) string {
+	t.Helper()
+	cert, err := certs.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.Subject.CommonName
+}
+
+// TestCertReloader_NewCertReloader tests loading a certificate from files
+func TestCertReloader_NewCertReloader(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	certFile, keyFile := writeCertificate(t, dir, "first")
+	certs, err := server.NewCertReloader(certFile, keyFile, time.Minute)
+	is.NoErr(err)
+	is.Equal(servedName(t, certs), "first")
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := server.NewCertReloader(filepath.Join(dir, "missing.pem"), keyFile, time.Minute)
+		is.True(os.IsNotExist(err))
+	})
+
+	t.Run("key of another certificate", func(t *testing.T) {
+		otherCert, _ := writeCertificate(t, t.TempDir(), "other")
+		_, err := server.NewCertReloader(otherCert, keyFile, time.Minute)
+		is.True(err != nil)
+	})
+}
+
+// TestCertReloader_Run tests that a certificate whose files change is reloaded, and that invalid
+// files leave the loaded certificate in place
+func TestCertReloader_Run(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	certFile, keyFile := writeCertificate(t, dir, "first")
+	certs, err := server.NewCertReloader(certFile, keyFile, 10*time.Millisecond)
+	is.NoErr(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		certs.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// Move the modification time on so the change is seen even on coarse-grained file systems
+	touch := func() {
+		later := time.Now().Add(time.Minute)
+		is.NoErr(os.Chtimes(certFile, later, later))
+		is.NoErr(os.Chtimes(keyFile, later, later))
+	}
+	waitFor := func(name string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for servedName(t, certs) != name {
+			if time.Now().After(deadline) {
+				t.Fatalf("certificate %q was not loaded", name)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	is.NoErr(os.WriteFile(certFile, []byte("not a certificate"), 0o600))
+	touch()
+	time.Sleep(50 * time.Millisecond)
+	is.Equal(servedName(t, certs), "first")
+
+	writeCertificate(t, dir, "second")
+	touch()
+	waitFor("second")
+}
@@ -1,118 +1,463 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 
+	"godiscauth/internal/database"
 	"godiscauth/internal/handlers"
+	"godiscauth/internal/mailer"
+	"godiscauth/internal/metrics"
 	"godiscauth/internal/middleware"
+	"godiscauth/internal/models"
 	"godiscauth/internal/repository"
 	"godiscauth/internal/services"
 	"godiscauth/pkg/apperrors"
 	"godiscauth/pkg/config"
+	"godiscauth/pkg/keyring"
 )
 
 // APIServer represents the API server with a gin router.
 type APIServer struct {
-	DB                 *gorm.DB
+	// DB is nil for servers built by `NewMemoryAPIServer`
+	DB *gorm.DB
+	// Repos are the stores behind the services
+	Repos              *RepoProvider
 	Router             *gin.Engine
 	HandlerRegistry    *HandlerRegistry
 	MiddlewareProvider *MiddlewareProvider
+	// Reaper deletes expired sessions in the background while the server runs
+	Reaper *services.SessionReaper
+	// Server serves the router with the configured address and timeouts, over TLS if its
+	// `TLSConfig` is set
+	Server *http.Server
+	// Certificates serves the TLS certificate and reloads it while the server runs. Nil without TLS.
+	Certificates *CertReloader
+	// ShutdownTimeout is how long requests in flight get to finish once the server is stopped
+	ShutdownTimeout time.Duration
+	// MetricsServer serves `/metrics` on its own port. Nil if the router serves it.
+	MetricsServer *http.Server
 }
 
-// NewAPIServer initializes a new API server with the gin engine as the router.
-func NewAPIServer(db *gorm.DB) (*APIServer, error) {
+// NewAPIServer initializes a new API server with the gin engine as the router, configured by cfg.
+func NewAPIServer(db *gorm.DB, cfg *config.Config) (*APIServer, error) {
 	if db == nil {
 		return nil, apperrors.ErrDatabaseIsNil
 	}
+	if cfg == nil {
+		return nil, apperrors.ErrConfigIsNil
+	}
 
-	repoProvider, err := NewRepoProvider(db)
+	// Time every statement, once per connection pool
+	if err := db.Use(metrics.GormPlugin{}); err != nil && !errors.Is(err, gorm.ErrRegistered) {
+		return nil, err
+	}
+	repoProvider, err := NewRepoProvider(db, cfg)
 	if err != nil {
 		return nil, err
 	}
-	serviceProvider, err := NewServiceProvider(repoProvider)
+	return newAPIServer(db, repoProvider, cfg)
+}
+
+// NewMemoryAPIServer initializes an API server like `NewAPIServer`, but with in-memory stores and
+// no database, for tests and local development. Nothing it stores survives a restart.
+func NewMemoryAPIServer(cfg *config.Config) (*APIServer, error) {
+	if cfg == nil {
+		return nil, apperrors.ErrConfigIsNil
+	}
+	return newAPIServer(nil, NewMemoryRepoProvider(), cfg)
+}
+
+// newAPIServer wires the services, handlers and middlewares over the given stores. db is only
+// used for the readiness checks and may be nil.
+func newAPIServer(db *gorm.DB, repoProvider *RepoProvider, cfg *config.Config) (*APIServer, error) {
+	// Load the session keys up front so a bad key configuration fails at startup
+	sessionKeys, err := models.LoadSessionKeyRing(cfg.Sessions)
 	if err != nil {
 		return nil, err
 	}
+
+	m, err := mailer.NewMailerFromConfig(cfg.Mail)
+	if err != nil {
+		return nil, err
+	}
+	serviceProvider, err := NewServiceProvider(repoProvider, m, sessionKeys, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if serviceProvider.Health, err = NewReadinessChecks(db, serviceProvider.SessionReaper, sessionKeys, cfg); err != nil {
+		return nil, err
+	}
 	HandlerRegistry, err := NewHandlerRegistry(serviceProvider)
 	if err != nil {
 		return nil, err
 	}
-	middlewareProvider, err := NewMiddlewares(db)
+	// Share the stores, and the session cache, so invalidations by the services reach it
+	middlewareProvider, err := NewMiddlewares(repoProvider, sessionKeys, cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	router := gin.New()
 	router.Use(gin.Logger())
+	// Outside of the recovery, so requests that panicked are counted as 500s
+	router.Use(metrics.Middleware())
 	router.Use(gin.Recovery())
 	router.SetTrustedProxies([]string{"127.0.0.1"})
 
 	server := &APIServer{
 		DB:                 db,
+		Repos:              repoProvider,
 		Router:             router,
 		HandlerRegistry:    HandlerRegistry,
 		MiddlewareProvider: middlewareProvider,
+		Reaper:             serviceProvider.SessionReaper,
+		Server:             NewHTTPServer(router, cfg.Server),
+		ShutdownTimeout:    cfg.Server.ShutdownTimeout,
+	}
+	if cfg.Server.MetricsPort != "" {
+		server.MetricsServer = NewMetricsServer(cfg.Server)
+	}
+	if cfg.Server.TLSCertFile != "" {
+		certs, err := NewCertReloader(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile, cfg.Server.TLSReloadInterval)
+		if err != nil {
+			return nil, err
+		}
+		server.Certificates = certs
+		server.Server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
 	}
 	return server, nil
 }
 
+// NewHTTPServer returns an HTTP server for handler with the address and timeouts in cfg
+func NewHTTPServer(handler http.Handler, cfg config.ServerConfig) *http.Server {
+	return &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// NewMetricsServer returns an HTTP server serving only `/metrics`, on the metrics port and with the
+// timeouts in cfg
+func NewMetricsServer(cfg config.ServerConfig) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	srv := NewHTTPServer(mux, cfg)
+	srv.Addr = ":" + cfg.MetricsPort
+	return srv
+}
+
+// NewReadinessChecks returns a HealthService checking that the database can be reached and is fully
+// migrated, that sessions can be signed and that the session reaper is running, with each check
+// limited to the readiness timeout in cfg. Without a database, only the session keys and the reaper
+// are checked.
+func NewReadinessChecks(
+	db *gorm.DB,
+	reaper *services.SessionReaper,
+	keys *keyring.KeyRing,
+	cfg *config.Config,
+) (*services.HealthService, error) {
+	if reaper == nil {
+		return nil, apperrors.ErrSessionRepoIsNil
+	}
+	if cfg == nil {
+		return nil, apperrors.ErrConfigIsNil
+	}
+	hs := services.NewHealthService(cfg.Server)
+	hs.Checks["session_key"] = models.CheckSessionKeyRing(keys)
+	hs.Checks["session_reaper"] = reaper.Check
+	if db == nil {
+		return hs, nil
+	}
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return nil, err
+	}
+	hs.Checks["database"] = func(ctx context.Context) error { return database.Ping(ctx, db) }
+	hs.Checks["migrations"] = migrator.Check
+	return hs, nil
+}
+
 // SetupRoutes sets up the routes for the API server.
 func (s *APIServer) SetupRoutes() {
 	r := s.Router
 	r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	r.GET("/healthz", s.HandlerRegistry.Health.Healthz)
+	r.GET("/readyz", s.HandlerRegistry.Health.Readyz)
+	if s.MetricsServer == nil {
+		r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	}
 
 	r.POST("/register", s.HandlerRegistry.User.RegisterUser)
 	r.POST("/login", s.HandlerRegistry.User.Login)
+	r.POST("/login/2fa", s.HandlerRegistry.User.LoginSecondFactor)
+	r.POST("/login/2fa/passkey/begin", s.HandlerRegistry.Passkey.BeginSecondFactor)
+	r.POST("/login/2fa/passkey/finish", s.HandlerRegistry.Passkey.FinishSecondFactor)
+	r.POST("/login/passkey/begin", s.HandlerRegistry.Passkey.BeginLogin)
+	r.POST("/login/passkey/finish", s.HandlerRegistry.Passkey.FinishLogin)
 	r.POST("/logout", s.HandlerRegistry.User.Logout)
+	r.POST("/password/forgot", s.HandlerRegistry.Password.ForgotPassword)
+	r.POST("/password/reset", s.HandlerRegistry.Password.ResetPassword)
+	r.POST("/verify-email", s.HandlerRegistry.Verification.VerifyEmail)
+	r.POST("/verify-email/resend", s.HandlerRegistry.Verification.ResendVerification)
+	r.POST("/introspect", s.MiddlewareProvider.Service.RequireServiceAuth(), s.HandlerRegistry.Introspection.Introspect)
 
 	protected := r.Group("")
 	protected.Use(s.MiddlewareProvider.Auth.RequireAuth())
 	{
 		protected.GET("/profile", s.HandlerRegistry.User.GetUserProfile)
+		protected.Any("/verify", s.HandlerRegistry.User.ForwardAuth)
 		protected.POST("/logouteverywhere", s.HandlerRegistry.User.LogoutEverywhere)
+		protected.GET("/sessions", s.HandlerRegistry.User.ListSessions)
+		protected.DELETE("/sessions/:id", s.HandlerRegistry.User.RevokeSession)
 		protected.POST("/updateuser", s.HandlerRegistry.User.UpdateUser)
 		protected.DELETE("/deleteaccount", s.HandlerRegistry.User.PermanentlyDeleteUser)
+		protected.POST("/mfa/totp/enroll", s.HandlerRegistry.MFA.EnrollTOTP)
+		protected.POST("/mfa/totp/confirm", s.HandlerRegistry.MFA.ConfirmTOTP)
+		protected.POST("/mfa/totp/disable", s.HandlerRegistry.MFA.DisableTOTP)
+		protected.GET("/mfa/recovery-codes", s.HandlerRegistry.MFA.GetRecoveryCodeStatus)
+		protected.POST("/mfa/recovery-codes", s.HandlerRegistry.MFA.RegenerateRecoveryCodes)
+		protected.POST("/passkeys/register/begin", s.HandlerRegistry.Passkey.BeginRegistration)
+		protected.POST("/passkeys/register/finish", s.HandlerRegistry.Passkey.FinishRegistration)
+		protected.GET("/passkeys", s.HandlerRegistry.Passkey.ListPasskeys)
+		protected.DELETE("/passkeys/:id", s.HandlerRegistry.Passkey.DeletePasskey)
+		protected.GET("/security/activity", s.HandlerRegistry.Activity.GetSecurityActivity)
 	}
 }
 
-// Run starts the API server and listens for incoming requests.
-func (s *APIServer) Run() {
+// Run sets up the routes and serves them on the server's address until the process is interrupted
+// or terminated, see `Serve`
+func (s *APIServer) Run() error {
 	s.SetupRoutes()
-	s.Router.Run(":" + os.Getenv(config.AuthServerPort))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := net.Listen("tcp", s.Server.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve starts the background jobs and the metrics server if any, and serves requests on ln, over
+// TLS if configured, until ctx is done. It then stops accepting connections and lets requests in
+// flight finish for up to `ShutdownTimeout` before closing the connections left, waits for the
+// background jobs and the metrics server to stop, and returns nil.
+func (s *APIServer) Serve(ctx context.Context, ln net.Listener) error {
+	// Deferred first so that it runs after stop
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	if s.MetricsServer != nil {
+		metricsLn, err := net.Listen("tcp", s.MetricsServer.Addr)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.MetricsServer.Serve(metricsLn); !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Msg("Metrics server failed")
+			}
+		}()
+		// Scrapes are short and can be retried, so they don't need draining
+		defer s.MetricsServer.Close()
+	}
+
+	if s.Reaper != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Reaper.Run(ctx)
+		}()
+	}
+	if s.Certificates != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Certificates.Run(ctx)
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.Server.TLSConfig != nil {
+			// The certificate comes from `TLSConfig.GetCertificate`
+			serveErr <- s.Server.ServeTLS(ln, "", "")
+		} else {
+			serveErr <- s.Server.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info().Msg("Shutting down")
+	stop()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+	if err := s.Server.Shutdown(shutdownCtx); err != nil {
+		log.Warn().Err(err).Msg("Requests did not finish in time, closing their connections")
+		s.Server.Close()
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
-func NewRepoProvider(db *gorm.DB) (*RepoProvider, error) {
+func NewRepoProvider(db *gorm.DB, cfg *config.Config) (*RepoProvider, error) {
 	if db == nil {
 		return nil, apperrors.ErrDatabaseIsNil
 	}
+	if cfg == nil {
+		return nil, apperrors.ErrConfigIsNil
+	}
 	ur, err := repository.NewUserRepository(db)
 	if err != nil {
 		return nil, err
 	}
-	sr, err := repository.NewSessionRepository(db)
+	sr, err := repository.NewSessionStoreFromConfig(db, cfg.Sessions)
+	if err != nil {
+		return nil, err
+	}
+	prr, err := repository.NewPasswordResetRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	tr, err := repository.NewTOTPRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	cr, err := repository.NewMFAChallengeRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	rr, err := repository.NewRecoveryCodeRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	er, err := repository.NewSecurityEventRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	wr, err := repository.NewWebAuthnCredentialRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	wcr, err := repository.NewWebAuthnCeremonyRepository(db)
 	if err != nil {
 		return nil, err
 	}
 	return &RepoProvider{
-		User:    ur,
-		Session: sr,
+		User:          ur,
+		Session:       sr,
+		PasswordReset: prr,
+		TOTP:          tr,
+		MFAChallenge:  cr,
+		RecoveryCode:  rr,
+		SecurityEvent: er,
+		WebAuthn:      wr,
+		Ceremony:      wcr,
 	}, nil
 }
 
-func NewServiceProvider(repos *RepoProvider) (*ServiceProvider, error) {
+// NewMemoryRepoProvider returns stores that keep everything in the process
+func NewMemoryRepoProvider() *RepoProvider {
+	return &RepoProvider{
+		User:          repository.NewMemoryUserStore(),
+		Session:       repository.NewMemorySessionStore(),
+		PasswordReset: repository.NewMemoryPasswordResetStore(),
+		TOTP:          repository.NewMemoryTOTPStore(),
+		MFAChallenge:  repository.NewMemoryMFAChallengeStore(),
+		RecoveryCode:  repository.NewMemoryRecoveryCodeStore(),
+		SecurityEvent: repository.NewMemorySecurityEventStore(),
+		WebAuthn:      repository.NewMemoryWebAuthnCredentialStore(),
+		Ceremony:      repository.NewMemoryWebAuthnCeremonyStore(),
+	}
+}
+
+func NewServiceProvider(repos *RepoProvider, m mailer.Mailer, keys *keyring.KeyRing, cfg *config.Config) (*ServiceProvider, error) {
 	if repos == nil {
 		return nil, apperrors.ErrRepoProviderIsNil
 	}
-	us, err := services.NewUserService(repos.User, repos.Session)
+	if cfg == nil {
+		return nil, apperrors.ErrConfigIsNil
+	}
+	us, err := services.NewUserService(repos.User, repos.Session, keys, cfg)
+	if err != nil {
+		return nil, err
+	}
+	prs, err := services.NewPasswordResetService(repos.User, repos.Session, repos.PasswordReset, m, cfg.Passwords)
+	if err != nil {
+		return nil, err
+	}
+	vs, err := services.NewVerificationService(repos.User, m, keys, cfg.EmailVerification)
+	if err != nil {
+		return nil, err
+	}
+	us.Verifier = vs
+	as, err := services.NewAuditService(repos.SecurityEvent)
+	if err != nil {
+		return nil, err
+	}
+	ms, err := services.NewMFAService(repos.User, repos.TOTP, repos.MFAChallenge, repos.RecoveryCode, cfg)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := services.NewWebAuthnService(repos.User, repos.WebAuthn, repos.Ceremony, cfg)
+	if err != nil {
+		return nil, err
+	}
+	ws.Audit = as
+	ws.MFA = ms
+	ms.Audit = as
+	us.Audit = as
+	ms.Passkeys = ws
+	us.MFA = ms
+	us.Passkeys = ws
+	ins, err := services.NewIntrospectionService(repos.User, repos.Session, keys, cfg)
+	if err != nil {
+		return nil, err
+	}
+	reaper, err := services.NewSessionReaper(repos.Session, cfg.Sessions)
 	if err != nil {
 		return nil, err
 	}
 	return &ServiceProvider{
-		User: us,
+		User:          us,
+		PasswordReset: prs,
+		Verification:  vs,
+		MFA:           ms,
+		Audit:         as,
+		WebAuthn:      ws,
+		Introspection: ins,
+		SessionReaper: reaper,
 	}, nil
 }
 
@@ -121,34 +466,108 @@ func NewHandlerRegistry(services *ServiceProvider) (*HandlerRegistry, error) {
 	if err != nil {
 		return nil, err
 	}
+	ph, err := handlers.NewPasswordHandler(services.PasswordReset)
+	if err != nil {
+		return nil, err
+	}
+	vh, err := handlers.NewVerificationHandler(services.Verification)
+	if err != nil {
+		return nil, err
+	}
+	mh, err := handlers.NewMFAHandler(services.MFA)
+	if err != nil {
+		return nil, err
+	}
+	ah, err := handlers.NewActivityHandler(services.Audit)
+	if err != nil {
+		return nil, err
+	}
+	pkh, err := handlers.NewPasskeyHandler(services.WebAuthn, services.User)
+	if err != nil {
+		return nil, err
+	}
+	ih, err := handlers.NewIntrospectionHandler(services.Introspection)
+	if err != nil {
+		return nil, err
+	}
+	hh, err := handlers.NewHealthHandler(services.Health)
+	if err != nil {
+		return nil, err
+	}
 	return &HandlerRegistry{
-		User: uh,
+		User:          uh,
+		Password:      ph,
+		Verification:  vh,
+		MFA:           mh,
+		Activity:      ah,
+		Passkey:       pkh,
+		Introspection: ih,
+		Health:        hh,
 	}, nil
 }
 
-func NewMiddlewares(db *gorm.DB) (*MiddlewareProvider, error) {
-	mw, err := middleware.NewAuthMiddleware(db)
+func NewMiddlewares(repos *RepoProvider, keys *keyring.KeyRing, cfg *config.Config) (*MiddlewareProvider, error) {
+	if repos == nil {
+		return nil, apperrors.ErrRepoProviderIsNil
+	}
+	if cfg == nil {
+		return nil, apperrors.ErrConfigIsNil
+	}
+	mw, err := middleware.NewAuthMiddlewareFromStores(repos.User, repos.Session, keys, cfg)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := middleware.ParseServiceCredentials(cfg.Services.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	smw, err := middleware.NewServiceAuthMiddleware(credentials)
 	if err != nil {
 		return nil, err
 	}
 	return &MiddlewareProvider{
-		Auth: mw,
+		Auth:    mw,
+		Service: smw,
 	}, nil
 }
 
 type RepoProvider struct {
-	User    *repository.UserRepository
-	Session *repository.SessionRepository
+	User          repository.UserStore
+	Session       repository.SessionStore
+	PasswordReset repository.PasswordResetStore
+	TOTP          repository.TOTPStore
+	MFAChallenge  repository.MFAChallengeStore
+	RecoveryCode  repository.RecoveryCodeStore
+	SecurityEvent repository.SecurityEventStore
+	WebAuthn      repository.WebAuthnCredentialStore
+	Ceremony      repository.WebAuthnCeremonyStore
 }
 
 type ServiceProvider struct {
-	User *services.UserService
+	User          *services.UserService
+	PasswordReset *services.PasswordResetService
+	Verification  *services.VerificationService
+	MFA           *services.MFAService
+	Audit         *services.AuditService
+	WebAuthn      *services.WebAuthnService
+	Introspection *services.IntrospectionService
+	SessionReaper *services.SessionReaper
+	// Health runs the readiness checks, see `NewReadinessChecks`
+	Health *services.HealthService
 }
 
 type HandlerRegistry struct {
-	User *handlers.UserHandler
+	User          *handlers.UserHandler
+	Password      *handlers.PasswordHandler
+	Verification  *handlers.VerificationHandler
+	MFA           *handlers.MFAHandler
+	Activity      *handlers.ActivityHandler
+	Passkey       *handlers.PasskeyHandler
+	Introspection *handlers.IntrospectionHandler
+	Health        *handlers.HealthHandler
 }
 
 type MiddlewareProvider struct {
-	Auth *middleware.AuthMiddleware
+	Auth    *middleware.AuthMiddleware
+	Service *middleware.ServiceAuthMiddleware
 }
@@ -1,15 +1,27 @@
 package server_test
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/matryer/is"
 
+	"godiscauth/internal/repository"
 	"godiscauth/internal/server"
+	"godiscauth/internal/services"
 	"godiscauth/internal/testutils"
+	"godiscauth/pkg/config"
+	"godiscauth/pkg/keyring"
 )
 
 // TestMain sets up the test environment for all tests in the `server_test` package.
@@ -24,8 +36,8 @@ func TestPingRoute(t *testing.T) {
 
 	testutils.TestEnvSetup()
 
-	testDB := testutils.TestDBSetup()
-	server, err := server.NewAPIServer(testDB)
+	testDB := testutils.TestDBSetup(t)
+	server, err := server.NewAPIServer(testDB, testutils.TestConfig())
 	is.NoErr(err)
 	server.SetupRoutes()
 
@@ -37,3 +49,243 @@ func TestPingRoute(t *testing.T) {
 	is.Equal(http.StatusOK, rr.Code)
 	is.Equal("pong", rr.Body.String())
 }
+
+// TestHealthRoutes tests the `/healthz` and `/readyz` routes of the API server with a migrated
+// database
+func TestHealthRoutes(t *testing.T) {
+	is := is.New(t)
+
+	server, err := server.NewAPIServer(testutils.TestDBSetup(t), testutils.TestConfig())
+	is.NoErr(err)
+	server.SetupRoutes()
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		is.Equal(http.StatusOK, rr.Code)
+	}
+
+	results, ready := server.HandlerRegistry.Health.HealthService.Ready(context.Background())
+	is.True(ready)
+	for _, name := range []string{"database", "migrations", "session_key", "session_reaper"} {
+		is.NoErr(results[name].Err)
+	}
+}
+
+// TestMetricsRoute tests that the API server serves `/metrics` without a metrics port, counting the
+// requests it handled by route
+func TestMetricsRoute(t *testing.T) {
+	is := is.New(t)
+
+	server, err := server.NewAPIServer(testutils.TestDBSetup(t), testutils.TestConfig())
+	is.NoErr(err)
+	server.SetupRoutes()
+
+	for _, path := range []string{"/ping", "/metrics"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		is.Equal(http.StatusOK, rr.Code)
+		if path == "/metrics" {
+			is.True(strings.Contains(rr.Body.String(), `godiscauth_http_requests_total{method="GET",route="/ping",status="200"}`))
+			is.True(strings.Contains(rr.Body.String(), "godiscauth_active_sessions"))
+		}
+	}
+}
+
+// TestNewMemoryAPIServer_SessionKeyRing tests that the API server starts with session keys from
+// `AUTH_SESSION_KEYS` and without the legacy key
+func TestNewMemoryAPIServer_SessionKeyRing(t *testing.T) {
+	is := is.New(t)
+	t.Setenv(config.SessionKey, "")
+	t.Setenv(config.EnvSessionKeys, "2025-06:"+strings.Repeat("k3y", keyring.MinKeyLength))
+
+	cfg, err := config.Load("")
+	is.NoErr(err)
+	server, err := server.NewMemoryAPIServer(cfg)
+	is.NoErr(err)
+	server.SetupRoutes()
+
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	is.Equal(http.StatusOK, rr.Code)
+}
+
+// setupServing returns an API server without a database that serves router with the default
+// timeouts, and a listener for it on a free local port
+func setupServing(t *testing.T, router *gin.Engine) (*server.APIServer, net.Listener) {
+	t.Helper()
+	reaper, err := services.NewSessionReaper(repository.NewMemorySessionStore(), testutils.TestConfig().Sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &server.APIServer{
+		Router:          router,
+		Reaper:          reaper,
+		Server:          server.NewHTTPServer(router, config.Default().Server),
+		ShutdownTimeout: time.Second,
+	}, ln
+}
+
+// TestAPIServer_NewHTTPServer tests that the HTTP server gets the configured timeouts
+func TestAPIServer_NewHTTPServer(t *testing.T) {
+	is := is.New(t)
+	cfg := config.Default().Server
+	cfg.Port = "8443"
+	cfg.WriteTimeout = time.Minute
+
+	srv := server.NewHTTPServer(http.NotFoundHandler(), cfg)
+	is.Equal(srv.Addr, ":8443")
+	is.Equal(srv.ReadHeaderTimeout, cfg.ReadHeaderTimeout)
+	is.Equal(srv.ReadTimeout, cfg.ReadTimeout)
+	is.Equal(srv.WriteTimeout, time.Minute)
+	is.Equal(srv.IdleTimeout, cfg.IdleTimeout)
+}
+
+// TestAPIServer_Serve tests that stopping the server lets requests in flight finish and stops the
+// background jobs before returning
+func TestAPIServer_Serve(t *testing.T) {
+	is := is.New(t)
+
+	started := make(chan struct{})
+	router := gin.New()
+	router.GET("/slow", func(c *gin.Context) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+	apiServer, ln := setupServing(t, router)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- apiServer.Serve(ctx, ln) }()
+
+	type response struct {
+		body string
+		err  error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- response{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+	r := <-responses
+	is.NoErr(r.err)
+	is.Equal(r.body, "done")
+	is.NoErr(<-served)
+	is.True(apiServer.Reaper.Status().Runs >= 1)
+
+	_, err := http.Get("http://" + ln.Addr().String() + "/slow")
+	is.True(err != nil)
+}
+
+// TestAPIServer_ServeTLS tests serving HTTPS with the certificate of the reloader
+func TestAPIServer_ServeTLS(t *testing.T) {
+	is := is.New(t)
+
+	router := gin.New()
+	router.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	apiServer, ln := setupServing(t, router)
+
+	certFile, keyFile := writeCertificate(t, t.TempDir(), "localhost")
+	certs, err := server.NewCertReloader(certFile, keyFile, time.Minute)
+	is.NoErr(err)
+	apiServer.Certificates = certs
+	apiServer.Server.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- apiServer.Serve(ctx, ln) }()
+	defer func() {
+		cancel()
+		is.NoErr(<-served)
+	}()
+
+	pem, err := os.ReadFile(certFile)
+	is.NoErr(err)
+	roots := x509.NewCertPool()
+	is.True(roots.AppendCertsFromPEM(pem))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	is.NoErr(err)
+	resp, err := client.Get("https://localhost:" + port + "/ping")
+	is.NoErr(err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	is.NoErr(err)
+	is.Equal(string(body), "pong")
+
+	// Plain HTTP is refused
+	resp, err = http.Get("http://" + ln.Addr().String() + "/ping")
+	is.NoErr(err)
+	resp.Body.Close()
+	is.Equal(resp.StatusCode, http.StatusBadRequest)
+}
+
+// TestAPIServer_ServeMetrics tests serving the metrics on their own port while the server runs
+func TestAPIServer_ServeMetrics(t *testing.T) {
+	is := is.New(t)
+
+	router := gin.New()
+	router.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	apiServer, ln := setupServing(t, router)
+
+	// Find a free port for the metrics server
+	metricsLn, err := net.Listen("tcp", "127.0.0.1:0")
+	is.NoErr(err)
+	_, port, err := net.SplitHostPort(metricsLn.Addr().String())
+	is.NoErr(err)
+	is.NoErr(metricsLn.Close())
+	cfg := config.Default().Server
+	cfg.MetricsPort = port
+	apiServer.MetricsServer = server.NewMetricsServer(cfg)
+	is.Equal(apiServer.MetricsServer.Addr, ":"+port)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- apiServer.Serve(ctx, ln) }()
+
+	// The metrics server starts listening in the background
+	metricsURL := "http://127.0.0.1:" + port + "/metrics"
+	deadline := time.Now().Add(5 * time.Second)
+	resp, err := http.Get(metricsURL)
+	for err != nil {
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		resp, err = http.Get(metricsURL)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	is.NoErr(err)
+	is.Equal(resp.StatusCode, http.StatusOK)
+	is.True(strings.Contains(string(body), "godiscauth_"))
+
+	resp, err = http.Get("http://127.0.0.1:" + port + "/ping")
+	is.NoErr(err)
+	resp.Body.Close()
+	is.Equal(resp.StatusCode, http.StatusNotFound)
+
+	cancel()
+	is.NoErr(<-served)
+	_, err = http.Get(metricsURL)
+	is.True(err != nil)
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// AuditService records security-relevant account changes so users can review their security
+// activity
+type AuditService struct {
+	EventRepo repository.SecurityEventStore
+}
+
+// NewAuditService returns a value of type AuditService
+func NewAuditService(er repository.SecurityEventStore) (*AuditService, error) {
+	if er == nil {
+		return nil, apperrors.ErrEventRepoIsNil
+	}
+	return &AuditService{EventRepo: er}, nil
+}
+
+// Record adds an event to a user's security activity. Failures are logged rather than returned
+// so auditing never blocks the action being audited.
+func (as *AuditService) Record(userID uuid.UUID, eventType models.SecurityEventType, detail string) {
+	log.Info().
+		Str("userID", userID.String()).
+		Str("event", string(eventType)).
+		Str("detail", detail).
+		Msg("Security event")
+
+	event, err := models.NewSecurityEvent(userID, eventType, detail)
+	if err == nil {
+		err = as.EventRepo.CreateEvent(event)
+	}
+	if err != nil {
+		log.Error().
+			Str("userID", userID.String()).
+			Str("event", string(eventType)).
+			Str("error", err.Error()).
+			Msg("Failed to record security event")
+	}
+}
+
+// ListActivity returns a user's most recent security events, newest first
+func (as *AuditService) ListActivity(userID string) ([]models.SecurityEvent, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	return as.EventRepo.ListEventsByUserID(userID, config.SecurityActivityLimit)
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"godiscauth/pkg/config"
+)
+
+// HealthCheck checks a dependency the service needs to handle requests and returns why it can't be
+// used, within the time ctx allows
+type HealthCheck func(ctx context.Context) error
+
+// CheckResult is the outcome of a HealthCheck
+type CheckResult struct {
+	// Err is why the check failed, `context.DeadlineExceeded` if it timed out. Nil if it passed.
+	Err      error
+	Duration time.Duration
+}
+
+// HealthService runs the checks that decide whether the service is ready for requests
+type HealthService struct {
+	// Checks are the readiness checks by name
+	Checks map[string]HealthCheck
+	// Timeout is how long each check may take before it counts as failed
+	Timeout time.Duration
+}
+
+// NewHealthService returns a HealthService without checks, with the readiness timeout of cfg
+func NewHealthService(cfg config.ServerConfig) *HealthService {
+	return &HealthService{
+		Checks:  make(map[string]HealthCheck),
+		Timeout: cfg.ReadinessTimeout,
+	}
+}
+
+// Ready runs all checks at once and returns their results by name, and whether all of them passed.
+// A check that doesn't return within the timeout fails without waiting for it.
+func (hs *HealthService) Ready(ctx context.Context) (map[string]CheckResult, bool) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]CheckResult, len(hs.Checks))
+	for name, check := range hs.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := hs.run(ctx, check)
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	ready := true
+	for _, result := range results {
+		if result.Err != nil {
+			ready = false
+		}
+	}
+	return results, ready
+}
+
+// run runs check with the timeout
+func (hs *HealthService) run(ctx context.Context, check HealthCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, hs.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return CheckResult{Err: err, Duration: time.Since(start)}
+}
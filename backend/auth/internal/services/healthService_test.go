@@ -0,0 +1,54 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/services"
+	"godiscauth/pkg/config"
+)
+
+// TestHealthService_Ready tests that the service is ready only when every check passes in time
+func TestHealthService_Ready(t *testing.T) {
+	is := is.New(t)
+	hs := services.NewHealthService(config.ServerConfig{ReadinessTimeout: time.Second})
+	is.Equal(hs.Timeout, time.Second)
+
+	results, ready := hs.Ready(context.Background())
+	is.True(ready)
+	is.Equal(len(results), 0)
+
+	hs.Checks["passing"] = func(context.Context) error { return nil }
+	results, ready = hs.Ready(context.Background())
+	is.True(ready)
+	is.NoErr(results["passing"].Err)
+
+	errDown := errors.New("down")
+	hs.Checks["failing"] = func(context.Context) error { return errDown }
+	results, ready = hs.Ready(context.Background())
+	is.True(!ready)
+	is.NoErr(results["passing"].Err)
+	is.Equal(results["failing"].Err, errDown)
+
+	t.Run("timeout", func(t *testing.T) {
+		is := is.New(t)
+		hs := services.NewHealthService(config.ServerConfig{ReadinessTimeout: 10 * time.Millisecond})
+		block := make(chan struct{})
+		t.Cleanup(func() { close(block) })
+		// Ignores ctx, so the timeout has to be enforced without its cooperation
+		hs.Checks["hanging"] = func(context.Context) error {
+			<-block
+			return nil
+		}
+
+		start := time.Now()
+		results, ready := hs.Ready(context.Background())
+		is.True(!ready)
+		is.Equal(results["hanging"].Err, context.DeadlineExceeded)
+		is.True(time.Since(start) < time.Second)
+	})
+}
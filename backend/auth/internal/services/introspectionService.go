@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+	"godiscauth/pkg/keyring"
+)
+
+// IntrospectionService tells other backend services who a session token belongs to
+type IntrospectionService struct {
+	UserRepo    repository.UserStore
+	SessionRepo repository.SessionStore
+	// SessionKeys verify session tokens
+	SessionKeys *keyring.KeyRing
+	// SessionPolicies decide how long sessions last
+	SessionPolicies models.SessionPolicies
+	// VerificationPolicy decides whether sessions of unverified accounts are active
+	VerificationPolicy VerificationPolicy
+	// LastSeenInterval is the minimum time between recording that a session is in use, like
+	// `RequireAuth` does
+	LastSeenInterval time.Duration
+}
+
+// Introspection is the state of a session token. Only Active is set for inactive tokens.
+type Introspection struct {
+	Active bool
+	UserID uuid.UUID
+	Roles  []string
+	MFA    bool
+	// RememberMe tells whether the user asked to be remembered, i.e. whether a cookie carrying the
+	// token should outlive the browser session
+	RememberMe bool
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
+}
+
+// NewIntrospectionService returns a value of type IntrospectionService that verifies tokens with
+// keys, under the session and email verification policies of cfg
+func NewIntrospectionService(
+	ur repository.UserStore,
+	sr repository.SessionStore,
+	keys *keyring.KeyRing,
+	cfg *config.Config,
+) (*IntrospectionService, error) {
+	if ur == nil {
+		return nil, apperrors.ErrUserRepoIsNil
+	}
+	if sr == nil {
+		return nil, apperrors.ErrSessionRepoIsNil
+	}
+	if keys == nil {
+		return nil, apperrors.ErrSessionKeyMissing
+	}
+	if cfg == nil {
+		return nil, apperrors.ErrConfigIsNil
+	}
+	verificationPolicy, err := ParseVerificationPolicy(cfg.EmailVerification.Policy)
+	if err != nil {
+		return nil, err
+	}
+	return &IntrospectionService{
+		UserRepo:           ur,
+		SessionRepo:        sr,
+		SessionKeys:        keys,
+		SessionPolicies:    models.NewSessionPolicies(cfg.Sessions),
+		VerificationPolicy: verificationPolicy,
+		LastSeenInterval:   cfg.Sessions.LastSeenInterval,
+	}, nil
+}
+
+// Introspect reports whether a session token would be accepted by `RequireAuth` and, if so, the
+// session it belongs to. Like a request to a protected route, it counts as use of the session and
+// restarts its idle timeout. Malformed, forged, expired and unknown tokens are inactive rather than
+// errors; an error means the state of the token could not be determined.
+func (ins *IntrospectionService) Introspect(sessionToken string) (*Introspection, error) {
+	inactive := &Introspection{}
+
+	tokenHash, err := models.ParseSessionToken(ins.SessionKeys, sessionToken)
+	if err != nil {
+		return inactive, nil
+	}
+
+	session, err := ins.SessionRepo.GetUnexpiredSessionByTokenHash(tokenHash)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return inactive, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if session.IsExpired(ins.SessionPolicies, time.Now().UTC()) {
+		return inactive, nil
+	}
+
+	user, err := ins.UserRepo.GetUserByID(session.UserID.String())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return inactive, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if ins.VerificationPolicy == VerificationPolicyProtected && !user.IsEmailVerified() {
+		return inactive, nil
+	}
+
+	// Record that the session is in use, at most every `LastSeenInterval`. The caller is another
+	// service, so the session keeps the IP address it was last used from.
+	now := time.Now()
+	expiresAt := session.ExpiresAt
+	if now.Sub(session.LastSeenAt) >= ins.LastSeenInterval {
+		expiresAt = session.Policy(ins.SessionPolicies).ExpiresAt(session.AuthenticatedAt, now)
+		if err := ins.SessionRepo.TouchSession(session.ID, session.ClientIP, now, expiresAt); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Introspection{
+		Active:     true,
+		UserID:     user.ID,
+		Roles:      user.RoleList(),
+		MFA:        session.MFA,
+		RememberMe: session.RememberMe,
+		IssuedAt:   session.CreatedAt,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
@@ -0,0 +1,125 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/services"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestIntrospectionService_NewIntrospectionService tests the creation of a new IntrospectionService
+func TestIntrospectionService_NewIntrospectionService(t *testing.T) {
+	is := is.New(t)
+	us := setupUserService(t)
+
+	_, err := services.NewIntrospectionService(nil, us.SessionRepo, testutils.TestSessionKeys(), testutils.TestConfig())
+	is.Equal(err, apperrors.ErrUserRepoIsNil)
+	_, err = services.NewIntrospectionService(us.UserRepo, nil, testutils.TestSessionKeys(), testutils.TestConfig())
+	is.Equal(err, apperrors.ErrSessionRepoIsNil)
+}
+
+// TestIntrospectionService_Introspect tests which session tokens are reported as active
+func TestIntrospectionService_Introspect(t *testing.T) {
+	is := is.New(t)
+	us := setupUserService(t)
+	ins, err := services.NewIntrospectionService(us.UserRepo, us.SessionRepo, testutils.TestSessionKeys(), testutils.TestConfig())
+	is.NoErr(err)
+
+	email := "testIntrospect@test.com"
+	err = us.RegisterUser(email, testutils.TestingPassword)
+	is.NoErr(err)
+	user, err := us.UserRepo.GetUserByEmail(email)
+	is.NoErr(err)
+	result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+	is.NoErr(err)
+
+	t.Run("active session", func(t *testing.T) {
+		introspection, err := ins.Introspect(result.SessionToken)
+		is.NoErr(err)
+		is.True(introspection.Active)
+		is.Equal(introspection.UserID, user.ID)
+		is.Equal(introspection.Roles, []string{models.RoleUser})
+		is.True(!introspection.MFA)
+		is.True(introspection.ExpiresAt.After(time.Now()))
+		is.True(!introspection.IssuedAt.After(time.Now()))
+	})
+
+	t.Run("counts as use of the session", func(t *testing.T) {
+		ins.LastSeenInterval = time.Minute
+		defer func() { ins.LastSeenInterval = 0 }()
+		session := sessionFromToken(t, us, result.SessionToken)
+		lastSeen := time.Now().Add(-time.Hour)
+		is.NoErr(us.SessionRepo.TouchSession(session.ID, session.ClientIP, lastSeen, time.Now().Add(time.Minute)))
+
+		introspection, err := ins.Introspect(result.SessionToken)
+		is.NoErr(err)
+		is.True(!introspection.RememberMe)
+		is.True(introspection.ExpiresAt.After(time.Now().Add(time.Hour)))
+		touched := sessionFromToken(t, us, result.SessionToken)
+		is.True(touched.LastSeenAt.After(lastSeen.Add(time.Minute)))
+		is.True(touched.ExpiresAt.After(time.Now().Add(time.Hour)))
+
+		// Not again within the interval
+		_, err = ins.Introspect(result.SessionToken)
+		is.NoErr(err)
+		is.True(sessionFromToken(t, us, result.SessionToken).LastSeenAt.Equal(touched.LastSeenAt))
+	})
+
+	t.Run("roles", func(t *testing.T) {
+		err := us.UserRepo.UpdateUser(user.ID.String(), map[string]any{"roles": models.RoleUser + "," + models.RoleAdmin})
+		is.NoErr(err)
+
+		introspection, err := ins.Introspect(result.SessionToken)
+		is.NoErr(err)
+		is.Equal(introspection.Roles, []string{models.RoleUser, models.RoleAdmin})
+	})
+
+	t.Run("inactive tokens", func(t *testing.T) {
+		expiredToken, tokenHash, err := models.GenerateSessionToken(testutils.TestSessionKeys())
+		is.NoErr(err)
+		_, signature, _ := strings.Cut(expiredToken, ".")
+		expired, err := models.NewSession(user.ID, tokenHash, time.Now().Add(-time.Minute))
+		is.NoErr(err)
+		err = us.SessionRepo.CreateSession(expired)
+		is.NoErr(err)
+
+		for name, token := range map[string]string{
+			"empty":     "",
+			"malformed": "invalid",
+			"forged":    uuid.NewString() + "." + signature,
+			"unknown":   uuid.NewString(),
+			"expired":   expiredToken,
+		} {
+			introspection, err := ins.Introspect(token)
+			is.NoErr(err)
+			if introspection.Active {
+				t.Errorf("%s token is active", name)
+			}
+		}
+	})
+
+	t.Run("unverified account under protected policy", func(t *testing.T) {
+		ins.VerificationPolicy = services.VerificationPolicyProtected
+		defer func() { ins.VerificationPolicy = services.VerificationPolicyOff }()
+
+		introspection, err := ins.Introspect(result.SessionToken)
+		is.NoErr(err)
+		is.True(!introspection.Active)
+	})
+
+	t.Run("logged out session", func(t *testing.T) {
+		err := us.Logout(result.SessionToken)
+		is.NoErr(err)
+
+		introspection, err := ins.Introspect(result.SessionToken)
+		is.NoErr(err)
+		is.True(!introspection.Active)
+	})
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"time"
+
+	"godiscauth/internal/metrics"
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/config"
+)
+
+// LockoutPolicy decides when repeated failed logins or second factor codes lock an account and for how long
+type LockoutPolicy struct {
+	// MaxAttempts is the number of consecutive failed logins that triggers a lock
+	MaxAttempts int
+	// BaseDuration is the length of the first lock
+	BaseDuration time.Duration
+	// MaxDuration caps the lock length for repeat offenders
+	MaxDuration time.Duration
+}
+
+// LockoutPolicyFromConfig returns the lockout policy configured by cfg
+func LockoutPolicyFromConfig(cfg config.LockoutConfig) LockoutPolicy {
+	return LockoutPolicy{
+		MaxAttempts:  cfg.MaxAttempts,
+		BaseDuration: cfg.Length,
+		MaxDuration:  cfg.MaxLength,
+	}
+}
+
+// ShouldLock reports whether an account with the given number of consecutive failed logins
+// should be locked
+func (p LockoutPolicy) ShouldLock(failedAttempts int) bool {
+	return failedAttempts >= p.MaxAttempts
+}
+
+// LockDuration returns how long to lock an account that has already been locked
+// `priorLockouts` times since its last successful login. The duration doubles with each
+// prior lockout and never exceeds `MaxDuration`.
+func (p LockoutPolicy) LockDuration(priorLockouts int) time.Duration {
+	d := p.BaseDuration
+	for range max(priorLockouts, 0) {
+		if d >= p.MaxDuration {
+			break
+		}
+		d *= 2
+	}
+	return min(d, p.MaxDuration)
+}
+
+// RecordFailure counts a wrong password or second factor code against a user and locks their
+// account once the policy says so, for longer each time
+func (p LockoutPolicy) RecordFailure(ur repository.UserStore, user *models.User, now time.Time) error {
+	attempts, err := ur.IncrementFailedLogins(user.ID.String())
+	if err != nil {
+		return err
+	}
+	if !p.ShouldLock(attempts) {
+		return nil
+	}
+	if err := ur.LockAccount(user.ID.String(), now.Add(p.LockDuration(user.LockoutCount))); err != nil {
+		return err
+	}
+	metrics.Lockouts.Inc()
+	return nil
+}
@@ -0,0 +1,62 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/services"
+	"godiscauth/pkg/config"
+)
+
+// TestLockoutPolicy_ShouldLock tests the lock threshold of the lockout policy
+func TestLockoutPolicy_ShouldLock(t *testing.T) {
+	is := is.New(t)
+	policy := services.LockoutPolicyFromConfig(config.Default().Lockout)
+
+	is.True(!policy.ShouldLock(0))
+	is.True(!policy.ShouldLock(policy.MaxAttempts - 1))
+	is.True(policy.ShouldLock(policy.MaxAttempts))
+	is.True(policy.ShouldLock(policy.MaxAttempts + 1))
+}
+
+// TestLockoutPolicy_LockoutPolicyFromConfig tests building the lockout policy from the config
+func TestLockoutPolicy_LockoutPolicyFromConfig(t *testing.T) {
+	is := is.New(t)
+
+	policy := services.LockoutPolicyFromConfig(config.LockoutConfig{
+		MaxAttempts: 3,
+		Length:      time.Minute,
+		MaxLength:   time.Hour,
+	})
+	is.Equal(policy, services.LockoutPolicy{MaxAttempts: 3, BaseDuration: time.Minute, MaxDuration: time.Hour})
+}
+
+// TestLockoutPolicy_LockDuration tests that lock durations grow progressively and are capped
+func TestLockoutPolicy_LockDuration(t *testing.T) {
+	is := is.New(t)
+	policy := services.LockoutPolicy{
+		MaxAttempts:  5,
+		BaseDuration: 15 * time.Minute,
+		MaxDuration:  2 * time.Hour,
+	}
+
+	t.Run("first lockout uses base duration", func(t *testing.T) {
+		is.Equal(policy.LockDuration(0), 15*time.Minute)
+	})
+
+	t.Run("doubles for repeat offenders", func(t *testing.T) {
+		is.Equal(policy.LockDuration(1), 30*time.Minute)
+		is.Equal(policy.LockDuration(2), time.Hour)
+	})
+
+	t.Run("caps at max duration", func(t *testing.T) {
+		is.Equal(policy.LockDuration(3), 2*time.Hour)
+		is.Equal(policy.LockDuration(1000), 2*time.Hour)
+	})
+
+	t.Run("treats negative counts as first lockout", func(t *testing.T) {
+		is.Equal(policy.LockDuration(-1), 15*time.Minute)
+	})
+}
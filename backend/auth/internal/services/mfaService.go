@@ -0,0 +1,456 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+	"godiscauth/pkg/secretbox"
+	"godiscauth/pkg/totp"
+)
+
+// MFAService contains the repositories needed to enroll users in TOTP two-factor authentication
+// and to check their second factor during login
+type MFAService struct {
+	UserRepo      repository.UserStore
+	TOTPRepo      repository.TOTPStore
+	ChallengeRepo repository.MFAChallengeStore
+	RecoveryRepo  repository.RecoveryCodeStore
+	// Audit records enrollment changes and recovery code use. Optional.
+	Audit *AuditService
+	// Passkeys lets users with passkeys answer a login challenge with one instead of a code.
+	// Optional.
+	Passkeys *WebAuthnService
+	// EncryptionKey encrypts TOTP secrets at rest
+	EncryptionKey string
+	// Issuer is the account issuer shown in authenticator apps
+	Issuer string
+	// ChallengeExpiration is how long a user has to enter their second factor after their password
+	ChallengeExpiration time.Duration
+	// MaxChallengeAttempts is the number of codes that can be tried against one login challenge
+	MaxChallengeAttempts int
+	// Lockout counts wrong codes towards the same account lock as wrong passwords, so codes
+	// can't be guessed across challenges or from a hijacked session
+	Lockout LockoutPolicy
+}
+
+// NewMFAService returns a value of type MFAService with the MFA settings and lockout policy of cfg
+func NewMFAService(
+	ur repository.UserStore,
+	tr repository.TOTPStore,
+	cr repository.MFAChallengeStore,
+	rr repository.RecoveryCodeStore,
+	cfg *config.Config,
+) (*MFAService, error) {
+	if ur == nil {
+		return nil, apperrors.ErrUserRepoIsNil
+	}
+	if tr == nil {
+		return nil, apperrors.ErrTOTPRepoIsNil
+	}
+	if cr == nil {
+		return nil, apperrors.ErrChallengeRepoIsNil
+	}
+	if rr == nil {
+		return nil, apperrors.ErrRecoveryRepoIsNil
+	}
+	if cfg == nil {
+		return nil, apperrors.ErrConfigIsNil
+	}
+	return &MFAService{
+		UserRepo:             ur,
+		TOTPRepo:             tr,
+		ChallengeRepo:        cr,
+		RecoveryRepo:         rr,
+		EncryptionKey:        cfg.MFA.Key,
+		Issuer:               cfg.MFA.Issuer,
+		ChallengeExpiration:  cfg.MFA.ChallengeExpiration,
+		MaxChallengeAttempts: cfg.MFA.MaxChallengeAttempts,
+		Lockout:              LockoutPolicyFromConfig(cfg.Lockout),
+	}, nil
+}
+
+// EnrollTOTP starts TOTP enrollment by generating a new secret for the user. It returns the
+// secret and an otpauth:// URI for the user to add to their authenticator app. The enrollment
+// only takes effect once confirmed with `ConfirmTOTP`; calling this again before then replaces
+// the secret.
+func (ms *MFAService) EnrollTOTP(userID string) (secret string, uri string, err error) {
+	if userID == "" {
+		return "", "", apperrors.ErrUserIdEmpty
+	}
+	user, err := ms.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, err = totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := secretbox.Seal(ms.EncryptionKey, []byte(secret))
+	if err != nil {
+		return "", "", err
+	}
+	cred, err := models.NewTOTPCredential(user.ID, sealed)
+	if err != nil {
+		return "", "", err
+	}
+	if err := ms.TOTPRepo.SavePendingCredential(cred); err != nil {
+		return "", "", err
+	}
+
+	return secret, totp.URI(ms.Issuer, user.Email, secret), nil
+}
+
+// ConfirmTOTP completes enrollment once the user enters a valid code from their authenticator.
+// From then on, logins require a second factor. Returns a fresh set of recovery codes, which
+// are only ever shown to the user this once.
+func (ms *MFAService) ConfirmTOTP(userID string, code string) ([]string, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	if code == "" {
+		return nil, apperrors.ErrMFACodeIsEmpty
+	}
+
+	cred, err := ms.TOTPRepo.GetCredentialByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if cred.IsConfirmed() {
+		return nil, apperrors.ErrMFAAlreadyEnabled
+	}
+	step, err := ms.validateTOTP(cred, code)
+	if err != nil {
+		return nil, err
+	}
+	if err := ms.TOTPRepo.ConfirmCredential(userID, step, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	ms.record(cred.UserID, models.SecurityEventTOTPEnabled, "")
+
+	return ms.replaceRecoveryCodes(cred.UserID)
+}
+
+// RegenerateRecoveryCodes replaces all of a user's recovery codes, e.g. when they are running low
+// or may have been exposed. A valid second factor code is required, and wrong ones count
+// towards the account lock.
+func (ms *MFAService) RegenerateRecoveryCodes(userID string, code string) ([]string, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	if code == "" {
+		return nil, apperrors.ErrMFACodeIsEmpty
+	}
+
+	cred, err := ms.TOTPRepo.GetCredentialByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !cred.IsConfirmed() {
+		return nil, apperrors.ErrMFANotEnrolled
+	}
+	if err := ms.checkSecondFactor(cred, code); err != nil {
+		return nil, err
+	}
+	return ms.replaceRecoveryCodes(cred.UserID)
+}
+
+// RemainingRecoveryCodes returns the number of unused recovery codes a user has
+func (ms *MFAService) RemainingRecoveryCodes(userID string) (int64, error) {
+	return ms.RecoveryRepo.CountUnusedCodes(userID)
+}
+
+// DisableTOTP removes a user's TOTP enrollment. Once enrollment is confirmed, a valid code is
+// required so a hijacked session alone can't turn off the second factor. Wrong codes count
+// towards the account lock, which stops further attempts until it expires.
+func (ms *MFAService) DisableTOTP(userID string, code string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+
+	cred, err := ms.TOTPRepo.GetCredentialByUserID(userID)
+	if err != nil {
+		return err
+	}
+	if cred.IsConfirmed() {
+		if err := ms.checkSecondFactor(cred, code); err != nil {
+			return err
+		}
+	}
+	if err := ms.TOTPRepo.DeleteCredential(userID); err != nil {
+		return err
+	}
+	if err := ms.RecoveryRepo.DeleteCodesByUserID(userID); err != nil {
+		return err
+	}
+	if cred.IsConfirmed() {
+		ms.record(cred.UserID, models.SecurityEventTOTPDisabled, "")
+	}
+	return ms.ChallengeRepo.DeleteChallengesByUserID(userID)
+}
+
+// IsEnabled reports whether a user has a confirmed second factor and so must complete a login
+// challenge
+func (ms *MFAService) IsEnabled(userID string) (bool, error) {
+	cred, err := ms.TOTPRepo.GetCredentialByUserID(userID)
+	if errors.Is(err, apperrors.ErrMFANotEnrolled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return cred.IsConfirmed(), nil
+}
+
+// CreateChallenge starts a two-factor login for a user who has entered a correct password. The
+// returned token is exchanged for a session with `VerifyChallenge`.
+func (ms *MFAService) CreateChallenge(userID uuid.UUID) (string, error) {
+	token, tokenHash, err := models.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	challenge, err := models.NewMFAChallenge(userID, tokenHash, time.Now().UTC().Add(ms.ChallengeExpiration))
+	if err != nil {
+		return "", err
+	}
+	if err := ms.ChallengeRepo.CreateChallenge(challenge); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// VerifyChallenge checks a second factor code against a login challenge and returns the ID of the
+// user it belongs to. The code can be from the authenticator or a recovery code. A challenge is
+// single-use and is discarded after `MaxChallengeAttempts` wrong codes. Wrong codes also count
+// towards the account lock, and no code is accepted while the account is locked.
+func (ms *MFAService) VerifyChallenge(challengeToken string, code string) (uuid.UUID, error) {
+	if challengeToken == "" {
+		return uuid.Nil, apperrors.ErrMFAChallengeIsEmpty
+	}
+	if code == "" {
+		return uuid.Nil, apperrors.ErrMFACodeIsEmpty
+	}
+
+	challenge, err := ms.ChallengeRepo.RecordAttempt(models.HashToken(challengeToken), ms.MaxChallengeAttempts)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	userID := challenge.UserID.String()
+
+	cred, err := ms.TOTPRepo.GetCredentialByUserID(userID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !cred.IsConfirmed() {
+		return uuid.Nil, apperrors.ErrMFANotEnrolled
+	}
+	if err := ms.checkSecondFactor(cred, code); err != nil {
+		log.Info().
+			Str("userID", userID).
+			Int("attempts", challenge.Attempts).
+			Msg("Invalid second factor code")
+		return uuid.Nil, err
+	}
+
+	// Delete the challenge before handing out a session so it can't be exchanged twice
+	if err := ms.ChallengeRepo.DeleteChallenge(challenge.ID); err != nil {
+		return uuid.Nil, err
+	}
+	return challenge.UserID, nil
+}
+
+// BeginPasskeyChallenge starts answering a login challenge with one of the user's passkeys instead
+// of a code. It returns a passkey ceremony token and the options to pass to
+// `navigator.credentials.get()`.
+func (ms *MFAService) BeginPasskeyChallenge(challengeToken string) (string, *protocol.CredentialAssertion, error) {
+	if ms.Passkeys == nil {
+		return "", nil, apperrors.ErrWebAuthnServiceIsNil
+	}
+	if challengeToken == "" {
+		return "", nil, apperrors.ErrMFAChallengeIsEmpty
+	}
+
+	challenge, err := ms.ChallengeRepo.GetChallenge(models.HashToken(challengeToken), ms.MaxChallengeAttempts)
+	if err != nil {
+		return "", nil, err
+	}
+	return ms.Passkeys.BeginSecondFactor(challenge.UserID)
+}
+
+// VerifyPasskeyChallenge checks a passkey's response against a login challenge and returns the ID
+// of the user it belongs to. It counts as an attempt against the challenge just like a code.
+func (ms *MFAService) VerifyPasskeyChallenge(challengeToken string, ceremonyToken string, response []byte) (uuid.UUID, error) {
+	if ms.Passkeys == nil {
+		return uuid.Nil, apperrors.ErrWebAuthnServiceIsNil
+	}
+	if challengeToken == "" {
+		return uuid.Nil, apperrors.ErrMFAChallengeIsEmpty
+	}
+
+	challenge, err := ms.ChallengeRepo.RecordAttempt(models.HashToken(challengeToken), ms.MaxChallengeAttempts)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := ms.Passkeys.FinishSecondFactor(challenge.UserID, ceremonyToken, response); err != nil {
+		log.Info().
+			Str("userID", challenge.UserID.String()).
+			Int("attempts", challenge.Attempts).
+			Msg("Invalid second factor passkey")
+		return uuid.Nil, err
+	}
+
+	// Delete the challenge before handing out a session so it can't be exchanged twice
+	if err := ms.ChallengeRepo.DeleteChallenge(challenge.ID); err != nil {
+		return uuid.Nil, err
+	}
+	return challenge.UserID, nil
+}
+
+// checkSecondFactorIfEnabled verifies a code with `checkSecondFactor` if the user has a confirmed
+// second factor
+func (ms *MFAService) checkSecondFactorIfEnabled(userID string, code string) error {
+	cred, err := ms.TOTPRepo.GetCredentialByUserID(userID)
+	if errors.Is(err, apperrors.ErrMFANotEnrolled) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !cred.IsConfirmed() {
+		return nil
+	}
+	if code == "" {
+		return apperrors.ErrMFACodeIsEmpty
+	}
+	return ms.checkSecondFactor(cred, code)
+}
+
+// checkSecondFactor verifies a code for a confirmed credential unless the user is locked out,
+// counting a wrong code as a failed login attempt
+func (ms *MFAService) checkSecondFactor(cred *models.TOTPCredential, code string) error {
+	user, err := ms.UserRepo.GetUserByID(cred.UserID.String())
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if user.IsLocked(now) {
+		return apperrors.ErrAccountIsLocked
+	}
+
+	err = ms.verifySecondFactor(cred, code)
+	if errors.Is(err, apperrors.ErrInvalidMFACode) {
+		if err := ms.Lockout.RecordFailure(ms.UserRepo, user, now); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// verifySecondFactor accepts either a code from the authenticator or an unused recovery code for
+// a confirmed credential. Either way the code can't be used again.
+func (ms *MFAService) verifySecondFactor(cred *models.TOTPCredential, code string) error {
+	if isTOTPCode(code) {
+		return ms.useTOTP(cred, code)
+	}
+	return ms.useRecoveryCode(cred.UserID, code)
+}
+
+// useRecoveryCode checks a code against a user's unused recovery codes and marks the match used
+func (ms *MFAService) useRecoveryCode(userID uuid.UUID, code string) error {
+	codes, err := ms.RecoveryRepo.GetUnusedCodes(userID.String())
+	if err != nil {
+		return err
+	}
+	for _, rc := range codes {
+		if !rc.Matches(code) {
+			continue
+		}
+		if err := ms.RecoveryRepo.MarkCodeUsed(rc.ID); err != nil {
+			return err
+		}
+		ms.record(userID, models.SecurityEventRecoveryCodeUsed, fmt.Sprintf("%d recovery codes left", len(codes)-1))
+		return nil
+	}
+	return apperrors.ErrInvalidMFACode
+}
+
+// replaceRecoveryCodes generates, stores and returns a new set of recovery codes for a user,
+// invalidating any old ones
+func (ms *MFAService) replaceRecoveryCodes(userID uuid.UUID) ([]string, error) {
+	codes, err := models.GenerateRecoveryCodes(config.RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashed := make([]*models.RecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		rc, err := models.NewRecoveryCode(userID, code)
+		if err != nil {
+			return nil, err
+		}
+		hashed = append(hashed, rc)
+	}
+	if err := ms.RecoveryRepo.ReplaceCodes(userID, hashed); err != nil {
+		return nil, err
+	}
+	ms.record(userID, models.SecurityEventRecoveryCodesGenerated, "")
+	return codes, nil
+}
+
+// record adds an event to the user's security activity if auditing is configured
+func (ms *MFAService) record(userID uuid.UUID, eventType models.SecurityEventType, detail string) {
+	if ms.Audit == nil {
+		return
+	}
+	ms.Audit.Record(userID, eventType, detail)
+}
+
+// isTOTPCode reports whether a code looks like it came from an authenticator rather than being a
+// recovery code
+func isTOTPCode(code string) bool {
+	code = strings.TrimSpace(code)
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// useTOTP validates a code against a confirmed credential and marks its time step as used
+func (ms *MFAService) useTOTP(cred *models.TOTPCredential, code string) error {
+	step, err := ms.validateTOTP(cred, code)
+	if err != nil {
+		return err
+	}
+	return ms.TOTPRepo.UseStep(cred.UserID.String(), step)
+}
+
+// validateTOTP decrypts a credential's secret and checks a code against it, returning the time
+// step the code belongs to
+func (ms *MFAService) validateTOTP(cred *models.TOTPCredential, code string) (int64, error) {
+	secret, err := secretbox.Open(ms.EncryptionKey, cred.EncryptedSecret)
+	if err != nil {
+		return 0, err
+	}
+	step, ok, err := totp.Validate(string(secret), code, time.Now(), config.TOTPSkew)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, apperrors.ErrInvalidMFACode
+	}
+	return step, nil
+}
@@ -0,0 +1,480 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/services"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+	"godiscauth/pkg/secretbox"
+	"godiscauth/pkg/totp"
+)
+
+// TestMFAService_NewMFAService tests the creation of a new MFAService
+func TestMFAService_NewMFAService(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("returns err with nil repos", func(t *testing.T) {
+		ur := repository.NewMemoryUserStore()
+		tr := repository.NewMemoryTOTPStore()
+		cr := repository.NewMemoryMFAChallengeStore()
+
+		_, err := services.NewMFAService(nil, tr, cr, nil, testutils.TestConfig())
+		is.Equal(err, apperrors.ErrUserRepoIsNil)
+		_, err = services.NewMFAService(ur, nil, cr, nil, testutils.TestConfig())
+		is.Equal(err, apperrors.ErrTOTPRepoIsNil)
+		_, err = services.NewMFAService(ur, tr, nil, nil, testutils.TestConfig())
+		is.Equal(err, apperrors.ErrChallengeRepoIsNil)
+		_, err = services.NewMFAService(ur, tr, cr, nil, testutils.TestConfig())
+		is.Equal(err, apperrors.ErrRecoveryRepoIsNil)
+	})
+}
+
+// TestMFAService_Enrollment tests TOTP enrollment, confirmation and removal
+func TestMFAService_Enrollment(t *testing.T) {
+	is := is.New(t)
+
+	email := "testMFAEnrollment@test.com"
+
+	t.Run("enroll returns a usable secret that is stored encrypted", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+
+		secret, uri, err := us.MFA.EnrollTOTP(userID)
+		is.NoErr(err)
+		is.Equal(uri, totp.URI(us.MFA.Issuer, email, secret))
+
+		cred, err := us.MFA.TOTPRepo.GetCredentialByUserID(userID)
+		is.NoErr(err)
+		is.True(!cred.IsConfirmed())
+		is.True(cred.EncryptedSecret != secret)
+		opened, err := secretbox.Open(us.MFA.EncryptionKey, cred.EncryptedSecret)
+		is.NoErr(err)
+		is.Equal(string(opened), secret)
+
+		// Unconfirmed enrollment doesn't affect login
+		enabled, err := us.MFA.IsEnabled(userID)
+		is.NoErr(err)
+		is.True(!enabled)
+	})
+
+	t.Run("confirm enables two-factor authentication", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+
+		secret, _, err := us.MFA.EnrollTOTP(userID)
+		is.NoErr(err)
+
+		_, err = us.MFA.ConfirmTOTP(userID, "000000")
+		is.Equal(err, apperrors.ErrInvalidMFACode)
+
+		recoveryCodes, err := us.MFA.ConfirmTOTP(userID, totpCode(t, secret, 0))
+		is.NoErr(err)
+		is.Equal(len(recoveryCodes), config.RecoveryCodeCount)
+		enabled, err := us.MFA.IsEnabled(userID)
+		is.NoErr(err)
+		is.True(enabled)
+
+		// Can't enroll again without disabling first
+		_, _, err = us.MFA.EnrollTOTP(userID)
+		is.Equal(err, apperrors.ErrMFAAlreadyEnabled)
+		_, err = us.MFA.ConfirmTOTP(userID, totpCode(t, secret, 1))
+		is.Equal(err, apperrors.ErrMFAAlreadyEnabled)
+	})
+
+	t.Run("re-enrolling before confirmation replaces the secret", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+
+		first, _, err := us.MFA.EnrollTOTP(userID)
+		is.NoErr(err)
+		second, _, err := us.MFA.EnrollTOTP(userID)
+		is.NoErr(err)
+		is.True(first != second)
+
+		_, err = us.MFA.ConfirmTOTP(userID, totpCode(t, second, 0))
+		is.NoErr(err)
+	})
+
+	t.Run("confirm without enrollment fails", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+
+		_, err := us.MFA.ConfirmTOTP(userID, "123456")
+		is.Equal(err, apperrors.ErrMFANotEnrolled)
+	})
+
+	t.Run("disable requires a valid code once confirmed", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+		secret, _ := enableTOTP(t, us, userID)
+
+		err := us.MFA.DisableTOTP(userID, "")
+		is.Equal(err, apperrors.ErrInvalidMFACode)
+
+		err = us.MFA.DisableTOTP(userID, totpCode(t, secret, 0))
+		is.NoErr(err)
+		enabled, err := us.MFA.IsEnabled(userID)
+		is.NoErr(err)
+		is.True(!enabled)
+
+		// Recovery codes go with it
+		remaining, err := us.MFA.RemainingRecoveryCodes(userID)
+		is.NoErr(err)
+		is.Equal(remaining, int64(0))
+	})
+
+	t.Run("wrong codes to disable lock the account", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+		secret, _ := enableTOTP(t, us, userID)
+		us.MFA.Lockout.MaxAttempts = 2
+
+		for range 2 {
+			err := us.MFA.DisableTOTP(userID, "000000")
+			is.Equal(err, apperrors.ErrInvalidMFACode)
+		}
+		err := us.MFA.DisableTOTP(userID, totpCode(t, secret, 0))
+		is.Equal(err, apperrors.ErrAccountIsLocked)
+		_, err = us.MFA.RegenerateRecoveryCodes(userID, totpCode(t, secret, 0))
+		is.Equal(err, apperrors.ErrAccountIsLocked)
+
+		enabled, err := us.MFA.IsEnabled(userID)
+		is.NoErr(err)
+		is.True(enabled)
+	})
+
+	t.Run("enrollment fails without an encryption key", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+		us.MFA.EncryptionKey = ""
+
+		_, _, err := us.MFA.EnrollTOTP(userID)
+		is.Equal(err, apperrors.ErrEncryptionKeyIsEmpty)
+	})
+}
+
+// TestMFAService_Login tests the two-step login for users with TOTP enabled
+func TestMFAService_Login(t *testing.T) {
+	is := is.New(t)
+
+	email := "testMFALogin@test.com"
+
+	t.Run("login without second factor returns a session", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		registerTestUser(t, us, email)
+
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		is.True(result.SessionToken != "")
+		is.Equal(result.MFAChallenge, "")
+	})
+
+	t.Run("login with second factor returns a challenge", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+		secret, _ := enableTOTP(t, us, userID)
+
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		is.Equal(result.SessionToken, "")
+		is.True(result.MFAChallenge != "")
+
+		token, err := us.CompleteMFALogin(result.MFAChallenge, totpCode(t, secret, 0), models.ClientInfo{})
+		is.NoErr(err)
+
+		// Session records that MFA was used
+		session := sessionFromToken(t, us, token)
+		is.True(session.MFA)
+
+		// The session keeps the flag when rotated
+		rotated, _, err := us.RotateSession(session.ID)
+		is.NoErr(err)
+		is.True(sessionFromToken(t, us, rotated).MFA)
+	})
+
+	t.Run("challenge is single use", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+		secret, _ := enableTOTP(t, us, userID)
+
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		_, err = us.CompleteMFALogin(result.MFAChallenge, totpCode(t, secret, 0), models.ClientInfo{})
+		is.NoErr(err)
+		_, err = us.CompleteMFALogin(result.MFAChallenge, totpCode(t, secret, 1), models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+	})
+
+	t.Run("codes can't be replayed", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+		secret, _ := enableTOTP(t, us, userID)
+		code := totpCode(t, secret, 0)
+
+		first, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		_, err = us.CompleteMFALogin(first.MFAChallenge, code, models.ClientInfo{})
+		is.NoErr(err)
+
+		second, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		_, err = us.CompleteMFALogin(second.MFAChallenge, code, models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidMFACode)
+	})
+
+	t.Run("challenge is discarded after too many wrong codes", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+		secret, _ := enableTOTP(t, us, userID)
+
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		for range us.MFA.MaxChallengeAttempts {
+			_, err = us.CompleteMFALogin(result.MFAChallenge, "000000", models.ClientInfo{})
+			is.Equal(err, apperrors.ErrInvalidMFACode)
+		}
+		_, err = us.CompleteMFALogin(result.MFAChallenge, totpCode(t, secret, 0), models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+	})
+
+	t.Run("wrong codes count towards the account lock across challenges", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+		secret, _ := enableTOTP(t, us, userID)
+		us.MFA.Lockout.MaxAttempts = 3
+
+		first, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		for range 2 {
+			_, err = us.CompleteMFALogin(first.MFAChallenge, "000000", models.ClientInfo{})
+			is.Equal(err, apperrors.ErrInvalidMFACode)
+		}
+
+		// A fresh challenge doesn't reset the count
+		second, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		_, err = us.CompleteMFALogin(second.MFAChallenge, "000000", models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidMFACode)
+
+		// Locked now: neither a valid code nor a new challenge gets in
+		_, err = us.CompleteMFALogin(second.MFAChallenge, totpCode(t, secret, 0), models.ClientInfo{})
+		is.Equal(err, apperrors.ErrAccountIsLocked)
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.Equal(err, apperrors.ErrAccountIsLocked)
+	})
+
+	t.Run("a correct password alone doesn't reset failed attempts", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+		secret, _ := enableTOTP(t, us, userID)
+		us.Lockout.MaxAttempts = 3
+
+		for range 2 {
+			_, err := us.LoginUser(email, "wrong password", models.ClientInfo{})
+			is.Equal(err, apperrors.ErrInvalidLogin)
+		}
+		_, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		_, err = us.LoginUser(email, "wrong password", models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidLogin)
+
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.Equal(err, apperrors.ErrAccountIsLocked)
+		user, err := us.UserRepo.GetUserByID(userID)
+		is.NoErr(err)
+		is.Equal(user.LockoutCount, 1)
+
+		// Completing the second factor does reset them
+		is.NoErr(us.UserRepo.UnlockAccount(userID))
+		_, err = us.LoginUser(email, "wrong password", models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidLogin)
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		_, err = us.CompleteMFALogin(result.MFAChallenge, totpCode(t, secret, 0), models.ClientInfo{})
+		is.NoErr(err)
+		user, err = us.UserRepo.GetUserByID(userID)
+		is.NoErr(err)
+		is.Equal(user.FailedLoginAttempts, 0)
+	})
+
+	t.Run("expired challenge is rejected", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+		secret, _ := enableTOTP(t, us, userID)
+		us.MFA.ChallengeExpiration = -time.Minute
+
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		_, err = us.CompleteMFALogin(result.MFAChallenge, totpCode(t, secret, 0), models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+	})
+
+	t.Run("unknown challenge is rejected", func(t *testing.T) {
+		us := setupMFAUserService(t)
+
+		challenge, _, err := models.GenerateToken()
+		is.NoErr(err)
+		_, err = us.CompleteMFALogin(challenge, "123456", models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+	})
+}
+
+// TestMFAService_RecoveryCodes tests recovery codes as a stand-in for the authenticator
+func TestMFAService_RecoveryCodes(t *testing.T) {
+	is := is.New(t)
+
+	email := "testMFARecoveryCodes@test.com"
+
+	t.Run("recovery code completes login once", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+		_, recoveryCodes := enableTOTP(t, us, userID)
+
+		// Codes are stored hashed
+		stored, err := us.MFA.RecoveryRepo.GetUnusedCodes(userID)
+		is.NoErr(err)
+		is.Equal(len(stored), config.RecoveryCodeCount)
+		for _, rc := range stored {
+			is.True(rc.CodeHash != recoveryCodes[0])
+		}
+
+		// Typed without the separator and in upper case
+		typed := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		token, err := us.CompleteMFALogin(result.MFAChallenge, typed, models.ClientInfo{})
+		is.NoErr(err)
+		is.True(sessionFromToken(t, us, token).MFA)
+
+		remaining, err := us.MFA.RemainingRecoveryCodes(userID)
+		is.NoErr(err)
+		is.Equal(remaining, int64(config.RecoveryCodeCount-1))
+
+		// The same code can't be used twice
+		result, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		_, err = us.CompleteMFALogin(result.MFAChallenge, recoveryCodes[0], models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidMFACode)
+
+		// Use is in the security activity
+		events, err := us.MFA.Audit.ListActivity(userID)
+		is.NoErr(err)
+		is.Equal(events[0].Type, models.SecurityEventRecoveryCodeUsed)
+	})
+
+	t.Run("regenerating invalidates old codes", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+		secret, oldCodes := enableTOTP(t, us, userID)
+
+		_, err := us.MFA.RegenerateRecoveryCodes(userID, "000000")
+		is.Equal(err, apperrors.ErrInvalidMFACode)
+
+		newCodes, err := us.MFA.RegenerateRecoveryCodes(userID, totpCode(t, secret, 0))
+		is.NoErr(err)
+		is.Equal(len(newCodes), config.RecoveryCodeCount)
+
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		_, err = us.CompleteMFALogin(result.MFAChallenge, oldCodes[0], models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidMFACode)
+		_, err = us.CompleteMFALogin(result.MFAChallenge, newCodes[0], models.ClientInfo{})
+		is.NoErr(err)
+	})
+
+	t.Run("regenerating requires two-factor authentication", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		userID := registerTestUser(t, us, email)
+
+		_, err := us.MFA.RegenerateRecoveryCodes(userID, "123456")
+		is.Equal(err, apperrors.ErrMFANotEnrolled)
+	})
+}
+
+// totpCode returns the TOTP code for `secret` at the current time step plus `offset`. Codes are
+// single-use, so tests that need several codes use different offsets within `config.TOTPSkew`.
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+
+	code, err := totp.CodeAt(secret, totp.Step(time.Now())+offset)
+	if err != nil {
+		t.Fatalf("failed to generate TOTP code: %v", err)
+	}
+	return code
+}
+
+// enableTOTP enrolls and confirms TOTP for a user with a code from the previous time step, leaving
+// the current and next steps free for the test. Returns the secret and the recovery codes.
+func enableTOTP(t *testing.T, us *services.UserService, userID string) (string, []string) {
+	t.Helper()
+
+	secret, _, err := us.MFA.EnrollTOTP(userID)
+	if err != nil {
+		t.Fatalf("failed to enroll TOTP: %v", err)
+	}
+	recoveryCodes, err := us.MFA.ConfirmTOTP(userID, totpCode(t, secret, -1))
+	if err != nil {
+		t.Fatalf("failed to confirm TOTP: %v", err)
+	}
+	return secret, recoveryCodes
+}
+
+// registerTestUser registers a user with `testutils.TestingPassword` and returns their ID
+func registerTestUser(t *testing.T, us *services.UserService, email string) string {
+	t.Helper()
+
+	if err := us.RegisterUser(email, testutils.TestingPassword); err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+	user, err := us.UserRepo.GetUserByEmail(email)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	return user.ID.String()
+}
+
+// sessionFromToken loads the session a session token refers to
+func sessionFromToken(t *testing.T, us *services.UserService, token string) *models.Session {
+	t.Helper()
+
+	tokenHash, err := models.ParseSessionToken(testutils.TestSessionKeys(), token)
+	if err != nil {
+		t.Fatalf("failed to parse session token: %v", err)
+	}
+	session, err := us.SessionRepo.GetUnexpiredSessionByTokenHash(tokenHash)
+	if err != nil {
+		t.Fatalf("failed to get session: %v", err)
+	}
+	return session
+}
+
+func setupMFAUserService(t *testing.T) *services.UserService {
+	t.Helper()
+
+	us := setupUserService(t)
+	as, err := services.NewAuditService(repository.NewMemorySecurityEventStore())
+	if err != nil {
+		t.Fatalf("failed to create audit service: %v", err)
+	}
+	ms, err := services.NewMFAService(
+		us.UserRepo,
+		repository.NewMemoryTOTPStore(),
+		repository.NewMemoryMFAChallengeStore(),
+		repository.NewMemoryRecoveryCodeStore(),
+		testutils.TestConfig(),
+	)
+	if err != nil {
+		t.Fatalf("failed to create MFA service: %v", err)
+	}
+	ms.Audit = as
+	us.MFA = ms
+	return us
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/mailer"
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// PasswordResetService contains the repositories and mailer needed to let users who forgot their
+// password set a new one
+type PasswordResetService struct {
+	UserRepo    repository.UserStore
+	SessionRepo repository.SessionStore
+	ResetRepo   repository.PasswordResetStore
+	Mailer      mailer.Mailer
+	// ResetURL is the page that completes a reset. If empty, the bare token is mailed instead.
+	ResetURL string
+	// TokenExpiration is how long a reset token can be redeemed after it is issued
+	TokenExpiration time.Duration
+	// MinEntropyBits is the strength new passwords need
+	MinEntropyBits float64
+}
+
+// NewPasswordResetService returns a value of type PasswordResetService with the password policy of
+// cfg
+func NewPasswordResetService(
+	ur repository.UserStore,
+	sr repository.SessionStore,
+	prr repository.PasswordResetStore,
+	m mailer.Mailer,
+	cfg config.PasswordConfig,
+) (*PasswordResetService, error) {
+	if ur == nil {
+		return nil, apperrors.ErrUserRepoIsNil
+	}
+	if sr == nil {
+		return nil, apperrors.ErrSessionRepoIsNil
+	}
+	if prr == nil {
+		return nil, apperrors.ErrResetRepoIsNil
+	}
+	if m == nil {
+		return nil, apperrors.ErrMailerIsNil
+	}
+	return &PasswordResetService{
+		UserRepo:        ur,
+		SessionRepo:     sr,
+		ResetRepo:       prr,
+		Mailer:          m,
+		ResetURL:        cfg.ResetURL,
+		TokenExpiration: cfg.ResetExpiration,
+		MinEntropyBits:  cfg.MinEntropyBits,
+	}, nil
+}
+
+// RequestPasswordReset issues a new reset token for the user with the given email and mails it to
+// them, invalidating any earlier tokens. Unknown emails are not an error so that callers can't use
+// this to discover which emails are registered.
+func (prs *PasswordResetService) RequestPasswordReset(email string) error {
+	if email == "" {
+		return apperrors.ErrEmailIsEmpty
+	}
+
+	user, err := prs.UserRepo.GetUserByEmail(email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Info().Str("email", email).Msg("Password reset requested for unknown email")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Only the most recently mailed token should work
+	if err := prs.ResetRepo.DeleteTokensByUserID(user.ID.String()); err != nil {
+		return err
+	}
+
+	token, tokenHash, err := models.GenerateToken()
+	if err != nil {
+		return err
+	}
+	resetToken, err := models.NewPasswordResetToken(user.ID, tokenHash, time.Now().UTC().Add(prs.TokenExpiration))
+	if err != nil {
+		return err
+	}
+	if err := prs.ResetRepo.CreateToken(resetToken); err != nil {
+		return err
+	}
+
+	return prs.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    prs.resetEmailBody(token),
+	})
+}
+
+// ResetPassword redeems a reset token, sets the user's new password, lifts a lockout after failed
+// logins and logs the user out everywhere
+func (prs *PasswordResetService) ResetPassword(token, newPassword string) error {
+	if token == "" {
+		return apperrors.ErrResetTokenIsEmpty
+	}
+	if newPassword == "" {
+		return apperrors.ErrPasswordIsEmpty
+	}
+
+	// Validate the new password before redeeming the token so a weak password doesn't burn it
+	hashedPassword, err := hashPassword(newPassword, prs.MinEntropyBits)
+	if err != nil {
+		return err
+	}
+
+	resetToken, err := prs.ResetRepo.ConsumeToken(models.HashToken(token))
+	if err != nil {
+		return err
+	}
+	userID := resetToken.UserID.String()
+
+	if err := prs.UserRepo.UpdateUser(userID, map[string]any{"password": hashedPassword}); err != nil {
+		return err
+	}
+
+	// The user just proved they own the account's email, so a brute force lockout no longer applies.
+	// A lock set by an operator stays.
+	if err := prs.UserRepo.ClearLockout(userID); err != nil {
+		return err
+	}
+
+	// Sessions started with the old password may belong to whoever the user is locking out
+	if err := prs.SessionRepo.DeleteSessionsByUserID(userID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return prs.ResetRepo.DeleteTokensByUserID(userID)
+}
+
+// resetEmailBody renders the body of a password reset email
+func (prs *PasswordResetService) resetEmailBody(token string) string {
+	instructions := fmt.Sprintf("Use this password reset token to choose a new password:\n\n%s", token)
+	if prs.ResetURL != "" {
+		instructions = fmt.Sprintf(
+			"Follow this link to choose a new password:\n\n%s?token=%s",
+			prs.ResetURL,
+			url.QueryEscape(token),
+		)
+	}
+
+	return fmt.Sprintf(
+		"Someone asked to reset the password for your account.\n\n%s\n\n"+
+			"This expires in %s and can only be used once. "+
+			"If you didn't ask to reset your password, you can ignore this email.\n",
+		instructions,
+		prs.TokenExpiration,
+	)
+}
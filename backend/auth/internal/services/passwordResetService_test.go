@@ -0,0 +1,215 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/services"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestPasswordResetService_NewPasswordResetService tests the creation of a new PasswordResetService
+func TestPasswordResetService_NewPasswordResetService(t *testing.T) {
+	is := is.New(t)
+	ur := repository.NewMemoryUserStore()
+	sr := repository.NewMemorySessionStore()
+	prr := repository.NewMemoryPasswordResetStore()
+
+	t.Run("returns err with nil reset repo", func(t *testing.T) {
+		prs, err := services.NewPasswordResetService(ur, sr, nil, &testutils.MockMailer{}, testutils.TestConfig().Passwords)
+		is.Equal(prs, nil)
+		is.Equal(err, apperrors.ErrResetRepoIsNil)
+	})
+
+	t.Run("returns err with nil mailer", func(t *testing.T) {
+		prs, err := services.NewPasswordResetService(ur, sr, prr, nil, testutils.TestConfig().Passwords)
+		is.Equal(prs, nil)
+		is.Equal(err, apperrors.ErrMailerIsNil)
+	})
+
+	t.Run("creates password reset service", func(t *testing.T) {
+		prs, _, _ := setupPasswordResetService(t)
+		is.True(prs != nil)
+	})
+}
+
+// TestPasswordResetService_RequestPasswordReset tests that reset tokens are issued and mailed
+func TestPasswordResetService_RequestPasswordReset(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("empty email", func(t *testing.T) {
+		prs, _, _ := setupPasswordResetService(t)
+		err := prs.RequestPasswordReset("")
+		is.Equal(err, apperrors.ErrEmailIsEmpty)
+	})
+
+	t.Run("unknown email sends nothing", func(t *testing.T) {
+		prs, _, m := setupPasswordResetService(t)
+		err := prs.RequestPasswordReset("doesNotExist@test.com")
+		is.NoErr(err)
+		is.Equal(len(m.Messages), 0)
+	})
+
+	t.Run("mails token to user", func(t *testing.T) {
+		prs, us, m := setupPasswordResetService(t)
+		email := "testRequestPasswordReset@test.com"
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+
+		err = prs.RequestPasswordReset(email)
+		is.NoErr(err)
+
+		msg, ok := m.Last()
+		is.True(ok)
+		is.Equal(msg.To, email)
+		is.True(testutils.ExtractToken(msg.Body) != "")
+	})
+
+	t.Run("links to reset page when configured", func(t *testing.T) {
+		prs, us, m := setupPasswordResetService(t)
+		prs.ResetURL = "https://discussion.test/reset"
+		email := "testRequestPasswordResetURL@test.com"
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+
+		err = prs.RequestPasswordReset(email)
+		is.NoErr(err)
+
+		msg, _ := m.Last()
+		is.True(strings.Contains(msg.Body, "https://discussion.test/reset?token="+testutils.ExtractToken(msg.Body)))
+	})
+
+	t.Run("new request invalidates earlier token", func(t *testing.T) {
+		prs, us, m := setupPasswordResetService(t)
+		email := "testRequestPasswordResetTwice@test.com"
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+
+		err = prs.RequestPasswordReset(email)
+		is.NoErr(err)
+		firstMsg, _ := m.Last()
+		err = prs.RequestPasswordReset(email)
+		is.NoErr(err)
+
+		err = prs.ResetPassword(testutils.ExtractToken(firstMsg.Body), "new"+testutils.TestingPassword)
+		is.Equal(err, apperrors.ErrInvalidResetToken)
+	})
+}
+
+// TestPasswordResetService_ResetPassword tests that a reset token can be redeemed for a new password
+func TestPasswordResetService_ResetPassword(t *testing.T) {
+	is := is.New(t)
+
+	newPassword := "new" + testutils.TestingPassword
+
+	t.Run("empty token", func(t *testing.T) {
+		prs, _, _ := setupPasswordResetService(t)
+		err := prs.ResetPassword("", newPassword)
+		is.Equal(err, apperrors.ErrResetTokenIsEmpty)
+	})
+
+	t.Run("empty password", func(t *testing.T) {
+		prs, _, _ := setupPasswordResetService(t)
+		err := prs.ResetPassword("token", "")
+		is.Equal(err, apperrors.ErrPasswordIsEmpty)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		prs, _, _ := setupPasswordResetService(t)
+		err := prs.ResetPassword("notARealToken", newPassword)
+		is.Equal(err, apperrors.ErrInvalidResetToken)
+	})
+
+	t.Run("resets password and invalidates sessions", func(t *testing.T) {
+		prs, us, m := setupPasswordResetService(t)
+		email := "testResetPassword@test.com"
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+		user, err := us.UserRepo.GetUserByEmail(email)
+		is.NoErr(err)
+
+		// Log in and lock the account
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		err = us.UserRepo.LockAccount(user.ID.String(), time.Now().Add(time.Hour))
+		is.NoErr(err)
+
+		err = prs.RequestPasswordReset(email)
+		is.NoErr(err)
+		msg, _ := m.Last()
+		token := testutils.ExtractToken(msg.Body)
+
+		err = prs.ResetPassword(token, newPassword)
+		is.NoErr(err)
+
+		// Existing sessions are gone
+		err = us.SessionRepo.DeleteSessionsByUserID(user.ID.String())
+		is.Equal(err, gorm.ErrRecordNotFound)
+
+		// Old password no longer works, new password does and the lock is lifted
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidLogin)
+		_, err = us.LoginUser(email, newPassword, models.ClientInfo{})
+		is.NoErr(err)
+
+		// Token is single use
+		err = prs.ResetPassword(token, "another"+newPassword)
+		is.Equal(err, apperrors.ErrInvalidResetToken)
+	})
+
+	t.Run("reset keeps an operator's lock", func(t *testing.T) {
+		prs, us, m := setupPasswordResetService(t)
+		email := "testResetPasswordAdminLock@test.com"
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+		user, err := us.UserRepo.GetUserByEmail(email)
+		is.NoErr(err)
+		is.NoErr(us.LockUser(user.ID.String(), nil))
+
+		err = prs.RequestPasswordReset(email)
+		is.NoErr(err)
+		msg, _ := m.Last()
+		err = prs.ResetPassword(testutils.ExtractToken(msg.Body), newPassword)
+		is.NoErr(err)
+
+		_, err = us.LoginUser(email, newPassword, models.ClientInfo{})
+		is.Equal(err, apperrors.ErrAccountIsLocked)
+	})
+
+	t.Run("weak password does not burn token", func(t *testing.T) {
+		prs, us, m := setupPasswordResetService(t)
+		email := "testResetPasswordWeak@test.com"
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+
+		err = prs.RequestPasswordReset(email)
+		is.NoErr(err)
+		msg, _ := m.Last()
+		token := testutils.ExtractToken(msg.Body)
+
+		err = prs.ResetPassword(token, "short")
+		is.True(err != nil)
+
+		err = prs.ResetPassword(token, newPassword)
+		is.NoErr(err)
+	})
+}
+
+func setupPasswordResetService(t *testing.T) (*services.PasswordResetService, *services.UserService, *testutils.MockMailer) {
+	t.Helper()
+
+	us := setupUserService(t)
+	m := &testutils.MockMailer{}
+	prs, err := services.NewPasswordResetService(us.UserRepo, us.SessionRepo, repository.NewMemoryPasswordResetStore(), m, testutils.TestConfig().Passwords)
+	if err != nil {
+		t.Fatalf("failed to create password reset service: %v", err)
+	}
+	return prs, us, m
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"fmt"
+
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// SessionLimitPolicy decides what happens when a user with the maximum number of active sessions
+// logs in again
+type SessionLimitPolicy string
+
+const (
+	// SessionLimitEvictOldest ends the session the user logged in to longest ago
+	SessionLimitEvictOldest SessionLimitPolicy = "evict-oldest"
+	// SessionLimitReject refuses the new login
+	SessionLimitReject SessionLimitPolicy = "reject"
+)
+
+// SessionLimit caps the number of active sessions per user
+type SessionLimit struct {
+	// Max is the number of active sessions a user can have. Zero means no limit.
+	Max int
+	// Policy decides what a login over the limit does
+	Policy SessionLimitPolicy
+}
+
+// SessionLimitFromConfig returns the session limit configured by `cfg.MaxSessions` and
+// `cfg.LimitPolicy`. An empty policy selects evicting the oldest session.
+func SessionLimitFromConfig(cfg config.SessionConfig) (SessionLimit, error) {
+	if cfg.MaxSessions < 0 {
+		return SessionLimit{}, fmt.Errorf("%w: %d", apperrors.ErrInvalidMaxSessions, cfg.MaxSessions)
+	}
+	limit := SessionLimit{Max: cfg.MaxSessions, Policy: SessionLimitEvictOldest}
+	switch p := SessionLimitPolicy(cfg.LimitPolicy); p {
+	case "":
+	case SessionLimitEvictOldest, SessionLimitReject:
+		limit.Policy = p
+	default:
+		return SessionLimit{}, fmt.Errorf("%w: %q", apperrors.ErrUnknownSessionLimitPolicy, cfg.LimitPolicy)
+	}
+	return limit, nil
+}
@@ -0,0 +1,35 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/services"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// TestSessionLimit_SessionLimitFromConfig tests building the session limit from the config
+func TestSessionLimit_SessionLimitFromConfig(t *testing.T) {
+	is := is.New(t)
+
+	limit, err := services.SessionLimitFromConfig(config.Default().Sessions)
+	is.NoErr(err)
+	is.Equal(limit, services.SessionLimit{Max: config.Default().Sessions.MaxSessions, Policy: services.SessionLimitEvictOldest})
+
+	limit, err = services.SessionLimitFromConfig(config.SessionConfig{MaxSessions: 3, LimitPolicy: "reject"})
+	is.NoErr(err)
+	is.Equal(limit, services.SessionLimit{Max: 3, Policy: services.SessionLimitReject})
+
+	limit, err = services.SessionLimitFromConfig(config.SessionConfig{MaxSessions: 0, LimitPolicy: ""})
+	is.NoErr(err)
+	is.Equal(limit, services.SessionLimit{Max: 0, Policy: services.SessionLimitEvictOldest})
+
+	_, err = services.SessionLimitFromConfig(config.SessionConfig{MaxSessions: -1})
+	is.True(errors.Is(err, apperrors.ErrInvalidMaxSessions))
+
+	_, err = services.SessionLimitFromConfig(config.SessionConfig{LimitPolicy: "evict-newest"})
+	is.True(errors.Is(err, apperrors.ErrUnknownSessionLimitPolicy))
+}
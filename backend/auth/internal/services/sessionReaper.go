@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"godiscauth/internal/metrics"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// ReaperStatus describes the runs of a SessionReaper so far
+type ReaperStatus struct {
+	// Runs is the number of finished runs
+	Runs int64
+	// LastRunAt is when the last run started, zero before the first run
+	LastRunAt time.Time
+	// LastDuration is how long the last run took
+	LastDuration time.Duration
+	// LastDeleted is the number of sessions the last run deleted
+	LastDeleted int64
+	// TotalDeleted is the number of sessions deleted by all runs
+	TotalDeleted int64
+	// LastError ended the last run early. Nil if it deleted every expired session.
+	LastError error
+}
+
+// SessionReaper deletes expired sessions, which are never used again but are otherwise kept
+// forever. Each run deletes them in batches so a large backlog doesn't lock the table for long.
+type SessionReaper struct {
+	SessionRepo repository.SessionStore
+	// Interval is the time between runs started by `Run`
+	Interval time.Duration
+	// BatchSize is the maximum number of sessions deleted per statement
+	BatchSize int
+
+	mu     sync.Mutex
+	status ReaperStatus
+}
+
+// NewSessionReaper returns a SessionReaper with the reap interval and batch size of cfg
+func NewSessionReaper(sr repository.SessionStore, cfg config.SessionConfig) (*SessionReaper, error) {
+	if sr == nil {
+		return nil, apperrors.ErrSessionRepoIsNil
+	}
+	return &SessionReaper{
+		SessionRepo: sr,
+		Interval:    cfg.ReapInterval,
+		BatchSize:   cfg.ReapBatchSize,
+	}, nil
+}
+
+// Reap deletes the sessions that have expired, batch by batch until none are left or ctx is done,
+// and returns how many were deleted
+func (r *SessionReaper) Reap(ctx context.Context) (int64, error) {
+	start := time.Now()
+	var deleted int64
+	var err error
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var n int64
+		n, err = r.SessionRepo.DeleteExpiredSessions(start.UTC(), r.BatchSize)
+		deleted += n
+		if err != nil || n < int64(r.BatchSize) {
+			break
+		}
+	}
+
+	r.mu.Lock()
+	r.status.Runs++
+	r.status.LastRunAt = start
+	r.status.LastDuration = time.Since(start)
+	r.status.LastDeleted = deleted
+	r.status.TotalDeleted += deleted
+	r.status.LastError = err
+	r.mu.Unlock()
+
+	return deleted, err
+}
+
+// Run reaps expired sessions right away and then every interval until ctx is done, updating the
+// active sessions metric after each run. A batch in progress is finished before it returns.
+func (r *SessionReaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := r.Reap(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Int64("deleted", deleted).Msg("Failed to reap expired sessions")
+		} else if deleted > 0 {
+			log.Info().Int64("deleted", deleted).Msg("Reaped expired sessions")
+		}
+		if ctx.Err() == nil {
+			r.countActiveSessions()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// countActiveSessions sets the active sessions metric. It is counted here rather than at every
+// scrape since counting the sessions of all users is expensive in some stores.
+func (r *SessionReaper) countActiveSessions() {
+	count, err := r.SessionRepo.CountUnexpiredSessions(time.Now().UTC())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to count active sessions")
+		return
+	}
+	metrics.ActiveSessions.Set(float64(count))
+}
+
+// Status returns the status of the reaper's runs so far
+func (r *SessionReaper) Status() ReaperStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Check fails if the last run failed, or if no run has finished for twice the interval. A reaper
+// that hasn't finished its first run yet is considered healthy.
+func (r *SessionReaper) Check(context.Context) error {
+	status := r.Status()
+	if status.LastError != nil {
+		return status.LastError
+	}
+	if status.Runs > 0 && time.Since(status.LastRunAt) > 2*r.Interval {
+		return fmt.Errorf("%w: last run at %s", apperrors.ErrReaperStalled, status.LastRunAt.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matryer/is"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"godiscauth/internal/metrics"
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/services"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestSessionReaper_NewSessionReaper tests the creation of a new SessionReaper
+func TestSessionReaper_NewSessionReaper(t *testing.T) {
+	is := is.New(t)
+
+	_, err := services.NewSessionReaper(nil, testutils.TestConfig().Sessions)
+	is.Equal(err, apperrors.ErrSessionRepoIsNil)
+}
+
+// TestSessionReaper_Reap tests that expired sessions are deleted in batches and the runs are
+// counted
+func TestSessionReaper_Reap(t *testing.T) {
+	is := is.New(t)
+	us := setupUserService(t)
+	reaper, err := services.NewSessionReaper(us.SessionRepo, testutils.TestConfig().Sessions)
+	is.NoErr(err)
+	reaper.BatchSize = 2
+
+	userID, err := uuid.Parse(registerTestUser(t, us, "testSessionReaperReap@test.com"))
+	is.NoErr(err)
+	createSessions := func(n int, expiresIn time.Duration) {
+		for range n {
+			session, err := models.NewSession(userID, models.HashSessionSecret(uuid.NewString()), time.Now().Add(expiresIn))
+			is.NoErr(err)
+			is.NoErr(us.SessionRepo.CreateSession(session))
+		}
+	}
+	createSessions(5, -time.Hour)
+	createSessions(1, time.Hour)
+
+	is.Equal(reaper.Status(), services.ReaperStatus{})
+
+	deleted, err := reaper.Reap(context.Background())
+	is.NoErr(err)
+	is.Equal(deleted, int64(5))
+	sessions, err := us.ListSessions(userID.String())
+	is.NoErr(err)
+	is.Equal(len(sessions), 1)
+
+	createSessions(1, -time.Hour)
+	deleted, err = reaper.Reap(context.Background())
+	is.NoErr(err)
+	is.Equal(deleted, int64(1))
+
+	status := reaper.Status()
+	is.Equal(status.Runs, int64(2))
+	is.Equal(status.LastDeleted, int64(1))
+	is.Equal(status.TotalDeleted, int64(6))
+	is.True(!status.LastRunAt.IsZero())
+	is.NoErr(status.LastError)
+
+	t.Run("stops when cancelled", func(t *testing.T) {
+		createSessions(1, -time.Hour)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		deleted, err := reaper.Reap(ctx)
+		is.Equal(err, context.Canceled)
+		is.Equal(deleted, int64(0))
+		is.Equal(reaper.Status().LastError, context.Canceled)
+	})
+
+	t.Run("runs until cancelled", func(t *testing.T) {
+		reaper.Interval = time.Hour
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			reaper.Run(ctx)
+			close(done)
+		}()
+
+		// The first run starts right away
+		for reaper.Status().Runs < 4 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("reaper didn't stop")
+		}
+		is.Equal(reaper.Status().LastDeleted, int64(1))
+
+		// Each run counts the sessions that are left for the metrics
+		is.Equal(testutil.ToFloat64(metrics.ActiveSessions), float64(1))
+	})
+}
+
+// TestSessionReaper_Check tests that the reaper is healthy until a run fails or it stops running
+func TestSessionReaper_Check(t *testing.T) {
+	is := is.New(t)
+	reaper, err := services.NewSessionReaper(repository.NewMemorySessionStore(), testutils.TestConfig().Sessions)
+	is.NoErr(err)
+
+	// Not run yet
+	is.NoErr(reaper.Check(context.Background()))
+
+	_, err = reaper.Reap(context.Background())
+	is.NoErr(err)
+	is.NoErr(reaper.Check(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = reaper.Reap(ctx)
+	is.Equal(reaper.Check(context.Background()), err)
+
+	_, err = reaper.Reap(context.Background())
+	is.NoErr(err)
+	reaper.Interval = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	is.True(errors.Is(reaper.Check(context.Background()), apperrors.ErrReaperStalled))
+}
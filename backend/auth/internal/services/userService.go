@@ -1,37 +1,93 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"net/mail"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	passwordvalidator "github.com/wagslane/go-password-validator"
+	"github.com/rs/zerolog/log"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 
+	"godiscauth/internal/metrics"
 	"godiscauth/internal/models"
 	"godiscauth/internal/repository"
 	"godiscauth/pkg/apperrors"
 	"godiscauth/pkg/config"
+	"godiscauth/pkg/keyring"
 )
 
 // UserService is a struct that contains the repositories needed for user-related operations
 type UserService struct {
-	UserRepo    *repository.UserRepository
-	SessionRepo *repository.SessionRepository
+	UserRepo    repository.UserStore
+	SessionRepo repository.SessionStore
+	// SessionKeys sign and verify session tokens
+	SessionKeys *keyring.KeyRing
+	// SessionPolicies decide how long sessions last
+	SessionPolicies models.SessionPolicies
+	// MinEntropyBits is the strength passwords need
+	MinEntropyBits float64
+	Lockout        LockoutPolicy
+	// SessionLimit caps the number of active sessions per user
+	SessionLimit SessionLimit
+	// Verifier mails verification tokens on registration and email changes. Optional.
+	Verifier *VerificationService
+	// VerificationPolicy decides whether unverified accounts can log in
+	VerificationPolicy VerificationPolicy
+	// MFA checks second factors for users who have enrolled one. Optional.
+	MFA *MFAService
+	// Passkeys lets users log in with a passkey instead of a password. Optional.
+	Passkeys *WebAuthnService
+	// Audit records sessions ended to make room under the session limit. Optional.
+	Audit *AuditService
 }
 
-// NewUserService returns a value of type UserService
-func NewUserService(ur *repository.UserRepository, sr *repository.SessionRepository) (*UserService, error) {
+// LoginResult is the outcome of a correct password. Exactly one field is set: SessionToken if the
+// user is logged in, or MFAChallenge if they still have to complete `CompleteMFALogin`.
+type LoginResult struct {
+	SessionToken string
+	MFAChallenge string
+}
+
+// NewUserService returns a value of type UserService that signs sessions with keys, under the
+// session, password, lockout and email verification policies of cfg
+func NewUserService(
+	ur repository.UserStore,
+	sr repository.SessionStore,
+	keys *keyring.KeyRing,
+	cfg *config.Config,
+) (*UserService, error) {
 	if ur == nil {
 		return nil, apperrors.ErrUserRepoIsNil
 	}
 	if sr == nil {
 		return nil, apperrors.ErrSessionRepoIsNil
 	}
+	if keys == nil {
+		return nil, apperrors.ErrSessionKeyMissing
+	}
+	if cfg == nil {
+		return nil, apperrors.ErrConfigIsNil
+	}
+	limit, err := SessionLimitFromConfig(cfg.Sessions)
+	if err != nil {
+		return nil, err
+	}
+	verificationPolicy, err := ParseVerificationPolicy(cfg.EmailVerification.Policy)
+	if err != nil {
+		return nil, err
+	}
 	return &UserService{
-		UserRepo:    ur,
-		SessionRepo: sr,
+		UserRepo:           ur,
+		SessionRepo:        sr,
+		SessionKeys:        keys,
+		SessionPolicies:    models.NewSessionPolicies(cfg.Sessions),
+		MinEntropyBits:     cfg.Passwords.MinEntropyBits,
+		Lockout:            LockoutPolicyFromConfig(cfg.Lockout),
+		SessionLimit:       limit,
+		VerificationPolicy: verificationPolicy,
 	}, nil
 }
 
@@ -45,94 +101,244 @@ func (us *UserService) RegisterUser(email, password string) error {
 		return apperrors.ErrPasswordIsEmpty
 	}
 
-	user, err := models.NewUser(email, password)
+	user, err := models.NewUser(email, password, us.MinEntropyBits)
 	if err != nil {
 		return err
 	}
-	return us.UserRepo.RegisterUser(user)
+	if err := us.UserRepo.RegisterUser(user); err != nil {
+		return err
+	}
+	metrics.Registrations.Inc()
+
+	us.sendVerification(user.ID.String())
+	return nil
 }
 
-// LoginUser authenticates a registered user and creates an associated session
-func (us *UserService) LoginUser(email, password string) (string, error) {
+// LoginUser authenticates a registered user and creates an associated session for the client.
+// Users with a second factor get a login challenge instead of a session. Users at the session
+// limit lose their oldest session or get `apperrors.ErrTooManySessions`, depending on its policy.
+func (us *UserService) LoginUser(email, password string, client models.ClientInfo) (*LoginResult, error) {
 	// Check for empty fields
 	var err error
 	if email == "" {
 		err := apperrors.ErrEmailIsEmpty
-		return "", err
+		return nil, err
 	}
 	if password == "" {
 		err := apperrors.ErrPasswordIsEmpty
-		return "", err
+		return nil, err
 	}
 
 	// Check if user exists
 	user, err := us.UserRepo.GetUserByEmail(email)
 	if err != nil {
-		return "", err
+		countFailedLogin(err)
+		return nil, err
 	}
 
-	// Deny login if account is locked
-	if user.AccountLocked {
-		return "", apperrors.ErrAccountIsLocked
+	// Deny login if account is locked. Expired locks are lifted below on successful login.
+	now := time.Now().UTC()
+	if user.IsLocked(now) {
+		countFailedLogin(apperrors.ErrAccountIsLocked)
+		return nil, apperrors.ErrAccountIsLocked
 	}
 
 	// Validate password
 	if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		// Increment failed login attempts
-		err = us.UserRepo.IncrementFailedLogins(user.ID.String())
+		// Count the failed attempt and lock the account on too many
+		if err := us.Lockout.RecordFailure(us.UserRepo, user, now); err != nil {
+			return nil, err
+		}
+		countFailedLogin(apperrors.ErrInvalidLogin)
+		return nil, apperrors.ErrInvalidLogin
+	}
+
+	// Deny login until the email is verified if the policy requires it
+	if us.VerificationPolicy == VerificationPolicyLogin && !user.IsEmailVerified() {
+		return nil, apperrors.ErrEmailNotVerified
+	}
+
+	// Hold back the session until the second factor is checked. The lockout counters are only
+	// reset once it is, so wrong codes and fresh challenges can't undo failed attempts.
+	if us.MFA != nil {
+		enabled, err := us.MFA.IsEnabled(user.ID.String())
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		// Lock account on too many failed attempts
-		if user.FailedLoginAttempts == config.MaxLoginAttempts-1 {
-			err = us.UserRepo.LockAccount(user.ID.String())
+		if enabled {
+			challenge, err := us.MFA.CreateChallenge(user.ID)
 			if err != nil {
-				return "", err
+				return nil, err
 			}
+			return &LoginResult{MFAChallenge: challenge}, nil
 		}
-		return "", apperrors.ErrInvalidLogin
 	}
 
-	// Generate session ID
-	sessionID, signature, err := models.GenerateSessionID()
+	// Update last login time and reset lockout counters. This fails if a concurrent failed
+	// login locked the account after it was read above.
+	if err := us.UserRepo.RecordSuccessfulLogin(user.ID.String(), now); err != nil {
+		return nil, err
+	}
+
+	sessionToken, err := us.createSession(user.ID, false, client)
 	if err != nil {
-		return "", apperrors.ErrSessionIDGeneration
+		return nil, err
+	}
+	return &LoginResult{SessionToken: sessionToken}, nil
+}
+
+// CompleteMFALogin exchanges a login challenge and a valid second factor code for a session
+func (us *UserService) CompleteMFALogin(challenge, code string, client models.ClientInfo) (string, error) {
+	if us.MFA == nil {
+		return "", apperrors.ErrMFAServiceIsNil
+	}
+	userID, err := us.MFA.VerifyChallenge(challenge, code)
+	if err != nil {
+		countFailedLogin(err)
+		return "", err
 	}
-	sessionToken := sessionID.String() + "." + signature
+	return us.completeLogin(userID, client)
+}
 
-	// Create session with expiration time (use UTC)
-	expiresAt := time.Now().UTC().Add(time.Duration(config.SessionExpiration) * time.Second)
-	session, err := models.NewSession(user.ID, sessionID, expiresAt)
+// CompleteMFALoginWithPasskey exchanges a login challenge and a passkey's response to
+// `MFAService.BeginPasskeyChallenge` for a session
+func (us *UserService) CompleteMFALoginWithPasskey(challenge, ceremony string, response []byte, client models.ClientInfo) (string, error) {
+	if us.MFA == nil {
+		return "", apperrors.ErrMFAServiceIsNil
+	}
+	userID, err := us.MFA.VerifyPasskeyChallenge(challenge, ceremony, response)
+	if err != nil {
+		countFailedLogin(err)
+		return "", err
+	}
+	return us.completeLogin(userID, client)
+}
 
-	if err := us.SessionRepo.CreateSession(session); err != nil {
+// LoginWithPasskey logs a user in with a passkey's response to `WebAuthnService.BeginLogin`
+// instead of a password. The passkey has to have verified the user, e.g. with a PIN or
+// biometrics, so it counts as two factors and no login challenge follows.
+func (us *UserService) LoginWithPasskey(ceremony string, response []byte, client models.ClientInfo) (string, error) {
+	if us.Passkeys == nil {
+		return "", apperrors.ErrWebAuthnServiceIsNil
+	}
+	userID, err := us.Passkeys.FinishLogin(ceremony, response)
+	if err != nil {
+		countFailedLogin(err)
+		return "", err
+	}
+	user, err := us.UserRepo.GetUserByID(userID.String())
+	if err != nil {
+		countFailedLogin(err)
 		return "", err
 	}
 
-	// Update last login time
-	requestData := map[string]any{"last_login": time.Now()}
-	if err := us.UpdateUser(user.ID.String(), requestData); err != nil {
+	// The same account checks as a password login, minus the failed attempt counting: a wrong
+	// passkey can't be guessed
+	now := time.Now().UTC()
+	if user.IsLocked(now) {
+		countFailedLogin(apperrors.ErrAccountIsLocked)
+		return "", apperrors.ErrAccountIsLocked
+	}
+	if us.VerificationPolicy == VerificationPolicyLogin && !user.IsEmailVerified() {
+		return "", apperrors.ErrEmailNotVerified
+	}
+	if err := us.UserRepo.RecordSuccessfulLogin(user.ID.String(), now); err != nil {
 		return "", err
 	}
 
+	return us.createSession(user.ID, true, client)
+}
+
+// completeLogin resets the lockout counters of a user who has passed their second factor and
+// creates their session
+func (us *UserService) completeLogin(userID uuid.UUID, client models.ClientInfo) (string, error) {
+	// RecordSuccessfulLogin also fails if wrong codes locked the account since the password
+	if err := us.UserRepo.RecordSuccessfulLogin(userID.String(), time.Now().UTC()); err != nil {
+		countFailedLogin(err)
+		return "", err
+	}
+	return us.createSession(userID, true, client)
+}
+
+// createSession creates a session for a user who has fully authenticated within the session
+// limit and returns its token. `mfa` records whether a second factor was used.
+func (us *UserService) createSession(userID uuid.UUID, mfa bool, client models.ClientInfo) (string, error) {
+	// Generate session token
+	sessionToken, tokenHash, err := models.GenerateSessionToken(us.SessionKeys)
+	if err != nil {
+		return "", apperrors.ErrSessionIDGeneration
+	}
+
+	// Create session that expires when idle under the policy the user chose (use UTC)
+	now := time.Now().UTC()
+	expiresAt := us.SessionPolicies.For(client.RememberMe).ExpiresAt(now, now)
+	session, err := models.NewSession(userID, tokenHash, expiresAt)
+	if err != nil {
+		return "", err
+	}
+	session.MFA = mfa
+	session.RememberMe = client.RememberMe
+	session.SetClient(client)
+
+	evicted, err := us.SessionRepo.CreateSessionWithinLimit(session, us.SessionLimit.Max, us.SessionLimit.Policy == SessionLimitEvictOldest)
+	if err != nil {
+		return "", err
+	}
+	for _, s := range evicted {
+		us.record(userID, models.SecurityEventSessionEvicted, fmt.Sprintf("%s (%s)", s.DeviceLabel, s.ClientIP))
+	}
+	metrics.Logins.WithLabelValues(metrics.LoginSuccess).Inc()
+
 	return sessionToken, nil
 }
 
-// Logout invalidates a token by deleting its corresponding session
+// countFailedLogin counts a login that failed because of its credentials or a locked account.
+// Other failures, e.g. a missing field or a database error, aren't outcomes of a login attempt.
+func countFailedLogin(err error) {
+	switch {
+	case errors.Is(err, apperrors.ErrAccountIsLocked):
+		metrics.Logins.WithLabelValues(metrics.LoginLocked).Inc()
+	case errors.Is(err, apperrors.ErrInvalidLogin),
+		errors.Is(err, gorm.ErrRecordNotFound),
+		errors.Is(err, apperrors.ErrUserNotFound),
+		errors.Is(err, apperrors.ErrInvalidMFACode),
+		errors.Is(err, apperrors.ErrInvalidMFAChallenge),
+		errors.Is(err, apperrors.ErrInvalidPasskey),
+		errors.Is(err, apperrors.ErrInvalidWebAuthnCeremony),
+		errors.Is(err, apperrors.ErrPasskeySignCountRejected):
+		metrics.Logins.WithLabelValues(metrics.LoginInvalid).Inc()
+	}
+}
+
+// record adds an event to the user's security activity if auditing is configured
+func (us *UserService) record(userID uuid.UUID, eventType models.SecurityEventType, detail string) {
+	if us.Audit == nil {
+		return
+	}
+	us.Audit.Record(userID, eventType, detail)
+}
+
+// Logout invalidates a token by deleting its corresponding session. Logging out of a session that
+// has expired or already ended succeeds, since there is nothing left to end.
 func (us *UserService) Logout(sessionToken string) error {
 	if sessionToken == "" {
 		return apperrors.ErrSessionIdIsEmpty
 	}
-	// Split the session token
-	parts := strings.Split(sessionToken, ".")
-	if len(parts) != 2 {
-		return apperrors.ErrInvalidTokenFormat
-	}
-	sessionID := parts[0]
-	parsedID, err := uuid.Parse(sessionID)
+	tokenHash, err := models.ParseSessionToken(us.SessionKeys, sessionToken)
 	if err != nil {
-		return apperrors.ErrInvalidTokenFormat
+		return err
+	}
+	session, err := us.SessionRepo.GetUnexpiredSessionByTokenHash(tokenHash)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err = us.SessionRepo.DeleteSessionByID(session.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
 	}
-	return us.SessionRepo.DeleteSessionByID(parsedID)
+	return err
 }
 
 func (us *UserService) LogoutEverywhere(userID string) error {
@@ -142,6 +348,24 @@ func (us *UserService) LogoutEverywhere(userID string) error {
 	return us.SessionRepo.DeleteSessionsByUserID(userID)
 }
 
+// ListSessions returns a user's active sessions, most recently seen first
+func (us *UserService) ListSessions(userID string) ([]models.Session, error) {
+	return us.SessionRepo.GetUnexpiredSessionsByUserID(userID)
+}
+
+// RevokeSession ends one of a user's sessions other than the current one, which has to be ended
+// with `Logout`
+func (us *UserService) RevokeSession(userID string, sessionID, currentSessionID uuid.UUID) error {
+	if sessionID == currentSessionID {
+		return apperrors.ErrCannotRevokeCurrentSession
+	}
+	err := us.SessionRepo.DeleteUserSession(userID, sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return apperrors.ErrSessionNotFound
+	}
+	return err
+}
+
 func (us *UserService) GetUserProfile(userID string) (*models.UserProfile, error) {
 	if userID == "" {
 		return nil, apperrors.ErrUserIdEmpty
@@ -155,8 +379,9 @@ func (us *UserService) GetUserProfile(userID string) (*models.UserProfile, error
 	// The User object contains sensitive information like password hash.
 	// Rather than trust ourselves to never expose that, we create a new struct
 	userProfile := &models.UserProfile{
-		Email:     user.Email,
-		LastLogin: user.LastLogin,
+		Email:           user.Email,
+		LastLogin:       user.LastLogin,
+		EmailVerifiedAt: user.EmailVerifiedAt,
 	}
 	return userProfile, nil
 }
@@ -168,17 +393,14 @@ func (us *UserService) UpdateUser(userID string, request map[string]any) error {
 	}
 
 	if password, ok := request["password"].(string); ok && password != "" {
-		if err := passwordvalidator.Validate(password, config.MinEntropyBits); err != nil {
-			return err
-		}
-
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		hashedPassword, err := hashPassword(password, us.MinEntropyBits)
 		if err != nil {
 			return err
 		}
-		request["password"] = string(hashedPassword)
+		request["password"] = hashedPassword
 	}
 
+	emailChanged := false
 	if email, ok := request["email"].(string); ok && email != "" {
 		if _, err := mail.ParseAddress(email); err != nil {
 			return err
@@ -186,9 +408,50 @@ func (us *UserService) UpdateUser(userID string, request map[string]any) error {
 		if len(email) > 254 {
 			return apperrors.ErrEmailMaxLength
 		}
+		// A new address has to be verified again, without waiting out the resend interval of the
+		// old one
+		if user, err := us.UserRepo.GetUserByID(userID); err == nil && user.Email != email {
+			request["email_verified_at"] = nil
+			request["verification_sent_at"] = nil
+			emailChanged = true
+		}
 	}
 
-	return us.UserRepo.UpdateUser(userID, request)
+	if err := us.UserRepo.UpdateUser(userID, request); err != nil {
+		return err
+	}
+
+	if emailChanged {
+		us.sendVerification(userID)
+	}
+	return nil
+}
+
+// sendVerification mails a verification token if a verifier is configured. Failures are logged
+// rather than returned, since the user can always ask for the email to be resent.
+func (us *UserService) sendVerification(userID string) {
+	if us.Verifier == nil {
+		return
+	}
+	if err := us.Verifier.SendVerification(userID); err != nil {
+		log.Error().
+			Str("userID", userID).
+			Str("error", err.Error()).
+			Msg("Failed to send verification email")
+	}
+}
+
+// hashPassword enforces minimum password complexity and returns the bcrypt hash of a password
+func hashPassword(password string, minEntropyBits float64) (string, error) {
+	if err := models.ValidatePassword(password, minEntropyBits); err != nil {
+		return "", err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
 }
 
 // PermanentlyDeleteUser removes the user from the database. This is a permanent operation rather
@@ -204,44 +467,91 @@ func (us *UserService) PermanentlyDeleteUser(userID string) error {
 	if rowsAffected == 0 {
 		return apperrors.ErrUserNotFound
 	}
+	// Postgres deleted the sessions with the user, but other session stores don't know about users
+	if err := us.SessionRepo.DeleteSessionsByUserID(userID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
 	return nil
 }
 
-// RotateSession generates a new session token for the user and invalidates the old one
-// RotateSession creates a new session and replaces the old one
-func (us *UserService) RotateSession(oldSessionID uuid.UUID) (string, error) {
-	// Check session exists
-	oldSession, err := us.SessionRepo.GetUnexpiredSessionByID(oldSessionID)
+// SetPassword replaces a user's password without asking for the old one, e.g. for an operator, and
+// ends the user's sessions
+func (us *UserService) SetPassword(userID, password string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	if password == "" {
+		return apperrors.ErrPasswordIsEmpty
+	}
+	hashedPassword, err := hashPassword(password, us.MinEntropyBits)
 	if err != nil {
-		return "", err
+		return err
 	}
+	if err := us.UserRepo.UpdateUser(userID, map[string]any{"password": hashedPassword}); err != nil {
+		return err
+	}
+	if err := us.SessionRepo.DeleteSessionsByUserID(userID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return nil
+}
 
-	// Generate new session token with same claims
-	newSessionID, signature, err := models.GenerateSessionID()
+// LockUser locks a user out until the given time, or until they are unlocked if until is nil, and
+// ends their sessions. Unlike a lockout after failed logins, it doesn't count towards longer
+// lockouts and resetting the password doesn't lift it.
+func (us *UserService) LockUser(userID string, until *time.Time) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+	var lockedUntil any
+	if until != nil {
+		lockedUntil = until.UTC()
+	}
+	err := us.UserRepo.UpdateUser(userID, map[string]any{
+		"admin_locked":       true,
+		"admin_locked_until": lockedUntil,
+	})
 	if err != nil {
-		return "", apperrors.ErrSessionIDGeneration
+		return err
 	}
-	newSessionToken := newSessionID.String() + "." + signature
+	if err := us.SessionRepo.DeleteSessionsByUserID(userID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return nil
+}
 
-	// Create new session with the new token and expiration time
-	expiresAt := time.Now().UTC().Add(time.Duration(config.SessionExpiration) * time.Second)
-	newSession, err := models.NewSession(oldSession.UserID, newSessionID, expiresAt)
+// RotateSession creates a new session that replaces the old one, keeping its login time, policy
+// and device, and returns the new token and session ID
+func (us *UserService) RotateSession(oldSessionID uuid.UUID) (string, uuid.UUID, error) {
+	// Check session exists
+	oldSession, err := us.SessionRepo.GetUnexpiredSessionByID(oldSessionID)
 	if err != nil {
-		return "", err
+		return "", uuid.Nil, err
 	}
 
-	// Use the existing database connection/transaction from the repository
-	db := us.SessionRepo.DB
-
-	// Insert new session into the database
-	if err := db.Create(newSession).Error; err != nil {
-		return "", err
+	// Generate new session token with same claims
+	newSessionToken, tokenHash, err := models.GenerateSessionToken(us.SessionKeys)
+	if err != nil {
+		return "", uuid.Nil, apperrors.ErrSessionIDGeneration
 	}
 
-	// Delete old session
-	if err := db.Where("id = ?", oldSessionID).Delete(&models.Session{}).Error; err != nil {
-		return "", err
+	// Create new session with the new token. It expires under the old session's policy, so the
+	// maximum lifetime still counts from the original login.
+	expiresAt := oldSession.Policy(us.SessionPolicies).ExpiresAt(oldSession.AuthenticatedAt, time.Now().UTC())
+	newSession, err := models.NewSession(oldSession.UserID, tokenHash, expiresAt)
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+	newSession.MFA = oldSession.MFA
+	newSession.RememberMe = oldSession.RememberMe
+	newSession.AuthenticatedAt = oldSession.AuthenticatedAt
+	newSession.UserAgent = oldSession.UserAgent
+	newSession.ClientIP = oldSession.ClientIP
+	newSession.DeviceLabel = oldSession.DeviceLabel
+
+	if err := us.SessionRepo.ReplaceSession(oldSessionID, newSession); err != nil {
+		return "", uuid.Nil, err
 	}
 
-	return newSessionToken, nil
+	return newSessionToken, newSession.ID, nil
 }
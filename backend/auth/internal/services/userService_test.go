@@ -1,15 +1,16 @@
 package services_test
 
 import (
-	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/matryer/is"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"godiscauth/internal/metrics"
 	"godiscauth/internal/models"
 	"godiscauth/internal/repository"
 	"godiscauth/internal/services"
@@ -21,28 +22,15 @@ import (
 // TestUserService_NewUserService tests the creation of a new UserService
 func TestUserService_NewUserService(t *testing.T) {
 	is := is.New(t)
-	testDB := testutils.TestDBSetup()
 
 	t.Run("returns err with nil user repo", func(t *testing.T) {
-		tx := testDB.Begin()
-		defer tx.Rollback()
-
-		sr, err := repository.NewSessionRepository(tx)
-		is.Equal(err, nil)
-
-		userService, err := services.NewUserService(nil, sr)
+		userService, err := services.NewUserService(nil, repository.NewMemorySessionStore(), testutils.TestSessionKeys(), testutils.TestConfig())
 		is.Equal(userService, nil)
 		is.Equal(err, apperrors.ErrUserRepoIsNil)
 	})
 
 	t.Run("returns err with nil session repo", func(t *testing.T) {
-		tx := testDB.Begin()
-		defer tx.Rollback()
-
-		ur, err := repository.NewUserRepository(tx)
-		is.Equal(err, nil)
-
-		userService, err := services.NewUserService(ur, nil)
+		userService, err := services.NewUserService(repository.NewMemoryUserStore(), nil, testutils.TestSessionKeys(), testutils.TestConfig())
 		is.Equal(userService, nil)
 		is.Equal(err, apperrors.ErrSessionRepoIsNil)
 	})
@@ -77,10 +65,9 @@ func TestUserService_RegisterUser(t *testing.T) {
 		err := us.RegisterUser(email, testutils.TestingPassword)
 		is.NoErr(err)
 
-		// Check user actually exists in db
-		var user models.User
-		result := us.UserRepo.DB.First(&user, "email = ?", email)
-		is.NoErr(result.Error)
+		// Check user actually exists in the store
+		_, err = us.UserRepo.GetUserByEmail(email)
+		is.NoErr(err)
 	})
 }
 
@@ -146,9 +133,8 @@ func TestUserService_UpdateUser(t *testing.T) {
 
 		// Update user
 		referenceTime := time.Now().Add(time.Hour * 24).UTC().Truncate(time.Second)
-		var user models.User
-		result := us.UserRepo.DB.First(&user, "email = ?", email)
-		is.NoErr(result.Error)
+		user, err := us.UserRepo.GetUserByEmail(email)
+		is.NoErr(err)
 		err = us.UpdateUser(user.ID.String(), map[string]any{
 			"email":                 "newUserName@test.com",
 			"password":              "new" + testutils.TestingPassword,
@@ -196,19 +182,19 @@ func TestUserService_LoginUser(t *testing.T) {
 
 	t.Run("non existing user", func(t *testing.T) {
 		us := setupUserService(t)
-		_, err := us.LoginUser("doesNotExist@test.com", "password")
+		_, err := us.LoginUser("doesNotExist@test.com", "password", models.ClientInfo{})
 		is.Equal(err, gorm.ErrRecordNotFound)
 	})
 
 	t.Run("empty email", func(t *testing.T) {
 		us := setupUserService(t)
-		_, err := us.LoginUser("", "password")
+		_, err := us.LoginUser("", "password", models.ClientInfo{})
 		is.Equal(err, apperrors.ErrEmailIsEmpty)
 	})
 
 	t.Run("empty password", func(t *testing.T) {
 		us := setupUserService(t)
-		_, err := us.LoginUser("some@test.com", "")
+		_, err := us.LoginUser("some@test.com", "", models.ClientInfo{})
 		is.Equal(err, apperrors.ErrPasswordIsEmpty)
 	})
 
@@ -216,7 +202,7 @@ func TestUserService_LoginUser(t *testing.T) {
 		us := setupUserService(t)
 		err := us.RegisterUser(email, testutils.TestingPassword)
 		is.NoErr(err)
-		_, err = us.LoginUser(email, "thisIsNotThePassword")
+		_, err = us.LoginUser(email, "thisIsNotThePassword", models.ClientInfo{})
 		is.Equal(err, apperrors.ErrInvalidLogin)
 	})
 
@@ -224,9 +210,9 @@ func TestUserService_LoginUser(t *testing.T) {
 		us := setupUserService(t)
 		err := us.RegisterUser(email, testutils.TestingPassword)
 		is.NoErr(err)
-		token, err := us.LoginUser(email, testutils.TestingPassword)
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
 		is.NoErr(err)
-		is.True(token != "")
+		is.True(result.SessionToken != "")
 	})
 
 	t.Run("deny locked account login", func(t *testing.T) {
@@ -241,10 +227,11 @@ func TestUserService_LoginUser(t *testing.T) {
 		is.NoErr(err)
 
 		// Lock account
-		us.UserRepo.LockAccount(user.ID.String())
+		err = us.UserRepo.LockAccount(user.ID.String(), time.Now().Add(time.Hour))
+		is.NoErr(err)
 
 		// Attempt locked-account login
-		_, err = us.LoginUser(email, testutils.TestingPassword)
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
 		is.Equal(err, apperrors.ErrAccountIsLocked)
 	})
 
@@ -259,16 +246,137 @@ func TestUserService_LoginUser(t *testing.T) {
 		is.NoErr(err)
 
 		// Manually set failed attempts to max-1
-		us.UserRepo.DB.Model(&models.User{}).Where("id = ?", user.ID).
-			Updates(map[string]any{"failed_login_attempts": config.MaxLoginAttempts - 1})
+		err = us.UserRepo.UpdateUser(user.ID.String(), map[string]any{"failed_login_attempts": config.Default().Lockout.MaxAttempts - 1})
+		is.NoErr(err)
 
 		// Fail a login attempt
-		_, err = us.LoginUser(email, "thisIsNotThePassword")
+		_, err = us.LoginUser(email, "thisIsNotThePassword", models.ClientInfo{})
 		is.Equal(err, apperrors.ErrInvalidLogin)
 
 		// Attempt subsequent login, expecting locked account
-		_, err = us.LoginUser(email, testutils.TestingPassword)
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
 		is.Equal(err, apperrors.ErrAccountIsLocked)
+
+		// Lock length follows the policy for a first lockout
+		user, err = us.UserRepo.GetUserByEmail(email)
+		is.NoErr(err)
+		is.True(user.AccountLockedUntil != nil)
+		expectedUntil := time.Now().Add(us.Lockout.LockDuration(0))
+		is.True(user.AccountLockedUntil.Sub(expectedUntil).Abs() < 5*time.Second)
+	})
+
+	t.Run("allows login once lock expires", func(t *testing.T) {
+		us := setupUserService(t)
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+		user, err := us.UserRepo.GetUserByEmail(email)
+		is.NoErr(err)
+
+		// Lock account with a lock that has already run out
+		err = us.UserRepo.LockAccount(user.ID.String(), time.Now().Add(-time.Minute))
+		is.NoErr(err)
+
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		is.True(result.SessionToken != "")
+
+		// Lock is lifted in the database
+		user, err = us.UserRepo.GetUserByEmail(email)
+		is.NoErr(err)
+		is.True(!user.AccountLocked)
+		is.Equal(user.AccountLockedUntil, nil)
+	})
+
+	t.Run("resets failed attempts on success", func(t *testing.T) {
+		us := setupUserService(t)
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+
+		for range config.Default().Lockout.MaxAttempts - 1 {
+			_, err = us.LoginUser(email, "thisIsNotThePassword", models.ClientInfo{})
+			is.Equal(err, apperrors.ErrInvalidLogin)
+		}
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+
+		user, err := us.UserRepo.GetUserByEmail(email)
+		is.NoErr(err)
+		is.Equal(user.FailedLoginAttempts, 0)
+
+		// A single further failure does not lock the account
+		_, err = us.LoginUser(email, "thisIsNotThePassword", models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidLogin)
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+	})
+
+	t.Run("locks repeat offenders for longer", func(t *testing.T) {
+		us := setupUserService(t)
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+		user, err := us.UserRepo.GetUserByEmail(email)
+		is.NoErr(err)
+
+		// Simulate an expired first lockout
+		err = us.UserRepo.LockAccount(user.ID.String(), time.Now().Add(-time.Minute))
+		is.NoErr(err)
+
+		for range config.Default().Lockout.MaxAttempts {
+			_, err = us.LoginUser(email, "thisIsNotThePassword", models.ClientInfo{})
+			is.Equal(err, apperrors.ErrInvalidLogin)
+		}
+
+		user, err = us.UserRepo.GetUserByEmail(email)
+		is.NoErr(err)
+		is.Equal(user.LockoutCount, 2)
+		expectedUntil := time.Now().Add(us.Lockout.LockDuration(1))
+		is.True(user.AccountLockedUntil.Sub(expectedUntil).Abs() < 5*time.Second)
+	})
+}
+
+// TestUserService_LoginUser_VerificationPolicy tests that the login verification policy rejects
+// unverified accounts
+func TestUserService_LoginUser_VerificationPolicy(t *testing.T) {
+	is := is.New(t)
+
+	email := "testLoginVerificationPolicy@test.com"
+
+	t.Run("allows unverified login when off", func(t *testing.T) {
+		us := setupUserService(t)
+		us.VerificationPolicy = services.VerificationPolicyOff
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+	})
+
+	t.Run("rejects unverified login when required", func(t *testing.T) {
+		us := setupUserService(t)
+		us.VerificationPolicy = services.VerificationPolicyLogin
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.Equal(err, apperrors.ErrEmailNotVerified)
+
+		// Wrong password still reports invalid login rather than verification state
+		_, err = us.LoginUser(email, "thisIsNotThePassword", models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidLogin)
+	})
+
+	t.Run("allows verified login when required", func(t *testing.T) {
+		us := setupUserService(t)
+		us.VerificationPolicy = services.VerificationPolicyLogin
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+		user, err := us.UserRepo.GetUserByEmail(email)
+		is.NoErr(err)
+		err = us.UserRepo.MarkEmailVerified(user.ID.String(), email, time.Now())
+		is.NoErr(err)
+
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
 	})
 }
 
@@ -287,24 +395,41 @@ func TestUserService_Logout(t *testing.T) {
 		email := "testUserServiceLogout@test.com"
 		err := us.RegisterUser(email, testutils.TestingPassword)
 		is.NoErr(err)
-		token, err := us.LoginUser(email, testutils.TestingPassword)
-		is.NoErr(err)
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
 		is.NoErr(err)
+		token := result.SessionToken
 
 		// Logout a user
 		err = us.Logout(token)
 
-		// Get session ID from token
-		parts := strings.Split(token, ".")
-		is.True(len(parts) == 2)
-		sessionID := parts[0]
-		parsedID, err := uuid.Parse(sessionID)
+		// Get the token's hash
+		tokenHash, err := models.ParseSessionToken(testutils.TestSessionKeys(), token)
 		is.NoErr(err)
 
 		// Check that corresponding session no longer exists in database
-		session, err := us.SessionRepo.GetUnexpiredSessionByID(parsedID)
+		session, err := us.SessionRepo.GetUnexpiredSessionByTokenHash(tokenHash)
 		is.Equal(session, nil)
 		is.Equal(err, gorm.ErrRecordNotFound)
+
+		// Logging out again succeeds
+		is.NoErr(us.Logout(token))
+	})
+
+	t.Run("succeeds for an expired session", func(t *testing.T) {
+		email := "testUserServiceLogoutExpired@test.com"
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+
+		tokenHash, err := models.ParseSessionToken(testutils.TestSessionKeys(), result.SessionToken)
+		is.NoErr(err)
+		session, err := us.SessionRepo.GetUnexpiredSessionByTokenHash(tokenHash)
+		is.NoErr(err)
+		now := time.Now()
+		is.NoErr(us.SessionRepo.TouchSession(session.ID, session.ClientIP, now, now.Add(-time.Minute)))
+
+		is.NoErr(us.Logout(result.SessionToken))
 	})
 }
 
@@ -330,9 +455,9 @@ func TestUserService_LogoutEverywhere(t *testing.T) {
 		// Login user multiple times
 		tokens := []string{}
 		for range 10 {
-			token, err := us.LoginUser(email, testutils.TestingPassword)
+			result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
 			is.NoErr(err)
-			tokens = append(tokens, token)
+			tokens = append(tokens, result.SessionToken)
 		}
 
 		// Invalidate all user's tokens
@@ -340,20 +465,181 @@ func TestUserService_LogoutEverywhere(t *testing.T) {
 
 		// Check that corresponding session no longer exists in database
 		for _, token := range tokens {
-			// Get session ID from token
-			parts := strings.Split(token, ".")
-			is.True(len(parts) == 2)
-			sessionID := parts[0]
-			parsedID, err := uuid.Parse(sessionID)
+			// Get the token's hash
+			tokenHash, err := models.ParseSessionToken(testutils.TestSessionKeys(), token)
 			is.NoErr(err)
 			// Confirm session is gone
-			session, err := us.SessionRepo.GetUnexpiredSessionByID(parsedID)
+			session, err := us.SessionRepo.GetUnexpiredSessionByTokenHash(tokenHash)
 			is.Equal(session, nil)
 			is.Equal(err, gorm.ErrRecordNotFound)
 		}
 	})
 }
 
+// TestUserService_Sessions tests recording the client of a session, listing sessions and revoking
+// them
+func TestUserService_Sessions(t *testing.T) {
+	is := is.New(t)
+	us := setupUserService(t)
+
+	email := "testUserServiceSessions@test.com"
+	userID := registerTestUser(t, us, email)
+	laptop := models.ClientInfo{UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0", IP: "192.0.2.1"}
+	phone := models.ClientInfo{UserAgent: "curl/8.5.0", IP: "192.0.2.2"}
+
+	laptopResult, err := us.LoginUser(email, testutils.TestingPassword, laptop)
+	is.NoErr(err)
+	laptopSession := sessionFromToken(t, us, laptopResult.SessionToken)
+	is.Equal(laptopSession.UserAgent, laptop.UserAgent)
+	is.Equal(laptopSession.ClientIP, laptop.IP)
+	is.Equal(laptopSession.DeviceLabel, "Firefox on Linux")
+
+	phoneResult, err := us.LoginUser(email, testutils.TestingPassword, phone)
+	is.NoErr(err)
+	phoneSession := sessionFromToken(t, us, phoneResult.SessionToken)
+
+	t.Run("rotation keeps the device and login time", func(t *testing.T) {
+		token, newID, err := us.RotateSession(phoneSession.ID)
+		is.NoErr(err)
+		rotated := sessionFromToken(t, us, token)
+		is.Equal(rotated.ID, newID)
+		is.Equal(rotated.DeviceLabel, phoneSession.DeviceLabel)
+		is.True(rotated.AuthenticatedAt.Equal(phoneSession.AuthenticatedAt))
+		phoneSession = rotated
+	})
+
+	t.Run("lists active sessions", func(t *testing.T) {
+		sessions, err := us.ListSessions(userID)
+		is.NoErr(err)
+		is.Equal(len(sessions), 2)
+	})
+
+	t.Run("won't revoke the current session", func(t *testing.T) {
+		err := us.RevokeSession(userID, laptopSession.ID, laptopSession.ID)
+		is.Equal(err, apperrors.ErrCannotRevokeCurrentSession)
+	})
+
+	t.Run("won't revoke other users' sessions", func(t *testing.T) {
+		otherUserID := registerTestUser(t, us, "testUserServiceSessionsOther@test.com")
+		err := us.RevokeSession(otherUserID, phoneSession.ID, uuid.New())
+		is.Equal(err, apperrors.ErrSessionNotFound)
+	})
+
+	t.Run("revokes another session", func(t *testing.T) {
+		err := us.RevokeSession(userID, phoneSession.ID, laptopSession.ID)
+		is.NoErr(err)
+		sessions, err := us.ListSessions(userID)
+		is.NoErr(err)
+		is.Equal(len(sessions), 1)
+		is.Equal(sessions[0].ID, laptopSession.ID)
+
+		err = us.RevokeSession(userID, phoneSession.ID, laptopSession.ID)
+		is.Equal(err, apperrors.ErrSessionNotFound)
+	})
+}
+
+// TestUserService_SessionPolicy tests that "remember me" selects the longer session policy and
+// that rotation can't extend a session past its maximum lifetime
+func TestUserService_SessionPolicy(t *testing.T) {
+	is := is.New(t)
+	us := setupUserService(t)
+
+	email := "testUserServiceSessionPolicy@test.com"
+	registerTestUser(t, us, email)
+
+	result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+	is.NoErr(err)
+	short := sessionFromToken(t, us, result.SessionToken)
+	is.True(!short.RememberMe)
+	is.True(!short.ExpiresAt.After(time.Now().Add(config.Default().Sessions.IdleTimeout)))
+
+	result, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{RememberMe: true})
+	is.NoErr(err)
+	long := sessionFromToken(t, us, result.SessionToken)
+	is.True(long.RememberMe)
+	is.True(long.ExpiresAt.After(time.Now().Add(config.Default().Sessions.IdleTimeout)))
+
+	t.Run("rotation keeps the policy", func(t *testing.T) {
+		token, _, err := us.RotateSession(long.ID)
+		is.NoErr(err)
+		rotated := sessionFromToken(t, us, token)
+		is.True(rotated.RememberMe)
+		long = rotated
+	})
+
+	t.Run("rotation is capped by the maximum lifetime", func(t *testing.T) {
+		// Pretend the user logged in almost a maximum lifetime ago
+		authenticatedAt := time.Now().UTC().Add(-config.Default().Sessions.MaxLifetime + time.Minute)
+		aged := *short
+		aged.ID = uuid.New()
+		aged.TokenHash = models.HashSessionSecret(uuid.NewString())
+		aged.AuthenticatedAt = authenticatedAt
+		is.NoErr(us.SessionRepo.ReplaceSession(short.ID, &aged))
+		short = &aged
+
+		token, _, err := us.RotateSession(short.ID)
+		is.NoErr(err)
+		rotated := sessionFromToken(t, us, token)
+		is.True(rotated.AuthenticatedAt.Sub(authenticatedAt).Abs() < time.Second)
+		is.True(!rotated.ExpiresAt.After(time.Now().Add(time.Minute)))
+	})
+}
+
+// TestUserService_SessionLimit tests that logins over the session limit evict the oldest session,
+// recording it in the user's security activity, or are rejected
+func TestUserService_SessionLimit(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("evicts the oldest session", func(t *testing.T) {
+		us := setupMFAUserService(t)
+		us.Audit = us.MFA.Audit
+		us.SessionLimit = services.SessionLimit{Max: 2, Policy: services.SessionLimitEvictOldest}
+		email := "testUserServiceSessionLimitEvict@test.com"
+		userID := registerTestUser(t, us, email)
+
+		laptop := models.ClientInfo{UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0", IP: "192.0.2.1"}
+		first, err := us.LoginUser(email, testutils.TestingPassword, laptop)
+		is.NoErr(err)
+		firstSession := sessionFromToken(t, us, first.SessionToken)
+		for range 2 {
+			_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+			is.NoErr(err)
+		}
+
+		sessions, err := us.ListSessions(userID)
+		is.NoErr(err)
+		is.Equal(len(sessions), 2)
+		_, err = us.SessionRepo.GetUnexpiredSessionByID(firstSession.ID)
+		is.Equal(err, gorm.ErrRecordNotFound)
+
+		events, err := us.Audit.ListActivity(userID)
+		is.NoErr(err)
+		is.Equal(len(events), 1)
+		is.Equal(events[0].Type, models.SecurityEventSessionEvicted)
+		is.Equal(events[0].Detail, "Firefox on Linux (192.0.2.1)")
+	})
+
+	t.Run("rejects new logins", func(t *testing.T) {
+		us := setupUserService(t)
+		us.SessionLimit = services.SessionLimit{Max: 1, Policy: services.SessionLimitReject}
+		email := "testUserServiceSessionLimitReject@test.com"
+		userID := registerTestUser(t, us, email)
+
+		first, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.Equal(err, apperrors.ErrTooManySessions)
+
+		// Logging out makes room again
+		is.NoErr(us.Logout(first.SessionToken))
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		sessions, err := us.ListSessions(userID)
+		is.NoErr(err)
+		is.Equal(len(sessions), 1)
+	})
+}
+
 func TestUserService_PermanentlyDeleteUser(t *testing.T) {
 	is := is.New(t)
 
@@ -388,24 +674,153 @@ func TestUserService_PermanentlyDeleteUser(t *testing.T) {
 	})
 }
 
+// TestUserService_MemoryStores tests a user's lifecycle with in-memory stores, which needs no
+// database
+func TestUserService_MemoryStores(t *testing.T) {
+	is := is.New(t)
+
+	us := setupUserService(t)
+	email := "testUserServiceMemoryStores@test.com"
+	is.NoErr(us.RegisterUser(email, testutils.TestingPassword))
+	is.Equal(us.RegisterUser(email, testutils.TestingPassword), apperrors.ErrDuplicateEmail)
+	user, err := us.UserRepo.GetUserByEmail(email)
+	is.NoErr(err)
+
+	t.Run("counts failed logins", func(t *testing.T) {
+		_, err := us.LoginUser(email, "thisIsNotThePassword", models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidLogin)
+		user, err := us.UserRepo.GetUserByID(user.ID.String())
+		is.NoErr(err)
+		is.Equal(user.FailedLoginAttempts, 1)
+	})
+
+	t.Run("logs in, rotates and logs out", func(t *testing.T) {
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		sessions, err := us.ListSessions(user.ID.String())
+		is.NoErr(err)
+		is.Equal(len(sessions), 1)
+
+		token, sessionID, err := us.RotateSession(sessions[0].ID)
+		is.NoErr(err)
+		is.True(sessionID != sessions[0].ID)
+		// The replaced token has nothing left to end
+		is.NoErr(us.Logout(result.SessionToken))
+		sessions, err = us.ListSessions(user.ID.String())
+		is.NoErr(err)
+		is.Equal(len(sessions), 1)
+		is.NoErr(us.Logout(token))
+
+		sessions, err = us.ListSessions(user.ID.String())
+		is.NoErr(err)
+		is.Equal(len(sessions), 0)
+	})
+
+	t.Run("sets the password and ends sessions", func(t *testing.T) {
+		_, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		newPassword := testutils.TestingPassword + "-new"
+
+		is.True(us.SetPassword(user.ID.String(), "short") != nil)
+		is.NoErr(us.SetPassword(user.ID.String(), newPassword))
+		sessions, err := us.ListSessions(user.ID.String())
+		is.NoErr(err)
+		is.Equal(len(sessions), 0)
+
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidLogin)
+		_, err = us.LoginUser(email, newPassword, models.ClientInfo{})
+		is.NoErr(err)
+		is.NoErr(us.SetPassword(user.ID.String(), testutils.TestingPassword))
+	})
+
+	t.Run("locks and unlocks the user", func(t *testing.T) {
+		_, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+
+		is.NoErr(us.LockUser(user.ID.String(), nil))
+		sessions, err := us.ListSessions(user.ID.String())
+		is.NoErr(err)
+		is.Equal(len(sessions), 0)
+		locked, err := us.UserRepo.GetUserByID(user.ID.String())
+		is.NoErr(err)
+		is.True(locked.IsLocked(time.Now().Add(24 * time.Hour)))
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.Equal(err, apperrors.ErrAccountIsLocked)
+
+		until := time.Now().Add(time.Hour)
+		is.NoErr(us.LockUser(user.ID.String(), &until))
+		locked, err = us.UserRepo.GetUserByID(user.ID.String())
+		is.NoErr(err)
+		is.True(locked.IsLocked(time.Now()))
+		is.True(!locked.IsLocked(until.Add(time.Second)))
+
+		is.NoErr(us.UserRepo.UnlockAccount(user.ID.String()))
+		_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		is.Equal(us.LockUser(uuid.NewString(), nil), apperrors.ErrUserNotFound)
+	})
+
+	t.Run("deletes the user and their sessions", func(t *testing.T) {
+		for range 3 {
+			_, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+			is.NoErr(err)
+		}
+		is.NoErr(us.PermanentlyDeleteUser(user.ID.String()))
+
+		_, err := us.UserRepo.GetUserByEmail(email)
+		is.Equal(err, gorm.ErrRecordNotFound)
+		sessions, err := us.ListSessions(user.ID.String())
+		is.NoErr(err)
+		is.Equal(len(sessions), 0)
+	})
+}
+
+// setupUserService returns a user service with in-memory stores
 func setupUserService(t *testing.T) *services.UserService {
 	t.Helper()
 
-	testDB := testutils.TestDBSetup()
-	tx := testDB.Begin()
-	t.Cleanup(func() { tx.Rollback() })
-
-	ur, err := repository.NewUserRepository(tx)
-	if err != nil {
-		t.Fatalf("failed to create user repository: %v", err)
-	}
-	sr, err := repository.NewSessionRepository(tx)
-	if err != nil {
-		t.Fatalf("failed to create session repository: %v", err)
-	}
-	us, err := services.NewUserService(ur, sr)
+	us, err := services.NewUserService(repository.NewMemoryUserStore(), repository.NewMemorySessionStore(), testutils.TestSessionKeys(), testutils.TestConfig())
 	if err != nil {
 		t.Fatalf("failed to create user service: %v", err)
 	}
 	return us
 }
+
+// TestUserService_Metrics tests that registrations, login outcomes and lockouts are counted
+func TestUserService_Metrics(t *testing.T) {
+	is := is.New(t)
+	us := setupUserService(t)
+	us.Lockout.MaxAttempts = 2
+
+	logins := func(outcome string) float64 {
+		return testutil.ToFloat64(metrics.Logins.WithLabelValues(outcome))
+	}
+	registrations := testutil.ToFloat64(metrics.Registrations)
+	success, invalid, locked := logins(metrics.LoginSuccess), logins(metrics.LoginInvalid), logins(metrics.LoginLocked)
+	lockouts := testutil.ToFloat64(metrics.Lockouts)
+
+	email := "testUserServiceMetrics@test.com"
+	is.NoErr(us.RegisterUser(email, testutils.TestingPassword))
+	is.Equal(us.RegisterUser(email, testutils.TestingPassword), apperrors.ErrDuplicateEmail)
+	is.Equal(testutil.ToFloat64(metrics.Registrations), registrations+1)
+
+	_, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+	is.NoErr(err)
+	_, err = us.LoginUser("nobody@test.com", testutils.TestingPassword, models.ClientInfo{})
+	is.Equal(err, gorm.ErrRecordNotFound)
+	_, err = us.LoginUser(email, "", models.ClientInfo{})
+	is.Equal(err, apperrors.ErrPasswordIsEmpty)
+	for range 2 {
+		_, err = us.LoginUser(email, "thisIsNotThePassword", models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidLogin)
+	}
+	_, err = us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+	is.Equal(err, apperrors.ErrAccountIsLocked)
+
+	is.Equal(logins(metrics.LoginSuccess), success+1)
+	// The unknown email and the wrong passwords, not the missing one
+	is.Equal(logins(metrics.LoginInvalid), invalid+3)
+	is.Equal(logins(metrics.LoginLocked), locked+1)
+	is.Equal(testutil.ToFloat64(metrics.Lockouts), lockouts+1)
+}
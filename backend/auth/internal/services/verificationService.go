@@ -0,0 +1,166 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"godiscauth/internal/mailer"
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+	"godiscauth/pkg/keyring"
+)
+
+// VerificationPolicy decides where accounts with unverified emails are rejected
+type VerificationPolicy string
+
+const (
+	// VerificationPolicyOff allows unverified accounts everywhere
+	VerificationPolicyOff VerificationPolicy = "off"
+	// VerificationPolicyLogin rejects logins from unverified accounts
+	VerificationPolicyLogin VerificationPolicy = "login"
+	// VerificationPolicyProtected lets unverified accounts log in but rejects them on protected routes
+	VerificationPolicyProtected VerificationPolicy = "protected"
+)
+
+// ParseVerificationPolicy parses the value of the `config.EnvEmailVerification` env variable. An
+// empty value is the same as "off".
+func ParseVerificationPolicy(s string) (VerificationPolicy, error) {
+	switch policy := VerificationPolicy(s); policy {
+	case "":
+		return VerificationPolicyOff, nil
+	case VerificationPolicyOff, VerificationPolicyLogin, VerificationPolicyProtected:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%w: %q", apperrors.ErrUnknownVerificationPolicy, s)
+	}
+}
+
+// VerificationService contains the repository and mailer needed to verify that users own the email
+// address they registered with
+type VerificationService struct {
+	UserRepo repository.UserStore
+	Mailer   mailer.Mailer
+	// SessionKeys sign verification tokens
+	SessionKeys *keyring.KeyRing
+	// VerifyURL is the page that completes verification. If empty, the bare token is mailed instead.
+	VerifyURL string
+	// TokenExpiration is how long a verification token is valid after it is issued
+	TokenExpiration time.Duration
+	// ResendInterval is the minimum time between verification emails to the same user
+	ResendInterval time.Duration
+}
+
+// NewVerificationService returns a value of type VerificationService that signs tokens with keys and
+// mails them as configured by cfg
+func NewVerificationService(
+	ur repository.UserStore,
+	m mailer.Mailer,
+	keys *keyring.KeyRing,
+	cfg config.EmailVerificationConfig,
+) (*VerificationService, error) {
+	if ur == nil {
+		return nil, apperrors.ErrUserRepoIsNil
+	}
+	if m == nil {
+		return nil, apperrors.ErrMailerIsNil
+	}
+	if keys == nil {
+		return nil, apperrors.ErrSessionKeyMissing
+	}
+	return &VerificationService{
+		UserRepo:        ur,
+		Mailer:          m,
+		SessionKeys:     keys,
+		VerifyURL:       cfg.URL,
+		TokenExpiration: cfg.Expiration,
+		ResendInterval:  cfg.ResendInterval,
+	}, nil
+}
+
+// SendVerification mails a verification token to a user's current email address, e.g. right
+// after registration or an email change. Sends are throttled per user by `ResendInterval`.
+func (vs *VerificationService) SendVerification(userID string) error {
+	if userID == "" {
+		return apperrors.ErrUserIdEmpty
+	}
+
+	now := time.Now().UTC()
+	if err := vs.UserRepo.ClaimVerificationSend(userID, now.Add(-vs.ResendInterval)); err != nil {
+		return err
+	}
+	user, err := vs.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	token, err := models.NewEmailVerificationToken(vs.SessionKeys, user.ID, user.Email, now.Add(vs.TokenExpiration))
+	if err != nil {
+		return err
+	}
+
+	return vs.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    vs.verificationEmailBody(token),
+	})
+}
+
+// ResendVerification mails a new verification token to the user with the given email. Unknown
+// emails are not an error so that callers can't use this to discover which emails are registered.
+func (vs *VerificationService) ResendVerification(email string) error {
+	if email == "" {
+		return apperrors.ErrEmailIsEmpty
+	}
+
+	user, err := vs.UserRepo.GetUserByEmail(email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Info().Str("email", email).Msg("Verification resend requested for unknown email")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return vs.SendVerification(user.ID.String())
+}
+
+// VerifyEmail redeems a verification token, marking the user's email as verified
+func (vs *VerificationService) VerifyEmail(token string) error {
+	userID, email, err := models.ParseEmailVerificationToken(vs.SessionKeys, token, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Fails if the user changed their email since the token was sent
+	err = vs.UserRepo.MarkEmailVerified(userID.String(), email, time.Now())
+	if errors.Is(err, apperrors.ErrUserNotFound) {
+		return apperrors.ErrInvalidVerificationToken
+	}
+	return err
+}
+
+// verificationEmailBody renders the body of a verification email
+func (vs *VerificationService) verificationEmailBody(token string) string {
+	instructions := fmt.Sprintf("Use this token to verify your email address:\n\n%s", token)
+	if vs.VerifyURL != "" {
+		instructions = fmt.Sprintf(
+			"Follow this link to verify your email address:\n\n%s?token=%s",
+			vs.VerifyURL,
+			url.QueryEscape(token),
+		)
+	}
+
+	return fmt.Sprintf(
+		"Thanks for signing up!\n\n%s\n\nThis expires in %s. "+
+			"If you didn't create an account, you can ignore this email.\n",
+		instructions,
+		vs.TokenExpiration,
+	)
+}
@@ -0,0 +1,191 @@
+package services_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/repository"
+	"godiscauth/internal/services"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+)
+
+// TestVerificationService_ParseVerificationPolicy tests parsing of the verification policy setting
+func TestVerificationService_ParseVerificationPolicy(t *testing.T) {
+	is := is.New(t)
+
+	valid := map[string]services.VerificationPolicy{
+		"":          services.VerificationPolicyOff,
+		"off":       services.VerificationPolicyOff,
+		"login":     services.VerificationPolicyLogin,
+		"protected": services.VerificationPolicyProtected,
+	}
+	for s, expected := range valid {
+		policy, err := services.ParseVerificationPolicy(s)
+		is.NoErr(err)
+		is.Equal(policy, expected)
+	}
+
+	_, err := services.ParseVerificationPolicy("sometimes")
+	is.True(errors.Is(err, apperrors.ErrUnknownVerificationPolicy))
+}
+
+// TestVerificationService_NewVerificationService tests the creation of a new VerificationService
+func TestVerificationService_NewVerificationService(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("returns err with nil user repo", func(t *testing.T) {
+		vs, err := services.NewVerificationService(nil, &testutils.MockMailer{}, testutils.TestSessionKeys(), testutils.TestConfig().EmailVerification)
+		is.Equal(vs, nil)
+		is.Equal(err, apperrors.ErrUserRepoIsNil)
+	})
+
+	t.Run("returns err with nil mailer", func(t *testing.T) {
+		vs, err := services.NewVerificationService(repository.NewMemoryUserStore(), nil, testutils.TestSessionKeys(), testutils.TestConfig().EmailVerification)
+		is.Equal(vs, nil)
+		is.Equal(err, apperrors.ErrMailerIsNil)
+	})
+}
+
+// TestVerificationService_VerifyEmail tests the registration to verification flow
+func TestVerificationService_VerifyEmail(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("registration mails a token that verifies the email", func(t *testing.T) {
+		us, m := setupVerifyingUserService(t)
+		email := "testVerifyEmail@test.com"
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+
+		msg, ok := m.Last()
+		is.True(ok)
+		is.Equal(msg.To, email)
+		token := testutils.ExtractVerificationToken(msg.Body)
+		is.True(token != "")
+
+		err = us.Verifier.VerifyEmail(token)
+		is.NoErr(err)
+
+		user, err := us.UserRepo.GetUserByEmail(email)
+		is.NoErr(err)
+		is.True(user.IsEmailVerified())
+
+		// Verified profile reports it
+		profile, err := us.GetUserProfile(user.ID.String())
+		is.NoErr(err)
+		is.True(profile.EmailVerifiedAt != nil)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		us, _ := setupVerifyingUserService(t)
+		err := us.Verifier.VerifyEmail("not.aToken")
+		is.Equal(err, apperrors.ErrInvalidVerificationToken)
+	})
+
+	t.Run("email change invalidates old token and requires verification", func(t *testing.T) {
+		us, m := setupVerifyingUserService(t)
+		email := "testVerifyEmailChange@test.com"
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+		msg, _ := m.Last()
+		oldToken := testutils.ExtractVerificationToken(msg.Body)
+		err = us.Verifier.VerifyEmail(oldToken)
+		is.NoErr(err)
+
+		user, err := us.UserRepo.GetUserByEmail(email)
+		is.NoErr(err)
+
+		newEmail := "testVerifyEmailChanged@test.com"
+		err = us.UpdateUser(user.ID.String(), map[string]any{"email": newEmail})
+		is.NoErr(err)
+
+		user, err = us.UserRepo.GetUserByEmail(newEmail)
+		is.NoErr(err)
+		is.True(!user.IsEmailVerified())
+
+		// Token for the old address no longer works, the new one does
+		err = us.Verifier.VerifyEmail(oldToken)
+		is.Equal(err, apperrors.ErrInvalidVerificationToken)
+
+		msg, _ = m.Last()
+		is.Equal(msg.To, newEmail)
+		err = us.Verifier.VerifyEmail(testutils.ExtractVerificationToken(msg.Body))
+		is.NoErr(err)
+	})
+}
+
+// TestVerificationService_ResendVerification tests resending of verification emails
+func TestVerificationService_ResendVerification(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("empty email", func(t *testing.T) {
+		us, _ := setupVerifyingUserService(t)
+		err := us.Verifier.ResendVerification("")
+		is.Equal(err, apperrors.ErrEmailIsEmpty)
+	})
+
+	t.Run("unknown email sends nothing", func(t *testing.T) {
+		us, m := setupVerifyingUserService(t)
+		err := us.Verifier.ResendVerification("doesNotExist@test.com")
+		is.NoErr(err)
+		is.Equal(len(m.Messages), 0)
+	})
+
+	t.Run("throttles resends", func(t *testing.T) {
+		us, m := setupVerifyingUserService(t)
+		email := "testResendVerification@test.com"
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+		is.Equal(len(m.Messages), 1)
+
+		err = us.Verifier.ResendVerification(email)
+		is.Equal(err, apperrors.ErrVerificationThrottled)
+		is.Equal(len(m.Messages), 1)
+
+		// Resend goes through without a throttle window
+		us.Verifier.ResendInterval = 0
+		err = us.Verifier.ResendVerification(email)
+		is.NoErr(err)
+		is.Equal(len(m.Messages), 2)
+	})
+
+	t.Run("verified email is not resent", func(t *testing.T) {
+		us, m := setupVerifyingUserService(t)
+		email := "testResendVerificationVerified@test.com"
+		err := us.RegisterUser(email, testutils.TestingPassword)
+		is.NoErr(err)
+		msg, _ := m.Last()
+		err = us.Verifier.VerifyEmail(testutils.ExtractVerificationToken(msg.Body))
+		is.NoErr(err)
+
+		us.Verifier.ResendInterval = 0
+		err = us.Verifier.ResendVerification(email)
+		is.Equal(err, apperrors.ErrEmailAlreadyVerified)
+	})
+
+	t.Run("links to verification page when configured", func(t *testing.T) {
+		us, m := setupVerifyingUserService(t)
+		us.Verifier.VerifyURL = "https://discussion.test/verify"
+		err := us.RegisterUser("testVerificationURL@test.com", testutils.TestingPassword)
+		is.NoErr(err)
+
+		msg, _ := m.Last()
+		is.True(strings.Contains(msg.Body, "https://discussion.test/verify?token="))
+	})
+}
+
+func setupVerifyingUserService(t *testing.T) (*services.UserService, *testutils.MockMailer) {
+	t.Helper()
+
+	us := setupUserService(t)
+	m := &testutils.MockMailer{}
+	vs, err := services.NewVerificationService(us.UserRepo, m, testutils.TestSessionKeys(), testutils.TestConfig().EmailVerification)
+	if err != nil {
+		t.Fatalf("failed to create verification service: %v", err)
+	}
+	us.Verifier = vs
+	return us, m
+}
@@ -0,0 +1,439 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// passkeyAddedWithSecondFactor is the security event detail of passkeys added to accounts with
+// two-factor authentication
+const passkeyAddedWithSecondFactor = "confirmed with a second factor"
+
+// WebAuthnService contains the repositories needed to register passkeys and to log in with them,
+// either instead of a password or as a second factor
+type WebAuthnService struct {
+	UserRepo       repository.UserStore
+	CredentialRepo repository.WebAuthnCredentialStore
+	CeremonyRepo   repository.WebAuthnCeremonyStore
+	// Audit records passkeys being added and removed. Optional.
+	Audit *AuditService
+	// MFA makes users with two-factor authentication enter a second factor code to add a
+	// passkey, as passkey logins skip it. Optional.
+	MFA *MFAService
+	// WebAuthn runs the registration and login ceremonies for the configured relying party
+	WebAuthn *webauthn.WebAuthn
+	// CeremonyExpiration is how long a user has to answer a passkey prompt
+	CeremonyExpiration time.Duration
+}
+
+// NewWebAuthnService returns a value of type WebAuthnService for the relying party configured in
+// cfg, named after the MFA issuer
+func NewWebAuthnService(
+	ur repository.UserStore,
+	wr repository.WebAuthnCredentialStore,
+	cr repository.WebAuthnCeremonyStore,
+	cfg *config.Config,
+) (*WebAuthnService, error) {
+	if ur == nil {
+		return nil, apperrors.ErrUserRepoIsNil
+	}
+	if wr == nil {
+		return nil, apperrors.ErrPasskeyRepoIsNil
+	}
+	if cr == nil {
+		return nil, apperrors.ErrCeremonyRepoIsNil
+	}
+	if cfg == nil {
+		return nil, apperrors.ErrConfigIsNil
+	}
+
+	w, err := NewRelyingParty(cfg.WebAuthn, cfg.MFA.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnService{
+		UserRepo:           ur,
+		CredentialRepo:     wr,
+		CeremonyRepo:       cr,
+		WebAuthn:           w,
+		CeremonyExpiration: cfg.WebAuthn.CeremonyExpiration,
+	}, nil
+}
+
+// NewRelyingParty returns the WebAuthn relying party configured by cfg, shown to users as name
+func NewRelyingParty(cfg config.WebAuthnConfig, name string) (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: name,
+		RPOrigins:     cfg.RPOrigins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+	})
+}
+
+// BeginRegistration starts adding a passkey to a user's account. Users with two-factor
+// authentication have to enter a second factor `code`, so a hijacked session alone can't add a
+// passkey that logs in without one. It returns a ceremony token and the options to pass to
+// `navigator.credentials.create()`.
+func (ws *WebAuthnService) BeginRegistration(userID string, code string) (string, *protocol.CredentialCreation, error) {
+	user, err := ws.loadUser(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if ws.MFA != nil {
+		if err := ws.MFA.checkSecondFactorIfEnabled(userID, code); err != nil {
+			return "", nil, err
+		}
+	}
+
+	creation, session, err := ws.WebAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := ws.saveCeremony(&user.ID, models.WebAuthnCeremonyRegistration, session)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, creation, nil
+}
+
+// FinishRegistration checks the browser's response to `BeginRegistration` and stores the new
+// passkey
+func (ws *WebAuthnService) FinishRegistration(userID string, ceremonyToken string, response []byte) (*models.WebAuthnCredential, error) {
+	if len(response) == 0 {
+		return nil, apperrors.ErrPasskeyResponseIsEmpty
+	}
+	session, err := ws.consumeCeremony(ceremonyToken, models.WebAuthnCeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	user, err := ws.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, invalidPasskey(userID, err)
+	}
+	credential, err := ws.WebAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, invalidPasskey(userID, err)
+	}
+
+	cred, err := models.NewWebAuthnCredential(user.ID, credential.ID, credential.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	cred.AttestationType = credential.AttestationType
+	cred.AAGUID = credential.Authenticator.AAGUID
+	cred.SignCount = int64(credential.Authenticator.SignCount)
+	cred.BackupEligible = credential.Flags.BackupEligible
+	cred.BackupState = credential.Flags.BackupState
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+	cred.Transports = strings.Join(transports, ",")
+
+	if err := ws.CredentialRepo.CreateCredential(cred); err != nil {
+		return nil, err
+	}
+
+	// The second factor was checked when the ceremony began
+	detail := ""
+	if ws.MFA != nil {
+		enabled, err := ws.MFA.IsEnabled(userID)
+		if err != nil {
+			return nil, err
+		}
+		if enabled {
+			detail = passkeyAddedWithSecondFactor
+		}
+	}
+	ws.record(user.ID, models.SecurityEventPasskeyAdded, detail)
+	return cred, nil
+}
+
+// ListCredentials returns a user's passkeys, oldest first
+func (ws *WebAuthnService) ListCredentials(userID string) ([]models.WebAuthnCredential, error) {
+	return ws.CredentialRepo.GetCredentialsByUserID(userID)
+}
+
+// HasCredentials reports whether a user has registered any passkeys
+func (ws *WebAuthnService) HasCredentials(userID string) (bool, error) {
+	count, err := ws.CredentialRepo.CountCredentialsByUserID(userID)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// DeleteCredential removes one of a user's passkeys
+func (ws *WebAuthnService) DeleteCredential(userID string, id uuid.UUID) error {
+	if err := ws.CredentialRepo.DeleteCredential(userID, id); err != nil {
+		return err
+	}
+	if parsedID, err := uuid.Parse(userID); err == nil {
+		ws.record(parsedID, models.SecurityEventPasskeyRemoved, "")
+	}
+	return nil
+}
+
+// BeginLogin starts a passwordless login. No user is given: the browser offers whichever
+// passkeys it holds for this site. It returns a ceremony token and the options to pass to
+// `navigator.credentials.get()`.
+func (ws *WebAuthnService) BeginLogin() (string, *protocol.CredentialAssertion, error) {
+	// The passkey replaces both the password and the second factor, so the user has to unlock it
+	assertion, session, err := ws.WebAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := ws.saveCeremony(nil, models.WebAuthnCeremonyLogin, session)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, assertion, nil
+}
+
+// FinishLogin checks the browser's response to `BeginLogin` and returns the ID of the user the
+// passkey belongs to
+func (ws *WebAuthnService) FinishLogin(ceremonyToken string, response []byte) (uuid.UUID, error) {
+	if len(response) == 0 {
+		return uuid.Nil, apperrors.ErrPasskeyResponseIsEmpty
+	}
+	session, err := ws.consumeCeremony(ceremonyToken, models.WebAuthnCeremonyLogin)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return uuid.Nil, invalidPasskey("", err)
+	}
+	var user *webAuthnUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		user, err = ws.loadUser(userID.String())
+		return user, err
+	}
+	_, credential, err := ws.WebAuthn.ValidatePasskeyLogin(handler, *session, parsed)
+	if err != nil {
+		return uuid.Nil, invalidPasskey("", err)
+	}
+
+	if err := ws.useCredential(user, credential); err != nil {
+		return uuid.Nil, err
+	}
+	return user.ID, nil
+}
+
+// BeginSecondFactor starts a passkey check for a user who has entered a correct password. It
+// returns a ceremony token and the options to pass to `navigator.credentials.get()`.
+func (ws *WebAuthnService) BeginSecondFactor(userID uuid.UUID) (string, *protocol.CredentialAssertion, error) {
+	user, err := ws.loadUser(userID.String())
+	if err != nil {
+		return "", nil, err
+	}
+	if len(user.credentials) == 0 {
+		return "", nil, apperrors.ErrPasskeyNotFound
+	}
+
+	assertion, session, err := ws.WebAuthn.BeginLogin(user)
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := ws.saveCeremony(&user.ID, models.WebAuthnCeremonySecondFactor, session)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, assertion, nil
+}
+
+// FinishSecondFactor checks the browser's response to `BeginSecondFactor` for the same user
+func (ws *WebAuthnService) FinishSecondFactor(userID uuid.UUID, ceremonyToken string, response []byte) error {
+	if len(response) == 0 {
+		return apperrors.ErrPasskeyResponseIsEmpty
+	}
+	session, err := ws.consumeCeremony(ceremonyToken, models.WebAuthnCeremonySecondFactor)
+	if err != nil {
+		return err
+	}
+	user, err := ws.loadUser(userID.String())
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return invalidPasskey(userID.String(), err)
+	}
+	credential, err := ws.WebAuthn.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		return invalidPasskey(userID.String(), err)
+	}
+	return ws.useCredential(user, credential)
+}
+
+// useCredential stores the signature counter of a verified assertion. An assertion whose counter
+// didn't increase is rejected, since it was either replayed or made by a cloned authenticator.
+func (ws *WebAuthnService) useCredential(user *webAuthnUser, credential *webauthn.Credential) error {
+	for _, record := range user.records {
+		if !bytes.Equal(record.CredentialID, credential.ID) {
+			continue
+		}
+		if credential.Authenticator.CloneWarning {
+			log.Warn().
+				Str("userID", user.ID.String()).
+				Str("passkeyID", record.ID.String()).
+				Msg("Passkey signature counter did not increase")
+			return apperrors.ErrPasskeySignCountRejected
+		}
+		return ws.CredentialRepo.UpdateSignCount(record.ID, credential.Authenticator.SignCount, credential.Flags.BackupState, time.Now().UTC())
+	}
+	return apperrors.ErrPasskeyNotFound
+}
+
+// saveCeremony stores the state of a started ceremony and returns the token that identifies it
+func (ws *WebAuthnService) saveCeremony(userID *uuid.UUID, kind models.WebAuthnCeremonyKind, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	token, tokenHash, err := models.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	ceremony, err := models.NewWebAuthnCeremony(userID, tokenHash, kind, string(data), time.Now().UTC().Add(ws.CeremonyExpiration))
+	if err != nil {
+		return "", err
+	}
+	if err := ws.CeremonyRepo.CreateCeremony(ceremony); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeCeremony loads and discards the state of a started ceremony
+func (ws *WebAuthnService) consumeCeremony(token string, kind models.WebAuthnCeremonyKind) (*webauthn.SessionData, error) {
+	if token == "" {
+		return nil, apperrors.ErrWebAuthnCeremonyIsEmpty
+	}
+	ceremony, err := ws.CeremonyRepo.ConsumeCeremony(models.HashToken(token), kind)
+	if err != nil {
+		return nil, err
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(ceremony.SessionData), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// loadUser loads a user and their passkeys in the form the webauthn library expects
+func (ws *WebAuthnService) loadUser(userID string) (*webAuthnUser, error) {
+	if userID == "" {
+		return nil, apperrors.ErrUserIdEmpty
+	}
+	user, err := ws.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	records, err := ws.CredentialRepo.GetCredentialsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(records))
+	for _, record := range records {
+		transports := make([]protocol.AuthenticatorTransport, 0)
+		for _, transport := range record.TransportList() {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              record.CredentialID,
+			PublicKey:       record.PublicKey,
+			AttestationType: record.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: record.BackupEligible,
+				BackupState:    record.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    record.AAGUID,
+				SignCount: uint32(record.SignCount),
+			},
+		})
+	}
+	return &webAuthnUser{User: user, records: records, credentials: credentials}, nil
+}
+
+// record adds an event to the user's security activity if auditing is configured
+func (ws *WebAuthnService) record(userID uuid.UUID, eventType models.SecurityEventType, detail string) {
+	if ws.Audit == nil {
+		return
+	}
+	ws.Audit.Record(userID, eventType, detail)
+}
+
+// invalidPasskey logs why the webauthn library rejected a passkey response and returns a generic
+// error, since the details are only useful for debugging
+func invalidPasskey(userID string, err error) error {
+	event := log.Info().Str("error", err.Error())
+	if userID != "" {
+		event = event.Str("userID", userID)
+	}
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) {
+		event = event.Str("details", protocolErr.Details).Str("info", protocolErr.DevInfo)
+	}
+	event.Msg("Passkey response rejected")
+	return apperrors.ErrInvalidPasskey
+}
+
+// webAuthnUser adapts a user to the webauthn library's User interface. The user handle is the
+// user's ID, so a passkey login can find the account without an email address.
+type webAuthnUser struct {
+	*models.User
+	records     []models.WebAuthnCredential
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return u.ID[:]
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.Email
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
@@ -0,0 +1,463 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/internal/models"
+	"godiscauth/internal/repository"
+	"godiscauth/internal/services"
+	"godiscauth/internal/testutils"
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// TestWebAuthnService_NewWebAuthnService tests the creation of a new WebAuthnService
+func TestWebAuthnService_NewWebAuthnService(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("returns err with nil repos", func(t *testing.T) {
+		ur := repository.NewMemoryUserStore()
+		wr := repository.NewMemoryWebAuthnCredentialStore()
+
+		_, err := services.NewWebAuthnService(nil, wr, nil, testutils.TestConfig())
+		is.Equal(err, apperrors.ErrUserRepoIsNil)
+		_, err = services.NewWebAuthnService(ur, nil, nil, testutils.TestConfig())
+		is.Equal(err, apperrors.ErrPasskeyRepoIsNil)
+		_, err = services.NewWebAuthnService(ur, wr, nil, testutils.TestConfig())
+		is.Equal(err, apperrors.ErrCeremonyRepoIsNil)
+	})
+}
+
+// TestWebAuthnService_Registration tests adding and removing passkeys
+func TestWebAuthnService_Registration(t *testing.T) {
+	is := is.New(t)
+
+	email := "testPasskeyRegistration@test.com"
+
+	t.Run("registration stores the passkey", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := registerPasskey(t, us, userID)
+
+		creds, err := us.Passkeys.ListCredentials(userID)
+		is.NoErr(err)
+		is.Equal(len(creds), 1)
+		is.Equal(creds[0].CredentialID, authenticator.CredentialID)
+		is.Equal(creds[0].AttestationType, "none")
+		is.Equal(creds[0].TransportList(), []string{"internal"})
+
+		events, err := us.MFA.Audit.ListActivity(userID)
+		is.NoErr(err)
+		is.Equal(events[0].Type, models.SecurityEventPasskeyAdded)
+	})
+
+	t.Run("users with two-factor authentication need a code", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		secret, _ := enableTOTP(t, us, userID)
+		authenticator := newSoftAuthenticator(t)
+
+		_, _, err := us.Passkeys.BeginRegistration(userID, "")
+		is.Equal(err, apperrors.ErrMFACodeIsEmpty)
+		_, _, err = us.Passkeys.BeginRegistration(userID, "000000")
+		is.Equal(err, apperrors.ErrInvalidMFACode)
+
+		ceremony, options, err := us.Passkeys.BeginRegistration(userID, totpCode(t, secret, 0))
+		is.NoErr(err)
+		response, err := authenticator.CreateCredential(options)
+		is.NoErr(err)
+		_, err = us.Passkeys.FinishRegistration(userID, ceremony, response)
+		is.NoErr(err)
+
+		events, err := us.MFA.Audit.ListActivity(userID)
+		is.NoErr(err)
+		is.Equal(events[0].Type, models.SecurityEventPasskeyAdded)
+		is.Equal(events[0].Detail, "confirmed with a second factor")
+	})
+
+	t.Run("ceremony is single use", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := newSoftAuthenticator(t)
+
+		ceremony, options, err := us.Passkeys.BeginRegistration(userID, "")
+		is.NoErr(err)
+		response, err := authenticator.CreateCredential(options)
+		is.NoErr(err)
+		_, err = us.Passkeys.FinishRegistration(userID, ceremony, response)
+		is.NoErr(err)
+		_, err = us.Passkeys.FinishRegistration(userID, ceremony, response)
+		is.Equal(err, apperrors.ErrInvalidWebAuthnCeremony)
+	})
+
+	t.Run("ceremony belongs to the user who started it", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		otherID := registerTestUser(t, us, "testPasskeyRegistrationOther@test.com")
+		authenticator := newSoftAuthenticator(t)
+
+		ceremony, options, err := us.Passkeys.BeginRegistration(userID, "")
+		is.NoErr(err)
+		response, err := authenticator.CreateCredential(options)
+		is.NoErr(err)
+		_, err = us.Passkeys.FinishRegistration(otherID, ceremony, response)
+		is.Equal(err, apperrors.ErrInvalidPasskey)
+	})
+
+	t.Run("response to another challenge is rejected", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := newSoftAuthenticator(t)
+
+		_, options, err := us.Passkeys.BeginRegistration(userID, "")
+		is.NoErr(err)
+		ceremony, _, err := us.Passkeys.BeginRegistration(userID, "")
+		is.NoErr(err)
+		response, err := authenticator.CreateCredential(options)
+		is.NoErr(err)
+		_, err = us.Passkeys.FinishRegistration(userID, ceremony, response)
+		is.Equal(err, apperrors.ErrInvalidPasskey)
+	})
+
+	t.Run("expired ceremony is rejected", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		us.Passkeys.CeremonyExpiration = -time.Minute
+		authenticator := newSoftAuthenticator(t)
+
+		ceremony, options, err := us.Passkeys.BeginRegistration(userID, "")
+		is.NoErr(err)
+		response, err := authenticator.CreateCredential(options)
+		is.NoErr(err)
+		_, err = us.Passkeys.FinishRegistration(userID, ceremony, response)
+		is.Equal(err, apperrors.ErrInvalidWebAuthnCeremony)
+	})
+
+	t.Run("passkey can't be registered twice", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := registerPasskey(t, us, userID)
+
+		ceremony, options, err := us.Passkeys.BeginRegistration(userID, "")
+		is.NoErr(err)
+		is.Equal(len(options.Response.CredentialExcludeList), 1)
+		response, err := authenticator.CreateCredential(options)
+		is.NoErr(err)
+		_, err = us.Passkeys.FinishRegistration(userID, ceremony, response)
+		is.Equal(err, apperrors.ErrPasskeyAlreadyRegistered)
+	})
+
+	t.Run("passkey can be deleted by its owner", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		otherID := registerTestUser(t, us, "testPasskeyRegistrationOther@test.com")
+		registerPasskey(t, us, userID)
+
+		creds, err := us.Passkeys.ListCredentials(userID)
+		is.NoErr(err)
+		is.Equal(us.Passkeys.DeleteCredential(otherID, creds[0].ID), apperrors.ErrPasskeyNotFound)
+		is.NoErr(us.Passkeys.DeleteCredential(userID, creds[0].ID))
+		is.Equal(us.Passkeys.DeleteCredential(userID, creds[0].ID), apperrors.ErrPasskeyNotFound)
+
+		hasPasskeys, err := us.Passkeys.HasCredentials(userID)
+		is.NoErr(err)
+		is.True(!hasPasskeys)
+	})
+}
+
+// TestWebAuthnService_Login tests logging in with a passkey instead of a password
+func TestWebAuthnService_Login(t *testing.T) {
+	is := is.New(t)
+
+	email := "testPasskeyLogin@test.com"
+
+	t.Run("passkey login returns a session", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := registerPasskey(t, us, userID)
+
+		token, err := passkeyLogin(t, us, authenticator)
+		is.NoErr(err)
+
+		// A user verifying passkey counts as two factors
+		session := sessionFromToken(t, us, token)
+		is.Equal(session.UserID.String(), userID)
+		is.True(session.MFA)
+
+		creds, err := us.Passkeys.ListCredentials(userID)
+		is.NoErr(err)
+		is.Equal(creds[0].SignCount, int64(authenticator.SignCount))
+		is.True(creds[0].LastUsedAt != nil)
+
+		user, err := us.UserRepo.GetUserByID(userID)
+		is.NoErr(err)
+		is.True(user.LastLogin != nil)
+	})
+
+	t.Run("passkey login skips the second factor", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := registerPasskey(t, us, userID)
+		enableTOTP(t, us, userID)
+
+		token, err := passkeyLogin(t, us, authenticator)
+		is.NoErr(err)
+		is.True(token != "")
+	})
+
+	t.Run("ceremony is single use", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := registerPasskey(t, us, userID)
+
+		ceremony, options, err := us.Passkeys.BeginLogin()
+		is.NoErr(err)
+		response, err := authenticator.GetAssertion(options)
+		is.NoErr(err)
+		_, err = us.LoginWithPasskey(ceremony, response, models.ClientInfo{})
+		is.NoErr(err)
+		_, err = us.LoginWithPasskey(ceremony, response, models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidWebAuthnCeremony)
+	})
+
+	t.Run("replayed assertion is rejected", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := registerPasskey(t, us, userID)
+
+		ceremony, options, err := us.Passkeys.BeginLogin()
+		is.NoErr(err)
+		response, err := authenticator.GetAssertion(options)
+		is.NoErr(err)
+
+		// Replaying the response against a new ceremony fails on the challenge
+		_, err = us.LoginWithPasskey(ceremony, response, models.ClientInfo{})
+		is.NoErr(err)
+		ceremony, _, err = us.Passkeys.BeginLogin()
+		is.NoErr(err)
+		_, err = us.LoginWithPasskey(ceremony, response, models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidPasskey)
+	})
+
+	t.Run("cloned authenticator is rejected", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := registerPasskey(t, us, userID)
+
+		_, err := passkeyLogin(t, us, authenticator)
+		is.NoErr(err)
+		_, err = passkeyLogin(t, us, authenticator)
+		is.NoErr(err)
+
+		// A copy of the key that has been used less often sends a lower counter
+		authenticator.SignCount = 0
+		_, err = passkeyLogin(t, us, authenticator)
+		is.Equal(err, apperrors.ErrPasskeySignCountRejected)
+	})
+
+	t.Run("passkey without user verification is rejected", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := registerPasskey(t, us, userID)
+		authenticator.UserVerified = false
+
+		_, err := passkeyLogin(t, us, authenticator)
+		is.Equal(err, apperrors.ErrInvalidPasskey)
+	})
+
+	t.Run("deleted passkey is rejected", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := registerPasskey(t, us, userID)
+
+		creds, err := us.Passkeys.ListCredentials(userID)
+		is.NoErr(err)
+		is.NoErr(us.Passkeys.DeleteCredential(userID, creds[0].ID))
+
+		_, err = passkeyLogin(t, us, authenticator)
+		is.Equal(err, apperrors.ErrInvalidPasskey)
+	})
+
+	t.Run("locked account is rejected", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := registerPasskey(t, us, userID)
+		is.NoErr(us.UserRepo.LockAccount(userID, time.Now().Add(time.Hour)))
+
+		_, err := passkeyLogin(t, us, authenticator)
+		is.Equal(err, apperrors.ErrAccountIsLocked)
+	})
+
+	t.Run("unverified email is rejected when required at login", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		us.VerificationPolicy = services.VerificationPolicyLogin
+		userID := registerTestUser(t, us, email)
+		authenticator := registerPasskey(t, us, userID)
+
+		_, err := passkeyLogin(t, us, authenticator)
+		is.Equal(err, apperrors.ErrEmailNotVerified)
+	})
+}
+
+// TestWebAuthnService_SecondFactor tests answering a two-factor login challenge with a passkey
+func TestWebAuthnService_SecondFactor(t *testing.T) {
+	is := is.New(t)
+
+	email := "testPasskeySecondFactor@test.com"
+
+	t.Run("passkey completes a two-factor login", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := registerPasskey(t, us, userID)
+		enableTOTP(t, us, userID)
+
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		is.True(result.MFAChallenge != "")
+
+		ceremony, options, err := us.MFA.BeginPasskeyChallenge(result.MFAChallenge)
+		is.NoErr(err)
+		is.Equal(len(options.Response.AllowedCredentials), 1)
+		response, err := authenticator.GetAssertion(options)
+		is.NoErr(err)
+		token, err := us.CompleteMFALoginWithPasskey(result.MFAChallenge, ceremony, response, models.ClientInfo{})
+		is.NoErr(err)
+		is.True(sessionFromToken(t, us, token).MFA)
+
+		// The challenge can't be exchanged again with a code or a passkey
+		_, err = us.CompleteMFALogin(result.MFAChallenge, "123456", models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+		_, _, err = us.MFA.BeginPasskeyChallenge(result.MFAChallenge)
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+	})
+
+	t.Run("another user's passkey is rejected", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		registerPasskey(t, us, userID)
+		enableTOTP(t, us, userID)
+		otherID := registerTestUser(t, us, "testPasskeySecondFactorOther@test.com")
+		other := registerPasskey(t, us, otherID)
+
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		ceremony, options, err := us.MFA.BeginPasskeyChallenge(result.MFAChallenge)
+		is.NoErr(err)
+		response, err := other.GetAssertion(options)
+		is.NoErr(err)
+		_, err = us.CompleteMFALoginWithPasskey(result.MFAChallenge, ceremony, response, models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidPasskey)
+	})
+
+	t.Run("failed passkey counts as an attempt", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		registerPasskey(t, us, userID)
+		enableTOTP(t, us, userID)
+		us.MFA.MaxChallengeAttempts = 1
+
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		ceremony, _, err := us.MFA.BeginPasskeyChallenge(result.MFAChallenge)
+		is.NoErr(err)
+		_, err = us.CompleteMFALoginWithPasskey(result.MFAChallenge, ceremony, []byte(`{}`), models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidPasskey)
+		_, err = us.CompleteMFALogin(result.MFAChallenge, "123456", models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidMFAChallenge)
+	})
+
+	t.Run("user without passkeys can't start a passkey check", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		enableTOTP(t, us, userID)
+
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		_, _, err = us.MFA.BeginPasskeyChallenge(result.MFAChallenge)
+		is.Equal(err, apperrors.ErrPasskeyNotFound)
+	})
+
+	t.Run("passkey login ceremony can't answer a challenge", func(t *testing.T) {
+		us := setupPasskeyUserService(t)
+		userID := registerTestUser(t, us, email)
+		authenticator := registerPasskey(t, us, userID)
+		enableTOTP(t, us, userID)
+
+		result, err := us.LoginUser(email, testutils.TestingPassword, models.ClientInfo{})
+		is.NoErr(err)
+		ceremony, options, err := us.Passkeys.BeginLogin()
+		is.NoErr(err)
+		response, err := authenticator.GetAssertion(options)
+		is.NoErr(err)
+		_, err = us.CompleteMFALoginWithPasskey(result.MFAChallenge, ceremony, response, models.ClientInfo{})
+		is.Equal(err, apperrors.ErrInvalidWebAuthnCeremony)
+	})
+}
+
+// newSoftAuthenticator creates a software authenticator for the default relying party origin
+func newSoftAuthenticator(t *testing.T) *testutils.SoftAuthenticator {
+	t.Helper()
+
+	authenticator, err := testutils.NewSoftAuthenticator(config.Default().WebAuthn.RPOrigins[0])
+	if err != nil {
+		t.Fatalf("failed to create software authenticator: %v", err)
+	}
+	return authenticator
+}
+
+// registerPasskey registers a new software authenticator for a user and returns it
+func registerPasskey(t *testing.T, us *services.UserService, userID string) *testutils.SoftAuthenticator {
+	t.Helper()
+
+	authenticator := newSoftAuthenticator(t)
+	ceremony, options, err := us.Passkeys.BeginRegistration(userID, "")
+	if err != nil {
+		t.Fatalf("failed to begin passkey registration: %v", err)
+	}
+	response, err := authenticator.CreateCredential(options)
+	if err != nil {
+		t.Fatalf("failed to create passkey: %v", err)
+	}
+	if _, err := us.Passkeys.FinishRegistration(userID, ceremony, response); err != nil {
+		t.Fatalf("failed to finish passkey registration: %v", err)
+	}
+	return authenticator
+}
+
+// passkeyLogin runs a passwordless login ceremony with an authenticator
+func passkeyLogin(t *testing.T, us *services.UserService, authenticator *testutils.SoftAuthenticator) (string, error) {
+	t.Helper()
+
+	ceremony, options, err := us.Passkeys.BeginLogin()
+	if err != nil {
+		t.Fatalf("failed to begin passkey login: %v", err)
+	}
+	response, err := authenticator.GetAssertion(options)
+	if err != nil {
+		t.Fatalf("failed to sign passkey assertion: %v", err)
+	}
+	return us.LoginWithPasskey(ceremony, response, models.ClientInfo{})
+}
+
+func setupPasskeyUserService(t *testing.T) *services.UserService {
+	t.Helper()
+
+	us := setupMFAUserService(t)
+	ws, err := services.NewWebAuthnService(
+		us.UserRepo,
+		repository.NewMemoryWebAuthnCredentialStore(),
+		repository.NewMemoryWebAuthnCeremonyStore(),
+		testutils.TestConfig(),
+	)
+	if err != nil {
+		t.Fatalf("failed to create WebAuthn service: %v", err)
+	}
+	ws.Audit = us.MFA.Audit
+	ws.MFA = us.MFA
+	us.MFA.Passkeys = ws
+	us.Passkeys = ws
+	return us
+}
@@ -0,0 +1,49 @@
+package testutils
+
+import (
+	"regexp"
+	"sync"
+
+	"godiscauth/internal/mailer"
+)
+
+// tokenPattern matches the opaque tokens created by `models.GenerateToken`
+var tokenPattern = regexp.MustCompile(`[A-Za-z0-9_-]{43}`)
+
+// verificationTokenPattern matches the signed tokens created by `models.NewEmailVerificationToken`,
+// with or without the ID of the key that signed them
+var verificationTokenPattern = regexp.MustCompile(`[A-Za-z0-9_-]+\.(?:[A-Za-z0-9_-]+\.)?[A-Za-z0-9_-]{43}`)
+
+// MockMailer records messages instead of sending them so tests can inspect them
+type MockMailer struct {
+	mu       sync.Mutex
+	Messages []mailer.Message
+}
+
+// Send records the message
+func (m *MockMailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Messages = append(m.Messages, msg)
+	return nil
+}
+
+// Last returns the most recently sent message, if any
+func (m *MockMailer) Last() (mailer.Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.Messages) == 0 {
+		return mailer.Message{}, false
+	}
+	return m.Messages[len(m.Messages)-1], true
+}
+
+// ExtractToken returns the first opaque token found in an email body
+func ExtractToken(body string) string {
+	return tokenPattern.FindString(body)
+}
+
+// ExtractVerificationToken returns the first email verification token found in an email body
+func ExtractVerificationToken(body string) string {
+	return verificationTokenPattern.FindString(body)
+}
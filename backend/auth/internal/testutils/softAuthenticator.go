@@ -0,0 +1,177 @@
+package testutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// SoftAuthenticator is an in-memory passkey for tests. It answers registration and login
+// options the way a browser and platform authenticator would, using a P-256 key and "none"
+// attestation.
+type SoftAuthenticator struct {
+	Origin       string
+	CredentialID []byte
+	UserHandle   []byte
+	// SignCount is the signature counter of the last response. Each assertion increments it first.
+	// Setting it back makes the authenticator look cloned.
+	SignCount uint32
+	// UserVerified sets the UV flag, as if the user entered a PIN or used biometrics
+	UserVerified bool
+
+	key *ecdsa.PrivateKey
+}
+
+// NewSoftAuthenticator creates a SoftAuthenticator that signs for the given origin
+func NewSoftAuthenticator(origin string) (*SoftAuthenticator, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	credentialID := make([]byte, 32)
+	if _, err := rand.Read(credentialID); err != nil {
+		return nil, err
+	}
+	return &SoftAuthenticator{
+		Origin:       origin,
+		CredentialID: credentialID,
+		UserVerified: true,
+		key:          key,
+	}, nil
+}
+
+// CreateCredential answers registration options with a new credential and returns the JSON a
+// browser would send back from `navigator.credentials.create()`
+func (a *SoftAuthenticator) CreateCredential(options *protocol.CredentialCreation) (json.RawMessage, error) {
+	if options == nil {
+		return nil, errors.New("registration options are nil")
+	}
+	// The user handle is raw bytes when the options come straight from the webauthn library and a
+	// base64url string once they have been through JSON
+	switch userHandle := options.Response.User.ID.(type) {
+	case protocol.URLEncodedBase64:
+		a.UserHandle = userHandle
+	case string:
+		decoded, err := base64.RawURLEncoding.DecodeString(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		a.UserHandle = decoded
+	default:
+		return nil, fmt.Errorf("unexpected user handle type %T", options.Response.User.ID)
+	}
+
+	clientData, err := a.clientData(protocol.CreateCeremony, options.Response.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Attested credential data: AAGUID, credential ID length, credential ID, public key
+	attested := make([]byte, 16, 16+2+len(a.CredentialID)+len(publicKey))
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.CredentialID)))
+	attested = append(attested, a.CredentialID...)
+	attested = append(attested, publicKey...)
+	authData := a.authenticatorData(options.Response.RelyingParty.ID, protocol.FlagAttestedCredentialData, attested)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+			"transports":        []string{"internal"},
+		},
+	})
+}
+
+// GetAssertion answers login options by signing the challenge and returns the JSON a browser
+// would send back from `navigator.credentials.get()`
+func (a *SoftAuthenticator) GetAssertion(options *protocol.CredentialAssertion) (json.RawMessage, error) {
+	if options == nil {
+		return nil, errors.New("login options are nil")
+	}
+
+	clientData, err := a.clientData(protocol.AssertCeremony, options.Response.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	a.SignCount++
+	authData := a.authenticatorData(options.Response.RelyingPartyID, 0, nil)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(a.UserHandle),
+		},
+	})
+}
+
+// clientData builds the clientDataJSON the browser would sign over
+func (a *SoftAuthenticator) clientData(ceremony protocol.CeremonyType, challenge protocol.URLEncodedBase64) ([]byte, error) {
+	return json.Marshal(protocol.CollectedClientData{
+		Type:      ceremony,
+		Challenge: challenge.String(),
+		Origin:    a.Origin,
+	})
+}
+
+// authenticatorData builds the authenticator data: the RP ID hash, flags, signature counter and
+// any attested credential data
+func (a *SoftAuthenticator) authenticatorData(rpID string, flags protocol.AuthenticatorFlags, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags |= protocol.FlagUserPresent
+	if a.UserVerified {
+		flags |= protocol.FlagUserVerified
+	}
+
+	data := make([]byte, 0, 37+len(attested))
+	data = append(data, rpIDHash[:]...)
+	data = append(data, byte(flags))
+	data = binary.BigEndian.AppendUint32(data, a.SignCount)
+	return append(data, attested...)
+}
@@ -0,0 +1,106 @@
+package testutils_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/matryer/is"
+
+	"godiscauth/internal/testutils"
+)
+
+// TestSoftAuthenticator checks that the webauthn library accepts the software authenticator's
+// registration and login responses, so service and handler tests exercise real ceremonies
+func TestSoftAuthenticator(t *testing.T) {
+	is := is.New(t)
+
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          "localhost",
+		RPDisplayName: "Test",
+		RPOrigins:     []string{"http://localhost:3000"},
+	})
+	is.NoErr(err)
+	authenticator, err := testutils.NewSoftAuthenticator("http://localhost:3000")
+	is.NoErr(err)
+	user := &softUser{id: []byte("0123456789abcdef")}
+
+	creation, session, err := w.BeginRegistration(user)
+	is.NoErr(err)
+	response, err := authenticator.CreateCredential(creation)
+	is.NoErr(err)
+	parsedCreation, err := protocol.ParseCredentialCreationResponseBytes(response)
+	is.NoErr(err)
+	credential, err := w.CreateCredential(user, *session, parsedCreation)
+	is.NoErr(err)
+	is.Equal(credential.ID, authenticator.CredentialID)
+	user.credentials = append(user.credentials, *credential)
+
+	t.Run("assertion is accepted and increments the counter", func(t *testing.T) {
+		assertion, session, err := w.BeginLogin(user, webauthn.WithUserVerification(protocol.VerificationRequired))
+		is.NoErr(err)
+		response, err := authenticator.GetAssertion(assertion)
+		is.NoErr(err)
+		parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+		is.NoErr(err)
+		used, err := w.ValidateLogin(user, *session, parsed)
+		is.NoErr(err)
+		is.Equal(used.Authenticator.SignCount, uint32(1))
+		is.True(!used.Authenticator.CloneWarning)
+	})
+
+	t.Run("options can come from JSON", func(t *testing.T) {
+		assertion, session, err := w.BeginLogin(user)
+		is.NoErr(err)
+		data, err := json.Marshal(assertion)
+		is.NoErr(err)
+		var decoded protocol.CredentialAssertion
+		is.NoErr(json.Unmarshal(data, &decoded))
+
+		response, err := authenticator.GetAssertion(&decoded)
+		is.NoErr(err)
+		parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+		is.NoErr(err)
+		_, err = w.ValidateLogin(user, *session, parsed)
+		is.NoErr(err)
+	})
+
+	t.Run("assertion for another challenge is rejected", func(t *testing.T) {
+		assertion, _, err := w.BeginLogin(user)
+		is.NoErr(err)
+		_, session, err := w.BeginLogin(user)
+		is.NoErr(err)
+		response, err := authenticator.GetAssertion(assertion)
+		is.NoErr(err)
+		parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+		is.NoErr(err)
+		_, err = w.ValidateLogin(user, *session, parsed)
+		is.True(err != nil)
+	})
+
+	t.Run("missing user verification is rejected when required", func(t *testing.T) {
+		authenticator.UserVerified = false
+		t.Cleanup(func() { authenticator.UserVerified = true })
+
+		assertion, session, err := w.BeginLogin(user, webauthn.WithUserVerification(protocol.VerificationRequired))
+		is.NoErr(err)
+		response, err := authenticator.GetAssertion(assertion)
+		is.NoErr(err)
+		parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+		is.NoErr(err)
+		_, err = w.ValidateLogin(user, *session, parsed)
+		is.True(err != nil)
+	})
+}
+
+// softUser is a minimal webauthn.User
+type softUser struct {
+	id          []byte
+	credentials []webauthn.Credential
+}
+
+func (u *softUser) WebAuthnID() []byte                         { return u.id }
+func (u *softUser) WebAuthnName() string                       { return "test@test.com" }
+func (u *softUser) WebAuthnDisplayName() string                { return "test@test.com" }
+func (u *softUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
@@ -4,6 +4,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,17 +15,31 @@ import (
 	"gorm.io/gorm/logger"
 
 	"godiscauth/internal/database"
+	"godiscauth/internal/models"
 	"godiscauth/pkg/config"
+	"godiscauth/pkg/keyring"
 )
 
 const TestingPassword = "correcthorsebatterystaple"
 
+// TestingMinEntropyBits is the password strength users are created with in tests
+const TestingMinEntropyBits = 64
+
+// TestingServiceID and TestingServiceSecret are the credentials of the internal service allowed to
+// introspect sessions in tests
+const (
+	TestingServiceID     = "testservice"
+	TestingServiceSecret = "testservicesecretthatislongenoughtobeaccepted"
+)
+
 // TestEnvSetup sets environment variables for the tests. The tests assume the
 // relevant test database has been created. See `scripts/init_testing.sql` to
 // create the testing database.
 func TestEnvSetup() {
 	os.Setenv(config.SessionKey, uuid.New().String())
+	os.Setenv(config.EnvMFAKey, uuid.New().String())
 	os.Setenv(config.AuthServerPort, "3001")
+	os.Setenv(config.EnvServiceCredentials, TestingServiceID+":"+TestingServiceSecret)
 	os.Setenv(config.DatabaseURL, "host=localhost user=godiscauth_test password=godiscauth_test dbname=godiscauth_test port=5432 sslmode=disable TimeZone=UTC")
 
 	zerolog.SetGlobalLevel(zerolog.Disabled)
@@ -33,8 +48,29 @@ func TestEnvSetup() {
 	gin.DefaultWriter = io.Discard
 }
 
-// TestDBSetup sets up a test database connection.
-func TestDBSetup() *gorm.DB {
+// TestConfig returns the config of the environment set up by `TestEnvSetup`
+func TestConfig() *config.Config {
+	cfg, err := config.Load("")
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	return cfg
+}
+
+// TestSessionKeys returns the session key ring of the environment set up by `TestEnvSetup`
+func TestSessionKeys() *keyring.KeyRing {
+	keys, err := models.LoadSessionKeyRing(TestConfig().Sessions)
+	if err != nil {
+		log.Fatalf("Error loading session keys: %v", err)
+	}
+	return keys
+}
+
+// TestDBSetup sets up a test database connection. The test is skipped if the test database can't be
+// reached, so the tests that don't need it still run without Postgres.
+func TestDBSetup(t testing.TB) *gorm.DB {
+	t.Helper()
+
 	// Silence GORM logs for testing
 	gormLogger := logger.New(
 		log.New(io.Discard, "", log.LstdFlags),
@@ -47,16 +83,16 @@ func TestDBSetup() *gorm.DB {
 	)
 
 	// Connect to test DB
-	db, err := gorm.Open(postgres.Open(os.Getenv(config.DatabaseURL)), &gorm.Config{
+	db, err := gorm.Open(postgres.Open(TestConfig().Database.URL), &gorm.Config{
 		Logger: gormLogger,
 	})
 	if err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
+		t.Skipf("Test database unavailable: %v", err)
 	}
 
 	err = database.Migrate(db)
 	if err != nil {
-		log.Fatalf("Error migrating database: %v", err)
+		t.Fatalf("Error migrating database: %v", err)
 	}
 	return db
 }
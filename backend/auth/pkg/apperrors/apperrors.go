@@ -13,6 +13,26 @@ var (
 	ErrSessionIDGeneration = New("Could not generate token")
 	ErrInvalidTokenFormat  = New("Invalid token format")
 
+	// Session errors
+	ErrInvalidSessionSignature    = New("Session token signature is invalid")
+	ErrSessionNotFound            = New("Session not found")
+	ErrCannotRevokeCurrentSession = New("The current session can't be revoked, log out instead")
+	ErrTooManySessions            = New("Too many active sessions, log out on another device first")
+	ErrUnknownSessionLimitPolicy  = New("Unknown session limit policy")
+	ErrInvalidMaxSessions         = New("Maximum number of sessions is invalid")
+	ErrInvalidBatchSize           = New("Batch size must be positive")
+	ErrUnknownSessionStore        = New("Unknown session store")
+	ErrRedisURLIsEmpty            = New("Redis URL is empty")
+
+	// Service authentication errors
+	ErrInvalidServiceCredentials = New("Service credentials are malformed")
+	ErrServiceSecretTooShort     = New("Service secret is too short")
+
+	// Auth client errors
+	ErrInvalidAuthServiceURL     = New("Auth service URL is invalid")
+	ErrServiceCredentialsMissing = New("Service credentials are not set")
+	ErrUnauthenticated           = New("Session is missing, invalid or expired")
+
 	// User registration errors
 	ErrDuplicateEmail = New("Email already exists in database")
 	ErrEmailIsEmpty   = New("Email is empty")
@@ -21,25 +41,118 @@ var (
 	// User registration errors
 	ErrSessionAlreadyExists = New("Session already exists")
 
+	// Password reset errors
+	ErrInvalidResetToken = New("Password reset token is invalid or expired")
+
+	// Email verification errors
+	ErrEmailNotVerified          = New("Email address is not verified")
+	ErrInvalidVerificationToken  = New("Email verification token is invalid or expired")
+	ErrEmailAlreadyVerified      = New("Email address is already verified")
+	ErrVerificationThrottled     = New("Verification email was sent recently, try again later")
+	ErrUnknownVerificationPolicy = New("Unknown email verification policy")
+	ErrVerificationTokenIsEmpty  = New("Email verification token is empty")
+
+	// Two-factor authentication errors
+	ErrInvalidMFACode      = New("Invalid two-factor authentication code")
+	ErrInvalidMFAChallenge = New("Two-factor login challenge is invalid or expired")
+	ErrMFAAlreadyEnabled   = New("Two-factor authentication is already enabled")
+	ErrMFANotEnrolled      = New("Two-factor authentication is not set up")
+	ErrMFAChallengeIsEmpty = New("Two-factor login challenge is empty")
+	ErrMFACodeIsEmpty      = New("Two-factor authentication code is empty")
+
+	// Passkey errors
+	ErrInvalidPasskey             = New("Passkey could not be verified")
+	ErrInvalidWebAuthnCeremony    = New("Passkey ceremony is invalid or expired")
+	ErrPasskeyNotFound            = New("Passkey not found")
+	ErrPasskeyAlreadyRegistered   = New("Passkey is already registered")
+	ErrPasskeySignCountRejected   = New("Passkey signature counter did not increase, it may have been cloned")
+	ErrWebAuthnCeremonyIsEmpty    = New("Passkey ceremony is empty")
+	ErrPasskeyResponseIsEmpty     = New("Passkey response is empty")
+	ErrPasskeyCredentialIDIsEmpty = New("Passkey credential ID is empty")
+	ErrPasskeyPublicKeyIsEmpty    = New("Passkey public key is empty")
+
+	// Encryption errors
+	ErrEncryptionKeyIsEmpty = New("Encryption key is empty")
+	ErrDecryptionFailed     = New("Could not decrypt value")
+
+	// Key ring errors
+	ErrInvalidKeyID       = New("Key ID is invalid")
+	ErrDuplicateKeyID     = New("Key ID is listed twice")
+	ErrKeyTooShort        = New("Key is too short")
+	ErrPrimaryKeyNotFound = New("Primary key is not in the key ring")
+	ErrSessionKeyMissing  = New("No session signing key is configured")
+
+	// Mailer errors
+	ErrUnknownMailer     = New("Unknown mailer")
+	ErrInvalidMailHeader = New("Mail header contains a line break")
+	ErrSMTPHostIsEmpty   = New("SMTP host is empty")
+	ErrMailFromIsEmpty   = New("Mail sender address is empty")
+	ErrMailDirIsEmpty    = New("Mail output directory is empty")
+
 	// Nil reference argument errors
-	ErrDatabaseIsNil     = New("Database is nil")
-	ErrSessionIsNil      = New("Session is nil")
-	ErrUserIsNil         = New("User is nil")
-	ErrSessionRepoIsNil  = New("Session repo is nil")
-	ErrUserRepoIsNil     = New("UserRepo is nil")
-	ErrUserServiceIsNil  = New("UserService is nil")
-	ErrUserHandlerIsNil  = New("UserHandler is nil")
-	ErrRepoProviderIsNil = New("RepoProvider is nil")
+	ErrDatabaseIsNil      = New("Database is nil")
+	ErrSessionIsNil       = New("Session is nil")
+	ErrUserIsNil          = New("User is nil")
+	ErrSessionRepoIsNil   = New("Session repo is nil")
+	ErrUserRepoIsNil      = New("UserRepo is nil")
+	ErrUserServiceIsNil   = New("UserService is nil")
+	ErrUserHandlerIsNil   = New("UserHandler is nil")
+	ErrRepoProviderIsNil  = New("RepoProvider is nil")
+	ErrConfigIsNil        = New("Config is nil")
+	ErrResetRepoIsNil     = New("PasswordResetRepo is nil")
+	ErrMailerIsNil        = New("Mailer is nil")
+	ErrTOTPRepoIsNil      = New("TOTPRepo is nil")
+	ErrChallengeRepoIsNil = New("MFAChallengeRepo is nil")
+	ErrRecoveryRepoIsNil  = New("RecoveryCodeRepo is nil")
+	ErrEventRepoIsNil     = New("SecurityEventRepo is nil")
+	ErrPasskeyRepoIsNil   = New("WebAuthnCredentialRepo is nil")
+	ErrCeremonyRepoIsNil  = New("WebAuthnCeremonyRepo is nil")
+
+	ErrPasswordResetServiceIsNil = New("PasswordResetService is nil")
+	ErrVerificationServiceIsNil  = New("VerificationService is nil")
+	ErrMFAServiceIsNil           = New("MFAService is nil")
+	ErrAuditServiceIsNil         = New("AuditService is nil")
+	ErrWebAuthnServiceIsNil      = New("WebAuthnService is nil")
+	ErrIntrospectionServiceIsNil = New("IntrospectionService is nil")
+	ErrAuthClientIsNil           = New("Auth client is nil")
+	ErrRedisClientIsNil          = New("Redis client is nil")
+	ErrHealthServiceIsNil        = New("HealthService is nil")
 
 	// Empty string argument errors
-	ErrExpiresAtIsEmpty = New("Expiration time is empty")
-	ErrPasswordIsEmpty  = New("Password is empty")
-	ErrSessionIdIsEmpty     = New("Token is empty")
-	ErrUserIdEmpty      = New("User ID is empty")
+	ErrExpiresAtIsEmpty         = New("Expiration time is empty")
+	ErrPasswordIsEmpty          = New("Password is empty")
+	ErrSessionIdIsEmpty         = New("Token is empty")
+	ErrUserIdEmpty              = New("User ID is empty")
+	ErrResetTokenIsEmpty        = New("Password reset token is empty")
+	ErrTOTPSecretIsEmpty        = New("TOTP secret is empty")
+	ErrSecurityEventTypeIsEmpty = New("Security event type is empty")
 
 	// Database errors
 	ErrUserNotFound = New("User not found")
 
+	// Migration errors
+	ErrInvalidMigrationName      = New("Migration file name is not <version>_<name>.up.sql or .down.sql")
+	ErrDuplicateMigration        = New("Migration version is used twice")
+	ErrIncompleteMigration       = New("Migration is missing its up or down script")
+	ErrMigrationChecksumMismatch = New("Applied migration was changed")
+	ErrUnknownMigration          = New("Applied migration is unknown to this build")
+	ErrInvalidMigrationSteps     = New("Number of migrations to roll back must be positive")
+	ErrMigrationPending          = New("Migration has not been applied")
+
+	// Readiness errors
+	ErrReaperStalled = New("Session reaper has not run for two intervals")
+
+	// Config errors
+	ErrUnknownConfigFormat = New("Config file must be .yaml, .yml or .toml")
+	ErrUnknownConfigKey    = New("Unknown config key")
+	ErrInvalidConfigValue  = New("Config value is invalid")
+
+	// Command line errors
+	ErrPasswordMismatch    = New("Passwords don't match")
+	ErrInvalidLockDuration = New("Lock duration must be positive")
+
 	ErrCouldNotIncrementFailedLogins = New("Could not increment users.failed_login_attempts")
 	ErrCouldNotUpdateUser            = New("Tried to update user but no changes were made")
+	ErrUnknownUserColumn             = New("Unknown users column")
+	ErrInvalidUserColumnValue        = New("Value doesn't fit users column")
 )
@@ -0,0 +1,89 @@
+package authclient
+
+import (
+	"crypto/sha256"
+	"slices"
+	"sync"
+	"time"
+)
+
+// identityCache remembers recently authenticated tokens for a short time. Tokens are keyed by
+// their SHA-256 so the cache never holds usable credentials. Only accepted tokens are cached, and a
+// nil cache caches nothing. Identities are copied in and out, so callers may change the ones they
+// get without affecting concurrent requests.
+type identityCache struct {
+	mu         sync.Mutex
+	entries    map[[sha256.Size]byte]cacheEntry
+	maxEntries int
+}
+
+type cacheEntry struct {
+	identity  Identity
+	expiresAt time.Time
+}
+
+func newIdentityCache(maxEntries int) *identityCache {
+	return &identityCache{
+		entries:    make(map[[sha256.Size]byte]cacheEntry),
+		maxEntries: maxEntries,
+	}
+}
+
+// get returns the identity cached for a token if it hasn't expired
+func (ic *identityCache) get(token string, now time.Time) (*Identity, bool) {
+	if ic == nil {
+		return nil, false
+	}
+	key := sha256.Sum256([]byte(token))
+
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	entry, ok := ic.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(entry.expiresAt) {
+		delete(ic.entries, key)
+		return nil, false
+	}
+	identity := entry.identity
+	identity.Roles = slices.Clone(identity.Roles)
+	return &identity, true
+}
+
+// set caches an identity until expiresAt. When the cache is full, expired entries are dropped
+// first; if it is still full the identity isn't cached.
+func (ic *identityCache) set(token string, identity *Identity, expiresAt, now time.Time) {
+	if ic == nil || !now.Before(expiresAt) {
+		return
+	}
+	key := sha256.Sum256([]byte(token))
+
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	if _, exists := ic.entries[key]; !exists && len(ic.entries) >= ic.maxEntries {
+		for k, entry := range ic.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(ic.entries, k)
+			}
+		}
+		if len(ic.entries) >= ic.maxEntries {
+			return
+		}
+	}
+	entry := cacheEntry{identity: *identity, expiresAt: expiresAt}
+	entry.identity.Roles = slices.Clone(identity.Roles)
+	ic.entries[key] = entry
+}
+
+// delete forgets a token
+func (ic *identityCache) delete(token string) {
+	if ic == nil {
+		return
+	}
+	key := sha256.Sum256([]byte(token))
+
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	delete(ic.entries, key)
+}
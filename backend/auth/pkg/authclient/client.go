@@ -0,0 +1,405 @@
+// Package authclient is a typed client for the auth service API, along with gin and net/http
+// middleware that let other services authenticate requests against it.
+package authclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// DefaultTimeout bounds each request made with the default HTTP client
+const DefaultTimeout = 10 * time.Second
+
+// Client calls the public endpoints of the auth service. Endpoints that need a logged in user are
+// on `Session`.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// ServiceID and ServiceSecret are the credentials from `AUTH_SERVICE_CREDENTIALS` used by
+	// `Introspect`. Optional.
+	ServiceID     string
+	ServiceSecret string
+}
+
+// APIError is a non-2xx response from the auth service
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("auth service responded %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("auth service responded %d: %s", e.StatusCode, e.Message)
+}
+
+// NewClient returns a Client for the auth service at baseURL, e.g. `http://goauth:3001`
+func NewClient(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, apperrors.ErrInvalidAuthServiceURL
+	}
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+	}, nil
+}
+
+// LoginResult is the outcome of a login. Either Token is set, or MFARequired and Challenge if the
+// user still has to pass `LoginSecondFactor` or `FinishPasskeySecondFactor`.
+type LoginResult struct {
+	Token       string
+	ExpiresIn   time.Duration
+	MFARequired bool
+	Challenge   string
+}
+
+// PasskeyCeremony is a started passkey ceremony. Options is passed to
+// `navigator.credentials.create()` or `navigator.credentials.get()` on the client.
+type PasskeyCeremony struct {
+	Ceremony string          `json:"ceremony"`
+	Options  json.RawMessage `json:"options"`
+}
+
+// Introspection is the state of a session token as reported to services. Only Active is set for
+// inactive tokens.
+type Introspection struct {
+	Active bool
+	UserID string
+	Roles  []string
+	MFA    bool
+	// RememberMe tells whether the user asked to be remembered
+	RememberMe bool
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
+}
+
+// Verification is a session accepted by `/verify`. RotatedToken is set if the session was
+// rotated; the old token no longer works.
+type Verification struct {
+	UserID       string
+	Email        string
+	RotatedToken string
+	// CookieMaxAge is how long a cookie carrying the rotated token should last. Zero means a
+	// cookie that ends with the browser session.
+	CookieMaxAge time.Duration
+}
+
+// Readiness is the outcome of the readiness checks of the auth service
+type Readiness struct {
+	// Ready is false if any check failed
+	Ready bool
+	// Checks are the checks by name, e.g. `database`
+	Checks map[string]ReadinessCheck
+}
+
+// ReadinessCheck is the outcome of one readiness check
+type ReadinessCheck struct {
+	// Status is `ok`, `failed` or `timeout`
+	Status   string
+	Duration time.Duration
+}
+
+// Ping checks that the auth service is up
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodGet, "/ping", "", nil, nil)
+	return err
+}
+
+// Healthz checks that the auth service process is up, without checking its dependencies
+func (c *Client) Healthz(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodGet, "/healthz", "", nil, nil)
+	return err
+}
+
+// Readyz runs the readiness checks of the auth service. A service that isn't ready is not an
+// error: Ready is false and the failed checks don't have the status `ok`.
+func (c *Client) Readyz(ctx context.Context) (*Readiness, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/readyz", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// Failed checks are reported with 503, which still carries the results
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, &APIError{StatusCode: resp.StatusCode}
+	}
+
+	var body struct {
+		Checks map[string]struct {
+			Status     string `json:"status"`
+			DurationMs int64  `json:"durationMs"`
+		} `json:"checks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	readiness := &Readiness{
+		Ready:  resp.StatusCode == http.StatusOK,
+		Checks: make(map[string]ReadinessCheck, len(body.Checks)),
+	}
+	for name, check := range body.Checks {
+		readiness.Checks[name] = ReadinessCheck{
+			Status:   check.Status,
+			Duration: time.Duration(check.DurationMs) * time.Millisecond,
+		}
+	}
+	return readiness, nil
+}
+
+// Register creates a new user
+func (c *Client) Register(ctx context.Context, email, password string) error {
+	_, err := c.do(ctx, http.MethodPost, "/register", "", map[string]string{
+		"email":    email,
+		"password": password,
+	}, nil)
+	return err
+}
+
+// Login logs a user in with their password. The session token is returned rather than set as a
+// cookie.
+func (c *Client) Login(ctx context.Context, email, password string) (*LoginResult, error) {
+	return c.login(ctx, "/login", map[string]any{
+		"email":    email,
+		"password": password,
+	})
+}
+
+// LoginSecondFactor completes a login with the challenge from `Login` and an authenticator or
+// recovery code
+func (c *Client) LoginSecondFactor(ctx context.Context, challenge, code string) (*LoginResult, error) {
+	return c.login(ctx, "/login/2fa", map[string]any{
+		"challenge": challenge,
+		"code":      code,
+	})
+}
+
+// BeginPasskeySecondFactor starts answering the challenge from `Login` with a passkey
+func (c *Client) BeginPasskeySecondFactor(ctx context.Context, challenge string) (*PasskeyCeremony, error) {
+	var ceremony PasskeyCeremony
+	_, err := c.do(ctx, http.MethodPost, "/login/2fa/passkey/begin", "", map[string]string{
+		"challenge": challenge,
+	}, &ceremony)
+	if err != nil {
+		return nil, err
+	}
+	return &ceremony, nil
+}
+
+// FinishPasskeySecondFactor completes a login with the credential the browser signed
+func (c *Client) FinishPasskeySecondFactor(ctx context.Context, challenge, ceremony string, credential json.RawMessage) (*LoginResult, error) {
+	return c.login(ctx, "/login/2fa/passkey/finish", map[string]any{
+		"challenge":  challenge,
+		"ceremony":   ceremony,
+		"credential": credential,
+	})
+}
+
+// BeginPasskeyLogin starts a passwordless login
+func (c *Client) BeginPasskeyLogin(ctx context.Context) (*PasskeyCeremony, error) {
+	var ceremony PasskeyCeremony
+	if _, err := c.do(ctx, http.MethodPost, "/login/passkey/begin", "", nil, &ceremony); err != nil {
+		return nil, err
+	}
+	return &ceremony, nil
+}
+
+// FinishPasskeyLogin completes a passwordless login with the credential the browser signed
+func (c *Client) FinishPasskeyLogin(ctx context.Context, ceremony string, credential json.RawMessage) (*LoginResult, error) {
+	return c.login(ctx, "/login/passkey/finish", map[string]any{
+		"ceremony":   ceremony,
+		"credential": credential,
+	})
+}
+
+// Logout ends the session of a token
+func (c *Client) Logout(ctx context.Context, token string) error {
+	_, err := c.do(ctx, http.MethodPost, "/logout", token, nil, nil)
+	return err
+}
+
+// ForgotPassword emails a password reset token if an account exists for the email
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	_, err := c.do(ctx, http.MethodPost, "/password/forgot", "", map[string]string{"email": email}, nil)
+	return err
+}
+
+// ResetPassword sets a new password with a token from `ForgotPassword`
+func (c *Client) ResetPassword(ctx context.Context, resetToken, password string) error {
+	_, err := c.do(ctx, http.MethodPost, "/password/reset", "", map[string]string{
+		"token":    resetToken,
+		"password": password,
+	}, nil)
+	return err
+}
+
+// VerifyEmail verifies an email address with the token that was mailed to it
+func (c *Client) VerifyEmail(ctx context.Context, verificationToken string) error {
+	_, err := c.do(ctx, http.MethodPost, "/verify-email", "", map[string]string{"token": verificationToken}, nil)
+	return err
+}
+
+// ResendVerification mails a new verification token if an unverified account exists for the email
+func (c *Client) ResendVerification(ctx context.Context, email string) error {
+	_, err := c.do(ctx, http.MethodPost, "/verify-email/resend", "", map[string]string{"email": email}, nil)
+	return err
+}
+
+// Introspect asks who a session token belongs to, authenticating with the client's service
+// credentials. Inactive tokens are not an error.
+func (c *Client) Introspect(ctx context.Context, token string) (*Introspection, error) {
+	if c.ServiceID == "" || c.ServiceSecret == "" {
+		return nil, apperrors.ErrServiceCredentialsMissing
+	}
+
+	form := url.Values{"token": {token}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/introspect", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.ServiceID, c.ServiceSecret)
+
+	var body struct {
+		Active     bool     `json:"active"`
+		Sub        string   `json:"sub"`
+		Roles      []string `json:"roles"`
+		MFA        bool     `json:"mfa"`
+		RememberMe bool     `json:"remember_me"`
+		Iat        int64    `json:"iat"`
+		Exp        int64    `json:"exp"`
+	}
+	if _, err := c.send(req, &body); err != nil {
+		return nil, err
+	}
+	if !body.Active {
+		return &Introspection{}, nil
+	}
+	return &Introspection{
+		Active:     true,
+		UserID:     body.Sub,
+		Roles:      body.Roles,
+		MFA:        body.MFA,
+		RememberMe: body.RememberMe,
+		IssuedAt:   time.Unix(body.Iat, 0),
+		ExpiresAt:  time.Unix(body.Exp, 0),
+	}, nil
+}
+
+// Verify checks a session token the way a reverse proxy would, rotating it if it is halfway
+// expired. A rejected token is an `*APIError` with status 401, or 403 for unverified accounts
+// when the auth service requires verification.
+func (c *Client) Verify(ctx context.Context, token string) (*Verification, error) {
+	header, err := c.do(ctx, http.MethodGet, "/verify", token, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Without a max age, e.g. from an older auth service, the cookie ends with the browser session
+	maxAge, _ := strconv.Atoi(header.Get(config.SessionMaxAgeHeader))
+	return &Verification{
+		UserID:       header.Get(config.ForwardAuthUserIDHeader),
+		Email:        header.Get(config.ForwardAuthUserEmailHeader),
+		RotatedToken: header.Get(config.SessionTokenHeader),
+		CookieMaxAge: time.Duration(max(maxAge, 0)) * time.Second,
+	}, nil
+}
+
+// login posts a login request in token mode
+func (c *Client) login(ctx context.Context, path string, body map[string]any) (*LoginResult, error) {
+	body["mode"] = "token"
+	var response struct {
+		Token       string `json:"token"`
+		ExpiresIn   int    `json:"expiresIn"`
+		MFARequired bool   `json:"mfaRequired"`
+		Challenge   string `json:"challenge"`
+	}
+	if _, err := c.do(ctx, http.MethodPost, path, "", body, &response); err != nil {
+		return nil, err
+	}
+	return &LoginResult{
+		Token:       response.Token,
+		ExpiresIn:   time.Duration(response.ExpiresIn) * time.Second,
+		MFARequired: response.MFARequired,
+		Challenge:   response.Challenge,
+	}, nil
+}
+
+// do sends a JSON request, authorized with a session token if one is given, and decodes the JSON
+// response into out if it isn't nil. The response headers are returned for successful requests.
+func (c *Client) do(ctx context.Context, method, path, token string, body, out any) (http.Header, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.send(req, out)
+}
+
+// send performs a request and turns non-2xx responses into an `*APIError`
+func (c *Client) send(req *http.Request, out any) (http.Header, error) {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&body) == nil {
+			apiErr.Message = body.Error
+		}
+		return nil, apiErr
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, err
+		}
+	}
+	return resp.Header, nil
+}
+
+// httpClient returns the HTTP client requests are sent with
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
@@ -0,0 +1,283 @@
+package authclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/authclient"
+	"godiscauth/pkg/config"
+)
+
+const (
+	testServiceID     = "discussion"
+	testServiceSecret = "aservicesecretthatislongenoughtobeaccepted"
+	testUserID        = "7d4c3e7e-5d43-4a3c-9d0b-7d1f2b0f6f11"
+	testEmail         = "authclient@test.com"
+)
+
+// fakeAuthService stands in for the auth service. "valid" is an active session, "halfway" is
+// rotated to "rotated", and "unverified" belongs to an unverified account.
+type fakeAuthService struct {
+	*httptest.Server
+	verifyCalls     atomic.Int32
+	introspectCalls atomic.Int32
+	// unready fails the database readiness check
+	unready atomic.Bool
+}
+
+func newFakeAuthService(t *testing.T) *fakeAuthService {
+	t.Helper()
+
+	f := &fakeAuthService{}
+	active := map[string]bool{"valid": true, "halfway": true, "halfway-remembered": true, "rotated": true, "unverified": true}
+
+	writeJSON := func(w http.ResponseWriter, status int, body any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+	bearer := func(r *http.Request) string {
+		return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	// authorize mimics `RequireAuth`, rotating "halfway" and "halfway-remembered"
+	authorize := func(w http.ResponseWriter, r *http.Request) bool {
+		token := bearer(r)
+		switch {
+		case token == "unverified":
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": apperrors.ErrEmailNotVerified.Error()})
+			return false
+		case !active[token]:
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		case token == "halfway":
+			w.Header().Set(config.SessionTokenHeader, "rotated")
+			w.Header().Set(config.SessionMaxAgeHeader, "0")
+		case token == "halfway-remembered":
+			w.Header().Set(config.SessionTokenHeader, "rotated")
+			w.Header().Set(config.SessionMaxAgeHeader, "3600")
+		}
+		return true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		check := func(status string) map[string]any { return map[string]any{"status": status, "durationMs": 2} }
+		if f.unready.Load() {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{
+				"status": "unavailable",
+				"checks": map[string]any{"database": check("timeout"), "session_key": check("ok")},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"status": "ok",
+			"checks": map[string]any{"database": check("ok"), "session_key": check("ok")},
+		})
+	})
+	mux.HandleFunc("POST /register", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": apperrors.ErrDuplicateEmail.Error()})
+	})
+	mux.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case body["mode"] != "token":
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "cookie mode"})
+		case body["email"] == "mfa@test.com":
+			writeJSON(w, http.StatusOK, map[string]any{"mfaRequired": true, "challenge": "challenge"})
+		default:
+			writeJSON(w, http.StatusOK, map[string]any{"token": "valid", "expiresIn": 7200})
+		}
+	})
+	mux.HandleFunc("GET /profile", func(w http.ResponseWriter, r *http.Request) {
+		if authorize(w, r) {
+			writeJSON(w, http.StatusOK, map[string]any{"email": testEmail})
+		}
+	})
+	mux.HandleFunc("DELETE /passkeys/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if authorize(w, r) {
+			writeJSON(w, http.StatusOK, map[string]string{"message": "passkey removed " + r.PathValue("id")})
+		}
+	})
+	mux.HandleFunc("/verify", func(w http.ResponseWriter, r *http.Request) {
+		f.verifyCalls.Add(1)
+		if authorize(w, r) {
+			w.Header().Set(config.ForwardAuthUserIDHeader, testUserID)
+			w.Header().Set(config.ForwardAuthUserEmailHeader, testEmail)
+		}
+	})
+	mux.HandleFunc("POST /introspect", func(w http.ResponseWriter, r *http.Request) {
+		f.introspectCalls.Add(1)
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != testServiceID || secret != testServiceSecret {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+		if r.FormValue("token") != "valid" {
+			writeJSON(w, http.StatusOK, map[string]any{"active": false})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"active":      true,
+			"sub":         testUserID,
+			"roles":       []string{"user"},
+			"mfa":         true,
+			"remember_me": true,
+			"iat":         time.Now().Unix(),
+			"exp":         time.Now().Add(time.Hour).Unix(),
+		})
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// TestAuthClient_NewClient tests validation of the auth service URL
+func TestAuthClient_NewClient(t *testing.T) {
+	is := is.New(t)
+
+	for _, baseURL := range []string{"", "goauth:3001", "ftp://goauth", "http://"} {
+		_, err := authclient.NewClient(baseURL)
+		is.Equal(err, apperrors.ErrInvalidAuthServiceURL)
+	}
+
+	client, err := authclient.NewClient("http://goauth:3001/")
+	is.NoErr(err)
+	is.Equal(client.BaseURL, "http://goauth:3001")
+}
+
+// TestAuthClient_Client tests public endpoints
+func TestAuthClient_Client(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	f := newFakeAuthService(t)
+	client, err := authclient.NewClient(f.URL)
+	is.NoErr(err)
+
+	t.Run("ping", func(t *testing.T) {
+		is.NoErr(client.Ping(ctx))
+	})
+
+	t.Run("health", func(t *testing.T) {
+		is.NoErr(client.Healthz(ctx))
+
+		readiness, err := client.Readyz(ctx)
+		is.NoErr(err)
+		is.True(readiness.Ready)
+		is.Equal(readiness.Checks["database"], authclient.ReadinessCheck{Status: "ok", Duration: 2 * time.Millisecond})
+
+		f.unready.Store(true)
+		defer f.unready.Store(false)
+		readiness, err = client.Readyz(ctx)
+		is.NoErr(err)
+		is.True(!readiness.Ready)
+		is.Equal(readiness.Checks["database"].Status, "timeout")
+		is.Equal(readiness.Checks["session_key"].Status, "ok")
+	})
+
+	t.Run("login in token mode", func(t *testing.T) {
+		result, err := client.Login(ctx, testEmail, "password")
+		is.NoErr(err)
+		is.Equal(result.Token, "valid")
+		is.Equal(result.ExpiresIn, 2*time.Hour)
+		is.True(!result.MFARequired)
+
+		result, err = client.Login(ctx, "mfa@test.com", "password")
+		is.NoErr(err)
+		is.Equal(result.Token, "")
+		is.True(result.MFARequired)
+		is.Equal(result.Challenge, "challenge")
+	})
+
+	t.Run("errors carry status and message", func(t *testing.T) {
+		err := client.Register(ctx, testEmail, "password")
+		var apiErr *authclient.APIError
+		is.True(errors.As(err, &apiErr))
+		is.Equal(apiErr.StatusCode, http.StatusInternalServerError)
+		is.Equal(apiErr.Message, apperrors.ErrDuplicateEmail.Error())
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		verification, err := client.Verify(ctx, "valid")
+		is.NoErr(err)
+		is.Equal(verification.UserID, testUserID)
+		is.Equal(verification.Email, testEmail)
+		is.Equal(verification.RotatedToken, "")
+
+		verification, err = client.Verify(ctx, "halfway")
+		is.NoErr(err)
+		is.Equal(verification.RotatedToken, "rotated")
+		is.Equal(verification.CookieMaxAge, time.Duration(0))
+
+		verification, err = client.Verify(ctx, "halfway-remembered")
+		is.NoErr(err)
+		is.Equal(verification.CookieMaxAge, time.Hour)
+
+		_, err = client.Verify(ctx, "invalid")
+		var apiErr *authclient.APIError
+		is.True(errors.As(err, &apiErr))
+		is.Equal(apiErr.StatusCode, http.StatusUnauthorized)
+	})
+
+	t.Run("introspect", func(t *testing.T) {
+		_, err := client.Introspect(ctx, "valid")
+		is.Equal(err, apperrors.ErrServiceCredentialsMissing)
+
+		serviceClient := *client
+		serviceClient.ServiceID = testServiceID
+		serviceClient.ServiceSecret = testServiceSecret
+
+		introspection, err := serviceClient.Introspect(ctx, "valid")
+		is.NoErr(err)
+		is.True(introspection.Active)
+		is.Equal(introspection.UserID, testUserID)
+		is.Equal(introspection.Roles, []string{"user"})
+		is.True(introspection.MFA)
+		is.True(introspection.RememberMe)
+		is.True(introspection.ExpiresAt.After(time.Now()))
+
+		introspection, err = serviceClient.Introspect(ctx, "invalid")
+		is.NoErr(err)
+		is.True(!introspection.Active)
+	})
+}
+
+// TestAuthClient_Session tests that sessions follow token rotation
+func TestAuthClient_Session(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	f := newFakeAuthService(t)
+	client, err := authclient.NewClient(f.URL)
+	is.NoErr(err)
+
+	session := client.Session("halfway")
+	profile, err := session.Profile(ctx)
+	is.NoErr(err)
+	is.Equal(profile.Email, testEmail)
+	is.Equal(session.Token(), "rotated")
+
+	// Path parameters are escaped
+	is.NoErr(session.DeletePasskey(ctx, "some-id"))
+
+	_, err = client.Session("invalid").Profile(ctx)
+	var apiErr *authclient.APIError
+	is.True(errors.As(err, &apiErr))
+	is.Equal(apiErr.StatusCode, http.StatusUnauthorized)
+}
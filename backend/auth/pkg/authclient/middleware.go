@@ -0,0 +1,237 @@
+package authclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/config"
+)
+
+// DefaultCacheTTL is how long an accepted token is trusted without asking the auth service again.
+// A logged out session can keep working for this long.
+const DefaultCacheTTL = 10 * time.Second
+
+// DefaultMaxCacheEntries bounds the memory used by the cache
+const DefaultMaxCacheEntries = 10000
+
+// RotatedToken is a session token that replaces the one a request was sent with
+type RotatedToken struct {
+	Token string
+	// CookieMaxAge is how long a cookie carrying the token should last. Zero means a cookie that
+	// ends with the browser session.
+	CookieMaxAge time.Duration
+}
+
+// Identity is the user a request was authenticated as. Email is only known through `/verify`;
+// Roles, MFA and ExpiresAt only through introspection.
+type Identity struct {
+	UserID    string
+	Email     string
+	Roles     []string
+	MFA       bool
+	ExpiresAt time.Time
+}
+
+// Authenticator validates the session token of incoming requests against the auth service. With
+// service credentials on the client it uses `/introspect`, otherwise `/verify`. Only `/verify`
+// rotates sessions, so prefer it for services that browsers talk to directly.
+type Authenticator struct {
+	Client *Client
+	// CacheTTL is how long accepted tokens are cached. Zero disables the cache.
+	CacheTTL time.Duration
+
+	cache *identityCache
+}
+
+// NewAuthenticator returns an Authenticator using the given client with the default cache
+func NewAuthenticator(client *Client) (*Authenticator, error) {
+	if client == nil {
+		return nil, apperrors.ErrAuthClientIsNil
+	}
+	return &Authenticator{
+		Client:   client,
+		CacheTTL: DefaultCacheTTL,
+		cache:    newIdentityCache(DefaultMaxCacheEntries),
+	}, nil
+}
+
+// Authenticate returns the identity of a session token, and the token to use from now on if the
+// session was rotated, nil otherwise. Rejected tokens return `apperrors.ErrUnauthenticated`, or an `*APIError`
+// with status 403 for unverified accounts; any other error means the auth service couldn't be
+// asked.
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (*Identity, *RotatedToken, error) {
+	if token == "" {
+		return nil, nil, apperrors.ErrUnauthenticated
+	}
+	now := time.Now()
+	if identity, ok := a.cache.get(token, now); ok {
+		return identity, nil, nil
+	}
+
+	if a.Client.ServiceID != "" {
+		introspection, err := a.Client.Introspect(ctx, token)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !introspection.Active {
+			return nil, nil, apperrors.ErrUnauthenticated
+		}
+		identity := &Identity{
+			UserID:    introspection.UserID,
+			Roles:     introspection.Roles,
+			MFA:       introspection.MFA,
+			ExpiresAt: introspection.ExpiresAt,
+		}
+		a.remember(token, identity, now)
+		return identity, nil, nil
+	}
+
+	verification, err := a.Client.Verify(ctx, token)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+		return nil, nil, apperrors.ErrUnauthenticated
+	} else if err != nil {
+		return nil, nil, err
+	}
+	identity := &Identity{UserID: verification.UserID, Email: verification.Email}
+	if verification.RotatedToken != "" {
+		// The old token is gone, so only the new one may be served from the cache
+		a.cache.delete(token)
+		a.remember(verification.RotatedToken, identity, now)
+		return identity, &RotatedToken{Token: verification.RotatedToken, CookieMaxAge: verification.CookieMaxAge}, nil
+	}
+	a.remember(token, identity, now)
+	return identity, nil, nil
+}
+
+// Gin returns gin middleware that rejects requests without a valid session and otherwise sets
+// "userID" and "mfa" in the context like the auth service's own `RequireAuth`, plus "roles" when
+// they are known. The identity is also added to the request context.
+func (a *Authenticator) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, bearer := TokenFromRequest(c.Request)
+		identity, rotated, err := a.Authenticate(c.Request.Context(), token)
+		if err != nil {
+			status, message := errorResponse(err)
+			c.AbortWithStatusJSON(status, gin.H{"error": message})
+			return
+		}
+		if rotated != nil {
+			a.setRotatedToken(c.Writer, rotated, bearer)
+		}
+
+		c.Set("userID", identity.UserID)
+		c.Set("mfa", identity.MFA)
+		if identity.Roles != nil {
+			c.Set("roles", identity.Roles)
+		}
+		c.Request = c.Request.WithContext(WithIdentity(c.Request.Context(), identity))
+		c.Next()
+	}
+}
+
+// Middleware wraps a net/http handler, rejecting requests without a valid session. The identity
+// is available to the handler through `IdentityFromContext`.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, bearer := TokenFromRequest(r)
+		identity, rotated, err := a.Authenticate(r.Context(), token)
+		if err != nil {
+			status, message := errorResponse(err)
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"error": message})
+			return
+		}
+		if rotated != nil {
+			a.setRotatedToken(w, rotated, bearer)
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
+
+// remember caches an identity for the cache TTL, or until the session expires if that is sooner
+func (a *Authenticator) remember(token string, identity *Identity, now time.Time) {
+	if a.CacheTTL <= 0 {
+		return
+	}
+	expiresAt := now.Add(a.CacheTTL)
+	if !identity.ExpiresAt.IsZero() && identity.ExpiresAt.Before(expiresAt) {
+		expiresAt = identity.ExpiresAt
+	}
+	a.cache.set(token, identity, expiresAt, now)
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying an identity
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity added by the middleware
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
+
+// TokenFromRequest returns the session token of a request and whether it was sent as a bearer
+// token, reading the `Authorization: Bearer` header before the session cookie like the auth
+// service does. Requests with another authorization scheme have no token.
+func TokenFromRequest(r *http.Request) (string, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return "", false
+		}
+		return strings.TrimSpace(token), true
+	}
+	cookie, err := r.Cookie(config.SessionCookieName)
+	if err != nil {
+		return "", false
+	}
+	return cookie.Value, false
+}
+
+// setRotatedToken hands a rotated session token back to the client the same way it sent the old
+// one. The cookie lasts as long as the auth service says, which is until the browser closes unless
+// the user asked to be remembered.
+func (a *Authenticator) setRotatedToken(w http.ResponseWriter, rotated *RotatedToken, bearer bool) {
+	if bearer {
+		w.Header().Set(config.SessionTokenHeader, rotated.Token)
+		w.Header().Set(config.SessionMaxAgeHeader, strconv.Itoa(int(rotated.CookieMaxAge.Seconds())))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     config.SessionCookieName,
+		Value:    rotated.Token,
+		Path:     "/",
+		MaxAge:   int(rotated.CookieMaxAge.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: config.SessionCookieSameSite,
+	})
+}
+
+// errorResponse maps an authentication error to a status and message. Failures to reach the auth
+// service are reported without detail.
+func errorResponse(err error) (int, string) {
+	var apiErr *APIError
+	switch {
+	case errors.Is(err, apperrors.ErrUnauthenticated):
+		return http.StatusUnauthorized, err.Error()
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden:
+		return http.StatusForbidden, apiErr.Message
+	default:
+		return http.StatusServiceUnavailable, "authentication is unavailable"
+	}
+}
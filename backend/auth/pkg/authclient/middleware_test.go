@@ -0,0 +1,210 @@
+package authclient_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/matryer/is"
+
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/authclient"
+	"godiscauth/pkg/config"
+)
+
+// TestAuthClient_Authenticator tests authentication through `/verify` and `/introspect` and the
+// local cache
+func TestAuthClient_Authenticator(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	_, err := authclient.NewAuthenticator(nil)
+	is.Equal(err, apperrors.ErrAuthClientIsNil)
+
+	t.Run("verify", func(t *testing.T) {
+		f := newFakeAuthService(t)
+		client, err := authclient.NewClient(f.URL)
+		is.NoErr(err)
+		auth, err := authclient.NewAuthenticator(client)
+		is.NoErr(err)
+
+		identity, rotated, err := auth.Authenticate(ctx, "valid")
+		is.NoErr(err)
+		is.Equal(identity.UserID, testUserID)
+		is.Equal(identity.Email, testEmail)
+		is.Equal(rotated, nil)
+
+		_, _, err = auth.Authenticate(ctx, "invalid")
+		is.Equal(err, apperrors.ErrUnauthenticated)
+		_, _, err = auth.Authenticate(ctx, "")
+		is.Equal(err, apperrors.ErrUnauthenticated)
+
+		// Accepted tokens are cached, rejected ones aren't
+		calls := f.verifyCalls.Load()
+		_, _, err = auth.Authenticate(ctx, "valid")
+		is.NoErr(err)
+		_, _, err = auth.Authenticate(ctx, "invalid")
+		is.Equal(err, apperrors.ErrUnauthenticated)
+		is.Equal(f.verifyCalls.Load(), calls+1)
+
+		// Rotated sessions are cached under the new token only
+		_, rotated, err = auth.Authenticate(ctx, "halfway")
+		is.NoErr(err)
+		is.Equal(rotated.Token, "rotated")
+		calls = f.verifyCalls.Load()
+		_, _, err = auth.Authenticate(ctx, "rotated")
+		is.NoErr(err)
+		is.Equal(f.verifyCalls.Load(), calls)
+	})
+
+	t.Run("introspection", func(t *testing.T) {
+		f := newFakeAuthService(t)
+		client, err := authclient.NewClient(f.URL)
+		is.NoErr(err)
+		client.ServiceID = testServiceID
+		client.ServiceSecret = testServiceSecret
+		auth, err := authclient.NewAuthenticator(client)
+		is.NoErr(err)
+
+		identity, _, err := auth.Authenticate(ctx, "valid")
+		is.NoErr(err)
+		is.Equal(identity.UserID, testUserID)
+		is.Equal(identity.Roles, []string{"user"})
+		is.True(identity.MFA)
+
+		// Changing a cached identity doesn't change it for other requests
+		identity.Roles[0] = "admin"
+		identity.MFA = false
+		cached, _, err := auth.Authenticate(ctx, "valid")
+		is.NoErr(err)
+		is.Equal(f.introspectCalls.Load(), int32(1))
+		is.Equal(cached.Roles, []string{"user"})
+		is.True(cached.MFA)
+		cached.Roles[0] = "admin"
+		cached, _, err = auth.Authenticate(ctx, "valid")
+		is.NoErr(err)
+		is.Equal(cached.Roles, []string{"user"})
+
+		_, _, err = auth.Authenticate(ctx, "invalid")
+		is.Equal(err, apperrors.ErrUnauthenticated)
+		is.Equal(f.verifyCalls.Load(), int32(0))
+	})
+
+	t.Run("cache expires", func(t *testing.T) {
+		f := newFakeAuthService(t)
+		client, err := authclient.NewClient(f.URL)
+		is.NoErr(err)
+		auth, err := authclient.NewAuthenticator(client)
+		is.NoErr(err)
+		auth.CacheTTL = 20 * time.Millisecond
+
+		_, _, err = auth.Authenticate(ctx, "valid")
+		is.NoErr(err)
+		time.Sleep(40 * time.Millisecond)
+		_, _, err = auth.Authenticate(ctx, "valid")
+		is.NoErr(err)
+		is.Equal(f.verifyCalls.Load(), int32(2))
+	})
+
+	t.Run("auth service unavailable", func(t *testing.T) {
+		f := newFakeAuthService(t)
+		client, err := authclient.NewClient(f.URL)
+		is.NoErr(err)
+		f.Close()
+		auth, err := authclient.NewAuthenticator(client)
+		is.NoErr(err)
+
+		_, _, err = auth.Authenticate(ctx, "valid")
+		is.True(err != nil)
+		is.True(err != apperrors.ErrUnauthenticated)
+	})
+}
+
+// TestAuthClient_Middleware tests the gin and net/http middleware
+func TestAuthClient_Middleware(t *testing.T) {
+	is := is.New(t)
+	gin.SetMode(gin.TestMode)
+
+	f := newFakeAuthService(t)
+	client, err := authclient.NewClient(f.URL)
+	is.NoErr(err)
+	auth, err := authclient.NewAuthenticator(client)
+	is.NoErr(err)
+
+	router := gin.New()
+	router.GET("/gin", auth.Gin(), func(c *gin.Context) {
+		identity, ok := authclient.IdentityFromContext(c.Request.Context())
+		is.True(ok)
+		is.Equal(identity.UserID, c.GetString("userID"))
+		c.String(http.StatusOK, c.GetString("userID"))
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/http", auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := authclient.IdentityFromContext(r.Context())
+		is.True(ok)
+		w.Write([]byte(identity.UserID))
+	})))
+
+	handlers := map[string]http.Handler{"/gin": router, "/http": mux}
+	for path, handler := range handlers {
+		serve := func(setAuth func(*http.Request)) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			setAuth(req)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		t.Run(path+" cookie", func(t *testing.T) {
+			rr := serve(func(r *http.Request) {
+				r.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: "valid"})
+			})
+			is.Equal(rr.Code, http.StatusOK)
+			is.Equal(rr.Body.String(), testUserID)
+		})
+
+		t.Run(path+" bearer", func(t *testing.T) {
+			rr := serve(func(r *http.Request) { r.Header.Set("Authorization", "Bearer valid") })
+			is.Equal(rr.Code, http.StatusOK)
+		})
+
+		t.Run(path+" rejects", func(t *testing.T) {
+			rr := serve(func(r *http.Request) {})
+			is.Equal(rr.Code, http.StatusUnauthorized)
+			rr = serve(func(r *http.Request) { r.Header.Set("Authorization", "Basic dmFsaWQ=") })
+			is.Equal(rr.Code, http.StatusUnauthorized)
+			rr = serve(func(r *http.Request) { r.Header.Set("Authorization", "Bearer unverified") })
+			is.Equal(rr.Code, http.StatusForbidden)
+		})
+
+		t.Run(path+" passes rotated tokens on", func(t *testing.T) {
+			rr := serve(func(r *http.Request) { r.Header.Set("Authorization", "Bearer halfway") })
+			is.Equal(rr.Code, http.StatusOK)
+			is.Equal(rr.Header().Get(config.SessionTokenHeader), "rotated")
+
+			rr = serve(func(r *http.Request) {
+				r.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: "halfway"})
+			})
+			is.Equal(rr.Code, http.StatusOK)
+			cookies := rr.Result().Cookies()
+			is.Equal(len(cookies), 1)
+			is.Equal(cookies[0].Name, config.SessionCookieName)
+			is.Equal(cookies[0].Value, "rotated")
+			is.True(cookies[0].HttpOnly)
+			is.Equal(cookies[0].MaxAge, 0) // ends with the browser session
+		})
+
+		t.Run(path+" keeps remembered sessions' cookies", func(t *testing.T) {
+			rr := serve(func(r *http.Request) {
+				r.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: "halfway-remembered"})
+			})
+			is.Equal(rr.Code, http.StatusOK)
+			cookies := rr.Result().Cookies()
+			is.Equal(len(cookies), 1)
+			is.Equal(cookies[0].MaxAge, 3600)
+		})
+	}
+}
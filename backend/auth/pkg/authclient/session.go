@@ -0,0 +1,241 @@
+package authclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"godiscauth/pkg/config"
+)
+
+// Session calls the endpoints that need a logged in user, authorized with a bearer token. The
+// auth service rotates halfway expired sessions; Session picks up the rotated token automatically,
+// so read `Token` again before persisting it.
+type Session struct {
+	client *Client
+
+	mu    sync.Mutex
+	token string
+}
+
+// Profile is a user's profile
+type Profile struct {
+	Email           string     `json:"email"`
+	LastLogin       *time.Time `json:"lastLogin"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+}
+
+// UserUpdate holds the fields `UpdateUser` changes. Empty fields are left unchanged.
+type UserUpdate struct {
+	Email    string `json:"email,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// TOTPEnrollment is a started authenticator app enrollment
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// Passkey is one of a user's passkeys
+type Passkey struct {
+	ID         string     `json:"id"`
+	BackedUp   bool       `json:"backedUp"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// ActiveSession is one of the places a user is logged in
+type ActiveSession struct {
+	ID              string    `json:"id"`
+	Device          string    `json:"device"`
+	UserAgent       string    `json:"userAgent"`
+	IPAddress       string    `json:"ipAddress"`
+	MFA             bool      `json:"mfa"`
+	AuthenticatedAt time.Time `json:"authenticatedAt"`
+	LastSeenAt      time.Time `json:"lastSeenAt"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+	// Current is set on the session making the request
+	Current bool `json:"current"`
+}
+
+// SecurityEvent is an entry in a user's security activity
+type SecurityEvent struct {
+	Type      string    `json:"type"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Session returns a Session for a token from `Login`
+func (c *Client) Session(token string) *Session {
+	return &Session{client: c, token: token}
+}
+
+// Token returns the current session token
+func (s *Session) Token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+// Profile returns the user's profile
+func (s *Session) Profile(ctx context.Context) (*Profile, error) {
+	var profile Profile
+	if err := s.do(ctx, http.MethodGet, "/profile", nil, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// UpdateUser changes the user's email and/or password
+func (s *Session) UpdateUser(ctx context.Context, update UserUpdate) error {
+	return s.do(ctx, http.MethodPost, "/updateuser", update, nil)
+}
+
+// DeleteAccount permanently deletes the user
+func (s *Session) DeleteAccount(ctx context.Context) error {
+	return s.do(ctx, http.MethodDelete, "/deleteaccount", nil, nil)
+}
+
+// Logout ends this session
+func (s *Session) Logout(ctx context.Context) error {
+	return s.do(ctx, http.MethodPost, "/logout", nil, nil)
+}
+
+// LogoutEverywhere ends all of the user's sessions
+func (s *Session) LogoutEverywhere(ctx context.Context) error {
+	return s.do(ctx, http.MethodPost, "/logouteverywhere", nil, nil)
+}
+
+// EnrollTOTP starts adding an authenticator app
+func (s *Session) EnrollTOTP(ctx context.Context) (*TOTPEnrollment, error) {
+	var enrollment TOTPEnrollment
+	if err := s.do(ctx, http.MethodPost, "/mfa/totp/enroll", nil, &enrollment); err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+// ConfirmTOTP enables two-factor authentication with a code from the app and returns the user's
+// recovery codes
+func (s *Session) ConfirmTOTP(ctx context.Context, code string) ([]string, error) {
+	var response struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/mfa/totp/confirm", map[string]string{"code": code}, &response); err != nil {
+		return nil, err
+	}
+	return response.RecoveryCodes, nil
+}
+
+// DisableTOTP removes the authenticator app
+func (s *Session) DisableTOTP(ctx context.Context, code string) error {
+	return s.do(ctx, http.MethodPost, "/mfa/totp/disable", map[string]string{"code": code}, nil)
+}
+
+// RecoveryCodesRemaining returns how many unused recovery codes the user has
+func (s *Session) RecoveryCodesRemaining(ctx context.Context) (int, error) {
+	var response struct {
+		Remaining int `json:"remaining"`
+	}
+	if err := s.do(ctx, http.MethodGet, "/mfa/recovery-codes", nil, &response); err != nil {
+		return 0, err
+	}
+	return response.Remaining, nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+func (s *Session) RegenerateRecoveryCodes(ctx context.Context, code string) ([]string, error) {
+	var response struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/mfa/recovery-codes", map[string]string{"code": code}, &response); err != nil {
+		return nil, err
+	}
+	return response.RecoveryCodes, nil
+}
+
+// BeginPasskeyRegistration starts adding a passkey
+func (s *Session) BeginPasskeyRegistration(ctx context.Context) (*PasskeyCeremony, error) {
+	var ceremony PasskeyCeremony
+	if err := s.do(ctx, http.MethodPost, "/passkeys/register/begin", nil, &ceremony); err != nil {
+		return nil, err
+	}
+	return &ceremony, nil
+}
+
+// FinishPasskeyRegistration stores the passkey the browser created and returns its ID
+func (s *Session) FinishPasskeyRegistration(ctx context.Context, ceremony string, credential json.RawMessage) (string, error) {
+	var response struct {
+		ID string `json:"id"`
+	}
+	err := s.do(ctx, http.MethodPost, "/passkeys/register/finish", map[string]any{
+		"ceremony":   ceremony,
+		"credential": credential,
+	}, &response)
+	if err != nil {
+		return "", err
+	}
+	return response.ID, nil
+}
+
+// ListPasskeys returns the user's passkeys, oldest first
+func (s *Session) ListPasskeys(ctx context.Context) ([]Passkey, error) {
+	var response struct {
+		Passkeys []Passkey `json:"passkeys"`
+	}
+	if err := s.do(ctx, http.MethodGet, "/passkeys", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Passkeys, nil
+}
+
+// DeletePasskey removes one of the user's passkeys
+func (s *Session) DeletePasskey(ctx context.Context, id string) error {
+	return s.do(ctx, http.MethodDelete, "/passkeys/"+url.PathEscape(id), nil, nil)
+}
+
+// Sessions returns the user's active sessions, most recently seen first
+func (s *Session) Sessions(ctx context.Context) ([]ActiveSession, error) {
+	var response struct {
+		Sessions []ActiveSession `json:"sessions"`
+	}
+	if err := s.do(ctx, http.MethodGet, "/sessions", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Sessions, nil
+}
+
+// RevokeSession ends one of the user's other sessions. The current one is ended with `Logout`.
+func (s *Session) RevokeSession(ctx context.Context, id string) error {
+	return s.do(ctx, http.MethodDelete, "/sessions/"+url.PathEscape(id), nil, nil)
+}
+
+// SecurityActivity returns the user's recent security events, newest first
+func (s *Session) SecurityActivity(ctx context.Context) ([]SecurityEvent, error) {
+	var response struct {
+		Events []SecurityEvent `json:"events"`
+	}
+	if err := s.do(ctx, http.MethodGet, "/security/activity", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Events, nil
+}
+
+// do sends a request with the current token and switches to the rotated token if the auth service
+// returns one
+func (s *Session) do(ctx context.Context, method, path string, body, out any) error {
+	header, err := s.client.do(ctx, method, path, s.Token(), body, out)
+	if err != nil {
+		return err
+	}
+	if rotated := header.Get(config.SessionTokenHeader); rotated != "" {
+		s.mu.Lock()
+		s.token = rotated
+		s.mu.Unlock()
+	}
+	return nil
+}
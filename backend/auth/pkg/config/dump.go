@@ -0,0 +1,68 @@
+package config
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces the values of secrets that are set in a dumped config
+const Redacted = "<redacted>"
+
+// Dump writes the config as a YAML config file, with the env variable of each value as a comment
+// and secrets replaced by `Redacted`
+func (c *Config) Dump(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	var section *yaml.Node
+	var sectionName string
+	for _, s := range c.settings() {
+		name, key, _ := strings.Cut(s.key, ".")
+		if section == nil || name != sectionName {
+			section = &yaml.Node{Kind: yaml.MappingNode}
+			sectionName = name
+			root.Content = append(root.Content, scalar("!!str", name), section)
+		}
+		value := s.node()
+		value.LineComment = s.env
+		section.Content = append(section.Content, scalar("!!str", key), value)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// node returns the YAML node of the setting's value
+func (s setting) node() *yaml.Node {
+	switch field := s.value.(type) {
+	case *string:
+		if s.secret && *field != "" {
+			return scalar("!!str", Redacted)
+		}
+		return scalar("!!str", *field)
+	case *int:
+		return scalar("!!int", strconv.Itoa(*field))
+	case *float64:
+		// Untagged, so that whole numbers aren't written with an explicit !!float tag
+		return scalar("", strconv.FormatFloat(*field, 'g', -1, 64))
+	case *time.Duration:
+		return scalar("!!str", field.String())
+	case *[]string:
+		list := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range *field {
+			list.Content = append(list.Content, scalar("!!str", item))
+		}
+		return list
+	}
+	return scalar("!!null", "")
+}
+
+func scalar(tag, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
@@ -0,0 +1,532 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	passwordvalidator "github.com/wagslane/go-password-validator"
+	"gopkg.in/yaml.v3"
+
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/keyring"
+)
+
+// Config is the runtime configuration of the auth service. `Load` reads it from the defaults, an
+// optional config file and the env variables named by the constants in this package, in that
+// order.
+type Config struct {
+	Server            ServerConfig
+	Database          DatabaseConfig
+	Sessions          SessionConfig
+	Passwords         PasswordConfig
+	Lockout           LockoutConfig
+	Mail              MailConfig
+	EmailVerification EmailVerificationConfig
+	MFA               MFAConfig
+	WebAuthn          WebAuthnConfig
+	Services          ServicesConfig
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Port              string
+	ShutdownTimeout   time.Duration
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// TLSCertFile and TLSKeyFile enable HTTPS when both are set
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSReloadInterval time.Duration
+	ReadinessTimeout  time.Duration
+	// MetricsPort serves `/metrics` on its own port when set, instead of with the API
+	MetricsPort string
+}
+
+// DatabaseConfig configures the Postgres connection
+type DatabaseConfig struct {
+	URL string
+}
+
+// SessionConfig configures how sessions are signed, stored and expired
+type SessionConfig struct {
+	// Key is the legacy signing key, see `SessionKey`
+	Key          string
+	Keys         string
+	KeysDir      string
+	PrimaryKeyID string
+
+	IdleTimeout           time.Duration
+	MaxLifetime           time.Duration
+	RememberMeIdleTimeout time.Duration
+	RememberMeMaxLifetime time.Duration
+	// MaxSessions is the number of active sessions a user can have. 0 means no limit.
+	MaxSessions int
+	// LimitPolicy is what a login over `MaxSessions` does: "evict-oldest" or "reject"
+	LimitPolicy string
+
+	// Store is where sessions are kept: "postgres", "redis" or "memory"
+	Store            string
+	RedisURL         string
+	CacheTTL         time.Duration
+	CacheSize        int
+	LastSeenInterval time.Duration
+	ReapInterval     time.Duration
+	ReapBatchSize    int
+}
+
+// PasswordConfig configures password strength and resets
+type PasswordConfig struct {
+	MinEntropyBits  float64
+	ResetURL        string
+	ResetExpiration time.Duration
+}
+
+// LockoutConfig configures locking accounts after failed logins
+type LockoutConfig struct {
+	MaxAttempts int
+	Length      time.Duration
+	MaxLength   time.Duration
+}
+
+// MailConfig configures outgoing mail
+type MailConfig struct {
+	// Mailer is "log", "file" or "smtp"
+	Mailer       string
+	From         string
+	Dir          string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// EmailVerificationConfig configures email verification
+type EmailVerificationConfig struct {
+	// Policy is where unverified accounts are rejected: "off", "login" or "protected"
+	Policy         string
+	URL            string
+	Expiration     time.Duration
+	ResendInterval time.Duration
+}
+
+// MFAConfig configures two-factor authentication
+type MFAConfig struct {
+	Key                  string
+	Issuer               string
+	ChallengeExpiration  time.Duration
+	MaxChallengeAttempts int
+}
+
+// WebAuthnConfig configures passkeys
+type WebAuthnConfig struct {
+	RPID               string
+	RPOrigins          []string
+	CeremonyExpiration time.Duration
+}
+
+// ServicesConfig configures the internal services allowed to introspect sessions
+type ServicesConfig struct {
+	// Credentials are comma separated `id:secret` pairs
+	Credentials string
+}
+
+// Default returns the configuration used for everything that isn't configured
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:              "3001",
+			ShutdownTimeout:   10 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			TLSReloadInterval: time.Minute,
+			ReadinessTimeout:  2 * time.Second,
+		},
+		Sessions: SessionConfig{
+			IdleTimeout:           2 * time.Hour,
+			MaxLifetime:           24 * time.Hour,
+			RememberMeIdleTimeout: 7 * 24 * time.Hour,
+			RememberMeMaxLifetime: 30 * 24 * time.Hour,
+			MaxSessions:           10,
+			LimitPolicy:           "evict-oldest",
+			Store:                 "postgres",
+			CacheTTL:              5 * time.Second,
+			CacheSize:             10000,
+			LastSeenInterval:      time.Minute,
+			ReapInterval:          15 * time.Minute,
+			ReapBatchSize:         1000,
+		},
+		Passwords: PasswordConfig{
+			MinEntropyBits:  64,
+			ResetExpiration: time.Hour,
+		},
+		Lockout: LockoutConfig{
+			MaxAttempts: 5,
+			Length:      15 * time.Minute,
+			MaxLength:   24 * time.Hour,
+		},
+		Mail: MailConfig{
+			Mailer: "log",
+		},
+		EmailVerification: EmailVerificationConfig{
+			Policy:         "off",
+			Expiration:     24 * time.Hour,
+			ResendInterval: time.Minute,
+		},
+		MFA: MFAConfig{
+			Issuer:               "Discussion App",
+			ChallengeExpiration:  5 * time.Minute,
+			MaxChallengeAttempts: 5,
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:               "localhost",
+			RPOrigins:          []string{"http://localhost:3000"},
+			CeremonyExpiration: 5 * time.Minute,
+		},
+	}
+}
+
+// setting binds a config value to its key in config files and its env variable
+type setting struct {
+	// key is the section and name of the value in config files, e.g. "sessions.idle_timeout"
+	key string
+	env string
+	// value points to a string, int, float64, time.Duration or []string field
+	value any
+	// secret values are redacted when the config is dumped
+	secret bool
+}
+
+// settings returns every setting of the config, in the order they are dumped
+func (c *Config) settings() []setting {
+	return []setting{
+		{key: "server.port", env: AuthServerPort, value: &c.Server.Port},
+		{key: "server.metrics_port", env: EnvMetricsPort, value: &c.Server.MetricsPort},
+		{key: "server.shutdown_timeout", env: EnvShutdownTimeout, value: &c.Server.ShutdownTimeout},
+		{key: "server.read_header_timeout", env: EnvReadHeaderTimeout, value: &c.Server.ReadHeaderTimeout},
+		{key: "server.read_timeout", env: EnvReadTimeout, value: &c.Server.ReadTimeout},
+		{key: "server.write_timeout", env: EnvWriteTimeout, value: &c.Server.WriteTimeout},
+		{key: "server.idle_timeout", env: EnvIdleTimeout, value: &c.Server.IdleTimeout},
+		{key: "server.tls_cert_file", env: EnvTLSCertFile, value: &c.Server.TLSCertFile},
+		{key: "server.tls_key_file", env: EnvTLSKeyFile, value: &c.Server.TLSKeyFile},
+		{key: "server.tls_reload_interval", env: EnvTLSReloadInterval, value: &c.Server.TLSReloadInterval},
+		{key: "server.readiness_timeout", env: EnvReadinessTimeout, value: &c.Server.ReadinessTimeout},
+
+		{key: "database.url", env: DatabaseURL, value: &c.Database.URL, secret: true},
+
+		{key: "sessions.key", env: SessionKey, value: &c.Sessions.Key, secret: true},
+		{key: "sessions.keys", env: EnvSessionKeys, value: &c.Sessions.Keys, secret: true},
+		{key: "sessions.keys_dir", env: EnvSessionKeysDir, value: &c.Sessions.KeysDir},
+		{key: "sessions.primary_key_id", env: EnvSessionPrimaryKeyID, value: &c.Sessions.PrimaryKeyID},
+		{key: "sessions.idle_timeout", env: EnvSessionIdleTimeout, value: &c.Sessions.IdleTimeout},
+		{key: "sessions.max_lifetime", env: EnvSessionMaxLifetime, value: &c.Sessions.MaxLifetime},
+		{key: "sessions.remember_me_idle_timeout", env: EnvRememberMeIdleTimeout, value: &c.Sessions.RememberMeIdleTimeout},
+		{key: "sessions.remember_me_max_lifetime", env: EnvRememberMeMaxLifetime, value: &c.Sessions.RememberMeMaxLifetime},
+		{key: "sessions.max_sessions", env: EnvMaxSessions, value: &c.Sessions.MaxSessions},
+		{key: "sessions.limit_policy", env: EnvSessionLimitPolicy, value: &c.Sessions.LimitPolicy},
+		{key: "sessions.store", env: EnvSessionStore, value: &c.Sessions.Store},
+		{key: "sessions.redis_url", env: EnvRedisURL, value: &c.Sessions.RedisURL, secret: true},
+		{key: "sessions.cache_ttl", env: EnvSessionCacheTTL, value: &c.Sessions.CacheTTL},
+		{key: "sessions.cache_size", env: EnvSessionCacheSize, value: &c.Sessions.CacheSize},
+		{key: "sessions.last_seen_interval", env: EnvSessionLastSeenInterval, value: &c.Sessions.LastSeenInterval},
+		{key: "sessions.reap_interval", env: EnvSessionReapInterval, value: &c.Sessions.ReapInterval},
+		{key: "sessions.reap_batch_size", env: EnvSessionReapBatchSize, value: &c.Sessions.ReapBatchSize},
+
+		{key: "passwords.min_entropy_bits", env: EnvMinEntropyBits, value: &c.Passwords.MinEntropyBits},
+		{key: "passwords.reset_url", env: EnvPasswordResetURL, value: &c.Passwords.ResetURL},
+		{key: "passwords.reset_expiration", env: EnvPasswordResetExpiration, value: &c.Passwords.ResetExpiration},
+
+		{key: "lockout.max_attempts", env: EnvMaxLoginAttempts, value: &c.Lockout.MaxAttempts},
+		{key: "lockout.length", env: EnvAccountLockoutLength, value: &c.Lockout.Length},
+		{key: "lockout.max_length", env: EnvMaxAccountLockoutLength, value: &c.Lockout.MaxLength},
+
+		{key: "mail.mailer", env: EnvMailer, value: &c.Mail.Mailer},
+		{key: "mail.from", env: EnvMailFrom, value: &c.Mail.From},
+		{key: "mail.dir", env: EnvMailDir, value: &c.Mail.Dir},
+		{key: "mail.smtp_host", env: EnvSMTPHost, value: &c.Mail.SMTPHost},
+		{key: "mail.smtp_port", env: EnvSMTPPort, value: &c.Mail.SMTPPort},
+		{key: "mail.smtp_username", env: EnvSMTPUsername, value: &c.Mail.SMTPUsername},
+		{key: "mail.smtp_password", env: EnvSMTPPassword, value: &c.Mail.SMTPPassword, secret: true},
+
+		{key: "email_verification.policy", env: EnvEmailVerification, value: &c.EmailVerification.Policy},
+		{key: "email_verification.url", env: EnvEmailVerificationURL, value: &c.EmailVerification.URL},
+		{key: "email_verification.expiration", env: EnvEmailVerificationExpiration, value: &c.EmailVerification.Expiration},
+		{key: "email_verification.resend_interval", env: EnvEmailVerificationResendInterval, value: &c.EmailVerification.ResendInterval},
+
+		{key: "mfa.key", env: EnvMFAKey, value: &c.MFA.Key, secret: true},
+		{key: "mfa.issuer", env: EnvMFAIssuer, value: &c.MFA.Issuer},
+		{key: "mfa.challenge_expiration", env: EnvMFAChallengeExpiration, value: &c.MFA.ChallengeExpiration},
+		{key: "mfa.max_challenge_attempts", env: EnvMaxMFAChallengeAttempts, value: &c.MFA.MaxChallengeAttempts},
+
+		{key: "webauthn.rp_id", env: EnvWebAuthnRPID, value: &c.WebAuthn.RPID},
+		{key: "webauthn.rp_origins", env: EnvWebAuthnRPOrigins, value: &c.WebAuthn.RPOrigins},
+		{key: "webauthn.ceremony_expiration", env: EnvWebAuthnCeremonyExpiration, value: &c.WebAuthn.CeremonyExpiration},
+
+		{key: "services.credentials", env: EnvServiceCredentials, value: &c.Services.Credentials, secret: true},
+	}
+}
+
+// Load returns the default config, overridden by the config file at path if it isn't empty and then
+// by the env variables that are set, after validating it. The file is YAML or TOML, by extension,
+// with a table per section, e.g. `sessions: {idle_timeout: 2h}`. Durations are written like "90s"
+// or "2h30m" and lists as comma separated strings in env variables.
+func Load(path string) (*Config, error) {
+	c := Default()
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadFile sets the values in a YAML or TOML file. Unknown keys are rejected, so typos don't go
+// unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	tree := make(map[string]any)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return fmt.Errorf("%w: %q", apperrors.ErrUnknownConfigFormat, path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]any)
+	flatten("", tree, values)
+	settings := c.settings()
+	for key, value := range values {
+		i := slices.IndexFunc(settings, func(s setting) bool { return s.key == key })
+		if i < 0 {
+			return fmt.Errorf("%w: %s in %s", apperrors.ErrUnknownConfigKey, key, path)
+		}
+		if err := settings[i].set(fileValue(value)); err != nil {
+			return fmt.Errorf("%s in %s: %w", key, path, err)
+		}
+	}
+	return nil
+}
+
+// loadEnv sets the values of the env variables that are set, even if empty
+func (c *Config) loadEnv() error {
+	for _, s := range c.settings() {
+		value, ok := os.LookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(value); err != nil {
+			return fmt.Errorf("%s: %w", s.env, err)
+		}
+	}
+	return nil
+}
+
+// flatten adds the leaves of a decoded config file to values, keyed by their dotted path
+func flatten(prefix string, tree map[string]any, values map[string]any) {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if table, ok := value.(map[string]any); ok {
+			flatten(key, table, values)
+			continue
+		}
+		values[key] = value
+	}
+}
+
+// fileValue returns a value decoded from a config file as it would be written in an env variable
+func fileValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// set parses a value into the setting's field
+func (s setting) set(value string) error {
+	var err error
+	switch field := s.value.(type) {
+	case *string:
+		*field = value
+	case *int:
+		*field, err = strconv.Atoi(value)
+	case *float64:
+		*field, err = strconv.ParseFloat(value, 64)
+	case *time.Duration:
+		*field, err = time.ParseDuration(value)
+	case *[]string:
+		*field = nil
+		for item := range strings.SplitSeq(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*field = append(*field, item)
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %q", apperrors.ErrInvalidConfigValue, value)
+	}
+	return nil
+}
+
+// Validate checks that the config makes sense, reporting every problem at once
+func (c *Config) Validate() error {
+	var errs []error
+	settings := c.settings()
+	invalid := func(key, problem string) {
+		i := slices.IndexFunc(settings, func(s setting) bool { return s.key == key })
+		errs = append(errs, fmt.Errorf("%w: %s (%s) %s", apperrors.ErrInvalidConfigValue, key, settings[i].env, problem))
+	}
+	positive := func(key string, d time.Duration) {
+		if d <= 0 {
+			invalid(key, "must be positive")
+		}
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		if !slices.Contains(allowed, value) {
+			invalid(key, fmt.Sprintf("must be one of %s, not %q", strings.Join(allowed, ", "), value))
+		}
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 0 || port > 65535 {
+		invalid("server.port", fmt.Sprintf("must be a port number, not %q", c.Server.Port))
+	}
+	if c.Server.MetricsPort != "" {
+		if port, err := strconv.Atoi(c.Server.MetricsPort); err != nil || port < 0 || port > 65535 {
+			invalid("server.metrics_port", fmt.Sprintf("must be a port number, not %q", c.Server.MetricsPort))
+		} else if c.Server.MetricsPort == c.Server.Port {
+			invalid("server.metrics_port", "must differ from server.port")
+		}
+	}
+	positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	positive("server.read_header_timeout", c.Server.ReadHeaderTimeout)
+	positive("server.read_timeout", c.Server.ReadTimeout)
+	positive("server.write_timeout", c.Server.WriteTimeout)
+	positive("server.idle_timeout", c.Server.IdleTimeout)
+	if c.Server.TLSCertFile != "" && c.Server.TLSKeyFile == "" {
+		invalid("server.tls_key_file", "must be set with server.tls_cert_file")
+	}
+	if c.Server.TLSKeyFile != "" && c.Server.TLSCertFile == "" {
+		invalid("server.tls_cert_file", "must be set with server.tls_key_file")
+	}
+	positive("server.tls_reload_interval", c.Server.TLSReloadInterval)
+	positive("server.readiness_timeout", c.Server.ReadinessTimeout)
+
+	// The legacy key is optional once the key ring has other keys, but when set it signs sessions
+	// like them, so it needs their length and the strength of a password
+	if c.Sessions.Key == "" && c.Sessions.Keys == "" && c.Sessions.KeysDir == "" {
+		invalid("sessions.key", "must be set unless sessions.keys or sessions.keys_dir is")
+	} else if c.Sessions.Key != "" {
+		if len(c.Sessions.Key) < keyring.MinKeyLength {
+			invalid("sessions.key", fmt.Sprintf("must be at least %d bytes", keyring.MinKeyLength))
+		} else if bits := passwordvalidator.GetEntropy(c.Sessions.Key); bits < c.Passwords.MinEntropyBits {
+			invalid("sessions.key", fmt.Sprintf("must have at least %g bits of entropy, not %.0f", c.Passwords.MinEntropyBits, bits))
+		}
+	}
+	if _, _, err := keyring.ParseKeys(c.Sessions.Keys); err != nil {
+		invalid("sessions.keys", err.Error())
+	}
+	positive("sessions.idle_timeout", c.Sessions.IdleTimeout)
+	positive("sessions.max_lifetime", c.Sessions.MaxLifetime)
+	positive("sessions.remember_me_idle_timeout", c.Sessions.RememberMeIdleTimeout)
+	positive("sessions.remember_me_max_lifetime", c.Sessions.RememberMeMaxLifetime)
+	if c.Sessions.MaxLifetime < c.Sessions.IdleTimeout {
+		invalid("sessions.max_lifetime", "must not be shorter than sessions.idle_timeout")
+	}
+	if c.Sessions.RememberMeMaxLifetime < c.Sessions.RememberMeIdleTimeout {
+		invalid("sessions.remember_me_max_lifetime", "must not be shorter than sessions.remember_me_idle_timeout")
+	}
+	if c.Sessions.MaxSessions < 0 {
+		invalid("sessions.max_sessions", "must not be negative")
+	}
+	oneOf("sessions.limit_policy", c.Sessions.LimitPolicy, "evict-oldest", "reject")
+	oneOf("sessions.store", c.Sessions.Store, "postgres", "redis", "memory")
+	if c.Sessions.Store == "redis" && c.Sessions.RedisURL == "" {
+		invalid("sessions.redis_url", "must be set for the redis session store")
+	}
+	positive("sessions.cache_ttl", c.Sessions.CacheTTL)
+	if c.Sessions.CacheSize <= 0 {
+		invalid("sessions.cache_size", "must be positive")
+	}
+	positive("sessions.last_seen_interval", c.Sessions.LastSeenInterval)
+	positive("sessions.reap_interval", c.Sessions.ReapInterval)
+	if c.Sessions.ReapBatchSize <= 0 {
+		invalid("sessions.reap_batch_size", "must be positive")
+	}
+
+	if c.Passwords.MinEntropyBits <= 0 {
+		invalid("passwords.min_entropy_bits", "must be positive")
+	}
+	positive("passwords.reset_expiration", c.Passwords.ResetExpiration)
+
+	if c.Lockout.MaxAttempts <= 0 {
+		invalid("lockout.max_attempts", "must be positive")
+	}
+	positive("lockout.length", c.Lockout.Length)
+	if c.Lockout.MaxLength < c.Lockout.Length {
+		invalid("lockout.max_length", "must not be shorter than lockout.length")
+	}
+
+	oneOf("mail.mailer", c.Mail.Mailer, "log", "file", "smtp")
+
+	oneOf("email_verification.policy", c.EmailVerification.Policy, "off", "login", "protected")
+	positive("email_verification.expiration", c.EmailVerification.Expiration)
+	if c.EmailVerification.ResendInterval < 0 {
+		invalid("email_verification.resend_interval", "must not be negative")
+	}
+
+	// Two-factor secrets are encrypted with the MFA key, so it has to be as strong as a password
+	if c.MFA.Key == "" {
+		invalid("mfa.key", "must be set")
+	} else if bits := passwordvalidator.GetEntropy(c.MFA.Key); bits < c.Passwords.MinEntropyBits {
+		invalid("mfa.key", fmt.Sprintf("must have at least %g bits of entropy, not %.0f", c.Passwords.MinEntropyBits, bits))
+	}
+	positive("mfa.challenge_expiration", c.MFA.ChallengeExpiration)
+	if c.MFA.MaxChallengeAttempts <= 0 {
+		invalid("mfa.max_challenge_attempts", "must be positive")
+	}
+
+	if c.WebAuthn.RPID == "" {
+		invalid("webauthn.rp_id", "must be set")
+	}
+	if len(c.WebAuthn.RPOrigins) == 0 {
+		invalid("webauthn.rp_origins", "must list at least one origin")
+	}
+	positive("webauthn.ceremony_expiration", c.WebAuthn.CeremonyExpiration)
+
+	return errors.Join(errs...)
+}
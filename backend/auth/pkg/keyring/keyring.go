@@ -0,0 +1,142 @@
+// Package keyring holds a set of named HMAC keys: one primary key that signs new values and any
+// number of older keys that are still accepted when verifying, so keys can be rotated without
+// invalidating everything signed with the previous one.
+package keyring
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"godiscauth/pkg/apperrors"
+)
+
+// MinKeyLength is the minimum number of bytes of a key loaded with `ParseKeys` or `LoadDir`
+const MinKeyLength = 32
+
+// validKeyID matches key IDs, which end up in signed values and must not contain separators
+var validKeyID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// KeyRing is an immutable set of named HMAC-SHA256 keys
+type KeyRing struct {
+	primaryID string
+	keys      map[string][]byte
+}
+
+// New returns a KeyRing that signs with the key named primaryID and verifies with any of keys
+func New(primaryID string, keys map[string][]byte) (*KeyRing, error) {
+	ring := &KeyRing{primaryID: primaryID, keys: make(map[string][]byte, len(keys))}
+	for id, key := range keys {
+		if !validKeyID.MatchString(id) {
+			return nil, fmt.Errorf("%w: %q", apperrors.ErrInvalidKeyID, id)
+		}
+		if len(key) == 0 {
+			return nil, fmt.Errorf("%w: %q", apperrors.ErrEncryptionKeyIsEmpty, id)
+		}
+		ring.keys[id] = slices.Clone(key)
+	}
+	if _, ok := ring.keys[primaryID]; !ok {
+		return nil, fmt.Errorf("%w: %q", apperrors.ErrPrimaryKeyNotFound, primaryID)
+	}
+	return ring, nil
+}
+
+// PrimaryID returns the ID of the key new values are signed with
+func (kr *KeyRing) PrimaryID() string {
+	return kr.primaryID
+}
+
+// IDs returns the IDs of all keys, sorted
+func (kr *KeyRing) IDs() []string {
+	ids := make([]string, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Sign returns the ID of the primary key and the MAC of message under it
+func (kr *KeyRing) Sign(message []byte) (string, []byte) {
+	return kr.primaryID, mac(kr.keys[kr.primaryID], message)
+}
+
+// Verify reports whether sum is the MAC of message under the key named keyID. Unknown keys never
+// verify.
+func (kr *KeyRing) Verify(keyID string, message, sum []byte) bool {
+	key, ok := kr.keys[keyID]
+	if !ok {
+		return false
+	}
+	return hmac.Equal(sum, mac(key, message))
+}
+
+func mac(key, message []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(message)
+	return h.Sum(nil)
+}
+
+// ParseKeys parses a comma separated list of `id:key` pairs, keeping their order
+func ParseKeys(s string) ([]string, map[string][]byte, error) {
+	var ids []string
+	keys := make(map[string][]byte)
+	for pair := range strings.SplitSeq(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, key, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, nil, apperrors.ErrInvalidKeyID
+		}
+		if err := addKey(keys, id, []byte(key)); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, keys, nil
+}
+
+// LoadDir loads one key per file from dir, named by the file name, as mounted by Docker and
+// Kubernetes secrets. Hidden files are skipped and surrounding whitespace is trimmed.
+func LoadDir(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string][]byte)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if err := addKey(keys, entry.Name(), []byte(strings.TrimSpace(string(data)))); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// addKey validates a loaded key and adds it to keys
+func addKey(keys map[string][]byte, id string, key []byte) error {
+	if !validKeyID.MatchString(id) {
+		return fmt.Errorf("%w: %q", apperrors.ErrInvalidKeyID, id)
+	}
+	if _, exists := keys[id]; exists {
+		return fmt.Errorf("%w: %q", apperrors.ErrDuplicateKeyID, id)
+	}
+	if len(key) < MinKeyLength {
+		return fmt.Errorf("%w: %q needs at least %d bytes", apperrors.ErrKeyTooShort, id, MinKeyLength)
+	}
+	keys[id] = key
+	return nil
+}
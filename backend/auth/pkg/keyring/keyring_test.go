@@ -0,0 +1,102 @@
+package keyring_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/keyring"
+)
+
+const (
+	keyA = "afirstkeythatislongenoughtobeaccepted"
+	keyB = "asecondkeythatislongenoughtobeaccepted"
+)
+
+// TestKeyRing_SignVerify tests signing with the primary key and verifying with any key
+func TestKeyRing_SignVerify(t *testing.T) {
+	is := is.New(t)
+	message := []byte("message")
+
+	ring, err := keyring.New("b", map[string][]byte{"a": []byte(keyA), "b": []byte(keyB)})
+	is.NoErr(err)
+	is.Equal(ring.PrimaryID(), "b")
+	is.Equal(ring.IDs(), []string{"a", "b"})
+
+	id, sum := ring.Sign(message)
+	is.Equal(id, "b")
+	is.True(ring.Verify("b", message, sum))
+	is.True(!ring.Verify("a", message, sum))
+	is.True(!ring.Verify("c", message, sum))
+	is.True(!ring.Verify("b", []byte("other message"), sum))
+
+	// A ring with only the old key still verifies what it signed
+	old, err := keyring.New("a", map[string][]byte{"a": []byte(keyA)})
+	is.NoErr(err)
+	id, sum = old.Sign(message)
+	is.True(ring.Verify(id, message, sum))
+}
+
+// TestKeyRing_New tests key ring validation
+func TestKeyRing_New(t *testing.T) {
+	is := is.New(t)
+
+	_, err := keyring.New("a", map[string][]byte{"b": []byte(keyB)})
+	is.True(errors.Is(err, apperrors.ErrPrimaryKeyNotFound))
+
+	_, err = keyring.New("a.b", map[string][]byte{"a.b": []byte(keyA)})
+	is.True(errors.Is(err, apperrors.ErrInvalidKeyID))
+
+	_, err = keyring.New("a", map[string][]byte{"a": nil})
+	is.True(errors.Is(err, apperrors.ErrEncryptionKeyIsEmpty))
+}
+
+// TestKeyRing_ParseKeys tests parsing `id:key` lists
+func TestKeyRing_ParseKeys(t *testing.T) {
+	is := is.New(t)
+
+	ids, keys, err := keyring.ParseKeys(" b:" + keyB + ", a:" + keyA + ",")
+	is.NoErr(err)
+	is.Equal(ids, []string{"b", "a"})
+	is.Equal(string(keys["a"]), keyA)
+
+	ids, _, err = keyring.ParseKeys("")
+	is.NoErr(err)
+	is.Equal(len(ids), 0)
+
+	for input, want := range map[string]error{
+		keyA:                       apperrors.ErrInvalidKeyID,
+		"a b:" + keyA:              apperrors.ErrInvalidKeyID,
+		"a:short":                  apperrors.ErrKeyTooShort,
+		"a:" + keyA + ",a:" + keyB: apperrors.ErrDuplicateKeyID,
+	} {
+		_, _, err := keyring.ParseKeys(input)
+		is.True(errors.Is(err, want))
+	}
+}
+
+// TestKeyRing_LoadDir tests loading one key per file
+func TestKeyRing_LoadDir(t *testing.T) {
+	is := is.New(t)
+
+	dir := t.TempDir()
+	is.NoErr(os.WriteFile(filepath.Join(dir, "a"), []byte(keyA+"\n"), 0o600))
+	is.NoErr(os.WriteFile(filepath.Join(dir, ".hidden"), []byte("ignored"), 0o600))
+	is.NoErr(os.Mkdir(filepath.Join(dir, "..data"), 0o700))
+
+	keys, err := keyring.LoadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(keys), 1)
+	is.Equal(string(keys["a"]), keyA)
+
+	is.NoErr(os.WriteFile(filepath.Join(dir, "b"), []byte("short"), 0o600))
+	_, err = keyring.LoadDir(dir)
+	is.True(errors.Is(err, apperrors.ErrKeyTooShort))
+
+	_, err = keyring.LoadDir(filepath.Join(dir, "missing"))
+	is.True(err != nil)
+}
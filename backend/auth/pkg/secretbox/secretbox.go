@@ -0,0 +1,61 @@
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"godiscauth/pkg/apperrors"
+)
+
+// Seal encrypts and authenticates plaintext with AES-256-GCM. The key can be any non-empty
+// string; it is stretched to 32 bytes with SHA-256. The result is the base64 encoding of the
+// nonce followed by the ciphertext.
+func Seal(key string, plaintext []byte) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value produced by Seal with the same key. Returns
+// `apperrors.ErrDecryptionFailed` if the value is malformed, was tampered with or was sealed with
+// a different key.
+func Open(key string, sealed string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < aead.NonceSize() {
+		return nil, apperrors.ErrDecryptionFailed
+	}
+	nonce, ciphertext := raw[:aead.NonceSize()], raw[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, apperrors.ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key string) (cipher.AEAD, error) {
+	if key == "" {
+		return nil, apperrors.ErrEncryptionKeyIsEmpty
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
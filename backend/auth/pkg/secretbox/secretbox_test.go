@@ -0,0 +1,64 @@
+package secretbox_test
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+
+	"godiscauth/pkg/apperrors"
+	"godiscauth/pkg/secretbox"
+)
+
+// TestSecretbox_SealOpen tests that sealed values round trip and are tamper evident
+func TestSecretbox_SealOpen(t *testing.T) {
+	is := is.New(t)
+
+	key := "asufficientlylongtestkey"
+	plaintext := []byte("JBSWY3DPEHPK3PXP")
+
+	t.Run("round trips", func(t *testing.T) {
+		sealed, err := secretbox.Seal(key, plaintext)
+		is.NoErr(err)
+		is.True(sealed != string(plaintext))
+
+		opened, err := secretbox.Open(key, sealed)
+		is.NoErr(err)
+		is.Equal(opened, plaintext)
+	})
+
+	t.Run("uses a fresh nonce each time", func(t *testing.T) {
+		first, err := secretbox.Seal(key, plaintext)
+		is.NoErr(err)
+		second, err := secretbox.Seal(key, plaintext)
+		is.NoErr(err)
+		is.True(first != second)
+	})
+
+	t.Run("rejects wrong key", func(t *testing.T) {
+		sealed, err := secretbox.Seal(key, plaintext)
+		is.NoErr(err)
+		_, err = secretbox.Open("adifferentkey", sealed)
+		is.Equal(err, apperrors.ErrDecryptionFailed)
+	})
+
+	t.Run("rejects tampered value", func(t *testing.T) {
+		sealed, err := secretbox.Seal(key, plaintext)
+		is.NoErr(err)
+		tampered := []byte(sealed)
+		tampered[len(tampered)/2] ^= 'A' ^ 'B'
+		_, err = secretbox.Open(key, string(tampered))
+		is.Equal(err, apperrors.ErrDecryptionFailed)
+	})
+
+	t.Run("rejects malformed value", func(t *testing.T) {
+		_, err := secretbox.Open(key, "not base64!")
+		is.Equal(err, apperrors.ErrDecryptionFailed)
+	})
+
+	t.Run("rejects empty key", func(t *testing.T) {
+		_, err := secretbox.Seal("", plaintext)
+		is.Equal(err, apperrors.ErrEncryptionKeyIsEmpty)
+		_, err = secretbox.Open("", "c2VhbGVk")
+		is.Equal(err, apperrors.ErrEncryptionKeyIsEmpty)
+	})
+}
@@ -0,0 +1,100 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parameters shared with authenticator apps. These are the defaults every app supports, so they
+// are not configurable.
+const (
+	// Digits is the number of digits in a code
+	Digits = 6
+	// Period is the number of seconds each code is valid for
+	Period = 30
+	// SecretSize is the number of random bytes in a secret, as recommended by RFC 4226
+	SecretSize = 20
+)
+
+// encoding is the base32 encoding authenticator apps expect secrets in
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret creates a new random base32-encoded secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, SecretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// Step returns the time step a code generated at time t belongs to
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// CodeAt returns the code for a secret at a time step, per RFC 4226 section 5.3
+func CodeAt(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range Digits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%mod), nil
+}
+
+// Validate checks a code against a secret at time t, accepting codes up to `skew` steps early or
+// late to allow for clock drift. Returns the matched time step so callers can reject replays.
+func Validate(secret string, code string, t time.Time, skew int) (int64, bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false, nil
+	}
+
+	current := Step(t)
+	for offset := -int64(skew); offset <= int64(skew); offset++ {
+		expected, err := CodeAt(secret, current+offset)
+		if err != nil {
+			return 0, false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return current + offset, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// URI returns the otpauth:// URI authenticator apps use to enroll a secret, usually shown as a
+// QR code. See https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func URI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(Period))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
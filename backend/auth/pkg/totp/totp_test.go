@@ -0,0 +1,109 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"godiscauth/pkg/totp"
+)
+
+// rfcSecret is the SHA1 test secret "12345678901234567890" from RFC 6238 appendix B
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// TestTOTP_CodeAt checks codes against the RFC 6238 test vectors, truncated to 6 digits
+func TestTOTP_CodeAt(t *testing.T) {
+	is := is.New(t)
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range vectors {
+		code, err := totp.CodeAt(rfcSecret, totp.Step(time.Unix(unix, 0)))
+		is.NoErr(err)
+		is.Equal(code, expected)
+	}
+}
+
+// TestTOTP_Validate tests code validation with clock skew
+func TestTOTP_Validate(t *testing.T) {
+	is := is.New(t)
+
+	secret, err := totp.GenerateSecret()
+	is.NoErr(err)
+	now := time.Now()
+
+	t.Run("accepts current code", func(t *testing.T) {
+		code, err := totp.CodeAt(secret, totp.Step(now))
+		is.NoErr(err)
+		step, ok, err := totp.Validate(secret, code, now, 1)
+		is.NoErr(err)
+		is.True(ok)
+		is.Equal(step, totp.Step(now))
+	})
+
+	t.Run("accepts code within skew", func(t *testing.T) {
+		code, err := totp.CodeAt(secret, totp.Step(now)-1)
+		is.NoErr(err)
+		step, ok, err := totp.Validate(secret, code, now, 1)
+		is.NoErr(err)
+		is.True(ok)
+		is.Equal(step, totp.Step(now)-1)
+	})
+
+	t.Run("rejects code outside skew", func(t *testing.T) {
+		code, err := totp.CodeAt(secret, totp.Step(now)-3)
+		is.NoErr(err)
+		_, ok, err := totp.Validate(secret, code, now, 1)
+		is.NoErr(err)
+		is.True(!ok)
+	})
+
+	t.Run("rejects malformed code", func(t *testing.T) {
+		_, ok, err := totp.Validate(secret, "12345", now, 1)
+		is.NoErr(err)
+		is.True(!ok)
+	})
+
+	t.Run("errors on malformed secret", func(t *testing.T) {
+		_, _, err := totp.Validate("not base32!", "123456", now, 1)
+		is.True(err != nil)
+	})
+}
+
+// TestTOTP_GenerateSecret tests secret generation
+func TestTOTP_GenerateSecret(t *testing.T) {
+	is := is.New(t)
+
+	secret, err := totp.GenerateSecret()
+	is.NoErr(err)
+	is.Equal(len(secret), 32) // 20 bytes in unpadded base32
+
+	other, err := totp.GenerateSecret()
+	is.NoErr(err)
+	is.True(secret != other)
+}
+
+// TestTOTP_URI tests otpauth URI generation
+func TestTOTP_URI(t *testing.T) {
+	is := is.New(t)
+
+	uri := totp.URI("Discussion App", "user@test.com", "SECRET")
+	is.True(strings.HasPrefix(uri, "otpauth://totp/Discussion%20App:user@test.com?"))
+
+	parsed, err := url.Parse(uri)
+	is.NoErr(err)
+	is.Equal(parsed.Query().Get("secret"), "SECRET")
+	is.Equal(parsed.Query().Get("issuer"), "Discussion App")
+	is.Equal(parsed.Query().Get("digits"), "6")
+	is.Equal(parsed.Query().Get("period"), "30")
+}
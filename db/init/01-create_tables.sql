@@ -1,27 +1,8 @@
 -- Generated from schema.dbml with dbml2sql tool, then manually altered
 
-create extension if not exists "uuid-ossp";
-
-create table if not exists users (
-    id uuid primary key default (uuid_generate_v4()),
-    email varchar(255) unique not null,
-    password text not null,
-    last_login timestamp,
-    failed_login_attempts integer default 0,
-    account_locked bool default false,
-    account_locked_until timestamp
-);
--- improve GetUserByEmail funcs
-create index idx_users_email on users (email);
-
-create table if not exists sessions (
-    id uuid primary key default (uuid_generate_v4()),
-    user_id uuid not null references users (id) on delete cascade,
-    expires_at timestamp not null,
-    created_at timestamp not null default (now())
-);
--- improve GetSessionByUserID funcs
-create index idx_sessions_user_id on sessions (user_id);
+-- users, sessions and the other tables of the auth service are created by its migrations in
+-- backend/auth/internal/database/migrations, which have to run first, e.g. with
+-- `./godiscauth migrate up`
 
 create table if not exists tags (
     id smallint generated by default as identity primary key, -- autoincrement